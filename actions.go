@@ -3,6 +3,7 @@ package storage_lock
 // 通用的事件
 const (
 	ActionLockNotFoundError       = "lock-not-found-error"
+	ActionLockRecordTampered      = "lock-record-tampered"
 	ActionNotLockOwner            = "not-lock-owner"
 	ActionGetLockInformationError = "get-lock-information-error"
 	ActionTimeout                 = "timeout"
@@ -11,6 +12,15 @@ const (
 	ActionGetLeaseExpireTimeError = "getLeaseExpireTime-error"
 )
 
+// 存储操作超时的事件
+const (
+	ActionStorageGetTimeout               = "StorageLock.Storage.Get.Timeout"
+	ActionStorageGetTimeTimeout           = "StorageLock.Storage.GetTime.Timeout"
+	ActionStorageCreateWithVersionTimeout = "StorageLock.Storage.CreateWithVersion.Timeout"
+	ActionStorageUpdateWithVersionTimeout = "StorageLock.Storage.UpdateWithVersion.Timeout"
+	ActionStorageDeleteWithVersionTimeout = "StorageLock.Storage.DeleteWithVersion.Timeout"
+)
+
 // 获取锁相关的事件
 const (
 	ActionLockBegin   = "StorageLock.Lock.Begin"
@@ -28,6 +38,13 @@ const (
 	ActionLockBusy        = "StorageLock.Lock.Begin.Busy"
 	ActionLockVersionMiss = "StorageLock.Lock.VersionMiss"
 
+	ActionLockSessionExpired = "StorageLock.Lock.SessionExpired"
+
+	ActionLockWatch       = "StorageLock.Lock.Watch"
+	ActionLockWatchError  = "StorageLock.Lock.Watch.Error"
+	ActionLockWatchNotify = "StorageLock.Lock.Watch.Notify"
+	ActionLockWatchClosed = "StorageLock.Lock.Watch.Closed"
+
 	ActionLockRollback        = "StorageLock.Lock.Rollback"
 	ActionLockRollbackSuccess = "StorageLock.Lock.Rollback.Success"
 	ActionLockRollbackError   = "StorageLock.Lock.Rollback.Error"
@@ -46,6 +63,20 @@ const (
 	ActionUnlockVersionMiss = "StorageLock.Unlock.VersionMiss"
 )
 
+// 转移锁的所有权相关的事件
+const (
+	ActionTransferBegin       = "StorageLock.Transfer.Begin"
+	ActionTransferFinish      = "StorageLock.Transfer.Finish"
+	ActionTransferSuccess     = "StorageLock.Transfer.Success"
+	ActionTransferError       = "StorageLock.Transfer.Error"
+	ActionTransfer            = "StorageLock.Transfer"
+	ActionTransferVersionMiss = "StorageLock.Transfer.VersionMiss"
+
+	ActionTransferAccept        = "StorageLock.Transfer.Accept"
+	ActionTransferAcceptSuccess = "StorageLock.Transfer.Accept.Success"
+	ActionTransferAcceptError   = "StorageLock.Transfer.Accept.Error"
+)
+
 // 看门狗相关的事件
 const (
 	ActionWatchDogRefresh        = "WatchDog.Refresh"
@@ -71,6 +102,70 @@ const (
 	ActionWatchDogSetEvent = "WatchDog.SetEvent"
 
 	ActionWatchDogOwnerIdMismatch = "WatchDog.OwnerIdMismatch"
+
+	ActionWatchDogLeaseContinuityViolation = "WatchDog.LeaseContinuityViolation"
+
+	ActionWatchDogSkipBySession = "WatchDog.SkipBySession"
+)
+
+// 会话相关的事件
+const (
+	ActionSessionCreate        = "Session.Create"
+	ActionSessionCreateSuccess = "Session.Create.Success"
+	ActionSessionCreateError   = "Session.Create.Error"
+
+	ActionSessionHeartbeat        = "Session.Heartbeat"
+	ActionSessionHeartbeatSuccess = "Session.Heartbeat.Success"
+	ActionSessionHeartbeatError   = "Session.Heartbeat.Error"
+	ActionSessionHeartbeatExit    = "Session.Heartbeat.Exit"
+
+	ActionSessionLost = "Session.Lost"
+
+	ActionSessionClose        = "Session.Close"
+	ActionSessionCloseSuccess = "Session.Close.Success"
+	ActionSessionCloseError   = "Session.Close.Error"
+)
+
+// 清理器相关的事件
+const (
+	ActionSweep        = "Sweeper.Sweep"
+	ActionSweepSuccess = "Sweeper.Sweep.Success"
+	ActionSweepError   = "Sweeper.Sweep.Error"
+
+	ActionSweepDelete         = "Sweeper.Delete"
+	ActionSweepDeleteSuccess  = "Sweeper.Delete.Success"
+	ActionSweepDeleteError    = "Sweeper.Delete.Error"
+	ActionSweepDeleteConflict = "Sweeper.Delete.Conflict"
+
+	ActionSweeperExit = "Sweeper.Exit"
+)
+
+// 时间源与本地时钟漂移相关的事件
+const (
+	ActionClockSkew          = "StorageLock.ClockSkew"
+	ActionClockSkewExceeded  = "StorageLock.ClockSkew.Exceeded"
+	ActionClockSkewRecovered = "StorageLock.ClockSkew.Recovered"
+)
+
+// 缓存的存储时间源相关的事件
+const (
+	ActionCachedTimeResync         = "CachedTime.Resync"
+	ActionCachedTimeResyncError    = "CachedTime.Resync.Error"
+	ActionCachedTimeDrift          = "CachedTime.Drift"
+	ActionCachedTimeLocalClockSkew = "CachedTime.LocalClockSkew"
+)
+
+// 单调时间源相关的事件
+const (
+	ActionTimeBackward = "MonotonicTime.Backward"
+)
+
+// 中位数时间源相关的事件
+const (
+	ActionMedianTimeSource           = "MedianTime.Source"
+	ActionMedianTimeSourceError      = "MedianTime.Source.Error"
+	ActionMedianTimeOutlier          = "MedianTime.Outlier"
+	ActionMedianTimeQuorumNotReached = "MedianTime.QuorumNotReached"
 )
 
 // Payload的名字
@@ -81,4 +176,18 @@ const (
 	PayloadSleep               = "sleep"
 	PayloadRefreshSuccessCount = "refreshSuccessCount"
 	PayloadContinueErrorCount  = "continueErrorCount"
+	PayloadFromOwnerId         = "fromOwnerId"
+	PayloadToOwnerId           = "toOwnerId"
+	PayloadLeaseDeadline       = "leaseDeadline"
+	PayloadOverdue             = "overdue"
+	PayloadSessionId           = "sessionId"
+	PayloadSweepReason         = "sweepReason"
+	PayloadSweepResult         = "sweepResult"
+	PayloadStorageTimeout      = "storageTimeout"
+	PayloadTimeUncertainty     = "timeUncertainty"
+	PayloadClockSkew           = "clockSkew"
+	PayloadTimeBackward        = "timeBackward"
+	PayloadTimeBackwardPolicy  = "timeBackwardPolicy"
+	PayloadTimeSource          = "timeSource"
+	PayloadTimeOffset          = "timeOffset"
 )
@@ -0,0 +1,208 @@
+package storage_lock
+
+import (
+	"context"
+	"fmt"
+	"github.com/storage-lock/go-events"
+	go_storage "github.com/storage-lock/go-storage"
+	"github.com/storage-lock/go-utils"
+	"sync"
+	"time"
+)
+
+// UncertainTimeProvider 返回的时间带有已知上限的误差的时间源，是 TimeProvider 的一个可选的能力，
+// 锁在检查续租的安全余量时会把误差计算在内
+type UncertainTimeProvider interface {
+	go_storage.TimeProvider
+
+	// MaxUncertainty 返回的时间与真实的存储时间之间最多相差多少
+	MaxUncertainty() time.Duration
+}
+
+// CachedTimeProvider 缓存的存储时间源，定期向存储采样一次时间，两次采样之间用本地的单调时钟外推
+//
+// 一次没有竞争的 Lock 在 lockNotExists 或者 lockExists 中要读一次存储的时间，重入、释放重入、写墓碑、续租也都各要读一次，
+// 每次都是一次存储的往返。多个锁共享同一个 CachedTimeProvider 的话，大部分的取时间都在本地完成，能明显减少对存储的调用：
+//
+//	timeProvider, _ := storage_lock.NewCachedTimeProvider(storage)
+//	options := storage_lock.NewStorageLockOptionsWithLockId(lockId).SetTimeProvider(timeProvider)
+//
+// 外推是有误差的：采样时不知道存储是在往返中的哪一刻读的时间，误差最多是往返耗时的一半，
+// 外推期间本地时钟相对于存储时钟的漂移也会让误差随时间增长。误差超过 MaxUncertainty 或者距离上次采样超过 ResyncInterval 时都会重新采样，
+// 本地的墙上时间与单调时钟走的不一致（比如虚拟机被挂起过、系统时间被调整过）的时候也会立刻重新采样。
+// 存储的往返太慢、单次采样的误差就超过了 MaxUncertainty 的时候不会缓存这次采样，直接返回存储的时间，退化为不使用缓存。
+// 重新采样之后新的外推结果可能比之前已经返回过的时间早（之前的外推偏快了），这时继续返回之前返回过的时间，
+// 保证同一个实例返回的时间不会倒退；两个时间都在真实时间的 MaxUncertainty 之内，所以这样做不会让误差超出范围。
+// 使用它的锁会把 MaxUncertainty 的两倍计入续租的安全余量。
+//
+// 注意它只是存储时间的缓存，自身并不是一个可靠的时间源，被缓存的时间源（通常就是存储本身）必须是可靠的。
+type CachedTimeProvider struct {
+	id      string
+	source  go_storage.TimeProvider
+	options *CachedTimeProviderOptions
+
+	e *events.Event
+
+	// 保护下面的采样状态，重新采样的时候其它的调用方会等待这次采样的结果，而不是各自去采样
+	mutex sync.Mutex
+
+	// 最近一次采样：采样时本地的时间（带单调时钟读数）、对应的存储时间、采样本身的误差
+	sampleLocalTime   time.Time
+	sampleStorageTime time.Time
+	sampleUncertainty time.Duration
+	sampled           bool
+
+	// 最近一次返回的时间，返回的时间不会比它早
+	lastReturned time.Time
+}
+
+var _ UncertainTimeProvider = &CachedTimeProvider{}
+
+// CachedTimeProviderIDPrefix 缓存的存储时间源的ID的前缀，用于在事件中区分不同的实例
+const CachedTimeProviderIDPrefix = "storage-lock-cached-time-"
+
+// NewCachedTimeProvider 使用默认选项缓存给定的时间源，Storage 本身就是一个 TimeProvider
+func NewCachedTimeProvider(source go_storage.TimeProvider) (*CachedTimeProvider, error) {
+	return NewCachedTimeProviderWithOptions(source, NewCachedTimeProviderOptions())
+}
+
+// NewCachedTimeProviderWithOptions 使用给定的选项缓存给定的时间源，第一次取时间的时候才会采样
+func NewCachedTimeProviderWithOptions(source go_storage.TimeProvider, options *CachedTimeProviderOptions) (*CachedTimeProvider, error) {
+	if err := checkCachedTimeProviderOptions(options); err != nil {
+		return nil, err
+	}
+	id := utils.RandomID(CachedTimeProviderIDPrefix)
+	e := events.NewEvent(id).SetListeners(options.EventListeners)
+	if storage, ok := source.(go_storage.Storage); ok {
+		e.SetStorageName(storage.GetName())
+	}
+	return &CachedTimeProvider{
+		id:      id,
+		source:  source,
+		options: options,
+		e:       e,
+	}, nil
+}
+
+// GetID 缓存的存储时间源的ID
+func (x *CachedTimeProvider) GetID() string {
+	return x.id
+}
+
+// MaxUncertainty 返回的时间最多与真实的存储时间相差多少
+func (x *CachedTimeProvider) MaxUncertainty() time.Duration {
+	return x.options.MaxUncertainty
+}
+
+// GetTime 返回外推出来的存储时间，需要的时候先重新采样，返回的时间不会倒退
+func (x *CachedTimeProvider) GetTime(ctx context.Context) (time.Time, error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	storageTime, err := x.getTime(ctx)
+	if err != nil {
+		return storageTime, err
+	}
+	if storageTime.Before(x.lastReturned) {
+		return x.lastReturned, nil
+	}
+	x.lastReturned = storageTime
+	return storageTime, nil
+}
+
+// 返回外推出来的存储时间，可能比之前返回过的早，调用前要持有 mutex
+func (x *CachedTimeProvider) getTime(ctx context.Context) (time.Time, error) {
+	now := time.Now()
+	if !x.sampled {
+		return x.resync(ctx)
+	}
+
+	elapsed := now.Sub(x.sampleLocalTime)
+	uncertainty := x.uncertainty(elapsed)
+	// 墙上时间与单调时钟走的不一样，说明本地时钟出了状况，外推不再可信
+	skew := now.Round(0).Sub(x.sampleLocalTime.Round(0)) - elapsed
+	if skew < 0 {
+		skew = -skew
+	}
+	switch {
+	case skew > x.options.MaxUncertainty:
+		x.e.Fork().AddAction(events.NewAction(ActionCachedTimeLocalClockSkew).AddPayload(PayloadClockSkew, skew)).Publish(ctx)
+	case elapsed < x.options.ResyncInterval && uncertainty <= x.options.MaxUncertainty:
+		return x.extrapolate(now), nil
+	}
+
+	storageTime, err := x.resync(ctx)
+	if err == nil {
+		return storageTime, nil
+	}
+	// 重新采样失败了，但是误差还在允许的范围内的话继续外推，只是到了该采样的时间
+	if skew <= x.options.MaxUncertainty && uncertainty <= x.options.MaxUncertainty {
+		return x.extrapolate(now), nil
+	}
+	return time.Time{}, err
+}
+
+// 向被缓存的时间源采样一次并返回 GetTime 应该返回的时间，调用前要持有 mutex
+// 采样的误差超过了 MaxUncertainty 的话这次采样不会被缓存，直接返回时间源读到的时间，
+// 与不使用缓存直接读取时间源一样，不会返回一个误差超出了 MaxUncertainty 的外推结果
+func (x *CachedTimeProvider) resync(ctx context.Context) (time.Time, error) {
+	e := x.e.Fork()
+	before := time.Now()
+	storageTime, err := x.source.GetTime(ctx)
+	after := time.Now()
+	if err != nil {
+		e.AddAction(events.NewAction(ActionCachedTimeResyncError).SetErr(err)).Publish(ctx)
+		return time.Time{}, err
+	}
+
+	// 认为存储是在往返的正中间读的时间，误差最多是往返耗时的一半
+	rtt := after.Sub(before)
+	localTime := before.Add(rtt / 2)
+	sampleUncertainty := rtt / 2
+
+	if x.sampled {
+		// 外推的结果与实际采样的结果之间的差距超出了误差的范围，说明漂移比预期的大
+		expected := x.extrapolate(localTime)
+		drift := storageTime.Sub(expected)
+		if drift < 0 {
+			drift = -drift
+		}
+		if bound := x.uncertainty(localTime.Sub(x.sampleLocalTime)) + sampleUncertainty; drift > bound {
+			e.Fork().AddAction(events.NewAction(ActionCachedTimeDrift).AddPayload(PayloadClockSkew, drift)).Publish(ctx)
+		}
+	}
+
+	action := events.NewAction(ActionCachedTimeResync).AddPayload(PayloadTimeUncertainty, sampleUncertainty)
+	if sampleUncertainty > x.options.MaxUncertainty {
+		// 单次采样的误差就已经超过了允许的范围，丢弃之前的采样，之后的每次取时间都会重新采样，退化为直接读取存储的时间
+		action.SetErr(fmt.Errorf("%w: sample uncertainty %s exceeds %s", ErrCachedTimeUncertaintyExceeded, sampleUncertainty, x.options.MaxUncertainty))
+		e.AddAction(action).Publish(ctx)
+		x.sampled = false
+		return storageTime, nil
+	}
+
+	x.sampleLocalTime = localTime
+	x.sampleStorageTime = storageTime
+	x.sampleUncertainty = sampleUncertainty
+	x.sampled = true
+	e.AddAction(action).Publish(ctx)
+	return x.extrapolate(time.Now()), nil
+}
+
+// 从最近一次采样外推到给定的本地时刻，调用前要持有 mutex
+func (x *CachedTimeProvider) extrapolate(localTime time.Time) time.Time {
+	return x.sampleStorageTime.Add(localTime.Sub(x.sampleLocalTime))
+}
+
+// 距离采样过去了 elapsed 之后外推结果的误差
+func (x *CachedTimeProvider) uncertainty(elapsed time.Duration) time.Duration {
+	return x.sampleUncertainty + time.Duration(float64(elapsed)*x.options.MaxDriftRate)
+}
+
+// 时间源已知的最大误差，不是 UncertainTimeProvider 的话认为没有误差
+func timeProviderUncertainty(timeProvider go_storage.TimeProvider) time.Duration {
+	if uncertainTimeProvider, ok := timeProvider.(UncertainTimeProvider); ok {
+		return uncertainTimeProvider.MaxUncertainty()
+	}
+	return 0
+}
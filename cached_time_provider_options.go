@@ -0,0 +1,80 @@
+package storage_lock
+
+import (
+	"github.com/storage-lock/go-events"
+	"time"
+)
+
+const (
+
+	// DefaultCachedTimeResyncInterval 缓存的存储时间默认每隔多久重新采样一次
+	DefaultCachedTimeResyncInterval = time.Second * 10
+
+	// DefaultCachedTimeMaxUncertainty 缓存的存储时间默认允许的最大不确定度
+	DefaultCachedTimeMaxUncertainty = time.Millisecond * 200
+
+	// DefaultCachedTimeMaxDriftRate 默认认为本地单调时钟相对于存储时钟每秒最多漂移多少，200ppm，普通的晶振都能满足
+	DefaultCachedTimeMaxDriftRate = 0.0002
+)
+
+// CachedTimeProviderOptions 创建缓存的存储时间源（CachedTimeProvider）的相关选项
+type CachedTimeProviderOptions struct {
+
+	// 最多每隔多久重新向存储采样一次时间，两次采样之间使用本地的单调时钟外推
+	ResyncInterval time.Duration
+
+	// 允许的最大不确定度，不确定度是采样时往返耗时的一半加上外推期间可能的时钟漂移，超过这个值之后必须重新采样。
+	// 使用这个时间源的锁会把它的两倍计入续租的安全余量（两个实例的误差方向可能相反）
+	MaxUncertainty time.Duration
+
+	// 本地单调时钟相对于存储时钟每秒最多漂移多少，用来估计外推期间不确定度的增长
+	MaxDriftRate float64
+
+	// 用于监听观测采样过程中的各种事件
+	EventListeners []events.Listener
+}
+
+// NewCachedTimeProviderOptions 使用默认值创建缓存的存储时间源的选项
+func NewCachedTimeProviderOptions() *CachedTimeProviderOptions {
+	return &CachedTimeProviderOptions{
+		ResyncInterval: DefaultCachedTimeResyncInterval,
+		MaxUncertainty: DefaultCachedTimeMaxUncertainty,
+		MaxDriftRate:   DefaultCachedTimeMaxDriftRate,
+	}
+}
+
+// 检查缓存的存储时间源的参数配置是否正确
+func checkCachedTimeProviderOptions(options *CachedTimeProviderOptions) error {
+	if options.MaxUncertainty <= 0 || options.MaxDriftRate < 0 {
+		return ErrCachedTimeUncertaintyInvalid
+	}
+	if options.ResyncInterval <= 0 {
+		options.ResyncInterval = DefaultCachedTimeResyncInterval
+	}
+	return nil
+}
+
+func (x *CachedTimeProviderOptions) SetResyncInterval(resyncInterval time.Duration) *CachedTimeProviderOptions {
+	x.ResyncInterval = resyncInterval
+	return x
+}
+
+func (x *CachedTimeProviderOptions) SetMaxUncertainty(maxUncertainty time.Duration) *CachedTimeProviderOptions {
+	x.MaxUncertainty = maxUncertainty
+	return x
+}
+
+func (x *CachedTimeProviderOptions) SetMaxDriftRate(maxDriftRate float64) *CachedTimeProviderOptions {
+	x.MaxDriftRate = maxDriftRate
+	return x
+}
+
+func (x *CachedTimeProviderOptions) SetEventListeners(eventListeners []events.Listener) *CachedTimeProviderOptions {
+	x.EventListeners = eventListeners
+	return x
+}
+
+func (x *CachedTimeProviderOptions) AddEventListeners(eventListener events.Listener) *CachedTimeProviderOptions {
+	x.EventListeners = append(x.EventListeners, eventListener)
+	return x
+}
@@ -0,0 +1,181 @@
+package storage_lock_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// 记录被读取了多少次时间，可以让读取失败
+type testCountingTimeProvider struct {
+	count atomic.Int64
+	fail  atomic.Bool
+}
+
+func (x *testCountingTimeProvider) GetTime(ctx context.Context) (time.Time, error) {
+	x.count.Add(1)
+	if x.fail.Load() {
+		return time.Time{}, errors.New("test get time error")
+	}
+	return time.Now(), nil
+}
+
+func TestCachedTimeProvider_Extrapolate(t *testing.T) {
+	ctx := context.Background()
+	source := &testCountingTimeProvider{}
+	timeProvider, err := storage_lock.NewCachedTimeProvider(source)
+	assert.Nil(t, err)
+
+	last := time.Time{}
+	for i := 0; i < 100; i++ {
+		now, err := timeProvider.GetTime(ctx)
+		assert.Nil(t, err)
+		assert.False(t, now.Before(last))
+		assert.InDelta(t, 0, time.Since(now), float64(timeProvider.MaxUncertainty()))
+		last = now
+	}
+	assert.Equal(t, int64(1), source.count.Load())
+}
+
+func TestCachedTimeProvider_Resync(t *testing.T) {
+	ctx := context.Background()
+
+	// 到了采样间隔重新采样
+	source := &testCountingTimeProvider{}
+	timeProvider, err := storage_lock.NewCachedTimeProviderWithOptions(source, storage_lock.NewCachedTimeProviderOptions().SetResyncInterval(time.Millisecond*20))
+	assert.Nil(t, err)
+	_, err = timeProvider.GetTime(ctx)
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 50)
+	_, err = timeProvider.GetTime(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), source.count.Load())
+
+	// 误差增长到上限之后重新采样
+	source = &testCountingTimeProvider{}
+	timeProvider, err = storage_lock.NewCachedTimeProviderWithOptions(source, storage_lock.NewCachedTimeProviderOptions().SetMaxDriftRate(1).SetMaxUncertainty(time.Millisecond*10))
+	assert.Nil(t, err)
+	_, err = timeProvider.GetTime(ctx)
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 50)
+	_, err = timeProvider.GetTime(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), source.count.Load())
+}
+
+func TestCachedTimeProvider_ResyncError(t *testing.T) {
+	ctx := context.Background()
+	source := &testCountingTimeProvider{}
+	source.fail.Store(true)
+	timeProvider, err := storage_lock.NewCachedTimeProviderWithOptions(source, storage_lock.NewCachedTimeProviderOptions().SetResyncInterval(time.Millisecond*20))
+	assert.Nil(t, err)
+
+	// 还没有采样成功过
+	_, err = timeProvider.GetTime(ctx)
+	assert.NotNil(t, err)
+
+	// 到了采样间隔但是采样失败了，误差还在范围内的话继续外推
+	source.fail.Store(false)
+	_, err = timeProvider.GetTime(ctx)
+	assert.Nil(t, err)
+	source.fail.Store(true)
+	time.Sleep(time.Millisecond * 50)
+	_, err = timeProvider.GetTime(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), source.count.Load())
+}
+
+// 重新采样发现之前外推得偏快了，返回的时间也不会倒退
+func TestCachedTimeProvider_Monotonic(t *testing.T) {
+	ctx := context.Background()
+	source := &testSkewTimeProvider{}
+	timeProvider, err := storage_lock.NewCachedTimeProviderWithOptions(source, storage_lock.NewCachedTimeProviderOptions().SetResyncInterval(time.Millisecond*20))
+	assert.Nil(t, err)
+	last, err := timeProvider.GetTime(ctx)
+	assert.Nil(t, err)
+
+	source.offset.Store(int64(-time.Second))
+	time.Sleep(time.Millisecond * 50)
+	now, err := timeProvider.GetTime(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, last, now)
+
+	// 采样的时间追上来之后继续往前走
+	source.offset.Store(int64(time.Second))
+	time.Sleep(time.Millisecond * 50)
+	now, err = timeProvider.GetTime(ctx)
+	assert.Nil(t, err)
+	assert.True(t, now.After(last))
+}
+
+// 往返很慢的时间源，记录最近一次返回的时间
+type testSlowTimeProvider struct {
+	latency time.Duration
+	count   atomic.Int64
+	last    atomic.Int64
+}
+
+func (x *testSlowTimeProvider) GetTime(ctx context.Context) (time.Time, error) {
+	x.count.Add(1)
+	now := time.Now()
+	x.last.Store(now.UnixNano())
+	time.Sleep(x.latency)
+	return now, nil
+}
+
+// 采样的误差超过上限的时候不缓存采样，直接返回时间源读到的时间
+func TestCachedTimeProvider_UncertaintyExceeded(t *testing.T) {
+	ctx := context.Background()
+	source := &testSlowTimeProvider{latency: time.Millisecond * 30}
+	timeProvider, err := storage_lock.NewCachedTimeProviderWithOptions(source, storage_lock.NewCachedTimeProviderOptions().SetMaxUncertainty(time.Millisecond*5))
+	assert.Nil(t, err)
+
+	for i := 1; i <= 3; i++ {
+		now, err := timeProvider.GetTime(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, source.last.Load(), now.UnixNano())
+		assert.Equal(t, int64(i), source.count.Load())
+	}
+}
+
+func TestCachedTimeProvider_Options(t *testing.T) {
+	_, err := storage_lock.NewCachedTimeProviderWithOptions(&testCountingTimeProvider{}, storage_lock.NewCachedTimeProviderOptions().SetMaxUncertainty(0))
+	assert.ErrorIs(t, err, storage_lock.ErrCachedTimeUncertaintyInvalid)
+
+	// 时间源的误差计入续租的安全余量
+	timeProvider, err := storage_lock.NewCachedTimeProviderWithOptions(&testCountingTimeProvider{}, storage_lock.NewCachedTimeProviderOptions().SetMaxUncertainty(time.Second))
+	assert.Nil(t, err)
+	options := storage_lock.NewStorageLockOptionsWithLockId("test-cached-time-lock").
+		SetLeaseExpireAfter(time.Second * 30).
+		SetLeaseRefreshInterval(time.Second * 19).
+		SetTimeProvider(timeProvider)
+	_, err = storage_lock.NewStorageLockWithOptions(memory_storage.NewMemoryStorage(), options)
+	assert.ErrorIs(t, err, storage_lock.ErrLeaseRefreshIntervalTooClose)
+	options.SetLeaseRefreshInterval(time.Second * 10)
+	_, err = storage_lock.NewStorageLockWithOptions(memory_storage.NewMemoryStorage(), options)
+	assert.Nil(t, err)
+}
+
+// 多次获取释放锁只读取了一次存储的时间
+func TestCachedTimeProvider_StorageLock(t *testing.T) {
+	ctx := context.Background()
+	s := memory_storage.NewMemoryStorage()
+	source := &testCountingTimeProvider{}
+	timeProvider, err := storage_lock.NewCachedTimeProvider(source)
+	assert.Nil(t, err)
+	lock, err := storage_lock.NewStorageLockWithOptions(s, storage_lock.NewStorageLockOptionsWithLockId("test-cached-time-lock").SetTimeProvider(timeProvider))
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, lock.Lock(ctx, "owner"))
+		assert.Nil(t, lock.Lock(ctx, "owner"))
+		assert.Nil(t, lock.UnLock(ctx, "owner"))
+		assert.Nil(t, lock.UnLock(ctx, "owner"))
+	}
+	assert.Equal(t, int64(1), source.count.Load())
+}
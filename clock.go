@@ -0,0 +1,96 @@
+package storage_lock
+
+import "time"
+
+// Clock 锁和看门狗使用的本地时钟，包括取当前时间、休眠和定时器
+//
+// 锁的租约是按存储时间计算的，但是获取锁时的重试等待、看门狗的续租间隔以及租约连续性检查都是按本地时钟进行的，
+// 默认使用真实的时钟。测试的时候可以注入一个可以手动拨动的时钟（比如 fake_clock.FakeClock），
+// 配合同样使用这个时钟的存储（比如 memory_storage 的 NowFunc），租约过期、看门狗续租这类场景不用真的等待就能确定的跑完。
+type Clock interface {
+
+	// Now 当前时间
+	Now() time.Time
+
+	// Since 从给定的时间到现在过了多久
+	Since(t time.Time) time.Duration
+
+	// Sleep 休眠给定的时长
+	Sleep(d time.Duration)
+
+	// After 给定的时长之后返回的 channel 会收到当时的时间
+	After(d time.Duration) <-chan time.Time
+
+	// NewTimer 创建一个给定时长之后触发的定时器
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer 与 time.Timer 相同的定时器，只是 channel 通过方法获取
+type Timer interface {
+
+	// C 定时器触发的时候会收到当时的时间
+	C() <-chan time.Time
+
+	// Stop 停止定时器，返回定时器是否是被这次调用停止的
+	Stop() bool
+
+	// Reset 重新设置定时器的时长，返回定时器在这之前是否还在等待
+	Reset(d time.Duration) bool
+}
+
+// RealClock 真实的时钟，直接使用 time 包
+type RealClock struct {
+}
+
+var _ Clock = &RealClock{}
+
+func NewRealClock() *RealClock {
+	return &RealClock{}
+}
+
+func (x *RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (x *RealClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (x *RealClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (x *RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (x *RealClock) NewTimer(d time.Duration) Timer {
+	return &realTimer{timer: time.NewTimer(d)}
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (x *realTimer) C() <-chan time.Time {
+	return x.timer.C
+}
+
+func (x *realTimer) Stop() bool {
+	return x.timer.Stop()
+}
+
+func (x *realTimer) Reset(d time.Duration) bool {
+	return x.timer.Reset(d)
+}
+
+// 没有设置时钟的时候使用的真实时钟
+var defaultClock Clock = NewRealClock()
+
+// 锁使用的时钟，选项中没有设置的话使用真实的时钟
+func (x *StorageLock) clock() Clock {
+	if x.options.Clock != nil {
+		return x.options.Clock
+	}
+	return defaultClock
+}
@@ -35,6 +35,18 @@ var (
 
 	// ErrLockRefreshFailed 刷新锁的过期时间时出错
 	ErrLockRefreshFailed = errors.New("lock refresh failed")
+
+	// ErrTransferOwnerInvalid 转移锁的所有权时新的持有者为空或者与当前持有者相同
+	ErrTransferOwnerInvalid = errors.New("transfer target owner must not be empty or same as current owner")
+
+	// ErrLockLeaseExpired 锁记录上的持有者是自己，但是租约（或者会话模式下引用的会话）已经过期了，锁随时可能被别人抢占
+	ErrLockLeaseExpired = errors.New("lock lease expired")
+
+	// ErrLeaseContinuityViolated 看门狗醒来时发现租约已经越过了截止时间，期间锁可能被别人合法持有过
+	ErrLeaseContinuityViolated = errors.New("lease continuity violated, lease expired before watch dog woke up")
+
+	// ErrLockRecordTampered 配置了签名密钥，但是读取到的锁记录没有签名或者签名校验不通过，锁记录被篡改过
+	ErrLockRecordTampered = errors.New("lock record tampered, signature verification failed")
 )
 
 var (
@@ -46,10 +58,106 @@ var (
 	ErrOwnerCanOnlyOne = errors.New("lock owner only one")
 )
 
+var (
+
+	// ErrSessionIdInvalid 手动指定的会话ID格式不正确，必须以 SessionIDPrefix 开头并且不能包含 SessionOwnerIdSeparator
+	ErrSessionIdInvalid = errors.New("session id must start with " + SessionIDPrefix + " and not contain " + SessionOwnerIdSeparator)
+
+	// ErrSessionExpired 会话已经过期或者会话记录已经丢失，会话下所有的锁都已经失效
+	ErrSessionExpired = errors.New("session expired")
+
+	// ErrSessionClosed 会话已经被主动关闭
+	ErrSessionClosed = errors.New("session closed")
+
+	// ErrSessionSigningKeyMismatch 锁的 SigningKey 与它引用的会话的 SigningKey 不一致
+	ErrSessionSigningKeyMismatch = errors.New("storage lock signing key does not match session signing key")
+)
+
+var (
+
+	// ErrWatchDogFactoryNameEmpty 注册的看门狗工厂没有名字
+	ErrWatchDogFactoryNameEmpty = errors.New("watch dog factory name can not empty")
+
+	// ErrWatchDogFactoryAlreadyRegistered 同名的看门狗工厂已经注册过了
+	ErrWatchDogFactoryAlreadyRegistered = errors.New("watch dog factory already registered")
+
+	// ErrWatchDogFactoryNotFound 按名字没有找到已经注册的看门狗工厂
+	ErrWatchDogFactoryNotFound = errors.New("watch dog factory not found")
+
+	// ErrWatchDogFactoryNameMismatch 同时设置了 WatchDogFactory 和 WatchDogFactoryName，但是两者的名字对不上
+	ErrWatchDogFactoryNameMismatch = errors.New("watch dog factory name mismatch")
+)
+
 var (
 
 	// ErrStorageCapabilityMissing 存储实现缺少分布式锁的必要能力
 	// 当 Storage 实现的 Capabilities() 方法返回值中缺少 CapabilityCAS 或 CapabilityReliableTime 时会返回此错误
 	// 这意味着该存储实现无法保证锁的正确性，不应被用于生产环境
 	ErrStorageCapabilityMissing = errors.New("storage missing required capabilities for distributed lock")
+
+	// ErrStorageSelfTestFailed 开启了 CapabilitySelfTest 时，存储实际的行为与它声明的能力不符，错误信息中附带了详细的自检报告
+	ErrStorageSelfTestFailed = errors.New("storage capability self test failed")
+
+	// ErrStorageOperationTimeout 存储操作超过了 StorageLockOptions 中为它配置的超时时间
+	ErrStorageOperationTimeout = errors.New("storage operation timeout")
+)
+
+var (
+
+	// ErrSweepGracePeriodInvalid 清理器的宽限期不能为负数
+	ErrSweepGracePeriodInvalid = errors.New("sweep grace period can not be negative")
+)
+
+var (
+
+	// ErrLockInformationCodecNameEmpty 注册的锁信息编码没有名字
+	ErrLockInformationCodecNameEmpty = errors.New("lock information codec name can not empty")
+
+	// ErrLockInformationCodecAlreadyRegistered 同名的锁信息编码已经注册过了
+	ErrLockInformationCodecAlreadyRegistered = errors.New("lock information codec already registered")
+
+	// ErrLockInformationCodecNotFound 按名字没有找到已经注册的锁信息编码
+	ErrLockInformationCodecNotFound = errors.New("lock information codec not found")
+
+	// ErrLockInformationCodecUnknown 存储中的锁信息不是任何一种已经注册的编码，无法识别
+	ErrLockInformationCodecUnknown = errors.New("lock information codec unknown")
+
+	// ErrLockInformationCorrupted 锁信息能识别出编码，但是内容不完整或者格式不对，无法解码
+	ErrLockInformationCorrupted = errors.New("lock information corrupted")
+)
+
+var (
+
+	// ErrCachedTimeUncertaintyInvalid 缓存的存储时间源允许的最大不确定度必须大于 0，漂移率不能为负数
+	ErrCachedTimeUncertaintyInvalid = errors.New("cached time uncertainty must be positive")
+
+	// ErrCachedTimeUncertaintyExceeded 采样存储时间的误差超过了允许的最大不确定度
+	ErrCachedTimeUncertaintyExceeded = errors.New("cached time uncertainty exceeded")
+)
+
+var (
+
+	// ErrClockSkewExceeded 时间源与本地时钟之间的漂移超过了 ClockSkewThreshold
+	ErrClockSkewExceeded = errors.New("clock skew exceeded")
+)
+
+var (
+
+	// ErrTimeWentBackward 时间源的时间倒退了，MonotonicTimeProvider 的策略是 TimeBackwardPolicyFail 时返回
+	ErrTimeWentBackward = errors.New("time went backward")
+)
+
+var (
+
+	// ErrMedianTimeOptionsInvalid 中位数时间源至少要有一个时间源，容差必须大于 0，法定数量不能超过时间源的个数
+	ErrMedianTimeOptionsInvalid = errors.New("median time options invalid")
+
+	// ErrMedianTimeQuorumNotReached 响应的或者彼此一致的时间源不足法定数量
+	ErrMedianTimeQuorumNotReached = errors.New("median time quorum not reached")
+
+	// ErrMedianTimeSourceTimeout 单个时间源没有在 SourceTimeout 之内返回
+	ErrMedianTimeSourceTimeout = errors.New("median time source timeout")
+
+	// ErrMedianTimeSourceOutlier 单个时间源与中位数相差超过了容差，被当做离群值丢弃
+	ErrMedianTimeSourceOutlier = errors.New("median time source outlier")
 )
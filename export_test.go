@@ -0,0 +1,22 @@
+package storage_lock
+
+import "time"
+
+// 把一些内部状态导出给 storage_lock_test 包中的测试使用，这个文件只会在测试时编译
+
+// CurrentWatchDog 当前实例上正在运行的看门狗，没有的话返回 nil
+func (x *StorageLock) CurrentWatchDog() WatchDog {
+	x.watchDogMu.Lock()
+	defer x.watchDogMu.Unlock()
+	return x.storageLockWatchDog
+}
+
+// EffectiveLeaseExpireAfter 看门狗当前使用的有效租约时长
+func (x *StorageLock) EffectiveLeaseExpireAfter() time.Duration {
+	return x.effectiveLeaseExpireAfter()
+}
+
+// EffectiveLeaseRefreshInterval 看门狗当前使用的有效刷新间隔
+func (x *StorageLock) EffectiveLeaseRefreshInterval() time.Duration {
+	return x.effectiveLeaseRefreshInterval()
+}
@@ -0,0 +1,199 @@
+package fake_clock
+
+import (
+	"context"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FakeClock 可以手动拨动的时钟，用于确定性的测试锁、看门狗这类依赖时间流逝的逻辑
+//
+// 时间只有在调用 Advance 或者 Set 的时候才会往前走，走到的时候到期的定时器、Sleep 和 After 会按照到期的先后依次触发。
+// 被测试的逻辑通常在别的协程里休眠，拨动时间之前可以先用 BlockUntil 等它们真正开始等待，避免拨早了：
+//
+//	clock := fake_clock.NewFakeClock()
+//	storage := memory_storage.NewMemoryStorageWithOptions(memory_storage.NewMemoryStorageOptions().SetNowFunc(clock.Now))
+//	options := storage_lock.NewStorageLockOptionsWithLockId(lockId).SetClock(clock)
+//	...
+//	clock.BlockUntil(ctx, 1)
+//	clock.Advance(time.Minute)
+type FakeClock struct {
+	mutex sync.Mutex
+
+	// 状态变化（时间被拨动、有新的等待者）的时候广播，BlockUntil 靠它醒来
+	cond *sync.Cond
+
+	now     time.Time
+	waiters []*fakeTimer
+}
+
+var _ storage_lock.Clock = &FakeClock{}
+
+// DefaultStartTime 默认的起始时间，使用一个固定的时间让测试的结果可以复现
+var DefaultStartTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// NewFakeClock 创建一个从 DefaultStartTime 开始的时钟
+func NewFakeClock() *FakeClock {
+	return NewFakeClockAt(DefaultStartTime)
+}
+
+// NewFakeClockAt 创建一个从给定的时间开始的时钟
+func NewFakeClockAt(now time.Time) *FakeClock {
+	clock := &FakeClock{now: now}
+	clock.cond = sync.NewCond(&clock.mutex)
+	return clock
+}
+
+func (x *FakeClock) Now() time.Time {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.now
+}
+
+func (x *FakeClock) Since(t time.Time) time.Duration {
+	return x.Now().Sub(t)
+}
+
+// Sleep 一直阻塞到时间被拨过了给定的时长
+func (x *FakeClock) Sleep(d time.Duration) {
+	<-x.After(d)
+}
+
+func (x *FakeClock) After(d time.Duration) <-chan time.Time {
+	return x.NewTimer(d).C()
+}
+
+func (x *FakeClock) NewTimer(d time.Duration) storage_lock.Timer {
+	timer := &fakeTimer{
+		clock: x,
+		c:     make(chan time.Time, 1),
+	}
+	timer.Reset(d)
+	return timer
+}
+
+// Advance 把时间往前拨给定的时长，触发期间到期的定时器
+func (x *FakeClock) Advance(d time.Duration) {
+	x.Set(x.Now().Add(d))
+}
+
+// Set 把时间拨到给定的时刻，不能往回拨，触发期间到期的定时器
+func (x *FakeClock) Set(t time.Time) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if t.Before(x.now) {
+		return
+	}
+
+	// 按照到期的先后依次触发，触发的时候时间就是定时器到期的时间
+	sort.SliceStable(x.waiters, func(i, j int) bool {
+		return x.waiters[i].deadline.Before(x.waiters[j].deadline)
+	})
+	remaining := x.waiters[:0]
+	for _, waiter := range x.waiters {
+		if waiter.deadline.After(t) {
+			remaining = append(remaining, waiter)
+			continue
+		}
+		if waiter.deadline.After(x.now) {
+			x.now = waiter.deadline
+		}
+		waiter.fire(x.now)
+	}
+	x.waiters = remaining
+	x.now = t
+	x.cond.Broadcast()
+}
+
+// Waiters 当前有多少个还没有到期的定时器（包括 Sleep 和 After）
+func (x *FakeClock) Waiters() int {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return len(x.waiters)
+}
+
+// BlockUntil 一直等到至少有 n 个还没有到期的定时器，或者 ctx 结束，返回是否等到了
+func (x *FakeClock) BlockUntil(ctx context.Context, n int) bool {
+	// ctx 结束的时候唤醒等待者
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			x.mutex.Lock()
+			defer x.mutex.Unlock()
+			x.cond.Broadcast()
+		case <-done:
+		}
+	}()
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	for len(x.waiters) < n {
+		if ctx.Err() != nil {
+			return false
+		}
+		x.cond.Wait()
+	}
+	return true
+}
+
+// 添加一个等待者，调用前要持有 mutex
+func (x *FakeClock) addWaiter(timer *fakeTimer) {
+	x.waiters = append(x.waiters, timer)
+	x.cond.Broadcast()
+}
+
+// 移除一个等待者，返回之前是否在等待，调用前要持有 mutex
+func (x *FakeClock) removeWaiter(timer *fakeTimer) bool {
+	for i, waiter := range x.waiters {
+		if waiter == timer {
+			x.waiters = append(x.waiters[:i], x.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ------------------------------------------------- --------------------------------------------------------------------
+
+type fakeTimer struct {
+	clock    *FakeClock
+	c        chan time.Time
+	deadline time.Time
+}
+
+var _ storage_lock.Timer = &fakeTimer{}
+
+func (x *fakeTimer) C() <-chan time.Time {
+	return x.c
+}
+
+func (x *fakeTimer) Stop() bool {
+	x.clock.mutex.Lock()
+	defer x.clock.mutex.Unlock()
+	return x.clock.removeWaiter(x)
+}
+
+func (x *fakeTimer) Reset(d time.Duration) bool {
+	x.clock.mutex.Lock()
+	defer x.clock.mutex.Unlock()
+	active := x.clock.removeWaiter(x)
+	x.deadline = x.clock.now.Add(d)
+	if d <= 0 {
+		x.fire(x.clock.now)
+		return active
+	}
+	x.clock.addWaiter(x)
+	return active
+}
+
+// 与 time.Timer 一样，channel 中已经有一个没有被取走的时间的话丢弃这次触发
+func (x *fakeTimer) fire(now time.Time) {
+	select {
+	case x.c <- now:
+	default:
+	}
+}
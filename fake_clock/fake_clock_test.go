@@ -0,0 +1,71 @@
+package fake_clock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock_Timers(t *testing.T) {
+	clock := NewFakeClock()
+	start := clock.Now()
+
+	first := clock.NewTimer(time.Second)
+	second := clock.NewTimer(time.Second * 2)
+	stopped := clock.NewTimer(time.Second)
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+	assert.Equal(t, 2, clock.Waiters())
+
+	// 按照到期的时间触发
+	clock.Advance(time.Second * 3)
+	assert.Equal(t, start.Add(time.Second), <-first.C())
+	assert.Equal(t, start.Add(time.Second*2), <-second.C())
+	assert.Equal(t, start.Add(time.Second*3), clock.Now())
+	assert.Equal(t, 0, clock.Waiters())
+	select {
+	case <-stopped.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+
+	// Reset 之后从现在开始重新计时
+	assert.False(t, first.Reset(time.Second))
+	clock.Advance(time.Millisecond * 999)
+	assert.Equal(t, 1, clock.Waiters())
+	clock.Advance(time.Millisecond)
+	assert.Equal(t, start.Add(time.Second*4), <-first.C())
+
+	// 不能往回拨
+	clock.Set(start)
+	assert.Equal(t, start.Add(time.Second*4), clock.Now())
+}
+
+func TestFakeClock_Sleep(t *testing.T) {
+	clock := NewFakeClock()
+	done := make(chan struct{})
+	go func() {
+		clock.Sleep(time.Hour)
+		close(done)
+	}()
+
+	assert.True(t, clock.BlockUntil(context.Background(), 1))
+	clock.Advance(time.Minute * 59)
+	select {
+	case <-done:
+		t.Fatal("woke up too early")
+	default:
+	}
+	clock.Advance(time.Minute)
+	<-done
+	assert.Equal(t, time.Hour, clock.Since(DefaultStartTime))
+}
+
+func TestFakeClock_BlockUntilContext(t *testing.T) {
+	clock := NewFakeClock()
+	ctx, cancelFunc := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancelFunc()
+	assert.False(t, clock.BlockUntil(ctx, 1))
+}
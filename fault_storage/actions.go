@@ -0,0 +1,17 @@
+package fault_storage
+
+// 注入故障的事件，每注入一次故障发布一个，便于按锁ID和时间找到故障是在哪里注入的
+const (
+	ActionInjectLatency          = "FaultStorage.Inject.Latency"
+	ActionInjectError            = "FaultStorage.Inject.Error"
+	ActionInjectAmbiguousSuccess = "FaultStorage.Inject.AmbiguousSuccess"
+	ActionInjectClockJump        = "FaultStorage.Inject.ClockJump"
+	ActionInjectPartition        = "FaultStorage.Inject.Partition"
+)
+
+// Payload的名字
+const (
+	PayloadOperation = "operation"
+	PayloadLatency   = "latency"
+	PayloadClockJump = "clockJump"
+)
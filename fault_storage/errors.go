@@ -0,0 +1,21 @@
+package fault_storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrStorageNil = errors.New("fault storage must wrap a storage")
+
+	// ErrInjectedFault 注入的普通错误
+	ErrInjectedFault = errors.New("injected fault")
+
+	// ErrInjectedPartition 注入的网络分区，分区期间所有的操作都会失败
+	ErrInjectedPartition = errors.New("injected partition")
+
+	// ErrInjectedAmbiguousTimeout 写入已经在后端生效了，但是调用方收到的是超时，
+	// 它同时也是一个 context.DeadlineExceeded，与真实的超时无法区分
+	ErrInjectedAmbiguousTimeout = fmt.Errorf("%w: injected timeout after the write was applied", context.DeadlineExceeded)
+)
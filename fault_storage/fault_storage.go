@@ -0,0 +1,261 @@
+package fault_storage
+
+import (
+	"context"
+	"github.com/golang-infrastructure/go-iterator"
+	"github.com/storage-lock/go-events"
+	"github.com/storage-lock/go-storage"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// FaultStorage 包装任意一个存储并按配置注入故障，用来在混沌测试中验证服务在存储出问题的时候的表现：
+// 延迟、按操作配置的错误率、写入生效之后返回超时（结果未知的写入）、GetTime 的时钟跳变、按时间表或者手动触发的网络分区。
+//
+// 所有的随机性都来自 Seed 初始化的随机数生成器，种子和调用顺序相同的时候注入的故障是可以复现的。
+// 每注入一次故障都会发布一个独立的根事件，LockId 是被操作的锁的ID。存储接口拿不到调用方的事件，
+// 所以这些事件不会挂在锁自己的事件树（链路）下面，需要按锁ID和时间与锁的事件对照着看。
+type FaultStorage struct {
+	storage storage.Storage
+	options *FaultStorageOptions
+
+	// 创建的时间，按时间表注入的分区从这个时间开始计算
+	createTime time.Time
+
+	lock sync.Mutex
+	rand *rand.Rand
+
+	// 手动触发的分区
+	partitioned bool
+
+	// 持续的时钟偏移
+	clockOffset time.Duration
+}
+
+var _ storage.Storage = &FaultStorage{}
+
+// NewFaultStorage 包装给定的存储，不注入任何故障，之后可以通过 Partition、JumpClock 等方法手动注入
+func NewFaultStorage(s storage.Storage) (*FaultStorage, error) {
+	return NewFaultStorageWithOptions(s, NewFaultStorageOptions())
+}
+
+// NewFaultStorageWithOptions 使用给定的选项包装给定的存储
+func NewFaultStorageWithOptions(s storage.Storage, options *FaultStorageOptions) (*FaultStorage, error) {
+	if s == nil {
+		return nil, ErrStorageNil
+	}
+	return &FaultStorage{
+		storage:    s,
+		options:    options,
+		createTime: time.Now(),
+		rand:       rand.New(rand.NewSource(options.Seed)),
+	}, nil
+}
+
+// Unwrap 返回被包装的存储
+func (x *FaultStorage) Unwrap() storage.Storage {
+	return x.storage
+}
+
+// Partition 手动开始一次网络分区，直到调用 Heal 为止
+func (x *FaultStorage) Partition() {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	x.partitioned = true
+}
+
+// Heal 结束手动开始的网络分区，不影响按时间表注入的分区
+func (x *FaultStorage) Heal() {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	x.partitioned = false
+}
+
+// IsPartitioned 当前是否处于网络分区中
+func (x *FaultStorage) IsPartitioned() bool {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	return x.isPartitioned(time.Now())
+}
+
+// JumpClock 让 GetTime 返回的时间持续偏移 delta，可以多次调用累加，传入负数模拟时钟回拨
+func (x *FaultStorage) JumpClock(delta time.Duration) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	x.clockOffset += delta
+}
+
+func (x *FaultStorage) GetName() string {
+	if x.options.Name != "" {
+		return x.options.Name
+	}
+	return x.storage.GetName()
+}
+
+// Capabilities 与被包装的存储相同
+func (x *FaultStorage) Capabilities() []storage.StorageCapability {
+	if declarer, ok := x.storage.(storage.CapabilityDeclarer); ok {
+		return declarer.Capabilities()
+	}
+	return nil
+}
+
+func (x *FaultStorage) Init(ctx context.Context) error {
+	return x.do(ctx, "", OperationInit, func() error {
+		return x.storage.Init(ctx)
+	})
+}
+
+func (x *FaultStorage) UpdateWithVersion(ctx context.Context, lockId string, exceptedVersion, newVersion storage.Version, lockInformation *storage.LockInformation) error {
+	return x.do(ctx, lockId, OperationUpdateWithVersion, func() error {
+		return x.storage.UpdateWithVersion(ctx, lockId, exceptedVersion, newVersion, lockInformation)
+	})
+}
+
+func (x *FaultStorage) CreateWithVersion(ctx context.Context, lockId string, version storage.Version, lockInformation *storage.LockInformation) error {
+	return x.do(ctx, lockId, OperationCreateWithVersion, func() error {
+		return x.storage.CreateWithVersion(ctx, lockId, version, lockInformation)
+	})
+}
+
+func (x *FaultStorage) DeleteWithVersion(ctx context.Context, lockId string, exceptedVersion storage.Version, lockInformation *storage.LockInformation) error {
+	return x.do(ctx, lockId, OperationDeleteWithVersion, func() error {
+		return x.storage.DeleteWithVersion(ctx, lockId, exceptedVersion, lockInformation)
+	})
+}
+
+func (x *FaultStorage) Get(ctx context.Context, lockId string) (string, error) {
+	var lockInformationJsonString string
+	err := x.do(ctx, lockId, OperationGet, func() error {
+		var err error
+		lockInformationJsonString, err = x.storage.Get(ctx, lockId)
+		return err
+	})
+	return lockInformationJsonString, err
+}
+
+func (x *FaultStorage) GetTime(ctx context.Context) (time.Time, error) {
+	var storageTime time.Time
+	err := x.do(ctx, "", OperationGetTime, func() error {
+		var err error
+		storageTime, err = x.storage.GetTime(ctx)
+		return err
+	})
+	if err != nil {
+		return storageTime, err
+	}
+
+	x.lock.Lock()
+	jump := x.clockOffset
+	randomJump := time.Duration(0)
+	if x.options.ClockJumpRate > 0 && x.options.ClockJumpMax > 0 && x.rand.Float64() < x.options.ClockJumpRate {
+		randomJump = time.Duration(x.rand.Int63n(int64(x.options.ClockJumpMax)*2+1)) - x.options.ClockJumpMax
+	}
+	x.lock.Unlock()
+
+	if randomJump != 0 {
+		x.publish(ctx, "", events.NewAction(ActionInjectClockJump).AddPayload(PayloadOperation, OperationGetTime).AddPayload(PayloadClockJump, randomJump))
+	}
+	return storageTime.Add(jump + randomJump), nil
+}
+
+func (x *FaultStorage) Close(ctx context.Context) error {
+	return x.storage.Close(ctx)
+}
+
+func (x *FaultStorage) List(ctx context.Context) (iterator.Iterator[*storage.LockInformation], error) {
+	var it iterator.Iterator[*storage.LockInformation]
+	err := x.do(ctx, "", OperationList, func() error {
+		var err error
+		it, err = x.storage.List(ctx)
+		return err
+	})
+	return it, err
+}
+
+// 本次操作要注入的故障，在一次加锁中全部抽取完，保证同样的调用顺序抽到同样的故障
+type faults struct {
+	partitioned bool
+	latency     time.Duration
+	err         bool
+	ambiguous   bool
+}
+
+func (x *FaultStorage) draw(operation Operation) *faults {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	f := &faults{
+		partitioned: x.isPartitioned(time.Now()),
+		latency:     x.options.Latency,
+	}
+	if x.options.LatencyJitter > 0 {
+		f.latency += time.Duration(x.rand.Int63n(int64(x.options.LatencyJitter)))
+	}
+	if rate := x.options.ErrorRates[operation]; rate > 0 {
+		f.err = x.rand.Float64() < rate
+	}
+	if operation.isWrite() && x.options.AmbiguousSuccessRate > 0 {
+		f.ambiguous = x.rand.Float64() < x.options.AmbiguousSuccessRate
+	}
+	return f
+}
+
+// 执行一次操作并按抽取到的结果注入故障
+func (x *FaultStorage) do(ctx context.Context, lockId string, operation Operation, f func() error) error {
+
+	faults := x.draw(operation)
+
+	if faults.partitioned {
+		x.publish(ctx, lockId, events.NewAction(ActionInjectPartition).SetErr(ErrInjectedPartition).AddPayload(PayloadOperation, operation))
+		if x.options.PartitionHang {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return ErrInjectedPartition
+	}
+
+	if faults.latency > 0 {
+		x.publish(ctx, lockId, events.NewAction(ActionInjectLatency).AddPayload(PayloadOperation, operation).AddPayload(PayloadLatency, faults.latency))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(faults.latency):
+		}
+	}
+
+	if faults.err {
+		x.publish(ctx, lockId, events.NewAction(ActionInjectError).SetErr(ErrInjectedFault).AddPayload(PayloadOperation, operation))
+		return ErrInjectedFault
+	}
+
+	err := f()
+	if err == nil && faults.ambiguous {
+		x.publish(ctx, lockId, events.NewAction(ActionInjectAmbiguousSuccess).SetErr(ErrInjectedAmbiguousTimeout).AddPayload(PayloadOperation, operation))
+		return ErrInjectedAmbiguousTimeout
+	}
+	return err
+}
+
+// 调用方需要持有锁
+func (x *FaultStorage) isPartitioned(now time.Time) bool {
+	if x.partitioned {
+		return true
+	}
+	elapsed := now.Sub(x.createTime)
+	for _, window := range x.options.Partitions {
+		if elapsed >= window.After && elapsed < window.After+window.Duration {
+			return true
+		}
+	}
+	return false
+}
+
+// 发布注入故障的事件，Storage 接口上没有事件可以继承，只能新建一个根事件
+func (x *FaultStorage) publish(ctx context.Context, lockId string, action *events.Action) {
+	if len(x.options.EventListeners) == 0 {
+		return
+	}
+	events.NewEvent(lockId).SetStorageName(x.GetName()).SetListeners(x.options.EventListeners).AddAction(action).Publish(ctx)
+}
@@ -0,0 +1,116 @@
+package fault_storage
+
+import (
+	"github.com/storage-lock/go-events"
+	"time"
+)
+
+// FaultStorageOptions 故障注入的相关选项，所有的概率都是 [0, 1] 之间的小数，为 0 表示不注入
+type FaultStorageOptions struct {
+
+	// 存储的名字，未设置的话沿用被包装的存储的名字
+	Name string
+
+	// 随机数种子，种子相同、调用顺序相同的时候注入的故障完全相同，便于复现问题
+	Seed int64
+
+	// 每次操作之前注入的延迟，实际延迟为 Latency + [0, LatencyJitter)
+	Latency       time.Duration
+	LatencyJitter time.Duration
+
+	// 每种操作返回 ErrInjectedFault 的概率，故障注入在调用被包装的存储之前，不会对存储产生任何影响
+	ErrorRates map[Operation]float64
+
+	// 写操作已经在被包装的存储上生效、但是返回 ErrInjectedAmbiguousTimeout 的概率
+	AmbiguousSuccessRate float64
+
+	// GetTime 返回的时间发生跳变的概率，跳变的幅度在 [-ClockJumpMax, ClockJumpMax] 之间，只影响这一次调用
+	// 想要持续的时钟偏移可以使用 FaultStorage.JumpClock
+	ClockJumpRate float64
+	ClockJumpMax  time.Duration
+
+	// 按时间表注入的网络分区，时间从创建 FaultStorage 开始计算
+	Partitions []*PartitionWindow
+
+	// 分区期间的操作是阻塞到 ctx 结束（更接近真实的网络分区）还是立即返回 ErrInjectedPartition
+	PartitionHang bool
+
+	// 注入故障的事件会发布到这些监听器上
+	EventListeners []events.Listener
+}
+
+// PartitionWindow 一段网络分区的时间窗口
+type PartitionWindow struct {
+
+	// 创建 FaultStorage 之后多久开始分区
+	After time.Duration
+
+	// 分区持续多久
+	Duration time.Duration
+}
+
+// NewFaultStorageOptions 创建一个不注入任何故障的选项
+func NewFaultStorageOptions() *FaultStorageOptions {
+	return &FaultStorageOptions{
+		ErrorRates: make(map[Operation]float64),
+	}
+}
+
+func (x *FaultStorageOptions) SetName(name string) *FaultStorageOptions {
+	x.Name = name
+	return x
+}
+
+func (x *FaultStorageOptions) SetSeed(seed int64) *FaultStorageOptions {
+	x.Seed = seed
+	return x
+}
+
+func (x *FaultStorageOptions) SetLatency(latency time.Duration) *FaultStorageOptions {
+	x.Latency = latency
+	return x
+}
+
+func (x *FaultStorageOptions) SetLatencyJitter(latencyJitter time.Duration) *FaultStorageOptions {
+	x.LatencyJitter = latencyJitter
+	return x
+}
+
+func (x *FaultStorageOptions) SetErrorRate(operation Operation, rate float64) *FaultStorageOptions {
+	if x.ErrorRates == nil {
+		x.ErrorRates = make(map[Operation]float64)
+	}
+	x.ErrorRates[operation] = rate
+	return x
+}
+
+func (x *FaultStorageOptions) SetAmbiguousSuccessRate(rate float64) *FaultStorageOptions {
+	x.AmbiguousSuccessRate = rate
+	return x
+}
+
+func (x *FaultStorageOptions) SetClockJump(rate float64, max time.Duration) *FaultStorageOptions {
+	x.ClockJumpRate = rate
+	x.ClockJumpMax = max
+	return x
+}
+
+func (x *FaultStorageOptions) AddPartition(after, duration time.Duration) *FaultStorageOptions {
+	x.Partitions = append(x.Partitions, &PartitionWindow{After: after, Duration: duration})
+	return x
+}
+
+func (x *FaultStorageOptions) SetPartitionHang(hang bool) *FaultStorageOptions {
+	x.PartitionHang = hang
+	return x
+}
+
+func (x *FaultStorageOptions) SetEventListeners(eventListeners []events.Listener) *FaultStorageOptions {
+	x.EventListeners = eventListeners
+	return x
+}
+
+func (x *FaultStorageOptions) AddEventListeners(listener events.Listener) *FaultStorageOptions {
+	x.EventListeners = append(x.EventListeners, listener)
+	return x
+}
@@ -0,0 +1,154 @@
+package fault_storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-events"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/storage-lock/go-storage-lock/resilient_storage"
+	"github.com/storage-lock/go-storage-lock/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFaultStorage(t *testing.T, options *FaultStorageOptions) (*FaultStorage, *memory_storage.MemoryStorage) {
+	memoryStorage := memory_storage.NewMemoryStorage()
+	s, err := NewFaultStorageWithOptions(memoryStorage, options)
+	assert.Nil(t, err)
+	return s, memoryStorage
+}
+
+// 种子相同的时候注入的故障完全相同
+func TestFaultStorage_Reproducible(t *testing.T) {
+	run := func(seed int64) []bool {
+		s, _ := newTestFaultStorage(t, NewFaultStorageOptions().SetSeed(seed).SetErrorRate(OperationGet, 0.5))
+		outcomes := make([]bool, 0, 100)
+		for i := 0; i < 100; i++ {
+			_, err := s.Get(context.Background(), "test-fault-reproducible")
+			outcomes = append(outcomes, err == ErrInjectedFault)
+		}
+		return outcomes
+	}
+	assert.Equal(t, run(42), run(42))
+	assert.NotEqual(t, run(42), run(43))
+}
+
+// 注入的错误不会影响被包装的存储，结果未知的写入则已经生效
+func TestFaultStorage_ErrorAndAmbiguousSuccess(t *testing.T) {
+	ctx := context.Background()
+	information := storagetest.NewTestLockInformation()
+
+	s, memoryStorage := newTestFaultStorage(t, NewFaultStorageOptions().SetErrorRate(OperationCreateWithVersion, 1))
+	assert.ErrorIs(t, s.CreateWithVersion(ctx, "test-fault-error", information.Version, information), ErrInjectedFault)
+	_, err := memoryStorage.Get(ctx, "test-fault-error")
+	assert.ErrorIs(t, err, storage_lock.ErrLockNotFound)
+
+	s, memoryStorage = newTestFaultStorage(t, NewFaultStorageOptions().SetAmbiguousSuccessRate(1))
+	err = s.CreateWithVersion(ctx, "test-fault-ambiguous", information.Version, information)
+	assert.ErrorIs(t, err, ErrInjectedAmbiguousTimeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = memoryStorage.Get(ctx, "test-fault-ambiguous")
+	assert.Nil(t, err)
+
+	// 读操作不会注入结果未知的故障
+	_, err = s.Get(ctx, "test-fault-ambiguous")
+	assert.Nil(t, err)
+}
+
+func TestFaultStorage_Partition(t *testing.T) {
+	ctx := context.Background()
+
+	s, _ := newTestFaultStorage(t, NewFaultStorageOptions())
+	s.Partition()
+	_, err := s.Get(ctx, "test-fault-partition")
+	assert.ErrorIs(t, err, ErrInjectedPartition)
+	s.Heal()
+	_, err = s.Get(ctx, "test-fault-partition")
+	assert.ErrorIs(t, err, storage_lock.ErrLockNotFound)
+
+	// 按时间表注入的分区
+	s, _ = newTestFaultStorage(t, NewFaultStorageOptions().AddPartition(time.Millisecond*30, time.Millisecond*30))
+	assert.False(t, s.IsPartitioned())
+	time.Sleep(time.Millisecond * 40)
+	assert.True(t, s.IsPartitioned())
+	time.Sleep(time.Millisecond * 30)
+	assert.False(t, s.IsPartitioned())
+
+	// 分区期间阻塞到 ctx 结束
+	s, _ = newTestFaultStorage(t, NewFaultStorageOptions().SetPartitionHang(true))
+	s.Partition()
+	timeoutCtx, cancelFunc := context.WithTimeout(ctx, time.Millisecond*20)
+	defer cancelFunc()
+	_, err = s.Get(timeoutCtx, "test-fault-partition")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestFaultStorage_ClockJump(t *testing.T) {
+	ctx := context.Background()
+
+	s, _ := newTestFaultStorage(t, NewFaultStorageOptions())
+	s.JumpClock(-time.Hour)
+	storageTime, err := s.GetTime(ctx)
+	assert.Nil(t, err)
+	assert.InDelta(t, float64(-time.Hour), float64(storageTime.Sub(time.Now())), float64(time.Second))
+
+	s, _ = newTestFaultStorage(t, NewFaultStorageOptions().SetClockJump(1, time.Minute))
+	jumped := false
+	for i := 0; i < 20; i++ {
+		storageTime, err := s.GetTime(ctx)
+		assert.Nil(t, err)
+		diff := storageTime.Sub(time.Now())
+		assert.LessOrEqual(t, diff, time.Minute+time.Second)
+		assert.GreaterOrEqual(t, diff, -time.Minute-time.Second)
+		if diff > time.Second || diff < -time.Second {
+			jumped = true
+		}
+	}
+	assert.True(t, jumped)
+}
+
+// 注入的故障会发布事件
+func TestFaultStorage_Events(t *testing.T) {
+	mutex := sync.Mutex{}
+	actions := make([]string, 0)
+	listener := events.NewListenerWrapper("test-fault-listener", func(ctx context.Context, e *events.Event) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, action := range e.Actions {
+			actions = append(actions, action.Name)
+		}
+	})
+	s, _ := newTestFaultStorage(t, NewFaultStorageOptions().SetLatency(time.Millisecond).SetErrorRate(OperationGet, 1).AddEventListeners(listener))
+	_, err := s.Get(context.Background(), "test-fault-events")
+	assert.ErrorIs(t, err, ErrInjectedFault)
+	assert.Equal(t, []string{ActionInjectLatency, ActionInjectError}, actions)
+}
+
+// 弹性存储可以扛住注入的故障，StorageLock 在故障下仍然能够正常的获取和释放锁
+func TestFaultStorage_WithResilientStorage(t *testing.T) {
+	ctx := context.Background()
+	options := NewFaultStorageOptions().
+		SetSeed(1).
+		SetErrorRate(OperationGet, 0.2).
+		SetErrorRate(OperationCreateWithVersion, 0.2).
+		SetErrorRate(OperationUpdateWithVersion, 0.2).
+		SetErrorRate(OperationDeleteWithVersion, 0.2).
+		SetAmbiguousSuccessRate(0.2)
+	s, _ := newTestFaultStorage(t, options)
+	resilientOptions := resilient_storage.NewResilientStorageOptions().
+		SetMaxRetries(10).
+		SetRetryInterval(time.Millisecond).
+		SetCircuitBreakerFailureThreshold(0)
+	resilientStorage, err := resilient_storage.NewResilientStorageWithOptions(s, resilientOptions)
+	assert.Nil(t, err)
+
+	lock, err := storage_lock.NewStorageLock(resilientStorage, "test-fault-resilient")
+	assert.Nil(t, err)
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, lock.Lock(ctx, "owner"))
+		assert.Nil(t, lock.UnLock(ctx, "owner"))
+	}
+}
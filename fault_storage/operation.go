@@ -0,0 +1,20 @@
+package fault_storage
+
+// Operation 存储上的操作，故障可以按操作分别配置
+type Operation string
+
+const (
+	OperationInit              Operation = "Init"
+	OperationGet               Operation = "Get"
+	OperationCreateWithVersion Operation = "CreateWithVersion"
+	OperationUpdateWithVersion Operation = "UpdateWithVersion"
+	OperationDeleteWithVersion Operation = "DeleteWithVersion"
+	OperationGetTime           Operation = "GetTime"
+	OperationList              Operation = "List"
+	OperationClose             Operation = "Close"
+)
+
+// 会修改存储内容的操作，只有这些操作才会注入"写入已经生效但是返回超时"的故障
+func (x Operation) isWrite() bool {
+	return x == OperationCreateWithVersion || x == OperationUpdateWithVersion || x == OperationDeleteWithVersion
+}
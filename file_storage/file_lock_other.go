@@ -0,0 +1,22 @@
+//go:build !unix
+
+package file_storage
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// 非 unix 平台上没有 flock，无法在多个进程之间提供互斥，直接拒绝而不是退化成一个不安全的实现
+func lockFile(ctx context.Context, file *os.File, pollInterval time.Duration) error {
+	return ErrFileLockNotSupported
+}
+
+func unlockFile(file *os.File) error {
+	return ErrFileLockNotSupported
+}
+
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,44 @@
+//go:build unix
+
+package file_storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// 在给定的文件上获取排他的 flock，ctx 被取消的时候放弃等待
+// flock 是与打开的文件描述绑定的，同一个进程内的不同 FileStorage 实例之间同样是互斥的，进程退出时内核会自动释放
+func lockFile(ctx context.Context, file *os.File, pollInterval time.Duration) error {
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) && !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func unlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
+
+// 把目录的元数据刷到磁盘上，保证 rename 和删除在掉电之后也是可见的
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,340 @@
+package file_storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/golang-infrastructure/go-iterator"
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileStorage 把每一把锁的记录存为目录下的一个文件，用于同一台机器上多个进程之间的互斥，不需要任何外部的数据库
+//
+// 目录下每把锁对应两个文件：
+//
+//	<sha256(lockId)>.lock   锁记录，内容是 FileStorageValue 序列化的JSON，总是通过"写临时文件、fsync、rename"整体替换，读的一方不会读到写了一半的内容
+//	<sha256(lockId)>.flock  用来加 flock 的文件，所有的写操作都在这个文件的排他锁之下进行"读出版本、比较、写入"，以此实现CAS
+//
+// 文件名是 lockId 的 sha256 的十六进制，长度固定，再长的 lockId 也不会超出文件名的长度限制，真正的 lockId 保存在锁记录里。
+// .flock 文件创建之后就不会再删除，如果删除了，正在等待旧文件锁的进程和新创建文件上的进程会同时认为自己拿到了锁。
+// 写锁记录的进程在 rename 之前崩溃的话会留下临时文件，Init 的时候会在对应的文件锁之下把它们清理掉。
+// 时间取的是本机的时钟，同一台机器上的所有进程看到的是同一个时钟，所以可以声明为可靠的时间源。
+type FileStorage struct {
+	options *FileStorageOptions
+}
+
+var _ storage.Storage = &FileStorage{}
+
+// DefaultName 文件存储默认的名字
+const DefaultName = "file-storage"
+
+const (
+
+	// 锁记录文件的后缀
+	recordFileSuffix = ".lock"
+
+	// 文件锁文件的后缀
+	flockFileSuffix = ".flock"
+
+	// 写锁记录时临时文件在锁记录文件名之后追加的部分
+	tmpFileInfix = ".tmp-"
+)
+
+var (
+	ErrDirEmpty             = errors.New("file storage dir can not be empty")
+	ErrFileLockNotSupported = errors.New("file lock is not supported on this platform")
+)
+
+// NewFileStorage 在给定的目录上创建一个文件存储，目录不存在的话会自动创建
+func NewFileStorage(dir string) (*FileStorage, error) {
+	return NewFileStorageWithOptions(NewFileStorageOptions().SetDir(dir))
+}
+
+// NewFileStorageWithOptions 使用给定的选项创建一个文件存储，目录不存在的话会自动创建
+func NewFileStorageWithOptions(options *FileStorageOptions) (*FileStorage, error) {
+	if options.Dir == "" {
+		return nil, ErrDirEmpty
+	}
+	if options.Name == "" {
+		options.Name = DefaultName
+	}
+	if options.FileLockPollInterval <= 0 {
+		options.FileLockPollInterval = time.Millisecond
+	}
+	x := &FileStorage{
+		options: options,
+	}
+	if err := x.Init(context.Background()); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func (x *FileStorage) GetName() string {
+	return x.options.Name
+}
+
+func (x *FileStorage) Capabilities() []storage.StorageCapability {
+	return []storage.StorageCapability{
+		storage.CapabilityCAS,
+		storage.CapabilityReliableTime,
+		storage.CapabilityAtomicDelete,
+	}
+}
+
+func (x *FileStorage) Init(ctx context.Context) error {
+	if err := os.MkdirAll(x.options.Dir, x.options.DirPerm); err != nil {
+		return err
+	}
+	return x.removeOrphanTmpFiles(ctx)
+}
+
+// 清理写锁记录的进程崩溃之后留下的临时文件
+// 临时文件只会在对应锁的文件锁之下写入和 rename，拿到文件锁之后还存在的临时文件一定是没人要的
+func (x *FileStorage) removeOrphanTmpFiles(ctx context.Context) error {
+	entries, err := os.ReadDir(x.options.Dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		index := strings.Index(entry.Name(), recordFileSuffix+tmpFileInfix)
+		if entry.IsDir() || index < 0 {
+			continue
+		}
+		tmpPath := filepath.Join(x.options.Dir, entry.Name())
+		flockPath := filepath.Join(x.options.Dir, entry.Name()[:index]+flockFileSuffix)
+		err := x.withFlock(ctx, flockPath, func() error {
+			if err := os.Remove(tmpPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *FileStorage) Get(ctx context.Context, lockId string) (string, error) {
+	// rename 是原子的，读的时候不需要加文件锁
+	value, err := x.readRecord(lockId)
+	if err != nil {
+		return "", err
+	}
+	return value.LockInformationJsonString, nil
+}
+
+func (x *FileStorage) UpdateWithVersion(ctx context.Context, lockId string, exceptedVersion, newVersion storage.Version, lockInformation *storage.LockInformation) error {
+	return x.withFileLock(ctx, lockId, func() error {
+
+		// 被更新的锁必须已经存在，否则无法更新
+		oldValue, err := x.readRecord(lockId)
+		if err != nil {
+			return err
+		}
+
+		// 乐观锁的版本必须能够对应得上，否则拒绝更新
+		if oldValue.Version != exceptedVersion {
+			return storage_lock.ErrVersionMiss
+		}
+
+		return x.writeRecord(lockId, &FileStorageValue{
+			LockId:                    lockId,
+			Version:                   newVersion,
+			LockInformationJsonString: lockInformation.ToJsonString(),
+		})
+	})
+}
+
+func (x *FileStorage) CreateWithVersion(ctx context.Context, lockId string, version storage.Version, lockInformation *storage.LockInformation) error {
+	return x.withFileLock(ctx, lockId, func() error {
+
+		// 插入的时候之前的锁不能存在，否则认为是插入失败
+		_, err := x.readRecord(lockId)
+		if err == nil {
+			return storage_lock.ErrLockAlreadyExists
+		}
+		if !errors.Is(err, storage_lock.ErrLockNotFound) {
+			return err
+		}
+
+		return x.writeRecord(lockId, &FileStorageValue{
+			LockId:                    lockId,
+			Version:                   version,
+			LockInformationJsonString: lockInformation.ToJsonString(),
+		})
+	})
+}
+
+func (x *FileStorage) DeleteWithVersion(ctx context.Context, lockId string, exceptedVersion storage.Version, lockInformation *storage.LockInformation) error {
+	return x.withFileLock(ctx, lockId, func() error {
+
+		// 被删除的锁必须已经存在，否则删除失败
+		oldValue, err := x.readRecord(lockId)
+		if err != nil {
+			return err
+		}
+
+		// 期望的版本号必须相等，否则无法删除
+		if oldValue.Version != exceptedVersion {
+			return storage_lock.ErrVersionMiss
+		}
+
+		// 只删除锁记录，.flock 文件要保留
+		if err := os.Remove(x.recordPath(lockId)); err != nil {
+			return err
+		}
+		return syncDir(x.options.Dir)
+	})
+}
+
+func (x *FileStorage) GetTime(ctx context.Context) (time.Time, error) {
+	// 同一台机器上的进程共享本机的时钟
+	return time.Now(), nil
+}
+
+func (x *FileStorage) Close(ctx context.Context) error {
+	return nil
+}
+
+func (x *FileStorage) List(ctx context.Context) (iterator.Iterator[*storage.LockInformation], error) {
+	entries, err := os.ReadDir(x.options.Dir)
+	if err != nil {
+		return nil, err
+	}
+	slice := make([]*storage.LockInformation, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), recordFileSuffix) {
+			continue
+		}
+		value, err := x.readRecordFile(filepath.Join(x.options.Dir, entry.Name()))
+		if err != nil {
+			// 列举期间被删除了
+			if errors.Is(err, storage_lock.ErrLockNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		information, err := storage_lock.DecodeLockInformation(value.LockInformationJsonString)
+		if err != nil {
+			return nil, err
+		}
+		slice = append(slice, information)
+	}
+	return iterator.FromSlice(slice), nil
+}
+
+// 在锁对应的 .flock 文件的排他锁之下执行 f
+func (x *FileStorage) withFileLock(ctx context.Context, lockId string, f func() error) error {
+	return x.withFlock(ctx, x.flockPath(lockId), f)
+}
+
+// 在给定的 .flock 文件的排他锁之下执行 f
+func (x *FileStorage) withFlock(ctx context.Context, flockPath string, f func() error) error {
+	file, err := os.OpenFile(flockPath, os.O_CREATE|os.O_RDWR, x.options.FilePerm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := lockFile(ctx, file, x.options.FileLockPollInterval); err != nil {
+		return err
+	}
+	defer unlockFile(file)
+
+	return f()
+}
+
+// 读取锁记录，不存在时返回 storage_lock.ErrLockNotFound
+func (x *FileStorage) readRecord(lockId string) (*FileStorageValue, error) {
+	return x.readRecordFile(x.recordPath(lockId))
+}
+
+func (x *FileStorage) readRecordFile(recordPath string) (*FileStorageValue, error) {
+	bytes, err := os.ReadFile(recordPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, storage_lock.ErrLockNotFound
+		}
+		return nil, err
+	}
+	value := &FileStorageValue{}
+	if err := json.Unmarshal(bytes, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// 写入锁记录：先写到同目录下的临时文件并 fsync，再 rename 覆盖，任何时刻锁记录文件要么是旧的内容要么是新的内容
+func (x *FileStorage) writeRecord(lockId string, value *FileStorageValue) (err error) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(x.options.Dir, filepath.Base(x.recordPath(lockId))+tmpFileInfix+"*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmpFile.Name())
+		}
+	}()
+
+	if _, err = tmpFile.Write(bytes); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err = tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err = tmpFile.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmpFile.Name(), x.options.FilePerm); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpFile.Name(), x.recordPath(lockId)); err != nil {
+		return err
+	}
+	return syncDir(x.options.Dir)
+}
+
+// lockId 可能包含路径分隔符等不能出现在文件名中的字符，也可能很长，统一取 sha256 的十六进制作为文件名
+func (x *FileStorage) fileName(lockId string) string {
+	sum := sha256.Sum256([]byte(lockId))
+	return hex.EncodeToString(sum[:])
+}
+
+func (x *FileStorage) recordPath(lockId string) string {
+	return filepath.Join(x.options.Dir, x.fileName(lockId)+recordFileSuffix)
+}
+
+func (x *FileStorage) flockPath(lockId string) string {
+	return filepath.Join(x.options.Dir, x.fileName(lockId)+flockFileSuffix)
+}
+
+// ------------------------------------------------ ---------------------------------------------------------------------
+
+// FileStorageValue 锁记录文件中实际存储的结构
+type FileStorageValue struct {
+
+	// 存储的是哪个锁的信息
+	LockId string `json:"lock_id"`
+
+	// 锁的版本号是多少
+	Version storage.Version `json:"version"`
+
+	// 锁的信息序列化为JSON字符串存储在这个字段
+	LockInformationJsonString string `json:"lock_information_json_string"`
+}
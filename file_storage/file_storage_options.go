@@ -0,0 +1,58 @@
+package file_storage
+
+import (
+	"os"
+	"time"
+)
+
+// FileStorageOptions 创建文件存储的相关选项
+type FileStorageOptions struct {
+
+	// 存放锁记录的目录，同一台机器上需要互斥的进程必须指向同一个目录
+	Dir string
+
+	// 存储的名字，用于在事件中区分不同的存储实例，未设置的话使用 DefaultName
+	Name string
+
+	// 创建目录和锁记录文件时使用的权限
+	DirPerm  os.FileMode
+	FilePerm os.FileMode
+
+	// 等待文件锁时轮询的间隔，为了能够响应 ctx 的取消，文件锁是以非阻塞的方式轮询获取的
+	FileLockPollInterval time.Duration
+}
+
+// NewFileStorageOptions 使用默认值创建文件存储的选项
+func NewFileStorageOptions() *FileStorageOptions {
+	return &FileStorageOptions{
+		Name:                 DefaultName,
+		DirPerm:              0755,
+		FilePerm:             0644,
+		FileLockPollInterval: time.Millisecond,
+	}
+}
+
+func (x *FileStorageOptions) SetDir(dir string) *FileStorageOptions {
+	x.Dir = dir
+	return x
+}
+
+func (x *FileStorageOptions) SetName(name string) *FileStorageOptions {
+	x.Name = name
+	return x
+}
+
+func (x *FileStorageOptions) SetDirPerm(dirPerm os.FileMode) *FileStorageOptions {
+	x.DirPerm = dirPerm
+	return x
+}
+
+func (x *FileStorageOptions) SetFilePerm(filePerm os.FileMode) *FileStorageOptions {
+	x.FilePerm = filePerm
+	return x
+}
+
+func (x *FileStorageOptions) SetFileLockPollInterval(fileLockPollInterval time.Duration) *FileStorageOptions {
+	x.FileLockPollInterval = fileLockPollInterval
+	return x
+}
@@ -0,0 +1,187 @@
+//go:build unix
+
+package file_storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFileStorage(t *testing.T, dir string) *FileStorage {
+	s, err := NewFileStorage(dir)
+	assert.Nil(t, err)
+	return s
+}
+
+func newTestFileStorageLock(t *testing.T, s storage.Storage, lockId string) *storage_lock.StorageLock {
+	options := storage_lock.NewStorageLockOptionsWithLockId(lockId).
+		SetLeaseExpireAfter(time.Second * 3).
+		SetLeaseRefreshInterval(time.Second).
+		SetVersionMissRetryInterval(time.Millisecond * 5)
+	lock, err := storage_lock.NewStorageLockWithOptions(s, options)
+	assert.Nil(t, err)
+	return lock
+}
+
+func TestFileStorage_CRUD(t *testing.T) {
+	ctx := context.Background()
+	s := newTestFileStorage(t, t.TempDir())
+	// 包含路径分隔符的 lockId 也要能正常存储
+	information := &storage.LockInformation{LockId: "test/file-storage", OwnerId: "owner", Version: 1, LockCount: 1}
+
+	_, err := s.Get(ctx, information.LockId)
+	assert.ErrorIs(t, err, storage_lock.ErrLockNotFound)
+
+	assert.Nil(t, s.CreateWithVersion(ctx, information.LockId, 1, information))
+	assert.ErrorIs(t, s.CreateWithVersion(ctx, information.LockId, 1, information), storage_lock.ErrLockAlreadyExists)
+
+	assert.ErrorIs(t, s.UpdateWithVersion(ctx, information.LockId, 2, 3, information), storage_lock.ErrVersionMiss)
+	information.Version = 2
+	assert.Nil(t, s.UpdateWithVersion(ctx, information.LockId, 1, 2, information))
+
+	lockInformationJsonString, err := s.Get(ctx, information.LockId)
+	assert.Nil(t, err)
+	assert.Equal(t, information.ToJsonString(), lockInformationJsonString)
+
+	iterator, err := s.List(ctx)
+	assert.Nil(t, err)
+	count := 0
+	for iterator.Next() {
+		assert.Equal(t, information.LockId, iterator.Value().LockId)
+		count++
+	}
+	assert.Equal(t, 1, count)
+
+	assert.ErrorIs(t, s.DeleteWithVersion(ctx, information.LockId, 1, information), storage_lock.ErrVersionMiss)
+	assert.Nil(t, s.DeleteWithVersion(ctx, information.LockId, 2, information))
+	assert.ErrorIs(t, s.DeleteWithVersion(ctx, information.LockId, 2, information), storage_lock.ErrLockNotFound)
+}
+
+// 很长的 lockId 也不会超出文件名的长度限制
+func TestFileStorage_LongLockId(t *testing.T) {
+	ctx := context.Background()
+	s := newTestFileStorage(t, t.TempDir())
+	information := &storage.LockInformation{LockId: strings.Repeat("test-long-lock-id-", 100), OwnerId: "owner", Version: 1, LockCount: 1}
+
+	assert.Nil(t, s.CreateWithVersion(ctx, information.LockId, 1, information))
+	lockInformationJsonString, err := s.Get(ctx, information.LockId)
+	assert.Nil(t, err)
+	assert.Equal(t, information.ToJsonString(), lockInformationJsonString)
+
+	iterator, err := s.List(ctx)
+	assert.Nil(t, err)
+	assert.True(t, iterator.Next())
+	assert.Equal(t, information.LockId, iterator.Value().LockId)
+	assert.Nil(t, s.DeleteWithVersion(ctx, information.LockId, 1, information))
+}
+
+// 进程在 rename 之前崩溃留下的临时文件在 Init 的时候被清理掉
+func TestFileStorage_RemoveOrphanTmpFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := newTestFileStorage(t, dir)
+	information := &storage.LockInformation{LockId: "test-orphan-tmp", OwnerId: "owner", Version: 1, LockCount: 1}
+	assert.Nil(t, s.CreateWithVersion(ctx, information.LockId, 1, information))
+
+	tmpPath := s.recordPath(information.LockId) + tmpFileInfix + "123456"
+	assert.Nil(t, os.WriteFile(tmpPath, []byte("{"), 0644))
+	otherPath := filepath.Join(dir, "other-file")
+	assert.Nil(t, os.WriteFile(otherPath, []byte("other"), 0644))
+
+	s = newTestFileStorage(t, dir)
+	_, err := os.Stat(tmpPath)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(otherPath)
+	assert.Nil(t, err)
+	lockInformationJsonString, err := s.Get(ctx, information.LockId)
+	assert.Nil(t, err)
+	assert.Equal(t, information.ToJsonString(), lockInformationJsonString)
+}
+
+func TestFileStorage_LockUnlock(t *testing.T) {
+	ctx := context.Background()
+	s := newTestFileStorage(t, t.TempDir())
+	lock := newTestFileStorageLock(t, s, "test-file-storage-lock")
+
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+
+	_, err := s.Get(ctx, "test-file-storage-lock")
+	assert.ErrorIs(t, err, storage_lock.ErrLockNotFound)
+}
+
+// 隐藏原子条件删除能力，让 StorageLock 走写墓碑的流程
+type testTombstoneFileStorage struct {
+	*FileStorage
+}
+
+func (x *testTombstoneFileStorage) Capabilities() []storage.StorageCapability {
+	return []storage.StorageCapability{storage.CapabilityCAS, storage.CapabilityReliableTime}
+}
+
+func TestFileStorage_Tombstone(t *testing.T) {
+	ctx := context.Background()
+	s := &testTombstoneFileStorage{FileStorage: newTestFileStorage(t, t.TempDir())}
+	lock := newTestFileStorageLock(t, s, "test-file-storage-tombstone")
+
+	assert.Nil(t, lock.Lock(ctx, "owner-a"))
+	assert.Nil(t, lock.UnLock(ctx, "owner-a"))
+
+	lockInformationJsonString, err := s.Get(ctx, "test-file-storage-tombstone")
+	assert.Nil(t, err)
+	information, err := storage.LockInformationFromJsonString(lockInformationJsonString)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, information.LockCount)
+
+	// 墓碑上可以直接重新获取锁
+	assert.Nil(t, lock.Lock(ctx, "owner-b"))
+	assert.Nil(t, lock.UnLock(ctx, "owner-b"))
+}
+
+// 多个 FileStorage 实例指向同一个目录，模拟同一台机器上的多个进程
+func TestFileStorage_MutualExclusion(t *testing.T) {
+	dir := t.TempDir()
+
+	// 临界区内同时只能有一个持有者，用原子变量统计是因为 race 检测感知不到文件锁建立的先后关系
+	var inside, counter int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := context.Background()
+			lock := newTestFileStorageLock(t, newTestFileStorage(t, dir), "test-file-storage-mutual-exclusion")
+			for j := 0; j < 10; j++ {
+				ownerId := storage_lock.NewOwnerIdGenerator().GenOwnerId()
+				assert.Nil(t, lock.Lock(ctx, ownerId))
+				assert.Equal(t, int32(1), atomic.AddInt32(&inside, 1))
+				atomic.AddInt32(&counter, 1)
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&inside, -1)
+				assert.Nil(t, lock.UnLock(ctx, ownerId))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(50), atomic.LoadInt32(&counter))
+}
+
+func TestFileStorage_Conformance(t *testing.T) {
+	dir := t.TempDir()
+	storagetest.RunConformance(t, func() storage.Storage {
+		return newTestFileStorage(t, dir)
+	})
+}
@@ -0,0 +1,50 @@
+package storage_lock
+
+import (
+	"context"
+	"github.com/storage-lock/go-events"
+	"time"
+)
+
+// LeaseContinuityViolation 租约连续性被破坏的详情
+//
+// 看门狗醒来时发现本地时间已经越过了最近一次确认过的租约截止时间，说明在这段时间里锁的租约是过期的，
+// 其他人可以合法地获取锁。即使之后续租成功（没有人趁机抢锁），这段时间里被保护资源的互斥性也已经无法保证了，
+// 持有者应当中止或者重新校验当前的临界区。
+type LeaseContinuityViolation struct {
+
+	// 哪个锁的租约出现了断档
+	LockId string
+
+	// 锁的持有者
+	OwnerId string
+
+	// 发现断档的看门狗
+	WatchDogId string
+
+	// 最近一次确认过的租约截止时间（本地单调时钟）
+	LeaseDeadline time.Time
+
+	// 发现断档的时间（本地单调时钟）
+	DetectTime time.Time
+
+	// 超出租约截止时间多久
+	Overdue time.Duration
+}
+
+// LeaseContinuityViolationHandler 租约出现断档时的回调，在看门狗协程中同步执行，不要在里面做耗时的操作
+type LeaseContinuityViolationHandler func(ctx context.Context, violation *LeaseContinuityViolation)
+
+// reportLeaseContinuityViolation 把租约断档通知给持有者：发送事件，并回调 options 中设置的处理函数
+func (x *StorageLock) reportLeaseContinuityViolation(ctx context.Context, e *events.Event, violation *LeaseContinuityViolation) {
+
+	action := events.NewAction(ActionWatchDogLeaseContinuityViolation).
+		SetErr(ErrLeaseContinuityViolated).
+		AddPayload(PayloadLeaseDeadline, violation.LeaseDeadline).
+		AddPayload(PayloadOverdue, violation.Overdue)
+	e.AddAction(action).Publish(ctx)
+
+	if x.options.OnLeaseContinuityViolation != nil {
+		x.options.OnLeaseContinuityViolation(ctx, violation)
+	}
+}
@@ -0,0 +1,187 @@
+package storage_lock
+
+import (
+	"fmt"
+	go_storage "github.com/storage-lock/go-storage"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// LockInformationCodec 锁信息的编码方式，决定了 LockInformation 在存储中是以什么格式保存的
+//
+// 默认情况下存储中保存的是 LockInformation.ToJsonString() 的输出，JSON 可读性好，但是体积比较大，
+// 每次续租都要解析一遍也比较耗 CPU。对存储的值大小有限制或者对性能比较敏感的话可以换成更紧凑的编码，
+// 写入时使用哪种编码由存储实现决定（比如 memory_storage 的 Codec 选项），
+// 读取时锁会通过 DecodeLockInformation 自动识别编码，同一个存储中可以同时存在不同编码的记录，
+// 不同版本的实例混合部署的时候可以逐步迁移：先让所有的实例都升级到能识别新编码的版本，再让存储开始使用新编码写入。
+//
+// 内置了三种编码：
+//   - JSON（LockInformationCodecJSONName）：与 LockInformation.ToJsonString() 完全兼容
+//   - 紧凑二进制（LockInformationCodecBinaryName）：变长整数编码，体积最小，解码最快，但是不可读，需要存储能够保存任意字节
+//   - MessagePack（LockInformationCodecMsgpackName）：字段名与 JSON 相同的 MessagePack map，其它语言也能方便的解析
+//
+// 第三方的编码可以通过 RegisterLockInformationCodec 注册，注册之后就能被自动识别了。
+type LockInformationCodec interface {
+
+	// Name 编码的名字，全局唯一
+	Name() string
+
+	// Encode 把锁信息编码为存储中保存的字符串
+	Encode(lockInformation *go_storage.LockInformation) (string, error)
+
+	// Decode 把存储中保存的字符串解码为锁信息
+	Decode(lockInformationString string) (*go_storage.LockInformation, error)
+
+	// Recognize 给定的字符串是不是这种编码的输出，只需要看开头的几个字节，不同编码之间的识别规则不能有重叠
+	Recognize(lockInformationString string) bool
+}
+
+var (
+	lockInformationCodecRegistry   = make(map[string]LockInformationCodec)
+	lockInformationCodecRegistryMu sync.RWMutex
+
+	// 识别编码时使用的快照，每次解码都要识别一次，所以在注册和移除编码的时候就整理好，识别的时候不用加锁
+	lockInformationCodecDetector atomic.Value
+)
+
+// 识别编码用的快照
+type lockInformationCodecDetectorSnapshot struct {
+
+	// 按名字排好序的所有编码，保证识别的结果是确定的
+	codecs []LockInformationCodec
+
+	// 内置的 JSON 编码，绝大多数的记录都是 JSON，看一下第一个字节就能确定，不用挨个识别
+	json LockInformationCodec
+}
+
+func init() {
+	MustRegisterLockInformationCodec(NewLockInformationCodecJSON())
+	MustRegisterLockInformationCodec(NewLockInformationCodecBinary())
+	MustRegisterLockInformationCodec(NewLockInformationCodecMsgpack())
+}
+
+// RegisterLockInformationCodec 把编码按它的名字注册到全局的注册表中，注册之后 DecodeLockInformation 就能识别这种编码了
+// 名字不能为空，也不能与已经注册过的编码重名，否则返回错误
+func RegisterLockInformationCodec(codec LockInformationCodec) error {
+	if codec == nil || codec.Name() == "" {
+		return ErrLockInformationCodecNameEmpty
+	}
+
+	lockInformationCodecRegistryMu.Lock()
+	defer lockInformationCodecRegistryMu.Unlock()
+
+	name := codec.Name()
+	if _, exists := lockInformationCodecRegistry[name]; exists {
+		return fmt.Errorf("%w: %s", ErrLockInformationCodecAlreadyRegistered, name)
+	}
+	lockInformationCodecRegistry[name] = codec
+	rebuildLockInformationCodecDetector()
+	return nil
+}
+
+// MustRegisterLockInformationCodec 注册编码，注册失败的话直接panic，适合在 init 中使用
+func MustRegisterLockInformationCodec(codec LockInformationCodec) {
+	if err := RegisterLockInformationCodec(codec); err != nil {
+		panic(err)
+	}
+}
+
+// UnregisterLockInformationCodec 从注册表中移除给定名字的编码，返回之前是否注册过
+func UnregisterLockInformationCodec(name string) bool {
+	lockInformationCodecRegistryMu.Lock()
+	defer lockInformationCodecRegistryMu.Unlock()
+
+	_, exists := lockInformationCodecRegistry[name]
+	delete(lockInformationCodecRegistry, name)
+	rebuildLockInformationCodecDetector()
+	return exists
+}
+
+// 根据注册表重新生成识别编码用的快照，调用前要持有 lockInformationCodecRegistryMu 的写锁
+func rebuildLockInformationCodecDetector() {
+	snapshot := &lockInformationCodecDetectorSnapshot{
+		codecs: make([]LockInformationCodec, 0, len(lockInformationCodecRegistry)),
+	}
+	for _, codec := range lockInformationCodecRegistry {
+		snapshot.codecs = append(snapshot.codecs, codec)
+		if json, ok := codec.(*LockInformationCodecJSON); ok {
+			snapshot.json = json
+		}
+	}
+	sort.Slice(snapshot.codecs, func(i, j int) bool {
+		return snapshot.codecs[i].Name() < snapshot.codecs[j].Name()
+	})
+	lockInformationCodecDetector.Store(snapshot)
+}
+
+// GetLockInformationCodec 根据名字查找已经注册的编码，未找到时返回 ErrLockInformationCodecNotFound
+func GetLockInformationCodec(name string) (LockInformationCodec, error) {
+	lockInformationCodecRegistryMu.RLock()
+	defer lockInformationCodecRegistryMu.RUnlock()
+
+	codec, exists := lockInformationCodecRegistry[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrLockInformationCodecNotFound, name)
+	}
+	return codec, nil
+}
+
+// DetectLockInformationCodec 识别给定的字符串是用哪种已经注册的编码编码的
+func DetectLockInformationCodec(lockInformationString string) (LockInformationCodec, error) {
+	snapshot, _ := lockInformationCodecDetector.Load().(*lockInformationCodecDetectorSnapshot)
+	if snapshot == nil {
+		return nil, ErrLockInformationCodecUnknown
+	}
+
+	if snapshot.json != nil && len(lockInformationString) > 0 && lockInformationString[0] == '{' {
+		return snapshot.json, nil
+	}
+	for _, codec := range snapshot.codecs {
+		if codec.Recognize(lockInformationString) {
+			return codec, nil
+		}
+	}
+	return nil, ErrLockInformationCodecUnknown
+}
+
+// DecodeLockInformation 自动识别编码并解码存储中保存的锁信息，读取锁信息的地方都应该使用它而不是直接解析 JSON
+func DecodeLockInformation(lockInformationString string) (*go_storage.LockInformation, error) {
+	codec, err := DetectLockInformationCodec(lockInformationString)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Decode(lockInformationString)
+}
+
+// ------------------------------------------------- --------------------------------------------------------------------
+
+// LockInformationCodecJSONName JSON 编码的名字
+const LockInformationCodecJSONName = "json"
+
+// LockInformationCodecJSON JSON 编码，与 LockInformation.ToJsonString() 完全兼容
+type LockInformationCodecJSON struct {
+}
+
+var _ LockInformationCodec = &LockInformationCodecJSON{}
+
+func NewLockInformationCodecJSON() *LockInformationCodecJSON {
+	return &LockInformationCodecJSON{}
+}
+
+func (x *LockInformationCodecJSON) Name() string {
+	return LockInformationCodecJSONName
+}
+
+func (x *LockInformationCodecJSON) Encode(lockInformation *go_storage.LockInformation) (string, error) {
+	return lockInformation.ToJsonString(), nil
+}
+
+func (x *LockInformationCodecJSON) Decode(lockInformationString string) (*go_storage.LockInformation, error) {
+	return go_storage.LockInformationFromJsonString(lockInformationString)
+}
+
+func (x *LockInformationCodecJSON) Recognize(lockInformationString string) bool {
+	return strings.HasPrefix(strings.TrimLeft(lockInformationString, " \t\r\n"), "{")
+}
@@ -0,0 +1,139 @@
+package storage_lock
+
+import (
+	"encoding/binary"
+	"fmt"
+	go_storage "github.com/storage-lock/go-storage"
+	"strings"
+	"time"
+)
+
+// LockInformationCodecBinaryName 紧凑二进制编码的名字
+const LockInformationCodecBinaryName = "binary"
+
+// 紧凑二进制编码的魔数，以 0x00 开头，不会与 JSON 和 MessagePack 的 map 混淆，最后一个字节是格式的版本号
+const lockInformationCodecBinaryMagic = "\x00SL\x01"
+
+// LockInformationCodecBinary 紧凑二进制编码，格式为：
+//
+//	魔数 | LockId长度 LockId | OwnerId长度 OwnerId | Version | LockCount | LockBeginTime | LeaseExpireTime
+//
+// 长度和 Version 使用 uvarint，LockCount 使用 varint，时间编码为 varint 的 Unix 秒数加上 uvarint 的纳秒数，解码出来的时间都是 UTC 的。
+// 编码的结果中会出现任意字节，只能用在能够原样保存二进制内容的存储上
+type LockInformationCodecBinary struct {
+}
+
+var _ LockInformationCodec = &LockInformationCodecBinary{}
+
+func NewLockInformationCodecBinary() *LockInformationCodecBinary {
+	return &LockInformationCodecBinary{}
+}
+
+func (x *LockInformationCodecBinary) Name() string {
+	return LockInformationCodecBinaryName
+}
+
+func (x *LockInformationCodecBinary) Encode(lockInformation *go_storage.LockInformation) (string, error) {
+	buff := make([]byte, 0, len(lockInformationCodecBinaryMagic)+len(lockInformation.LockId)+len(lockInformation.OwnerId)+binary.MaxVarintLen64*8)
+	buff = append(buff, lockInformationCodecBinaryMagic...)
+	buff = binary.AppendUvarint(buff, uint64(len(lockInformation.LockId)))
+	buff = append(buff, lockInformation.LockId...)
+	buff = binary.AppendUvarint(buff, uint64(len(lockInformation.OwnerId)))
+	buff = append(buff, lockInformation.OwnerId...)
+	buff = binary.AppendUvarint(buff, uint64(lockInformation.Version))
+	buff = binary.AppendVarint(buff, int64(lockInformation.LockCount))
+	buff = appendBinaryTime(buff, lockInformation.LockBeginTime)
+	buff = appendBinaryTime(buff, lockInformation.LeaseExpireTime)
+	return string(buff), nil
+}
+
+func appendBinaryTime(buff []byte, t time.Time) []byte {
+	buff = binary.AppendVarint(buff, t.Unix())
+	return binary.AppendUvarint(buff, uint64(t.Nanosecond()))
+}
+
+func (x *LockInformationCodecBinary) Decode(lockInformationString string) (*go_storage.LockInformation, error) {
+	if !x.Recognize(lockInformationString) {
+		return nil, fmt.Errorf("%w: binary magic missing", ErrLockInformationCorrupted)
+	}
+	reader := &binaryReader{buff: []byte(lockInformationString[len(lockInformationCodecBinaryMagic):])}
+	lockInformation := &go_storage.LockInformation{
+		LockId:  reader.readString(),
+		OwnerId: reader.readString(),
+		Version: go_storage.Version(reader.readUvarint()),
+	}
+	lockInformation.LockCount = int(reader.readVarint())
+	lockInformation.LockBeginTime = reader.readTime()
+	lockInformation.LeaseExpireTime = reader.readTime()
+	if reader.err != nil {
+		return nil, reader.err
+	}
+	if len(reader.buff) != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrLockInformationCorrupted, len(reader.buff))
+	}
+	return lockInformation, nil
+}
+
+func (x *LockInformationCodecBinary) Recognize(lockInformationString string) bool {
+	return strings.HasPrefix(lockInformationString, lockInformationCodecBinaryMagic)
+}
+
+// 按顺序读取二进制编码的各个字段，遇到第一个错误之后后续的读取都返回零值，最后统一检查 err
+type binaryReader struct {
+	buff []byte
+	err  error
+}
+
+func (x *binaryReader) fail(field string) {
+	if x.err == nil {
+		x.err = fmt.Errorf("%w: bad %s", ErrLockInformationCorrupted, field)
+	}
+	x.buff = nil
+}
+
+func (x *binaryReader) readUvarint() uint64 {
+	value, n := binary.Uvarint(x.buff)
+	if n <= 0 {
+		x.fail("uvarint")
+		return 0
+	}
+	x.buff = x.buff[n:]
+	return value
+}
+
+func (x *binaryReader) readVarint() int64 {
+	value, n := binary.Varint(x.buff)
+	if n <= 0 {
+		x.fail("varint")
+		return 0
+	}
+	x.buff = x.buff[n:]
+	return value
+}
+
+func (x *binaryReader) readString() string {
+	length := x.readUvarint()
+	if x.err != nil {
+		return ""
+	}
+	if length > uint64(len(x.buff)) {
+		x.fail("string length")
+		return ""
+	}
+	s := string(x.buff[:length])
+	x.buff = x.buff[length:]
+	return s
+}
+
+func (x *binaryReader) readTime() time.Time {
+	seconds := x.readVarint()
+	nanoseconds := x.readUvarint()
+	if x.err != nil {
+		return time.Time{}
+	}
+	if nanoseconds >= uint64(time.Second) {
+		x.fail("time nanoseconds")
+		return time.Time{}
+	}
+	return time.Unix(seconds, int64(nanoseconds)).UTC()
+}
@@ -0,0 +1,399 @@
+package storage_lock
+
+import (
+	"encoding/binary"
+	"fmt"
+	go_storage "github.com/storage-lock/go-storage"
+	"math"
+	"time"
+)
+
+// LockInformationCodecMsgpackName MessagePack 编码的名字
+const LockInformationCodecMsgpackName = "msgpack"
+
+// MessagePack 中时间戳扩展类型的类型编号
+const msgpackTimestampExtType = -1
+
+// LockInformationCodecMsgpack MessagePack 编码，锁信息编码为一个 map，key 与 JSON 编码的字段名相同，
+// 时间使用 MessagePack 标准的时间戳扩展类型（-1），其它语言的 MessagePack 库可以直接解析。
+// 这里只实现了锁信息用得到的那一部分 MessagePack，不引入额外的依赖；解码时不认识的 key 会被跳过，方便以后增加字段
+type LockInformationCodecMsgpack struct {
+}
+
+var _ LockInformationCodec = &LockInformationCodecMsgpack{}
+
+func NewLockInformationCodecMsgpack() *LockInformationCodecMsgpack {
+	return &LockInformationCodecMsgpack{}
+}
+
+func (x *LockInformationCodecMsgpack) Name() string {
+	return LockInformationCodecMsgpackName
+}
+
+func (x *LockInformationCodecMsgpack) Encode(lockInformation *go_storage.LockInformation) (string, error) {
+	buff := make([]byte, 0, 128+len(lockInformation.LockId)+len(lockInformation.OwnerId))
+	// fixmap，6 个字段
+	buff = append(buff, 0x80|6)
+	buff = appendMsgpackString(buff, "lock_id")
+	buff = appendMsgpackString(buff, lockInformation.LockId)
+	buff = appendMsgpackString(buff, "owner_id")
+	buff = appendMsgpackString(buff, lockInformation.OwnerId)
+	buff = appendMsgpackString(buff, "version")
+	buff = appendMsgpackUint(buff, uint64(lockInformation.Version))
+	buff = appendMsgpackString(buff, "lock_count")
+	buff = appendMsgpackInt(buff, int64(lockInformation.LockCount))
+	buff = appendMsgpackString(buff, "lock_begin_time")
+	buff = appendMsgpackTime(buff, lockInformation.LockBeginTime)
+	buff = appendMsgpackString(buff, "lease_expire_time")
+	buff = appendMsgpackTime(buff, lockInformation.LeaseExpireTime)
+	return string(buff), nil
+}
+
+func (x *LockInformationCodecMsgpack) Decode(lockInformationString string) (*go_storage.LockInformation, error) {
+	reader := &msgpackReader{buff: []byte(lockInformationString)}
+	size := reader.readMapHeader()
+	lockInformation := &go_storage.LockInformation{}
+	for i := 0; i < size && reader.err == nil; i++ {
+		switch key := reader.readString(); key {
+		case "lock_id":
+			lockInformation.LockId = reader.readString()
+		case "owner_id":
+			lockInformation.OwnerId = reader.readString()
+		case "version":
+			lockInformation.Version = go_storage.Version(reader.readUint())
+		case "lock_count":
+			lockInformation.LockCount = int(reader.readInt())
+		case "lock_begin_time":
+			lockInformation.LockBeginTime = reader.readTime()
+		case "lease_expire_time":
+			lockInformation.LeaseExpireTime = reader.readTime()
+		default:
+			reader.skip()
+		}
+	}
+	if reader.err != nil {
+		return nil, reader.err
+	}
+	if len(reader.buff) != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrLockInformationCorrupted, len(reader.buff))
+	}
+	return lockInformation, nil
+}
+
+// Recognize 以 MessagePack 的 map 开头（fixmap、map16、map32）
+func (x *LockInformationCodecMsgpack) Recognize(lockInformationString string) bool {
+	if lockInformationString == "" {
+		return false
+	}
+	first := lockInformationString[0]
+	return first&0xf0 == 0x80 || first == 0xde || first == 0xdf
+}
+
+// ------------------------------------------------- --------------------------------------------------------------------
+
+func appendMsgpackString(buff []byte, s string) []byte {
+	switch length := len(s); {
+	case length < 32:
+		buff = append(buff, 0xa0|byte(length))
+	case length <= math.MaxUint8:
+		buff = append(buff, 0xd9, byte(length))
+	case length <= math.MaxUint16:
+		buff = append(buff, 0xda)
+		buff = binary.BigEndian.AppendUint16(buff, uint16(length))
+	default:
+		buff = append(buff, 0xdb)
+		buff = binary.BigEndian.AppendUint32(buff, uint32(length))
+	}
+	return append(buff, s...)
+}
+
+func appendMsgpackUint(buff []byte, value uint64) []byte {
+	switch {
+	case value < 128:
+		return append(buff, byte(value))
+	case value <= math.MaxUint8:
+		return append(buff, 0xcc, byte(value))
+	case value <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buff, 0xcd), uint16(value))
+	case value <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buff, 0xce), uint32(value))
+	default:
+		return binary.BigEndian.AppendUint64(append(buff, 0xcf), value)
+	}
+}
+
+func appendMsgpackInt(buff []byte, value int64) []byte {
+	if value >= 0 {
+		return appendMsgpackUint(buff, uint64(value))
+	}
+	switch {
+	case value >= -32:
+		return append(buff, byte(value))
+	case value >= math.MinInt8:
+		return append(buff, 0xd0, byte(value))
+	case value >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(buff, 0xd1), uint16(value))
+	case value >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(buff, 0xd2), uint32(value))
+	default:
+		return binary.BigEndian.AppendUint64(append(buff, 0xd3), uint64(value))
+	}
+}
+
+// 按 MessagePack 规范选择最短的时间戳格式：timestamp 32、timestamp 64 或者 timestamp 96
+func appendMsgpackTime(buff []byte, t time.Time) []byte {
+	seconds, nanoseconds := t.Unix(), uint64(t.Nanosecond())
+	if uint64(seconds)>>34 == 0 {
+		data := nanoseconds<<34 | uint64(seconds)
+		if data&0xffffffff00000000 == 0 {
+			buff = append(buff, 0xd6, byte(msgpackTimestampExtType&0xff))
+			return binary.BigEndian.AppendUint32(buff, uint32(data))
+		}
+		buff = append(buff, 0xd7, byte(msgpackTimestampExtType&0xff))
+		return binary.BigEndian.AppendUint64(buff, data)
+	}
+	buff = append(buff, 0xc7, 12, byte(msgpackTimestampExtType&0xff))
+	buff = binary.BigEndian.AppendUint32(buff, uint32(nanoseconds))
+	return binary.BigEndian.AppendUint64(buff, uint64(seconds))
+}
+
+// ------------------------------------------------- --------------------------------------------------------------------
+
+// 按顺序读取 MessagePack 编码的值，遇到第一个错误之后后续的读取都返回零值，最后统一检查 err
+type msgpackReader struct {
+	buff []byte
+	err  error
+}
+
+func (x *msgpackReader) fail(format string, args ...any) {
+	if x.err == nil {
+		x.err = fmt.Errorf("%w: %s", ErrLockInformationCorrupted, fmt.Sprintf(format, args...))
+	}
+	x.buff = nil
+}
+
+func (x *msgpackReader) next(n int) []byte {
+	if x.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(x.buff) {
+		x.fail("unexpected end of msgpack")
+		return nil
+	}
+	bytes := x.buff[:n]
+	x.buff = x.buff[n:]
+	return bytes
+}
+
+func (x *msgpackReader) readByte() byte {
+	bytes := x.next(1)
+	if bytes == nil {
+		return 0
+	}
+	return bytes[0]
+}
+
+func (x *msgpackReader) readUint16() uint64 {
+	if bytes := x.next(2); bytes != nil {
+		return uint64(binary.BigEndian.Uint16(bytes))
+	}
+	return 0
+}
+
+func (x *msgpackReader) readUint32() uint64 {
+	if bytes := x.next(4); bytes != nil {
+		return uint64(binary.BigEndian.Uint32(bytes))
+	}
+	return 0
+}
+
+func (x *msgpackReader) readUint64() uint64 {
+	if bytes := x.next(8); bytes != nil {
+		return binary.BigEndian.Uint64(bytes)
+	}
+	return 0
+}
+
+func (x *msgpackReader) readMapHeader() int {
+	switch b := x.readByte(); {
+	case x.err != nil:
+		return 0
+	case b&0xf0 == 0x80:
+		return int(b & 0x0f)
+	case b == 0xde:
+		return int(x.readUint16())
+	case b == 0xdf:
+		return int(x.readUint32())
+	default:
+		x.fail("expect map, got 0x%02x", b)
+		return 0
+	}
+}
+
+func (x *msgpackReader) readString() string {
+	var length uint64
+	switch b := x.readByte(); {
+	case x.err != nil:
+		return ""
+	case b&0xe0 == 0xa0:
+		length = uint64(b & 0x1f)
+	case b == 0xd9:
+		length = uint64(x.readByte())
+	case b == 0xda:
+		length = x.readUint16()
+	case b == 0xdb:
+		length = x.readUint32()
+	default:
+		x.fail("expect string, got 0x%02x", b)
+		return ""
+	}
+	return string(x.next(int(length)))
+}
+
+func (x *msgpackReader) readUint() uint64 {
+	value := x.readInteger()
+	if value < 0 {
+		x.fail("expect unsigned integer, got %d", value)
+		return 0
+	}
+	return uint64(value)
+}
+
+func (x *msgpackReader) readInt() int64 {
+	return x.readInteger()
+}
+
+// 读取一个整数，uint64 中超出 int64 范围的值会被当做错误，锁信息中用不到这么大的数
+func (x *msgpackReader) readInteger() int64 {
+	switch b := x.readByte(); {
+	case x.err != nil:
+		return 0
+	case b < 0x80:
+		return int64(b)
+	case b >= 0xe0:
+		return int64(int8(b))
+	case b == 0xcc:
+		return int64(x.readByte())
+	case b == 0xcd:
+		return int64(x.readUint16())
+	case b == 0xce:
+		return int64(x.readUint32())
+	case b == 0xcf:
+		value := x.readUint64()
+		if value > math.MaxInt64 {
+			x.fail("integer overflow")
+			return 0
+		}
+		return int64(value)
+	case b == 0xd0:
+		return int64(int8(x.readByte()))
+	case b == 0xd1:
+		return int64(int16(x.readUint16()))
+	case b == 0xd2:
+		return int64(int32(x.readUint32()))
+	case b == 0xd3:
+		return int64(x.readUint64())
+	case b == 0xc0:
+		// nil 当做零值
+		return 0
+	default:
+		x.fail("expect integer, got 0x%02x", b)
+		return 0
+	}
+}
+
+func (x *msgpackReader) readTime() time.Time {
+	var length uint64
+	switch b := x.readByte(); {
+	case x.err != nil:
+		return time.Time{}
+	case b == 0xc0:
+		return time.Time{}
+	case b == 0xd6:
+		length = 4
+	case b == 0xd7:
+		length = 8
+	case b == 0xc7:
+		length = uint64(x.readByte())
+	default:
+		x.fail("expect timestamp, got 0x%02x", b)
+		return time.Time{}
+	}
+	if extType := int8(x.readByte()); x.err == nil && extType != msgpackTimestampExtType {
+		x.fail("expect timestamp ext type, got %d", extType)
+		return time.Time{}
+	}
+	var seconds, nanoseconds int64
+	switch length {
+	case 4:
+		seconds = int64(x.readUint32())
+	case 8:
+		data := x.readUint64()
+		seconds, nanoseconds = int64(data&0x3ffffffff), int64(data>>34)
+	case 12:
+		nanoseconds = int64(x.readUint32())
+		seconds = int64(x.readUint64())
+	default:
+		x.fail("bad timestamp length %d", length)
+	}
+	if x.err != nil {
+		return time.Time{}
+	}
+	if nanoseconds >= int64(time.Second) {
+		x.fail("bad timestamp nanoseconds %d", nanoseconds)
+		return time.Time{}
+	}
+	return time.Unix(seconds, nanoseconds).UTC()
+}
+
+// 跳过一个不认识的值
+func (x *msgpackReader) skip() {
+	switch b := x.readByte(); {
+	case x.err != nil:
+	case b < 0x80 || b >= 0xe0 || b == 0xc0 || b == 0xc2 || b == 0xc3:
+	case b&0xf0 == 0x80:
+		x.skipN(2 * int(b&0x0f))
+	case b&0xf0 == 0x90:
+		x.skipN(int(b & 0x0f))
+	case b&0xe0 == 0xa0:
+		x.next(int(b & 0x1f))
+	case b == 0xcc || b == 0xd0:
+		x.next(1)
+	case b == 0xcd || b == 0xd1:
+		x.next(2)
+	case b == 0xce || b == 0xd2 || b == 0xca:
+		x.next(4)
+	case b == 0xcf || b == 0xd3 || b == 0xcb:
+		x.next(8)
+	case b == 0xd9 || b == 0xc4:
+		x.next(int(x.readByte()))
+	case b == 0xda || b == 0xc5:
+		x.next(int(x.readUint16()))
+	case b == 0xdb || b == 0xc6:
+		x.next(int(x.readUint32()))
+	case b == 0xd4 || b == 0xd5 || b == 0xd6 || b == 0xd7 || b == 0xd8:
+		x.next(1 + 1<<(b-0xd4))
+	case b == 0xc7:
+		x.next(1 + int(x.readByte()))
+	case b == 0xc8:
+		x.next(1 + int(x.readUint16()))
+	case b == 0xc9:
+		x.next(1 + int(x.readUint32()))
+	case b == 0xdc:
+		x.skipN(int(x.readUint16()))
+	case b == 0xdd:
+		x.skipN(int(x.readUint32()))
+	case b == 0xde:
+		x.skipN(2 * int(x.readUint16()))
+	case b == 0xdf:
+		x.skipN(2 * int(x.readUint32()))
+	default:
+		x.fail("unsupported msgpack type 0x%02x", b)
+	}
+}
+
+func (x *msgpackReader) skipN(n int) {
+	for i := 0; i < n && x.err == nil; i++ {
+		x.skip()
+	}
+}
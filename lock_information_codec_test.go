@@ -0,0 +1,198 @@
+package storage_lock_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/storage-lock/go-storage-lock/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCodecLockInformation() *storage.LockInformation {
+	now := time.Now()
+	return &storage.LockInformation{
+		LockId:          "test-codec-lock",
+		OwnerId:         "owner@storage-lock-session-1#sig:abcdef",
+		Version:         1 << 40,
+		LockCount:       3,
+		LockBeginTime:   now,
+		LeaseExpireTime: now.Add(time.Minute),
+	}
+}
+
+func assertLockInformationEqual(t *testing.T, expected, actual *storage.LockInformation) {
+	assert.Equal(t, expected.LockId, actual.LockId)
+	assert.Equal(t, expected.OwnerId, actual.OwnerId)
+	assert.Equal(t, expected.Version, actual.Version)
+	assert.Equal(t, expected.LockCount, actual.LockCount)
+	assert.True(t, expected.LockBeginTime.Equal(actual.LockBeginTime), "%s != %s", expected.LockBeginTime, actual.LockBeginTime)
+	assert.True(t, expected.LeaseExpireTime.Equal(actual.LeaseExpireTime), "%s != %s", expected.LeaseExpireTime, actual.LeaseExpireTime)
+}
+
+// 每种编码都能无损的往返，并且能被自动识别出来
+func TestLockInformationCodec_RoundTrip(t *testing.T) {
+	tombstone := &storage.LockInformation{LockId: "test-codec-lock", Version: 7, LeaseExpireTime: time.Unix(1700000000, 0)}
+	negative := &storage.LockInformation{LockId: string(make([]byte, 300)), LockCount: -100000, LockBeginTime: time.Unix(1<<35, 999999999)}
+	for _, name := range []string{storage_lock.LockInformationCodecJSONName, storage_lock.LockInformationCodecBinaryName, storage_lock.LockInformationCodecMsgpackName} {
+		codec, err := storage_lock.GetLockInformationCodec(name)
+		assert.Nil(t, err)
+		for _, information := range []*storage.LockInformation{newTestCodecLockInformation(), tombstone, negative, {}} {
+			s, err := codec.Encode(information)
+			assert.Nil(t, err)
+			detected, err := storage_lock.DetectLockInformationCodec(s)
+			assert.Nil(t, err)
+			assert.Equal(t, name, detected.Name())
+			decoded, err := storage_lock.DecodeLockInformation(s)
+			assert.Nil(t, err, name)
+			assertLockInformationEqual(t, information, decoded)
+		}
+	}
+}
+
+// 紧凑的编码确实比 JSON 小
+func TestLockInformationCodec_Size(t *testing.T) {
+	information := newTestCodecLockInformation()
+	jsonString, _ := storage_lock.NewLockInformationCodecJSON().Encode(information)
+	binaryString, _ := storage_lock.NewLockInformationCodecBinary().Encode(information)
+	msgpackString, _ := storage_lock.NewLockInformationCodecMsgpack().Encode(information)
+	assert.Less(t, len(binaryString), len(msgpackString))
+	assert.Less(t, len(msgpackString), len(jsonString))
+}
+
+func TestLockInformationCodec_Corrupted(t *testing.T) {
+	_, err := storage_lock.DecodeLockInformation("not a lock information")
+	assert.ErrorIs(t, err, storage_lock.ErrLockInformationCodecUnknown)
+
+	for _, codec := range []storage_lock.LockInformationCodec{storage_lock.NewLockInformationCodecBinary(), storage_lock.NewLockInformationCodecMsgpack()} {
+		s, err := codec.Encode(newTestCodecLockInformation())
+		assert.Nil(t, err)
+		for _, corrupted := range []string{s[:len(s)-1], s + "x"} {
+			_, err = storage_lock.DecodeLockInformation(corrupted)
+			assert.ErrorIs(t, err, storage_lock.ErrLockInformationCorrupted, codec.Name())
+		}
+	}
+}
+
+// 不认识的 key 会被跳过
+func TestLockInformationCodecMsgpack_UnknownKey(t *testing.T) {
+	codec := storage_lock.NewLockInformationCodecMsgpack()
+	information := newTestCodecLockInformation()
+	s, err := codec.Encode(information)
+	assert.Nil(t, err)
+	// fixmap 的字段数加一，在末尾追加 "extra": [1, "a", {}]
+	extended := string([]byte{s[0] + 1}) + s[1:] + "\xa5extra" + "\x93\x01\xa1a\x80"
+	decoded, err := codec.Decode(extended)
+	assert.Nil(t, err)
+	assertLockInformationEqual(t, information, decoded)
+}
+
+type testCodec struct {
+	storage_lock.LockInformationCodec
+}
+
+func (x *testCodec) Name() string {
+	return "test-codec"
+}
+
+func TestLockInformationCodec_Registry(t *testing.T) {
+	assert.True(t, errors.Is(storage_lock.RegisterLockInformationCodec(storage_lock.NewLockInformationCodecJSON()), storage_lock.ErrLockInformationCodecAlreadyRegistered))
+	assert.ErrorIs(t, storage_lock.RegisterLockInformationCodec(nil), storage_lock.ErrLockInformationCodecNameEmpty)
+
+	_, err := storage_lock.GetLockInformationCodec("test-codec")
+	assert.ErrorIs(t, err, storage_lock.ErrLockInformationCodecNotFound)
+	assert.Nil(t, storage_lock.RegisterLockInformationCodec(&testCodec{storage_lock.NewLockInformationCodecJSON()}))
+	codec, err := storage_lock.GetLockInformationCodec("test-codec")
+	assert.Nil(t, err)
+	assert.Equal(t, "test-codec", codec.Name())
+	assert.True(t, storage_lock.UnregisterLockInformationCodec("test-codec"))
+	assert.False(t, storage_lock.UnregisterLockInformationCodec("test-codec"))
+}
+
+// 以 "~" 开头的测试编码，识别规则不与内置的编码重叠
+type testPrefixCodec struct {
+	storage_lock.LockInformationCodecJSON
+}
+
+func (x *testPrefixCodec) Name() string {
+	return "test-prefix-codec"
+}
+
+func (x *testPrefixCodec) Encode(lockInformation *storage.LockInformation) (string, error) {
+	return "~" + lockInformation.ToJsonString(), nil
+}
+
+func (x *testPrefixCodec) Decode(lockInformationString string) (*storage.LockInformation, error) {
+	return x.LockInformationCodecJSON.Decode(strings.TrimPrefix(lockInformationString, "~"))
+}
+
+func (x *testPrefixCodec) Recognize(lockInformationString string) bool {
+	return strings.HasPrefix(lockInformationString, "~")
+}
+
+// 注册和移除编码之后识别的结果随之变化
+func TestLockInformationCodec_Detect(t *testing.T) {
+	information := storagetest.NewTestLockInformation()
+
+	codec, err := storage_lock.DetectLockInformationCodec(information.ToJsonString())
+	assert.Nil(t, err)
+	assert.Equal(t, storage_lock.LockInformationCodecJSONName, codec.Name())
+	codec, err = storage_lock.DetectLockInformationCodec(" \n" + information.ToJsonString())
+	assert.Nil(t, err)
+	assert.Equal(t, storage_lock.LockInformationCodecJSONName, codec.Name())
+
+	prefixCodec := &testPrefixCodec{}
+	encoded, err := prefixCodec.Encode(information)
+	assert.Nil(t, err)
+	_, err = storage_lock.DecodeLockInformation(encoded)
+	assert.ErrorIs(t, err, storage_lock.ErrLockInformationCodecUnknown)
+
+	assert.Nil(t, storage_lock.RegisterLockInformationCodec(prefixCodec))
+	decoded, err := storage_lock.DecodeLockInformation(encoded)
+	assert.Nil(t, err)
+	assert.Equal(t, information.OwnerId, decoded.OwnerId)
+
+	assert.True(t, storage_lock.UnregisterLockInformationCodec(prefixCodec.Name()))
+	_, err = storage_lock.DecodeLockInformation(encoded)
+	assert.ErrorIs(t, err, storage_lock.ErrLockInformationCodecUnknown)
+}
+
+func TestLockInformationCodec_MemoryStorageConformance(t *testing.T) {
+	for _, codec := range []storage_lock.LockInformationCodec{storage_lock.NewLockInformationCodecBinary(), storage_lock.NewLockInformationCodecMsgpack()} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			s := memory_storage.NewMemoryStorageWithOptions(memory_storage.NewMemoryStorageOptions().SetCodec(codec))
+			storagetest.RunConformance(t, func() storage.Storage {
+				return s
+			})
+		})
+	}
+}
+
+// 迁移的过程中存储里同时存在不同编码的记录，锁都能正常的读取
+func TestLockInformationCodec_MixedFleet(t *testing.T) {
+	ctx := context.Background()
+	options := memory_storage.NewMemoryStorageOptions()
+	s := memory_storage.NewMemoryStorageWithOptions(options)
+	lock, err := storage_lock.NewStorageLock(s, "test-codec-mixed-lock")
+	assert.Nil(t, err)
+
+	// 旧实例用 JSON 写入，重入的时候新实例已经改用二进制写入，释放的时候又换成了 MessagePack
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	options.SetCodec(storage_lock.NewLockInformationCodecBinary())
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	raw, err := s.Get(ctx, "test-codec-mixed-lock")
+	assert.Nil(t, err)
+	codec, err := storage_lock.DetectLockInformationCodec(raw)
+	assert.Nil(t, err)
+	assert.Equal(t, storage_lock.LockInformationCodecBinaryName, codec.Name())
+	options.SetCodec(storage_lock.NewLockInformationCodecMsgpack())
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+	assert.Nil(t, lock.Lock(ctx, "other-owner"))
+	assert.Nil(t, lock.UnLock(ctx, "other-owner"))
+}
@@ -0,0 +1,230 @@
+package storage_lock
+
+import (
+	"context"
+	"fmt"
+	"github.com/storage-lock/go-events"
+	go_storage "github.com/storage-lock/go-storage"
+	"github.com/storage-lock/go-utils"
+	"sort"
+	"time"
+)
+
+// MedianTimeProvider 组合多个时间源的时间源，并发的向每个时间源取时间，取一致的那些时间源的中位数
+//
+// 锁的过期完全取决于时间源，只依赖一个 NTP 服务器之类的时间源的话，它的时间一旦跳变或者干脆不响应，所有的锁都会受影响。
+// MedianTimeProvider 每次取时间的时候：
+//   - 并发的向所有的时间源取时间，单个时间源最多等待 SourceTimeout，超时或者出错的本次不参与计算
+//   - 按照各自往返的时刻把结果对齐到同一个本地时刻之后取中位数，与中位数相差超过 Tolerance 的当做离群值丢弃
+//   - 剩下的彼此一致的时间源不足 Quorum 个的时候本次取时间失败，返回 ErrMedianTimeQuorumNotReached
+//   - 否则返回剩下的时间源的中位数
+//
+// 只要过半数（或者说 Quorum 个）时间源是正常的，单个时间源的跳变、卡住、返回错误都不会影响到锁的过期时间：
+//
+//	timeProvider, _ := storage_lock.NewMedianTimeProvider(ntpA, ntpB, ntpC)
+//	options := storage_lock.NewStorageLockOptionsWithLockId(lockId).SetTimeProvider(timeProvider)
+//
+// 每个参与计算的时间源相对于结果的偏差都会通过 ActionMedianTimeSource 事件发布出来，可以用来观测哪个时间源不太准。
+type MedianTimeProvider struct {
+	id      string
+	sources []go_storage.TimeProvider
+	options *MedianTimeProviderOptions
+
+	// 实际生效的法定数量
+	quorum int
+
+	e *events.Event
+}
+
+var _ UncertainTimeProvider = &MedianTimeProvider{}
+
+// MedianTimeProviderIDPrefix 中位数时间源的ID的前缀，用于在事件中区分不同的实例
+const MedianTimeProviderIDPrefix = "storage-lock-median-time-"
+
+// NewMedianTimeProvider 使用默认选项组合给定的时间源，默认要求过半数的时间源一致
+func NewMedianTimeProvider(sources ...go_storage.TimeProvider) (*MedianTimeProvider, error) {
+	return NewMedianTimeProviderWithOptions(sources, NewMedianTimeProviderOptions())
+}
+
+// NewMedianTimeProviderWithOptions 使用给定的选项组合给定的时间源
+func NewMedianTimeProviderWithOptions(sources []go_storage.TimeProvider, options *MedianTimeProviderOptions) (*MedianTimeProvider, error) {
+	if err := checkMedianTimeProviderOptions(options, len(sources)); err != nil {
+		return nil, err
+	}
+	quorum := options.Quorum
+	if quorum == 0 {
+		quorum = len(sources)/2 + 1
+	}
+	id := utils.RandomID(MedianTimeProviderIDPrefix)
+	return &MedianTimeProvider{
+		id:      id,
+		sources: append([]go_storage.TimeProvider(nil), sources...),
+		options: options,
+		quorum:  quorum,
+		e:       events.NewEvent(id).SetListeners(options.EventListeners),
+	}, nil
+}
+
+// GetID 中位数时间源的ID
+func (x *MedianTimeProvider) GetID() string {
+	return x.id
+}
+
+// MaxUncertainty 返回的时间最多与真实的时间相差多少：参与计算的时间源每次可能不一样，结果最多差出 Tolerance，再加上时间源自身的误差
+func (x *MedianTimeProvider) MaxUncertainty() time.Duration {
+	var sourceUncertainty time.Duration
+	for _, source := range x.sources {
+		if uncertainty := timeProviderUncertainty(source); uncertainty > sourceUncertainty {
+			sourceUncertainty = uncertainty
+		}
+	}
+	return x.options.Tolerance + sourceUncertainty
+}
+
+// 单个时间源的一次取时间的结果
+type medianTimeSample struct {
+	index int
+	time  time.Time
+	// 认为时间源是在往返的正中间读的时间
+	localTime time.Time
+	err       error
+}
+
+// GetTime 返回彼此一致的时间源的中位数，一致的时间源不足法定数量的时候返回 ErrMedianTimeQuorumNotReached
+func (x *MedianTimeProvider) GetTime(ctx context.Context) (time.Time, error) {
+	samples := x.collect(ctx)
+
+	// 对齐到同一个本地时刻，往返慢的时间源读到的时间相对来说更旧，需要补上读完之后又过去的时间
+	reference := time.Now()
+	offsets := make([]*medianTimeOffset, 0, len(samples))
+	for _, sample := range samples {
+		if sample.err != nil {
+			x.e.Fork().AddAction(events.NewAction(ActionMedianTimeSourceError).
+				SetErr(sample.err).
+				AddPayload(PayloadTimeSource, x.sourceName(sample.index))).Publish(ctx)
+			continue
+		}
+		offset := clampMedianTimeOffset(sample.time.Add(reference.Sub(sample.localTime)).Sub(reference))
+		offsets = append(offsets, &medianTimeOffset{index: sample.index, offset: offset})
+	}
+
+	if len(offsets) < x.quorum {
+		return time.Time{}, x.quorumNotReached(ctx, fmt.Sprintf("%d of %d sources responded, need %d", len(offsets), len(x.sources), x.quorum))
+	}
+
+	// 先用全部的结果取中位数，丢掉离它太远的，再用剩下的重新取中位数
+	median := medianTimeOffsets(offsets)
+	agreed := make([]*medianTimeOffset, 0, len(offsets))
+	for _, offset := range offsets {
+		deviation := offset.offset - median
+		if deviation > x.options.Tolerance || deviation < -x.options.Tolerance {
+			x.e.Fork().AddAction(events.NewAction(ActionMedianTimeOutlier).
+				SetErr(fmt.Errorf("%w: source %s deviates %s from median", ErrMedianTimeSourceOutlier, x.sourceName(offset.index), deviation)).
+				AddPayload(PayloadTimeSource, x.sourceName(offset.index)).
+				AddPayload(PayloadTimeOffset, deviation)).Publish(ctx)
+			continue
+		}
+		agreed = append(agreed, offset)
+	}
+
+	if len(agreed) < x.quorum {
+		return time.Time{}, x.quorumNotReached(ctx, fmt.Sprintf("%d of %d sources agree within %s, need %d", len(agreed), len(x.sources), x.options.Tolerance, x.quorum))
+	}
+
+	result := medianTimeOffsets(agreed)
+	for _, offset := range agreed {
+		x.e.Fork().AddAction(events.NewAction(ActionMedianTimeSource).
+			AddPayload(PayloadTimeSource, x.sourceName(offset.index)).
+			AddPayload(PayloadTimeOffset, offset.offset-result)).Publish(ctx)
+	}
+	// 加上计算过程中又过去的时间
+	return reference.Add(result + time.Since(reference)), nil
+}
+
+// 并发的向所有的时间源取时间，等所有的时间源都返回或者到了超时时间为止，超时的时间源记为失败
+func (x *MedianTimeProvider) collect(ctx context.Context) []*medianTimeSample {
+	timeoutCtx, cancel := context.WithTimeout(ctx, x.options.SourceTimeout)
+	defer cancel()
+
+	// 有缓冲，卡住的时间源之后再返回的时候也不会阻塞住它的协程
+	sampleChannel := make(chan *medianTimeSample, len(x.sources))
+	for index, source := range x.sources {
+		go func(index int, source go_storage.TimeProvider) {
+			before := time.Now()
+			sourceTime, err := source.GetTime(timeoutCtx)
+			after := time.Now()
+			sampleChannel <- &medianTimeSample{
+				index:     index,
+				time:      sourceTime,
+				localTime: before.Add(after.Sub(before) / 2),
+				err:       err,
+			}
+		}(index, source)
+	}
+
+	samples := make([]*medianTimeSample, len(x.sources))
+	for received := 0; received < len(x.sources); received++ {
+		select {
+		case sample := <-sampleChannel:
+			samples[sample.index] = sample
+		case <-timeoutCtx.Done():
+			for index := range samples {
+				if samples[index] == nil {
+					samples[index] = &medianTimeSample{index: index, err: fmt.Errorf("%w: %v", ErrMedianTimeSourceTimeout, timeoutCtx.Err())}
+				}
+			}
+			return samples
+		}
+	}
+	return samples
+}
+
+func (x *MedianTimeProvider) quorumNotReached(ctx context.Context, detail string) error {
+	err := fmt.Errorf("%w: %s", ErrMedianTimeQuorumNotReached, detail)
+	x.e.Fork().AddAction(events.NewAction(ActionMedianTimeQuorumNotReached).SetErr(err)).Publish(ctx)
+	return err
+}
+
+// 在事件中标识时间源：时间源是 Storage 的话用它的名字，否则用它的下标
+func (x *MedianTimeProvider) sourceName(index int) string {
+	if storage, ok := x.sources[index].(go_storage.Storage); ok {
+		return fmt.Sprintf("%d:%s", index, storage.GetName())
+	}
+	return fmt.Sprintf("%d", index)
+}
+
+// 单个时间源的时间相对于本地的参考时刻的偏差
+type medianTimeOffset struct {
+	index  int
+	offset time.Duration
+}
+
+// 偏差的上限，时间源返回了零值之类离谱的时间的时候 time.Time.Sub 会饱和到 time.Duration 的极值，
+// 限制在这个范围之内，之后求差、求平均的时候就不会溢出了
+const maxMedianTimeOffset = time.Duration(1<<62 - 1)
+
+func clampMedianTimeOffset(offset time.Duration) time.Duration {
+	if offset > maxMedianTimeOffset {
+		return maxMedianTimeOffset
+	}
+	if offset < -maxMedianTimeOffset {
+		return -maxMedianTimeOffset
+	}
+	return offset
+}
+
+// 中位数，偶数个的时候取中间两个的平均值
+func medianTimeOffsets(offsets []*medianTimeOffset) time.Duration {
+	sorted := make([]time.Duration, 0, len(offsets))
+	for _, offset := range offsets {
+		sorted = append(sorted, offset.offset)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[middle]
+	}
+	return sorted[middle-1] + (sorted[middle]-sorted[middle-1])/2
+}
@@ -0,0 +1,76 @@
+package storage_lock
+
+import (
+	"github.com/storage-lock/go-events"
+	"time"
+)
+
+const (
+
+	// DefaultMedianTimeTolerance 默认与中位数相差多少以内的时间源认为是一致的
+	DefaultMedianTimeTolerance = time.Second
+
+	// DefaultMedianTimeSourceTimeout 默认每次最多等待单个时间源多久
+	DefaultMedianTimeSourceTimeout = time.Second * 5
+)
+
+// MedianTimeProviderOptions 创建中位数时间源（MedianTimeProvider）的相关选项
+type MedianTimeProviderOptions struct {
+
+	// 与中位数相差超过这个值的时间源被当做离群值丢弃。
+	// 使用这个时间源的锁会把它计入续租的安全余量，因为不同的实例每次参与计算的时间源可能不一样
+	Tolerance time.Duration
+
+	// 至少要有多少个时间源彼此一致才能返回时间，为 0 时表示过半数
+	Quorum int
+
+	// 每次取时间的时候最多等待单个时间源多久，超时的时间源本次不参与计算
+	SourceTimeout time.Duration
+
+	// 用于监听观测每个时间源的偏差、离群、失败等事件
+	EventListeners []events.Listener
+}
+
+// NewMedianTimeProviderOptions 使用默认值创建中位数时间源的选项
+func NewMedianTimeProviderOptions() *MedianTimeProviderOptions {
+	return &MedianTimeProviderOptions{
+		Tolerance:     DefaultMedianTimeTolerance,
+		SourceTimeout: DefaultMedianTimeSourceTimeout,
+	}
+}
+
+// 检查中位数时间源的参数配置是否正确，sourceCount 是时间源的个数
+func checkMedianTimeProviderOptions(options *MedianTimeProviderOptions, sourceCount int) error {
+	if sourceCount == 0 || options.Tolerance <= 0 || options.Quorum < 0 || options.Quorum > sourceCount {
+		return ErrMedianTimeOptionsInvalid
+	}
+	if options.SourceTimeout <= 0 {
+		options.SourceTimeout = DefaultMedianTimeSourceTimeout
+	}
+	return nil
+}
+
+func (x *MedianTimeProviderOptions) SetTolerance(tolerance time.Duration) *MedianTimeProviderOptions {
+	x.Tolerance = tolerance
+	return x
+}
+
+func (x *MedianTimeProviderOptions) SetQuorum(quorum int) *MedianTimeProviderOptions {
+	x.Quorum = quorum
+	return x
+}
+
+func (x *MedianTimeProviderOptions) SetSourceTimeout(sourceTimeout time.Duration) *MedianTimeProviderOptions {
+	x.SourceTimeout = sourceTimeout
+	return x
+}
+
+func (x *MedianTimeProviderOptions) SetEventListeners(eventListeners []events.Listener) *MedianTimeProviderOptions {
+	x.EventListeners = eventListeners
+	return x
+}
+
+func (x *MedianTimeProviderOptions) AddEventListeners(eventListener events.Listener) *MedianTimeProviderOptions {
+	x.EventListeners = append(x.EventListeners, eventListener)
+	return x
+}
@@ -0,0 +1,140 @@
+package storage_lock_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	go_storage "github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// 与本地时钟相差固定偏移的时间源，可以让它返回错误或者卡住
+type testOffsetTimeProvider struct {
+	offset time.Duration
+	err    error
+	// 卡住的时候不理会 ctx，一直到测试结束都不返回
+	stuck chan struct{}
+}
+
+func (x *testOffsetTimeProvider) GetTime(ctx context.Context) (time.Time, error) {
+	if x.stuck != nil {
+		<-x.stuck
+	}
+	if x.err != nil {
+		return time.Time{}, x.err
+	}
+	return time.Now().Add(x.offset), nil
+}
+
+func newTestOffsetTimeProviders(offsets ...time.Duration) []go_storage.TimeProvider {
+	sources := make([]go_storage.TimeProvider, 0, len(offsets))
+	for _, offset := range offsets {
+		sources = append(sources, &testOffsetTimeProvider{offset: offset})
+	}
+	return sources
+}
+
+func TestMedianTimeProvider_Outlier(t *testing.T) {
+	recorder := newTestActionRecorder()
+	sources := newTestOffsetTimeProviders(0, time.Millisecond*100, time.Hour)
+	timeProvider, err := storage_lock.NewMedianTimeProviderWithOptions(sources, storage_lock.NewMedianTimeProviderOptions().AddEventListeners(recorder.listener()))
+	assert.Nil(t, err)
+
+	// 跳变了一个小时的时间源被丢弃，结果是剩下两个的中位数
+	now, err := timeProvider.GetTime(context.Background())
+	assert.Nil(t, err)
+	assert.InDelta(t, float64(time.Millisecond*50), float64(now.Sub(time.Now())), float64(time.Millisecond*20))
+	assert.Equal(t, 1, recorder.count(storage_lock.ActionMedianTimeOutlier))
+	assert.Equal(t, 2, recorder.count(storage_lock.ActionMedianTimeSource))
+}
+
+func TestMedianTimeProvider_QuorumNotReached(t *testing.T) {
+	recorder := newTestActionRecorder()
+
+	// 三个时间源各说各的
+	sources := newTestOffsetTimeProviders(0, time.Hour, -time.Hour)
+	timeProvider, err := storage_lock.NewMedianTimeProviderWithOptions(sources, storage_lock.NewMedianTimeProviderOptions().AddEventListeners(recorder.listener()))
+	assert.Nil(t, err)
+	_, err = timeProvider.GetTime(context.Background())
+	assert.ErrorIs(t, err, storage_lock.ErrMedianTimeQuorumNotReached)
+	assert.Equal(t, 2, recorder.count(storage_lock.ActionMedianTimeOutlier))
+	assert.Equal(t, 1, recorder.count(storage_lock.ActionMedianTimeQuorumNotReached))
+
+	// 响应的时间源不够
+	sources = []go_storage.TimeProvider{
+		&testOffsetTimeProvider{},
+		&testOffsetTimeProvider{err: errors.New("test ntp unreachable")},
+		&testOffsetTimeProvider{err: errors.New("test ntp unreachable")},
+	}
+	timeProvider, err = storage_lock.NewMedianTimeProviderWithOptions(sources, storage_lock.NewMedianTimeProviderOptions().AddEventListeners(recorder.listener()))
+	assert.Nil(t, err)
+	_, err = timeProvider.GetTime(context.Background())
+	assert.ErrorIs(t, err, storage_lock.ErrMedianTimeQuorumNotReached)
+	assert.Equal(t, 2, recorder.count(storage_lock.ActionMedianTimeSourceError))
+
+	// 降低法定数量之后一个就够了
+	timeProvider, err = storage_lock.NewMedianTimeProviderWithOptions(sources, storage_lock.NewMedianTimeProviderOptions().SetQuorum(1))
+	assert.Nil(t, err)
+	now, err := timeProvider.GetTime(context.Background())
+	assert.Nil(t, err)
+	assert.InDelta(t, 0, float64(time.Since(now)), float64(time.Millisecond*20))
+}
+
+func TestMedianTimeProvider_StuckSource(t *testing.T) {
+	stuck := make(chan struct{})
+	defer close(stuck)
+	recorder := newTestActionRecorder()
+	sources := append(newTestOffsetTimeProviders(0, 0), &testOffsetTimeProvider{stuck: stuck})
+	timeProvider, err := storage_lock.NewMedianTimeProviderWithOptions(sources, storage_lock.NewMedianTimeProviderOptions().
+		SetSourceTimeout(time.Millisecond*50).
+		AddEventListeners(recorder.listener()))
+	assert.Nil(t, err)
+
+	// 卡住的时间源不会拖住取时间
+	start := time.Now()
+	_, err = timeProvider.GetTime(context.Background())
+	assert.Nil(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, 1, recorder.count(storage_lock.ActionMedianTimeSourceError))
+}
+
+func TestMedianTimeProvider_ZeroTimeSource(t *testing.T) {
+	sources := append(newTestOffsetTimeProviders(0, 0), &testOffsetTimeProvider{offset: -time.Duration(1<<63 - 1)})
+	timeProvider, err := storage_lock.NewMedianTimeProvider(sources...)
+	assert.Nil(t, err)
+	now, err := timeProvider.GetTime(context.Background())
+	assert.Nil(t, err)
+	assert.InDelta(t, 0, float64(time.Since(now)), float64(time.Millisecond*20))
+}
+
+func TestMedianTimeProvider_OptionsInvalid(t *testing.T) {
+	_, err := storage_lock.NewMedianTimeProvider()
+	assert.ErrorIs(t, err, storage_lock.ErrMedianTimeOptionsInvalid)
+	_, err = storage_lock.NewMedianTimeProviderWithOptions(newTestOffsetTimeProviders(0), storage_lock.NewMedianTimeProviderOptions().SetQuorum(2))
+	assert.ErrorIs(t, err, storage_lock.ErrMedianTimeOptionsInvalid)
+	_, err = storage_lock.NewMedianTimeProviderWithOptions(newTestOffsetTimeProviders(0), storage_lock.NewMedianTimeProviderOptions().SetTolerance(0))
+	assert.ErrorIs(t, err, storage_lock.ErrMedianTimeOptionsInvalid)
+}
+
+// 一个时间源跳变不影响锁的过期时间
+func TestMedianTimeProvider_StorageLock(t *testing.T) {
+	ctx := context.Background()
+	timeProvider, err := storage_lock.NewMedianTimeProvider(newTestOffsetTimeProviders(0, 0, time.Hour*24)...)
+	assert.Nil(t, err)
+	assert.Equal(t, storage_lock.DefaultMedianTimeTolerance, timeProvider.MaxUncertainty())
+
+	s := memory_storage.NewMemoryStorage()
+	options := storage_lock.NewStorageLockOptionsWithLockId("test-median-time-lock").
+		SetTimeProvider(timeProvider).
+		SetSkipCapabilityCheck(true)
+	lock, err := storage_lock.NewStorageLockWithOptions(s, options)
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	information := getTestLockInformation(t, s, "test-median-time-lock")
+	assert.InDelta(t, float64(options.LeaseExpireAfter), float64(time.Until(information.LeaseExpireTime)), float64(time.Second))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+}
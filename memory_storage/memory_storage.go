@@ -0,0 +1,282 @@
+package memory_storage
+
+import (
+	"context"
+	"github.com/golang-infrastructure/go-iterator"
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// MemoryStorage 把锁存储在内存中，可以借助这个实现进程级别的锁，更主要的用途是在单元测试中代替真实的存储
+// 它声明了全部的能力（CAS、可靠时间源、原子条件删除），所有的操作都在同一把读写锁的保护下进行，
+// 同时实现了 storage_lock.WatchableStorage，锁被释放的时候可以立刻唤醒等待者，可以作为推送能力的参考实现
+type MemoryStorage struct {
+
+	// 实际存储锁的map
+	storageMap map[string]*MemoryStorageValue
+
+	// 用于线程安全的操作
+	storageLock sync.RWMutex
+
+	// 每个锁上的订阅者
+	watchers     map[string]map[chan struct{}]struct{}
+	watchersLock sync.Mutex
+
+	options *MemoryStorageOptions
+}
+
+var _ storage.Storage = &MemoryStorage{}
+var _ storage_lock.WatchableStorage = &MemoryStorage{}
+
+// DefaultName 内存存储默认的名字
+const DefaultName = "memory-storage"
+
+// NewMemoryStorage 使用默认选项创建一个内存存储
+func NewMemoryStorage() *MemoryStorage {
+	return NewMemoryStorageWithOptions(NewMemoryStorageOptions())
+}
+
+// NewMemoryStorageWithOptions 使用给定的选项创建一个内存存储
+func NewMemoryStorageWithOptions(options *MemoryStorageOptions) *MemoryStorage {
+	if options.Name == "" {
+		options.Name = DefaultName
+	}
+	if options.NowFunc == nil {
+		options.NowFunc = time.Now
+	}
+	if options.Clock == nil {
+		options.Clock = storage_lock.NewRealClock()
+	}
+	if options.Codec == nil {
+		options.Codec = storage_lock.NewLockInformationCodecJSON()
+	}
+	return &MemoryStorage{
+		storageMap: make(map[string]*MemoryStorageValue),
+		watchers:   make(map[string]map[chan struct{}]struct{}),
+		options:    options,
+	}
+}
+
+func (x *MemoryStorage) GetName() string {
+	return x.options.Name
+}
+
+func (x *MemoryStorage) Capabilities() []storage.StorageCapability {
+	capabilities := []storage.StorageCapability{
+		storage.CapabilityCAS,
+		storage.CapabilityReliableTime,
+	}
+	if !x.options.DisableAtomicDelete {
+		capabilities = append(capabilities, storage.CapabilityAtomicDelete)
+	}
+	return capabilities
+}
+
+func (x *MemoryStorage) Init(ctx context.Context) error {
+	// 没有要初始化的，在创建的时候就初始化了
+	return nil
+}
+
+func (x *MemoryStorage) Get(ctx context.Context, lockId string) (string, error) {
+	if err := x.simulateLatency(ctx); err != nil {
+		return "", err
+	}
+
+	x.storageLock.RLock()
+	defer x.storageLock.RUnlock()
+
+	value, exists := x.storageMap[lockId]
+	if !exists {
+		return "", storage_lock.ErrLockNotFound
+	}
+	return value.LockInformationJsonString, nil
+}
+
+func (x *MemoryStorage) UpdateWithVersion(ctx context.Context, lockId string, exceptedVersion, newVersion storage.Version, lockInformation *storage.LockInformation) error {
+	if err := x.simulateLatency(ctx); err != nil {
+		return err
+	}
+
+	x.storageLock.Lock()
+	defer x.storageLock.Unlock()
+
+	// 被更新的锁必须已经存在，否则无法更新
+	oldValue, exists := x.storageMap[lockId]
+	if !exists {
+		return storage_lock.ErrLockNotFound
+	}
+
+	// 乐观锁的版本必须能够对应得上，否则拒绝更新
+	if oldValue.Version != exceptedVersion {
+		return storage_lock.ErrVersionMiss
+	}
+
+	lockInformationString, err := x.options.Codec.Encode(lockInformation)
+	if err != nil {
+		return err
+	}
+
+	// 开始更新锁的信息和版本
+	oldValue.LockInformationJsonString = lockInformationString
+	oldValue.Version = newVersion
+	x.notify(lockId)
+	return nil
+}
+
+func (x *MemoryStorage) CreateWithVersion(ctx context.Context, lockId string, version storage.Version, lockInformation *storage.LockInformation) error {
+	if err := x.simulateLatency(ctx); err != nil {
+		return err
+	}
+
+	x.storageLock.Lock()
+	defer x.storageLock.Unlock()
+
+	// 插入的时候之前的锁不能存在，否则认为是插入失败
+	if _, exists := x.storageMap[lockId]; exists {
+		return storage_lock.ErrLockAlreadyExists
+	}
+
+	lockInformationString, err := x.options.Codec.Encode(lockInformation)
+	if err != nil {
+		return err
+	}
+
+	// 开始插入
+	x.storageMap[lockId] = &MemoryStorageValue{
+		LockId:                    lockId,
+		Version:                   version,
+		LockInformationJsonString: lockInformationString,
+	}
+	x.notify(lockId)
+	return nil
+}
+
+func (x *MemoryStorage) DeleteWithVersion(ctx context.Context, lockId string, exceptedVersion storage.Version, lockInformation *storage.LockInformation) error {
+	if err := x.simulateLatency(ctx); err != nil {
+		return err
+	}
+
+	x.storageLock.Lock()
+	defer x.storageLock.Unlock()
+
+	// 被删除的锁必须已经存在，否则删除失败
+	oldValue, exists := x.storageMap[lockId]
+	if !exists {
+		return storage_lock.ErrLockNotFound
+	}
+
+	// 期望的版本号必须相等，否则无法删除
+	if oldValue.Version != exceptedVersion {
+		return storage_lock.ErrVersionMiss
+	}
+
+	// 开始删除
+	delete(x.storageMap, lockId)
+	x.notify(lockId)
+	return nil
+}
+
+func (x *MemoryStorage) GetTime(ctx context.Context) (time.Time, error) {
+	if err := x.simulateLatency(ctx); err != nil {
+		return time.Time{}, err
+	}
+	// 因为是单机的内存存储，所以直接返回当前机器的时间（或者注入的时间源）
+	return x.options.NowFunc(), nil
+}
+
+func (x *MemoryStorage) Close(ctx context.Context) error {
+	return nil
+}
+
+func (x *MemoryStorage) List(ctx context.Context) (iterator.Iterator[*storage.LockInformation], error) {
+	if err := x.simulateLatency(ctx); err != nil {
+		return nil, err
+	}
+
+	x.storageLock.RLock()
+	defer x.storageLock.RUnlock()
+
+	slice := make([]*storage.LockInformation, 0, len(x.storageMap))
+	for _, value := range x.storageMap {
+		information, err := storage_lock.DecodeLockInformation(value.LockInformationJsonString)
+		if err != nil {
+			return nil, err
+		}
+		slice = append(slice, information)
+	}
+	return iterator.FromSlice(slice), nil
+}
+
+// Watch 订阅锁记录的变化，ctx 结束的时候取消订阅并关闭返回的 channel
+func (x *MemoryStorage) Watch(ctx context.Context, lockId string) (<-chan struct{}, error) {
+	// 缓冲为 1，订阅者来不及消费的多个通知合并为一个
+	notify := make(chan struct{}, 1)
+
+	x.watchersLock.Lock()
+	if x.watchers[lockId] == nil {
+		x.watchers[lockId] = make(map[chan struct{}]struct{})
+	}
+	x.watchers[lockId][notify] = struct{}{}
+	x.watchersLock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		x.watchersLock.Lock()
+		defer x.watchersLock.Unlock()
+		delete(x.watchers[lockId], notify)
+		if len(x.watchers[lockId]) == 0 {
+			delete(x.watchers, lockId)
+		}
+		close(notify)
+	}()
+	return notify, nil
+}
+
+// 通知锁上的所有订阅者，发送不会阻塞，在写锁的保护下调用，订阅者被唤醒之后一定能读到这次写入
+func (x *MemoryStorage) notify(lockId string) {
+	x.watchersLock.Lock()
+	defer x.watchersLock.Unlock()
+	for watcher := range x.watchers[lockId] {
+		select {
+		case watcher <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// 模拟存储操作的延迟，等待期间 ctx 被取消的话直接返回 ctx 的错误
+func (x *MemoryStorage) simulateLatency(ctx context.Context) error {
+	latency := x.options.Latency
+	if x.options.LatencyJitter > 0 {
+		latency += time.Duration(rand.Int63n(int64(x.options.LatencyJitter)))
+	}
+	if latency <= 0 {
+		return nil
+	}
+	timer := x.options.Clock.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
+
+// ------------------------------------------------ ---------------------------------------------------------------------
+
+// MemoryStorageValue 锁在内存中的实际存储结构
+type MemoryStorageValue struct {
+
+	// 存储的是哪个锁的信息
+	LockId string
+
+	// 锁的版本号是多少
+	Version storage.Version
+
+	// 锁的信息按照 MemoryStorageOptions.Codec 编码之后存储在这个字段，默认是JSON字符串
+	LockInformationJsonString string
+}
@@ -0,0 +1,76 @@
+package memory_storage
+
+import (
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"time"
+)
+
+// MemoryStorageOptions 创建内存存储的相关选项
+type MemoryStorageOptions struct {
+
+	// 存储的名字，用于在事件中区分不同的存储实例，未设置的话使用 DefaultName
+	Name string
+
+	// 获取当前时间的方法，未设置的话使用 time.Now，测试中可以注入可控的时间源来模拟时间流逝
+	NowFunc func() time.Time
+
+	// 等待模拟的延迟用的时钟，未设置的话使用真实的时钟，测试中注入假的时钟的时候通常也要把 NowFunc 设置为它的 Now
+	Clock storage_lock.Clock
+
+	// 模拟每次存储操作的延迟，为 0 时不模拟
+	Latency time.Duration
+
+	// 在 Latency 的基础上额外增加 [0, LatencyJitter) 的随机抖动
+	LatencyJitter time.Duration
+
+	// 不声明原子条件删除能力，用于模拟对象存储这类只能写墓碑的存储，测试墓碑相关的流程
+	DisableAtomicDelete bool
+
+	// 写入锁信息时使用的编码，未设置的话使用 JSON，读取时会自动识别编码，所以中途更换编码不影响已经写入的记录
+	Codec storage_lock.LockInformationCodec
+}
+
+// NewMemoryStorageOptions 使用默认值创建内存存储的选项
+func NewMemoryStorageOptions() *MemoryStorageOptions {
+	return &MemoryStorageOptions{
+		Name:    DefaultName,
+		NowFunc: time.Now,
+		Clock:   storage_lock.NewRealClock(),
+		Codec:   storage_lock.NewLockInformationCodecJSON(),
+	}
+}
+
+func (x *MemoryStorageOptions) SetName(name string) *MemoryStorageOptions {
+	x.Name = name
+	return x
+}
+
+func (x *MemoryStorageOptions) SetNowFunc(nowFunc func() time.Time) *MemoryStorageOptions {
+	x.NowFunc = nowFunc
+	return x
+}
+
+func (x *MemoryStorageOptions) SetClock(clock storage_lock.Clock) *MemoryStorageOptions {
+	x.Clock = clock
+	return x
+}
+
+func (x *MemoryStorageOptions) SetLatency(latency time.Duration) *MemoryStorageOptions {
+	x.Latency = latency
+	return x
+}
+
+func (x *MemoryStorageOptions) SetLatencyJitter(latencyJitter time.Duration) *MemoryStorageOptions {
+	x.LatencyJitter = latencyJitter
+	return x
+}
+
+func (x *MemoryStorageOptions) SetDisableAtomicDelete(disable bool) *MemoryStorageOptions {
+	x.DisableAtomicDelete = disable
+	return x
+}
+
+func (x *MemoryStorageOptions) SetCodec(codec storage_lock.LockInformationCodec) *MemoryStorageOptions {
+	x.Codec = codec
+	return x
+}
@@ -0,0 +1,132 @@
+package memory_storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/fake_clock"
+	"github.com/storage-lock/go-storage-lock/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStorage_CRUD(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	information := &storage.LockInformation{LockId: "test-memory-storage", OwnerId: "owner", Version: 1, LockCount: 1}
+
+	_, err := s.Get(ctx, information.LockId)
+	assert.ErrorIs(t, err, storage_lock.ErrLockNotFound)
+
+	assert.Nil(t, s.CreateWithVersion(ctx, information.LockId, 1, information))
+	assert.ErrorIs(t, s.CreateWithVersion(ctx, information.LockId, 1, information), storage_lock.ErrLockAlreadyExists)
+
+	assert.ErrorIs(t, s.UpdateWithVersion(ctx, information.LockId, 2, 3, information), storage_lock.ErrVersionMiss)
+	information.Version = 2
+	assert.Nil(t, s.UpdateWithVersion(ctx, information.LockId, 1, 2, information))
+
+	lockInformationJsonString, err := s.Get(ctx, information.LockId)
+	assert.Nil(t, err)
+	assert.Equal(t, information.ToJsonString(), lockInformationJsonString)
+
+	assert.ErrorIs(t, s.DeleteWithVersion(ctx, information.LockId, 1, information), storage_lock.ErrVersionMiss)
+	assert.Nil(t, s.DeleteWithVersion(ctx, information.LockId, 2, information))
+	assert.ErrorIs(t, s.DeleteWithVersion(ctx, information.LockId, 2, information), storage_lock.ErrLockNotFound)
+}
+
+func TestMemoryStorage_Capabilities(t *testing.T) {
+	assert.True(t, storage.SupportsAtomicDelete(NewMemoryStorage()))
+	assert.False(t, storage.SupportsAtomicDelete(NewMemoryStorageWithOptions(NewMemoryStorageOptions().SetDisableAtomicDelete(true))))
+}
+
+func TestMemoryStorage_LatencyRespectsContext(t *testing.T) {
+	s := NewMemoryStorageWithOptions(NewMemoryStorageOptions().SetLatency(time.Second))
+	ctx, cancelFunc := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancelFunc()
+	_, err := s.Get(ctx, "test-memory-storage")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// 模拟的延迟按照注入的时钟等待，不需要真的等
+func TestMemoryStorage_LatencyClock(t *testing.T) {
+	ctx := context.Background()
+	clock := fake_clock.NewFakeClock()
+	s := NewMemoryStorageWithOptions(NewMemoryStorageOptions().SetNowFunc(clock.Now).SetClock(clock).SetLatency(time.Minute))
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := s.Get(ctx, "test-memory-storage")
+		result <- err
+	}()
+	waitCtx, cancelFunc := context.WithTimeout(ctx, time.Second*5)
+	defer cancelFunc()
+	assert.True(t, clock.BlockUntil(waitCtx, 1))
+	select {
+	case err := <-result:
+		t.Fatalf("returned before latency elapsed: %v", err)
+	default:
+	}
+
+	clock.Advance(time.Minute)
+	assert.ErrorIs(t, <-result, storage_lock.ErrLockNotFound)
+	assert.Equal(t, 0, clock.Waiters())
+}
+
+func TestMemoryStorage_Conformance(t *testing.T) {
+	s := NewMemoryStorage()
+	storagetest.RunConformance(t, func() storage.Storage {
+		return s
+	})
+}
+
+func TestMemoryStorage_ConformanceWithoutAtomicDelete(t *testing.T) {
+	s := NewMemoryStorageWithOptions(NewMemoryStorageOptions().SetDisableAtomicDelete(true))
+	storagetest.RunConformance(t, func() storage.Storage {
+		return s
+	})
+}
+
+// 创建、更新、删除都会通知订阅者，ctx 结束之后关闭订阅
+func TestMemoryStorage_Watch(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	s := NewMemoryStorage()
+	lockId := "test-memory-watch"
+
+	notify, err := s.Watch(ctx, lockId)
+	assert.Nil(t, err)
+	expectNotify := func() {
+		select {
+		case _, ok := <-notify:
+			assert.True(t, ok)
+		case <-time.After(time.Second):
+			t.Fatal("no notification")
+		}
+	}
+
+	information := storagetest.NewTestLockInformation(1)
+	assert.Nil(t, s.CreateWithVersion(ctx, lockId, information.Version, information))
+	expectNotify()
+	newInformation := storagetest.NewTestLockInformation(2)
+	assert.Nil(t, s.UpdateWithVersion(ctx, lockId, information.Version, newInformation.Version, newInformation))
+	expectNotify()
+	assert.Nil(t, s.DeleteWithVersion(ctx, lockId, newInformation.Version, newInformation))
+	expectNotify()
+
+	// 其它锁的变化不会通知
+	assert.Nil(t, s.CreateWithVersion(ctx, "test-memory-watch-other", information.Version, information))
+	select {
+	case <-notify:
+		t.Fatal("unexpected notification")
+	default:
+	}
+
+	cancelFunc()
+	select {
+	case _, ok := <-notify:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("watch not closed")
+	}
+}
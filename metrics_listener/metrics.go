@@ -0,0 +1,170 @@
+package metrics_listener
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 指标以 Prometheus 的文本格式（text exposition format 0.0.4）输出，只实现了用到的计数器和直方图，不需要引入客户端库
+
+// 一组标签值对应的一个计数器或者直方图
+type metricSeries struct {
+	labelValues []string
+
+	// 计数器的值
+	value float64
+
+	// 直方图每个桶的计数（不累加），以及总和与总数
+	bucketCounts []uint64
+	sum          float64
+	count        uint64
+}
+
+// 一个指标以及它按标签拆分出来的所有序列
+type metricFamily struct {
+	name       string
+	help       string
+	histogram  bool
+	labelNames []string
+	buckets    []float64
+
+	series map[string]*metricSeries
+}
+
+func newCounterFamily(name, help string, labelNames ...string) *metricFamily {
+	return &metricFamily{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		series:     make(map[string]*metricSeries),
+	}
+}
+
+func newHistogramFamily(name, help string, buckets []float64, labelNames ...string) *metricFamily {
+	family := newCounterFamily(name, help, labelNames...)
+	family.histogram = true
+	family.buckets = buckets
+	return family
+}
+
+func (x *metricFamily) getSeries(labelValues []string) *metricSeries {
+	key := strings.Join(labelValues, "\xff")
+	series, exists := x.series[key]
+	if !exists {
+		series = &metricSeries{labelValues: labelValues}
+		if x.histogram {
+			series.bucketCounts = make([]uint64, len(x.buckets))
+		}
+		x.series[key] = series
+	}
+	return series
+}
+
+// 计数器加上给定的值
+func (x *metricFamily) add(value float64, labelValues ...string) {
+	x.getSeries(labelValues).value += value
+}
+
+// 直方图记录一个观测值
+func (x *metricFamily) observe(value float64, labelValues ...string) {
+	series := x.getSeries(labelValues)
+	if index := sort.SearchFloat64s(x.buckets, value); index < len(x.buckets) {
+		series.bucketCounts[index]++
+	}
+	series.sum += value
+	series.count++
+}
+
+// 按照文本格式输出，序列按照标签值排序保证输出稳定
+func (x *metricFamily) write(w io.Writer) error {
+	if len(x.series) == 0 {
+		return nil
+	}
+	metricType := "counter"
+	if x.histogram {
+		metricType = "histogram"
+	}
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", x.name, escapeHelp(x.help), x.name, metricType); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(x.series))
+	for key := range x.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		series := x.series[key]
+		labels := formatLabels(x.labelNames, series.labelValues)
+		if !x.histogram {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", x.name, wrapLabels(labels), formatFloat(series.value)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		cumulative := uint64(0)
+		for index, bucket := range x.buckets {
+			cumulative += series.bucketCounts[index]
+			bucketLabels := joinLabels(labels, fmt.Sprintf("le=%q", formatFloat(bucket)))
+			if _, err := fmt.Fprintf(w, "%s_bucket{%s} %d\n", x.name, bucketLabels, cumulative); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket{%s} %d\n%s_sum%s %s\n%s_count%s %d\n",
+			x.name, joinLabels(labels, `le="+Inf"`), series.count,
+			x.name, wrapLabels(labels), formatFloat(series.sum),
+			x.name, wrapLabels(labels), series.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatLabels(labelNames, labelValues []string) string {
+	pairs := make([]string, 0, len(labelNames))
+	for index, labelName := range labelNames {
+		pairs = append(pairs, labelName+`="`+escapeLabelValue(labelValues[index])+`"`)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+// 标签值中的反斜杠、双引号、换行需要转义
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// 帮助信息中的反斜杠、换行需要转义
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
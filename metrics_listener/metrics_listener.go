@@ -0,0 +1,236 @@
+package metrics_listener
+
+import (
+	"bytes"
+	"context"
+	"github.com/storage-lock/go-events"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MetricsListener 把锁发布的事件统计成计数器和直方图的监听器，通过 http.Handler 以 Prometheus 的文本格式暴露出去
+//
+// 统计的指标（前缀是 Namespace，标签 family 是 LockIdFamily 归出来的锁ID的族）：
+//   - acquire_seconds{family,result}：Lock 从开始到成功（success）、失败（error）、超时（timeout）花了多久
+//   - wait_seconds{family}：Lock 每次因为锁被占用或者版本miss而等待重试的时长
+//   - version_miss_total{family}、busy_total{family}：Lock 过程中版本miss和锁被占用的次数，取自 PayloadVersionMissCount、PayloadLockBusyCount
+//   - watchdog_refresh_total{family,result}：看门狗续租成功（success）和失败（error）的次数
+//   - rollback_total{family,result}：获取到锁之后回滚的次数
+//   - lease_lost_total{family,reason}：持有者丢失租约的次数，原因是锁被别人持有了（not_owner）、锁记录没了（not_found）、租约断档（continuity_violation）
+//
+// 使用的时候把它同时作为锁的监听器和 HTTP 的处理器：
+//
+//	listener := metrics_listener.NewMetricsListener()
+//	options := storage_lock.NewStorageLockOptionsWithLockId(lockId).AddEventListeners(listener)
+//	http.Handle("/metrics", listener)
+type MetricsListener struct {
+	options *MetricsListenerOptions
+
+	mutex sync.Mutex
+
+	acquireSeconds       *metricFamily
+	waitSeconds          *metricFamily
+	versionMissTotal     *metricFamily
+	busyTotal            *metricFamily
+	watchDogRefreshTotal *metricFamily
+	rollbackTotal        *metricFamily
+	leaseLostTotal       *metricFamily
+
+	// 正在等待重试的 Lock 开始等待的时间，key 是 Lock 的根事件的ID
+	waitBegin map[string]time.Time
+}
+
+var _ events.Listener = &MetricsListener{}
+var _ http.Handler = &MetricsListener{}
+
+// MetricsListenerName 指标监听器的名字
+const MetricsListenerName = "storage-lock-metrics-listener"
+
+// 指标中 result 和 reason 标签的取值
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+	ResultTimeout = "timeout"
+
+	ReasonNotOwner            = "not_owner"
+	ReasonNotFound            = "not_found"
+	ReasonContinuityViolation = "continuity_violation"
+)
+
+// NewMetricsListener 使用默认选项创建指标监听器
+func NewMetricsListener() *MetricsListener {
+	return NewMetricsListenerWithOptions(NewMetricsListenerOptions())
+}
+
+// NewMetricsListenerWithOptions 使用给定的选项创建指标监听器
+func NewMetricsListenerWithOptions(options *MetricsListenerOptions) *MetricsListener {
+	if options.Namespace == "" {
+		options.Namespace = DefaultNamespace
+	}
+	if len(options.Buckets) == 0 {
+		options.Buckets = DefaultBuckets
+	}
+	if options.LockIdFamily == nil {
+		options.LockIdFamily = DefaultLockIdFamily
+	}
+	name := func(name string) string {
+		return options.Namespace + "_" + name
+	}
+	return &MetricsListener{
+		options:              options,
+		acquireSeconds:       newHistogramFamily(name("acquire_seconds"), "Time spent in Lock until it succeeded, failed or timed out.", options.Buckets, "family", "result"),
+		waitSeconds:          newHistogramFamily(name("wait_seconds"), "Time Lock spent waiting before each retry.", options.Buckets, "family"),
+		versionMissTotal:     newCounterFamily(name("version_miss_total"), "Version misses while acquiring locks.", "family"),
+		busyTotal:            newCounterFamily(name("busy_total"), "Retries because the lock was held by another owner.", "family"),
+		watchDogRefreshTotal: newCounterFamily(name("watchdog_refresh_total"), "Lease refreshes by the watchdog.", "family", "result"),
+		rollbackTotal:        newCounterFamily(name("rollback_total"), "Rollbacks of acquired locks.", "family", "result"),
+		leaseLostTotal:       newCounterFamily(name("lease_lost_total"), "Leases lost by their holders.", "family", "reason"),
+		waitBegin:            make(map[string]time.Time),
+	}
+}
+
+func (x *MetricsListener) Name() string {
+	return MetricsListenerName
+}
+
+func (x *MetricsListener) On(ctx context.Context, e *events.Event) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	family := x.options.LockIdFamily(e.LockId)
+	lockEvent := e.EventType == events.EventTypeLock
+	refreshEvent := hasAction(e, storage_lock.ActionWatchDogRefresh)
+
+	for _, action := range e.Actions {
+		switch action.Name {
+
+		case storage_lock.ActionLockSuccess:
+			x.observeAcquire(e, action, family, ResultSuccess)
+		case storage_lock.ActionLockError:
+			x.observeAcquire(e, action, family, ResultError)
+		case storage_lock.ActionTimeout:
+			if lockEvent {
+				x.observeWait(e, action, family)
+				x.observeAcquire(e, action, family, ResultTimeout)
+			}
+
+		case storage_lock.ActionSleep:
+			if lockEvent {
+				x.waitBegin[e.RootID] = actionTime(action)
+			}
+		case storage_lock.ActionSleepRetry:
+			if lockEvent {
+				x.observeWait(e, action, family)
+			}
+
+		case storage_lock.ActionWatchDogRefreshSuccess:
+			x.watchDogRefreshTotal.add(1, family, ResultSuccess)
+		case storage_lock.ActionWatchDogRefreshError:
+			x.watchDogRefreshTotal.add(1, family, ResultError)
+
+		case storage_lock.ActionLockRollbackSuccess:
+			x.rollbackTotal.add(1, family, ResultSuccess)
+		case storage_lock.ActionLockRollbackError:
+			x.rollbackTotal.add(1, family, ResultError)
+
+		// 释放锁、转移锁的时候也会有这两个 action，只有看门狗续租时发现的才是丢失了租约
+		case storage_lock.ActionNotLockOwner:
+			if refreshEvent {
+				x.leaseLostTotal.add(1, family, ReasonNotOwner)
+			}
+		case storage_lock.ActionLockNotFoundError:
+			if refreshEvent {
+				x.leaseLostTotal.add(1, family, ReasonNotFound)
+			}
+		case storage_lock.ActionWatchDogLeaseContinuityViolation:
+			x.leaseLostTotal.add(1, family, ReasonContinuityViolation)
+		}
+	}
+}
+
+// Lock 结束的时候记录耗时，以及整个过程中版本miss和锁被占用的次数
+func (x *MetricsListener) observeAcquire(e *events.Event, action *events.Action, family, result string) {
+	delete(x.waitBegin, e.RootID)
+	if begin := rootEvent(e).StartTime; begin != nil {
+		x.acquireSeconds.observe(actionTime(action).Sub(*begin).Seconds(), family, result)
+	}
+	if versionMissCount, ok := action.GetPayload(storage_lock.PayloadVersionMissCount); ok {
+		if count, ok := versionMissCount.(int); ok {
+			x.versionMissTotal.add(float64(count), family)
+		}
+	}
+	if lockBusyCount, ok := action.GetPayload(storage_lock.PayloadLockBusyCount); ok {
+		if count, ok := lockBusyCount.(int); ok {
+			x.busyTotal.add(float64(count), family)
+		}
+	}
+}
+
+// 一次等待结束（醒来重试或者超时）的时候记录等待的时长
+func (x *MetricsListener) observeWait(e *events.Event, action *events.Action, family string) {
+	begin, exists := x.waitBegin[e.RootID]
+	if !exists {
+		return
+	}
+	delete(x.waitBegin, e.RootID)
+	x.waitSeconds.observe(actionTime(action).Sub(begin).Seconds(), family)
+}
+
+// ServeHTTP 以 Prometheus 的文本格式输出所有的指标
+func (x *MetricsListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	buff := &bytes.Buffer{}
+	if err := x.Write(buff); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write(buff.Bytes())
+}
+
+// Write 以 Prometheus 的文本格式把所有的指标写到给定的 Writer 中
+func (x *MetricsListener) Write(w io.Writer) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	for _, family := range []*metricFamily{
+		x.acquireSeconds,
+		x.waitSeconds,
+		x.versionMissTotal,
+		x.busyTotal,
+		x.watchDogRefreshTotal,
+		x.rollbackTotal,
+		x.leaseLostTotal,
+	} {
+		if err := family.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 事件是从 Lock 的根事件一路 Fork 出来的，沿着 Parent 找到根事件
+func rootEvent(e *events.Event) *events.Event {
+	for e.Parent != nil && !e.IsRootEvent() {
+		e = e.Parent
+	}
+	return e
+}
+
+func hasAction(e *events.Event, name string) bool {
+	for _, action := range e.Actions {
+		if action.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// action 发生的时间，没有的话认为就是现在
+func actionTime(action *events.Action) time.Time {
+	if action.StartTime != nil {
+		return *action.StartTime
+	}
+	return time.Now()
+}
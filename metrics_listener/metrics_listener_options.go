@@ -0,0 +1,57 @@
+package metrics_listener
+
+import (
+	"strings"
+)
+
+// DefaultNamespace 指标名字默认的前缀
+const DefaultNamespace = "storage_lock"
+
+// DefaultBuckets 耗时类的直方图默认的分桶，单位是秒，获取锁的等待可能很长，所以比常见的默认分桶多了几个大的桶
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// MetricsListenerOptions 创建指标监听器（MetricsListener）的相关选项
+type MetricsListenerOptions struct {
+
+	// 指标名字的前缀，比如 storage_lock_acquire_seconds 中的 storage_lock
+	Namespace string
+
+	// 耗时类的直方图的分桶，单位是秒，必须是递增的
+	Buckets []float64
+
+	// 把锁ID归到一个族，指标按族聚合而不是按锁ID，避免锁ID很多（比如每个订单一把锁）的时候指标的基数爆炸
+	LockIdFamily func(lockId string) string
+}
+
+// NewMetricsListenerOptions 使用默认值创建指标监听器的选项
+func NewMetricsListenerOptions() *MetricsListenerOptions {
+	return &MetricsListenerOptions{
+		Namespace:    DefaultNamespace,
+		Buckets:      DefaultBuckets,
+		LockIdFamily: DefaultLockIdFamily,
+	}
+}
+
+// DefaultLockIdFamily 默认的锁ID的族：锁ID中最后一个 ':' 或者 '/' 之前的部分，没有的话就是锁ID本身，
+// 比如 order:10086 和 order:10087 都属于 order 族
+func DefaultLockIdFamily(lockId string) string {
+	if index := strings.LastIndexAny(lockId, ":/"); index > 0 {
+		return lockId[:index]
+	}
+	return lockId
+}
+
+func (x *MetricsListenerOptions) SetNamespace(namespace string) *MetricsListenerOptions {
+	x.Namespace = namespace
+	return x
+}
+
+func (x *MetricsListenerOptions) SetBuckets(buckets []float64) *MetricsListenerOptions {
+	x.Buckets = buckets
+	return x
+}
+
+func (x *MetricsListenerOptions) SetLockIdFamily(lockIdFamily func(lockId string) string) *MetricsListenerOptions {
+	x.LockIdFamily = lockIdFamily
+	return x
+}
@@ -0,0 +1,118 @@
+package metrics_listener
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-events"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMetricsLock(t *testing.T, s *memory_storage.MemoryStorage, lockId string, listener events.Listener) *storage_lock.StorageLock {
+	options := storage_lock.NewStorageLockOptionsWithLockId(lockId).
+		SetLeaseExpireAfter(time.Second * 30).
+		SetLeaseRefreshInterval(time.Second * 10).
+		SetVersionMissRetryInterval(time.Millisecond * 10).
+		AddEventListeners(listener)
+	lock, err := storage_lock.NewStorageLockWithOptions(s, options)
+	assert.Nil(t, err)
+	return lock
+}
+
+func scrape(t *testing.T, listener *MetricsListener) string {
+	recorder := httptest.NewRecorder()
+	listener.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, recorder.Code)
+	assert.True(t, strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+	body, err := io.ReadAll(recorder.Body)
+	assert.Nil(t, err)
+	return string(body)
+}
+
+func TestMetricsListener_Lock(t *testing.T) {
+	ctx := context.Background()
+	listener := NewMetricsListener()
+	s := memory_storage.NewMemoryStorage()
+	holder := newTestMetricsLock(t, s, "order:1", listener)
+	waiter := newTestMetricsLock(t, s, "order:1", listener)
+
+	assert.Nil(t, holder.Lock(ctx, "holder"))
+
+	// 锁被占用，等待一段时间之后超时
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Millisecond*100)
+	defer cancel()
+	assert.NotNil(t, waiter.Lock(timeoutCtx, "waiter"))
+	assert.Nil(t, holder.UnLock(ctx, "holder"))
+
+	body := scrape(t, listener)
+	assert.Contains(t, body, "# TYPE storage_lock_acquire_seconds histogram\n")
+	assert.Contains(t, body, `storage_lock_acquire_seconds_count{family="order",result="success"} 1`+"\n")
+	assert.Contains(t, body, `storage_lock_acquire_seconds_count{family="order",result="timeout"} 1`+"\n")
+	assert.Contains(t, body, `storage_lock_acquire_seconds_bucket{family="order",result="timeout",le="+Inf"} 1`+"\n")
+	assert.Contains(t, body, "# TYPE storage_lock_busy_total counter\n")
+	assert.Contains(t, body, `storage_lock_wait_seconds_count{family="order"}`)
+	assert.NotContains(t, body, `storage_lock_busy_total{family="order"} 0`+"\n")
+	assert.NotContains(t, body, "storage_lock_lease_lost_total")
+	assert.Empty(t, listener.waitBegin)
+}
+
+func TestMetricsListener_LeaseLost(t *testing.T) {
+	ctx := context.Background()
+	listener := NewMetricsListener()
+	lockId := "tenant/a"
+
+	// 看门狗续租时发现锁已经被别人持有了
+	refresh := events.NewEvent(lockId).AddActionByName(storage_lock.ActionWatchDogRefresh).AddActionByName(storage_lock.ActionNotLockOwner)
+	refresh.Publish(ctx, listener)
+	// 释放锁的时候发现不是自己的锁，不算丢失租约
+	events.NewEvent(lockId).SetType(events.EventTypeUnlock).AddActionByName(storage_lock.ActionNotLockOwner).Publish(ctx, listener)
+	events.NewEvent(lockId).AddActionByName(storage_lock.ActionWatchDogLeaseContinuityViolation).Publish(ctx, listener)
+	events.NewEvent(lockId).AddActionByName(storage_lock.ActionWatchDogRefreshSuccess).Publish(ctx, listener)
+	events.NewEvent(lockId).AddActionByName(storage_lock.ActionWatchDogRefreshError).Publish(ctx, listener)
+	events.NewEvent(lockId).AddActionByName(storage_lock.ActionLockRollbackSuccess).Publish(ctx, listener)
+
+	body := scrape(t, listener)
+	assert.Contains(t, body, `storage_lock_lease_lost_total{family="tenant",reason="continuity_violation"} 1`+"\n")
+	assert.Contains(t, body, `storage_lock_lease_lost_total{family="tenant",reason="not_owner"} 1`+"\n")
+	assert.Contains(t, body, `storage_lock_watchdog_refresh_total{family="tenant",result="error"} 1`+"\n")
+	assert.Contains(t, body, `storage_lock_watchdog_refresh_total{family="tenant",result="success"} 1`+"\n")
+	assert.Contains(t, body, `storage_lock_rollback_total{family="tenant",result="success"} 1`+"\n")
+}
+
+func TestMetricFamily_Write(t *testing.T) {
+	histogram := newHistogramFamily("test_seconds", "Test\nhelp.", []float64{0.1, 1}, "family")
+	histogram.observe(0.05, `a"b`)
+	histogram.observe(0.1, `a"b`)
+	histogram.observe(5, `a"b`)
+	counter := newCounterFamily("test_total", "Test counter.")
+	counter.add(2)
+
+	buff := &bytes.Buffer{}
+	assert.Nil(t, histogram.write(buff))
+	assert.Nil(t, counter.write(buff))
+	assert.Equal(t, `# HELP test_seconds Test\nhelp.
+# TYPE test_seconds histogram
+test_seconds_bucket{family="a\"b",le="0.1"} 2
+test_seconds_bucket{family="a\"b",le="1"} 2
+test_seconds_bucket{family="a\"b",le="+Inf"} 3
+test_seconds_sum{family="a\"b"} 5.15
+test_seconds_count{family="a\"b"} 3
+# HELP test_total Test counter.
+# TYPE test_total counter
+test_total 2
+`, buff.String())
+}
+
+func TestDefaultLockIdFamily(t *testing.T) {
+	assert.Equal(t, "order", DefaultLockIdFamily("order:10086"))
+	assert.Equal(t, "tenant/a", DefaultLockIdFamily("tenant/a/job"))
+	assert.Equal(t, "single-lock", DefaultLockIdFamily("single-lock"))
+	assert.Equal(t, ":leading", DefaultLockIdFamily(":leading"))
+}
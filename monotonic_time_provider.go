@@ -0,0 +1,102 @@
+package storage_lock
+
+import (
+	"context"
+	"fmt"
+	"github.com/storage-lock/go-events"
+	go_storage "github.com/storage-lock/go-storage"
+	"github.com/storage-lock/go-utils"
+	"sync"
+	"time"
+)
+
+// MonotonicTimeProvider 保证时间不会倒退的时间源包装器
+//
+// 锁对时间源的要求是时间不能倒退：时间倒退的话刚写入的租约在别人看来会比实际的长，续租的截止时间也会算错。
+// 但是存储的时钟和外部注入的 TimeProvider 都可能被 NTP 往回校准（step correction），这在虚拟机上尤其常见。
+// MonotonicTimeProvider 记住见过的最大的时间，发现时间倒退的时候按照 TimeBackwardPolicy 处理，并发布 ActionTimeBackward 事件：
+//
+//	timeProvider := storage_lock.NewMonotonicTimeProvider(storage)
+//	options := storage_lock.NewStorageLockOptionsWithLockId(lockId).SetTimeProvider(timeProvider)
+//
+// 它只能在单个进程内保证单调，多个进程各自的包装器看到的最大时间是不一样的。
+type MonotonicTimeProvider struct {
+	id      string
+	source  go_storage.TimeProvider
+	options *MonotonicTimeProviderOptions
+
+	e *events.Event
+
+	mutex sync.Mutex
+	// 见过的最大的时间
+	last time.Time
+}
+
+var _ UncertainTimeProvider = &MonotonicTimeProvider{}
+
+// MonotonicTimeProviderIDPrefix 单调时间源的ID的前缀，用于在事件中区分不同的实例
+const MonotonicTimeProviderIDPrefix = "storage-lock-monotonic-time-"
+
+// NewMonotonicTimeProvider 使用默认选项包装给定的时间源，Storage 本身就是一个 TimeProvider
+func NewMonotonicTimeProvider(source go_storage.TimeProvider) *MonotonicTimeProvider {
+	return NewMonotonicTimeProviderWithOptions(source, NewMonotonicTimeProviderOptions())
+}
+
+// NewMonotonicTimeProviderWithOptions 使用给定的选项包装给定的时间源
+func NewMonotonicTimeProviderWithOptions(source go_storage.TimeProvider, options *MonotonicTimeProviderOptions) *MonotonicTimeProvider {
+	id := utils.RandomID(MonotonicTimeProviderIDPrefix)
+	e := events.NewEvent(id).SetListeners(options.EventListeners)
+	if storage, ok := source.(go_storage.Storage); ok {
+		e.SetStorageName(storage.GetName())
+	}
+	return &MonotonicTimeProvider{
+		id:      id,
+		source:  source,
+		options: options,
+		e:       e,
+	}
+}
+
+// GetID 单调时间源的ID
+func (x *MonotonicTimeProvider) GetID() string {
+	return x.id
+}
+
+// MaxUncertainty 被包装的时间源的误差，包装本身不引入误差
+func (x *MonotonicTimeProvider) MaxUncertainty() time.Duration {
+	return timeProviderUncertainty(x.source)
+}
+
+// GetTime 从被包装的时间源取时间，时间倒退的时候按照配置的策略处理
+func (x *MonotonicTimeProvider) GetTime(ctx context.Context) (time.Time, error) {
+	sourceTime, err := x.source.GetTime(ctx)
+	if err != nil {
+		return sourceTime, err
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if !sourceTime.Before(x.last) {
+		x.last = sourceTime
+		return sourceTime, nil
+	}
+
+	backward := x.last.Sub(sourceTime)
+	backwardErr := fmt.Errorf("%w: from %s to %s, backward %s", ErrTimeWentBackward, x.last, sourceTime, backward)
+	x.e.Fork().AddAction(events.NewAction(ActionTimeBackward).
+		SetErr(backwardErr).
+		AddPayload(PayloadTimeBackward, backward).
+		AddPayload(PayloadTimeBackwardPolicy, x.options.Policy.String())).Publish(ctx)
+
+	switch x.options.Policy {
+	case TimeBackwardPolicyFail:
+		return time.Time{}, backwardErr
+	case TimeBackwardPolicyAlarm:
+		// 只告警的话以新的时间为准，否则之后每次取时间都会告警，直到时间源追上来
+		x.last = sourceTime
+		return sourceTime, nil
+	default:
+		return x.last, nil
+	}
+}
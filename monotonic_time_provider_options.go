@@ -0,0 +1,65 @@
+package storage_lock
+
+import (
+	"github.com/storage-lock/go-events"
+)
+
+// TimeBackwardPolicy 时间源的时间倒退的时候如何处理，无论哪种策略都会发布 ActionTimeBackward 事件
+type TimeBackwardPolicy int
+
+const (
+
+	// TimeBackwardPolicyClamp 返回之前见过的最大的时间，直到时间源追上来为止，这是默认的策略
+	TimeBackwardPolicyClamp TimeBackwardPolicy = iota
+
+	// TimeBackwardPolicyFail 本次取时间失败，返回 ErrTimeWentBackward
+	TimeBackwardPolicyFail
+
+	// TimeBackwardPolicyAlarm 只发布事件告警，原样返回倒退之后的时间
+	TimeBackwardPolicyAlarm
+)
+
+func (x TimeBackwardPolicy) String() string {
+	switch x {
+	case TimeBackwardPolicyClamp:
+		return "clamp"
+	case TimeBackwardPolicyFail:
+		return "fail"
+	case TimeBackwardPolicyAlarm:
+		return "alarm"
+	default:
+		return "unknown"
+	}
+}
+
+// MonotonicTimeProviderOptions 创建单调时间源（MonotonicTimeProvider）的相关选项
+type MonotonicTimeProviderOptions struct {
+
+	// 时间倒退的时候如何处理
+	Policy TimeBackwardPolicy
+
+	// 用于监听观测时间倒退的事件
+	EventListeners []events.Listener
+}
+
+// NewMonotonicTimeProviderOptions 使用默认值创建单调时间源的选项
+func NewMonotonicTimeProviderOptions() *MonotonicTimeProviderOptions {
+	return &MonotonicTimeProviderOptions{
+		Policy: TimeBackwardPolicyClamp,
+	}
+}
+
+func (x *MonotonicTimeProviderOptions) SetPolicy(policy TimeBackwardPolicy) *MonotonicTimeProviderOptions {
+	x.Policy = policy
+	return x
+}
+
+func (x *MonotonicTimeProviderOptions) SetEventListeners(eventListeners []events.Listener) *MonotonicTimeProviderOptions {
+	x.EventListeners = eventListeners
+	return x
+}
+
+func (x *MonotonicTimeProviderOptions) AddEventListeners(eventListener events.Listener) *MonotonicTimeProviderOptions {
+	x.EventListeners = append(x.EventListeners, eventListener)
+	return x
+}
@@ -0,0 +1,95 @@
+package storage_lock_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// 按顺序返回给定的时间，模拟 NTP 把时钟往回校准
+type testSteppingTimeProvider struct {
+	mutex sync.Mutex
+	times []time.Time
+}
+
+func (x *testSteppingTimeProvider) GetTime(ctx context.Context) (time.Time, error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	t := x.times[0]
+	if len(x.times) > 1 {
+		x.times = x.times[1:]
+	}
+	return t, nil
+}
+
+func newTestNTPStepTimes() []time.Time {
+	base := time.Unix(1700000000, 0)
+	// 正常走了两秒之后被往回校准了五秒，之后继续走，再过六秒追上了之前的时间
+	return []time.Time{base, base.Add(time.Second * 2), base.Add(-time.Second * 3), base.Add(-time.Second * 2), base.Add(time.Second * 3)}
+}
+
+func collectTimes(timeProvider *storage_lock.MonotonicTimeProvider, n int) ([]time.Time, []error) {
+	times := make([]time.Time, 0, n)
+	errs := make([]error, 0, n)
+	for i := 0; i < n; i++ {
+		now, err := timeProvider.GetTime(context.Background())
+		times = append(times, now)
+		errs = append(errs, err)
+	}
+	return times, errs
+}
+
+func TestMonotonicTimeProvider_Clamp(t *testing.T) {
+	recorder := newTestActionRecorder()
+	stepTimes := newTestNTPStepTimes()
+	timeProvider := storage_lock.NewMonotonicTimeProviderWithOptions(&testSteppingTimeProvider{times: newTestNTPStepTimes()}, storage_lock.NewMonotonicTimeProviderOptions().AddEventListeners(recorder.listener()))
+	times, errs := collectTimes(timeProvider, 5)
+	for _, err := range errs {
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, []time.Time{stepTimes[0], stepTimes[1], stepTimes[1], stepTimes[1], stepTimes[4]}, times)
+	assert.Equal(t, 2, recorder.count(storage_lock.ActionTimeBackward))
+}
+
+func TestMonotonicTimeProvider_Fail(t *testing.T) {
+	recorder := newTestActionRecorder()
+	options := storage_lock.NewMonotonicTimeProviderOptions().SetPolicy(storage_lock.TimeBackwardPolicyFail).AddEventListeners(recorder.listener())
+	timeProvider := storage_lock.NewMonotonicTimeProviderWithOptions(&testSteppingTimeProvider{times: newTestNTPStepTimes()}, options)
+	_, errs := collectTimes(timeProvider, 5)
+	assert.Nil(t, errs[0])
+	assert.Nil(t, errs[1])
+	assert.ErrorIs(t, errs[2], storage_lock.ErrTimeWentBackward)
+	assert.ErrorIs(t, errs[3], storage_lock.ErrTimeWentBackward)
+	assert.Nil(t, errs[4])
+	assert.Equal(t, 2, recorder.count(storage_lock.ActionTimeBackward))
+}
+
+func TestMonotonicTimeProvider_Alarm(t *testing.T) {
+	recorder := newTestActionRecorder()
+	stepTimes := newTestNTPStepTimes()
+	options := storage_lock.NewMonotonicTimeProviderOptions().SetPolicy(storage_lock.TimeBackwardPolicyAlarm).AddEventListeners(recorder.listener())
+	timeProvider := storage_lock.NewMonotonicTimeProviderWithOptions(&testSteppingTimeProvider{times: newTestNTPStepTimes()}, options)
+	times, errs := collectTimes(timeProvider, 5)
+	for _, err := range errs {
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, stepTimes, times)
+	// 只在往回跳的那一刻告警一次
+	assert.Equal(t, 1, recorder.count(storage_lock.ActionTimeBackward))
+}
+
+// 包装存储的时间，与锁一起使用
+func TestMonotonicTimeProvider_StorageLock(t *testing.T) {
+	ctx := context.Background()
+	s := memory_storage.NewMemoryStorage()
+	timeProvider := storage_lock.NewMonotonicTimeProvider(s)
+	lock, err := storage_lock.NewStorageLockWithOptions(s, storage_lock.NewStorageLockOptionsWithLockId("test-monotonic-time-lock").SetTimeProvider(timeProvider))
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+}
@@ -0,0 +1,13 @@
+package namespace_storage
+
+import "errors"
+
+var (
+	ErrStorageNil = errors.New("namespace storage must wrap a storage")
+
+	// ErrNamespaceInvalid 命名空间为空或者包含了分隔符，包含分隔符的话 "a" 和 "a:b" 两个命名空间的锁ID会互相重叠
+	ErrNamespaceInvalid = errors.New("namespace can not be empty or contain the separator")
+
+	// ErrNamespaceQuotaExceeded 命名空间下存活的锁的数量已经达到了上限
+	ErrNamespaceQuotaExceeded = errors.New("namespace live lock quota exceeded")
+)
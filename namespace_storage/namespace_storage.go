@@ -0,0 +1,333 @@
+package namespace_storage
+
+import (
+	"context"
+	"errors"
+	"github.com/golang-infrastructure/go-iterator"
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NamespaceStorage 把锁ID映射到一个命名空间下，多个团队共用同一个存储（同一张表）的时候锁ID不会互相冲突。
+//
+// 写入时锁ID（包括 LockInformation 中的 LockId）被加上 "<namespace><separator>" 前缀，读取时再去掉，
+// 对 StorageLock 来说完全是透明的；List 只会列出本命名空间下的锁。
+//
+// 命名空间上还可以配置：
+//   - 存活锁的配额（MaxLiveLocks）：创建锁、或者把一条失效的记录重新变为持有状态之前会检查命名空间下存活的锁的数量，
+//     超过配额返回 ErrNamespaceQuotaExceeded。同一个 NamespaceStorage 实例上的检查是串行的，
+//     多个进程之间则是尽力而为，并发创建的时候可能会略微超出配额。
+//     会话记录不是锁，不占用配额；对一条已经被持有的记录的更新（续租、重入、释放一层）也不会检查配额
+//   - 锁参数的默认值：通过 NewStorageLockOptions / NewStorageLock 创建的锁使用命名空间上配置的租约等参数
+type NamespaceStorage struct {
+	storage storage.Storage
+	options *NamespaceStorageOptions
+
+	// 存储中实际的锁ID的前缀
+	prefix string
+
+	// 配额检查与写入之间不能插入同一个实例上的其他写入
+	quotaLock sync.Mutex
+
+	// 本实例写入的处于持有状态的记录的版本号，存储中的锁ID -> Version。
+	// 条件更新的期望版本号命中这里说明被替换的就是一条持有状态的记录，不可能是新增的存活锁，不需要再读记录检查配额
+	heldVersions sync.Map
+}
+
+var _ storage.Storage = &NamespaceStorage{}
+
+// NewNamespaceStorage 把给定的存储包装到给定的命名空间下
+func NewNamespaceStorage(s storage.Storage, namespace string) (*NamespaceStorage, error) {
+	return NewNamespaceStorageWithOptions(s, NewNamespaceStorageOptions(namespace))
+}
+
+// NewNamespaceStorageWithOptions 使用给定的选项包装给定的存储
+func NewNamespaceStorageWithOptions(s storage.Storage, options *NamespaceStorageOptions) (*NamespaceStorage, error) {
+	if s == nil {
+		return nil, ErrStorageNil
+	}
+	if options.Separator == "" {
+		options.Separator = DefaultSeparator
+	}
+	if options.Namespace == "" || strings.Contains(options.Namespace, options.Separator) {
+		return nil, ErrNamespaceInvalid
+	}
+	return &NamespaceStorage{
+		storage: s,
+		options: options,
+		prefix:  options.Namespace + options.Separator,
+	}, nil
+}
+
+// Unwrap 返回被包装的存储
+func (x *NamespaceStorage) Unwrap() storage.Storage {
+	return x.storage
+}
+
+// GetNamespace 命名空间的名字
+func (x *NamespaceStorage) GetNamespace() string {
+	return x.options.Namespace
+}
+
+// NewStorageLockOptions 创建一个使用命名空间默认参数的锁配置
+func (x *NamespaceStorage) NewStorageLockOptions(lockId string) *storage_lock.StorageLockOptions {
+	options := storage_lock.NewStorageLockOptionsWithLockId(lockId)
+	if x.options.LeaseExpireAfter > 0 {
+		options.SetLeaseExpireAfter(x.options.LeaseExpireAfter)
+	}
+	if x.options.LeaseRefreshInterval > 0 {
+		options.SetLeaseRefreshInterval(x.options.LeaseRefreshInterval)
+	}
+	if x.options.VersionMissRetryInterval > 0 {
+		options.SetVersionMissRetryInterval(x.options.VersionMissRetryInterval)
+	}
+	for _, listener := range x.options.EventListeners {
+		options.AddEventListeners(listener)
+	}
+	return options
+}
+
+// NewStorageLock 在这个命名空间上创建一把使用命名空间默认参数的锁
+func (x *NamespaceStorage) NewStorageLock(lockId string) (*storage_lock.StorageLock, error) {
+	return storage_lock.NewStorageLockWithOptions(x, x.NewStorageLockOptions(lockId))
+}
+
+func (x *NamespaceStorage) GetName() string {
+	if x.options.Name != "" {
+		return x.options.Name
+	}
+	return x.storage.GetName()
+}
+
+// Capabilities 与被包装的存储相同
+func (x *NamespaceStorage) Capabilities() []storage.StorageCapability {
+	if declarer, ok := x.storage.(storage.CapabilityDeclarer); ok {
+		return declarer.Capabilities()
+	}
+	return nil
+}
+
+func (x *NamespaceStorage) Init(ctx context.Context) error {
+	return x.storage.Init(ctx)
+}
+
+func (x *NamespaceStorage) UpdateWithVersion(ctx context.Context, lockId string, exceptedVersion, newVersion storage.Version, lockInformation *storage.LockInformation) error {
+	storageLockId := x.toStorageLockId(lockId)
+	if x.needQuota(lockId, lockInformation) && !x.isHeldVersion(storageLockId, exceptedVersion) {
+
+		x.quotaLock.Lock()
+		defer x.quotaLock.Unlock()
+
+		// 把一条已经失效的记录（墓碑或者租约过期）重新变为持有状态，相当于新增了一把存活的锁
+		current, err := x.getStorageLockInformation(ctx, storageLockId)
+		if err != nil {
+			return err
+		}
+		storageTime, err := x.storage.GetTime(ctx)
+		if err != nil {
+			return err
+		}
+		if !isLive(current, storageTime) {
+			if err := x.checkQuota(ctx, storageTime); err != nil {
+				return err
+			}
+		}
+	}
+	err := x.storage.UpdateWithVersion(ctx, storageLockId, exceptedVersion, newVersion, x.toStorageLockInformation(lockInformation))
+	if err == nil {
+		x.rememberVersion(storageLockId, newVersion, lockInformation)
+	}
+	return err
+}
+
+func (x *NamespaceStorage) CreateWithVersion(ctx context.Context, lockId string, version storage.Version, lockInformation *storage.LockInformation) error {
+	storageLockId := x.toStorageLockId(lockId)
+	if !x.needQuota(lockId, lockInformation) {
+		err := x.storage.CreateWithVersion(ctx, storageLockId, version, x.toStorageLockInformation(lockInformation))
+		if err == nil {
+			x.rememberVersion(storageLockId, version, lockInformation)
+		}
+		return err
+	}
+
+	x.quotaLock.Lock()
+	defer x.quotaLock.Unlock()
+
+	storageTime, err := x.storage.GetTime(ctx)
+	if err != nil {
+		return err
+	}
+	if err := x.checkQuota(ctx, storageTime); err != nil {
+		return err
+	}
+	err = x.storage.CreateWithVersion(ctx, storageLockId, version, x.toStorageLockInformation(lockInformation))
+	if err == nil {
+		x.rememberVersion(storageLockId, version, lockInformation)
+	}
+	return err
+}
+
+func (x *NamespaceStorage) DeleteWithVersion(ctx context.Context, lockId string, exceptedVersion storage.Version, lockInformation *storage.LockInformation) error {
+	storageLockId := x.toStorageLockId(lockId)
+	err := x.storage.DeleteWithVersion(ctx, storageLockId, exceptedVersion, x.toStorageLockInformation(lockInformation))
+	if err == nil {
+		x.heldVersions.Delete(storageLockId)
+	}
+	return err
+}
+
+func (x *NamespaceStorage) Get(ctx context.Context, lockId string) (string, error) {
+	lockInformationJsonString, err := x.storage.Get(ctx, x.toStorageLockId(lockId))
+	if err != nil || lockInformationJsonString == "" {
+		return lockInformationJsonString, err
+	}
+	// 保持底层存储中记录原本的编码，只把 LockId 中的前缀去掉
+	codec, err := storage_lock.DetectLockInformationCodec(lockInformationJsonString)
+	if err != nil {
+		return "", err
+	}
+	information, err := codec.Decode(lockInformationJsonString)
+	if err != nil {
+		return "", err
+	}
+	information.LockId = x.fromStorageLockId(information.LockId)
+	return codec.Encode(information)
+}
+
+func (x *NamespaceStorage) GetTime(ctx context.Context) (time.Time, error) {
+	return x.storage.GetTime(ctx)
+}
+
+func (x *NamespaceStorage) Close(ctx context.Context) error {
+	return x.storage.Close(ctx)
+}
+
+// List 只列出本命名空间下的锁，锁ID去掉了命名空间的前缀
+func (x *NamespaceStorage) List(ctx context.Context) (iterator.Iterator[*storage.LockInformation], error) {
+	slice, err := x.listStorageLockInformation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, information := range slice {
+		information.LockId = x.fromStorageLockId(information.LockId)
+	}
+	return iterator.FromSlice(slice), nil
+}
+
+// 列出本命名空间下的锁，锁ID仍然是存储中的锁ID
+func (x *NamespaceStorage) listStorageLockInformation(ctx context.Context) ([]*storage.LockInformation, error) {
+	it, err := x.storage.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	slice := make([]*storage.LockInformation, 0)
+	for it.Next() {
+		information := it.Value()
+		if strings.HasPrefix(information.LockId, x.prefix) {
+			slice = append(slice, information)
+		}
+	}
+	return slice, nil
+}
+
+// 写入的记录是否需要检查配额：配置了配额、写入的是持有状态的记录，并且不是会话记录
+func (x *NamespaceStorage) needQuota(lockId string, lockInformation *storage.LockInformation) bool {
+	return x.options.MaxLiveLocks > 0 && lockInformation.LockCount > 0 && !isSessionRecord(lockId)
+}
+
+// 条件更新替换的是否是本实例写入的持有状态的记录，是的话这次更新不会新增存活的锁（续租、重入、释放一层都是这种情况）；
+// 如果记录在这期间已经被别人改掉了，条件更新本身就会因为版本号对不上而失败
+func (x *NamespaceStorage) isHeldVersion(storageLockId string, exceptedVersion storage.Version) bool {
+	version, ok := x.heldVersions.Load(storageLockId)
+	return ok && version.(storage.Version) == exceptedVersion
+}
+
+// 记住本实例写入的持有状态的记录的版本号，写入的是墓碑则忘掉
+func (x *NamespaceStorage) rememberVersion(storageLockId string, version storage.Version, lockInformation *storage.LockInformation) {
+	if x.options.MaxLiveLocks <= 0 {
+		return
+	}
+	if lockInformation.LockCount > 0 {
+		x.heldVersions.Store(storageLockId, version)
+	} else {
+		x.heldVersions.Delete(storageLockId)
+	}
+}
+
+// 检查命名空间下存活的锁是否已经达到了配额，调用方需要持有 quotaLock
+func (x *NamespaceStorage) checkQuota(ctx context.Context, storageTime time.Time) error {
+	slice, err := x.listStorageLockInformation(ctx)
+	if err != nil {
+		return err
+	}
+	liveCount := 0
+	for _, information := range slice {
+		if isSessionRecord(x.fromStorageLockId(information.LockId)) {
+			continue
+		}
+		if isLive(information, storageTime) {
+			liveCount++
+		}
+	}
+	if liveCount >= x.options.MaxLiveLocks {
+		return ErrNamespaceQuotaExceeded
+	}
+	return nil
+}
+
+// 读取存储中的锁记录，不存在时返回 nil
+func (x *NamespaceStorage) getStorageLockInformation(ctx context.Context, storageLockId string) (*storage.LockInformation, error) {
+	lockInformationJsonString, err := x.storage.Get(ctx, storageLockId)
+	if err != nil {
+		if errors.Is(err, storage_lock.ErrLockNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if lockInformationJsonString == "" {
+		return nil, nil
+	}
+	return storage_lock.DecodeLockInformation(lockInformationJsonString)
+}
+
+func (x *NamespaceStorage) toStorageLockId(lockId string) string {
+	return x.prefix + lockId
+}
+
+func (x *NamespaceStorage) fromStorageLockId(storageLockId string) string {
+	return strings.TrimPrefix(storageLockId, x.prefix)
+}
+
+// 复制一份再改 LockId，不修改调用方传进来的锁信息
+func (x *NamespaceStorage) toStorageLockInformation(lockInformation *storage.LockInformation) *storage.LockInformation {
+	if lockInformation == nil {
+		return nil
+	}
+	information := *lockInformation
+	information.LockId = x.toStorageLockId(lockInformation.LockId)
+	return &information
+}
+
+// 锁记录是否处于被持有的状态，会话模式下的锁记录有效性取决于会话而不是自己的租约，这一层判断不了，保守的认为它仍然被持有
+func isLive(information *storage.LockInformation, storageTime time.Time) bool {
+	if information == nil || information.LockCount == 0 {
+		return false
+	}
+	if isSessionOwnerId(information.OwnerId) {
+		return true
+	}
+	return !storageTime.After(information.LeaseExpireTime)
+}
+
+// 是否是会话模式下写入的锁记录的 OwnerId
+func isSessionOwnerId(ownerId string) bool {
+	return strings.Contains(ownerId, storage_lock.SessionOwnerIdSeparator+storage_lock.SessionIDPrefix)
+}
+
+// 是否是会话记录，会话记录以会话ID为锁ID
+func isSessionRecord(lockId string) bool {
+	return strings.HasPrefix(lockId, storage_lock.SessionIDPrefix) && !strings.Contains(lockId, storage_lock.SessionOwnerIdSeparator)
+}
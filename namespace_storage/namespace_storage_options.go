@@ -0,0 +1,84 @@
+package namespace_storage
+
+import (
+	"github.com/storage-lock/go-events"
+	"time"
+)
+
+// DefaultSeparator 命名空间与锁ID之间默认的分隔符
+const DefaultSeparator = ":"
+
+// NamespaceStorageOptions 创建命名空间存储的相关选项
+type NamespaceStorageOptions struct {
+
+	// 命名空间，不能为空，也不能包含分隔符
+	Namespace string
+
+	// 命名空间与锁ID之间的分隔符，存储中实际的锁ID为 Namespace + Separator + lockId
+	Separator string
+
+	// 存储的名字，未设置的话沿用被包装的存储的名字
+	Name string
+
+	// 命名空间下最多同时存活多少把锁（租约未过期、不是墓碑），为 0 表示不限制
+	MaxLiveLocks int
+
+	// 命名空间下的锁默认使用的参数，通过 NamespaceStorage.NewStorageLockOptions 创建的锁配置会使用这些默认值，为零值的项沿用全局默认值
+	LeaseExpireAfter         time.Duration
+	LeaseRefreshInterval     time.Duration
+	VersionMissRetryInterval time.Duration
+	EventListeners           []events.Listener
+}
+
+// NewNamespaceStorageOptions 创建给定命名空间的选项
+func NewNamespaceStorageOptions(namespace string) *NamespaceStorageOptions {
+	return &NamespaceStorageOptions{
+		Namespace: namespace,
+		Separator: DefaultSeparator,
+	}
+}
+
+func (x *NamespaceStorageOptions) SetNamespace(namespace string) *NamespaceStorageOptions {
+	x.Namespace = namespace
+	return x
+}
+
+func (x *NamespaceStorageOptions) SetSeparator(separator string) *NamespaceStorageOptions {
+	x.Separator = separator
+	return x
+}
+
+func (x *NamespaceStorageOptions) SetName(name string) *NamespaceStorageOptions {
+	x.Name = name
+	return x
+}
+
+func (x *NamespaceStorageOptions) SetMaxLiveLocks(maxLiveLocks int) *NamespaceStorageOptions {
+	x.MaxLiveLocks = maxLiveLocks
+	return x
+}
+
+func (x *NamespaceStorageOptions) SetLeaseExpireAfter(leaseExpireAfter time.Duration) *NamespaceStorageOptions {
+	x.LeaseExpireAfter = leaseExpireAfter
+	return x
+}
+
+func (x *NamespaceStorageOptions) SetLeaseRefreshInterval(leaseRefreshInterval time.Duration) *NamespaceStorageOptions {
+	x.LeaseRefreshInterval = leaseRefreshInterval
+	return x
+}
+
+func (x *NamespaceStorageOptions) SetVersionMissRetryInterval(versionMissRetryInterval time.Duration) *NamespaceStorageOptions {
+	x.VersionMissRetryInterval = versionMissRetryInterval
+	return x
+}
+
+func (x *NamespaceStorageOptions) SetEventListeners(eventListeners []events.Listener) *NamespaceStorageOptions {
+	x.EventListeners = eventListeners
+	return x
+}
+
+func (x *NamespaceStorageOptions) AddEventListeners(listener events.Listener) *NamespaceStorageOptions {
+	x.EventListeners = append(x.EventListeners, listener)
+	return x
+}
@@ -0,0 +1,242 @@
+package namespace_storage
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/storage-lock/go-storage-lock/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestNamespaceStorage(t *testing.T, s storage.Storage, options *NamespaceStorageOptions) *NamespaceStorage {
+	namespaceStorage, err := NewNamespaceStorageWithOptions(s, options)
+	assert.Nil(t, err)
+	return namespaceStorage
+}
+
+func listLockIds(t *testing.T, s storage.Storage) []string {
+	it, err := s.List(context.Background())
+	assert.Nil(t, err)
+	lockIds := make([]string, 0)
+	for it.Next() {
+		lockIds = append(lockIds, it.Value().LockId)
+	}
+	return lockIds
+}
+
+func TestNamespaceStorage_Conformance(t *testing.T) {
+	s := newTestNamespaceStorage(t, memory_storage.NewMemoryStorage(), NewNamespaceStorageOptions("team-a"))
+	storagetest.RunConformance(t, func() storage.Storage {
+		return s
+	})
+}
+
+func TestNewNamespaceStorage_Invalid(t *testing.T) {
+	_, err := NewNamespaceStorage(nil, "team-a")
+	assert.ErrorIs(t, err, ErrStorageNil)
+
+	_, err = NewNamespaceStorage(memory_storage.NewMemoryStorage(), "")
+	assert.ErrorIs(t, err, ErrNamespaceInvalid)
+
+	_, err = NewNamespaceStorage(memory_storage.NewMemoryStorage(), "team:a")
+	assert.ErrorIs(t, err, ErrNamespaceInvalid)
+}
+
+// 不同命名空间下相同的锁ID互不影响，锁信息中的锁ID对调用方是透明的
+func TestNamespaceStorage_Isolation(t *testing.T) {
+	ctx := context.Background()
+	memoryStorage := memory_storage.NewMemoryStorage()
+	a := newTestNamespaceStorage(t, memoryStorage, NewNamespaceStorageOptions("team-a"))
+	b := newTestNamespaceStorage(t, memoryStorage, NewNamespaceStorageOptions("team-b"))
+	lockId := "test-namespace-isolation"
+
+	lockA, err := storage_lock.NewStorageLock(a, lockId)
+	assert.Nil(t, err)
+	lockB, err := storage_lock.NewStorageLock(b, lockId)
+	assert.Nil(t, err)
+	assert.Nil(t, lockA.Lock(ctx, "owner-a"))
+	assert.Nil(t, lockB.Lock(ctx, "owner-b"))
+
+	lockInformationJsonString, err := a.Get(ctx, lockId)
+	assert.Nil(t, err)
+	information, err := storage.LockInformationFromJsonString(lockInformationJsonString)
+	assert.Nil(t, err)
+	assert.Equal(t, lockId, information.LockId)
+	assert.Equal(t, "owner-a", information.OwnerId)
+
+	// 存储中实际的锁ID带有命名空间前缀
+	lockInformationJsonString, err = memoryStorage.Get(ctx, "team-b:"+lockId)
+	assert.Nil(t, err)
+	information, err = storage.LockInformationFromJsonString(lockInformationJsonString)
+	assert.Nil(t, err)
+	assert.Equal(t, "team-b:"+lockId, information.LockId)
+	assert.Equal(t, "owner-b", information.OwnerId)
+
+	assert.Nil(t, lockA.UnLock(ctx, "owner-a"))
+	assert.Nil(t, lockB.UnLock(ctx, "owner-b"))
+}
+
+// List 只列出本命名空间下的锁
+func TestNamespaceStorage_List(t *testing.T) {
+	ctx := context.Background()
+	memoryStorage := memory_storage.NewMemoryStorageWithOptions(memory_storage.NewMemoryStorageOptions().SetDisableAtomicDelete(true))
+	a := newTestNamespaceStorage(t, memoryStorage, NewNamespaceStorageOptions("team-a"))
+	b := newTestNamespaceStorage(t, memoryStorage, NewNamespaceStorageOptions("team-b"))
+
+	create := func(s storage.Storage, lockId string) {
+		information := storagetest.NewTestLockInformation()
+		information.LockId = lockId
+		assert.Nil(t, s.CreateWithVersion(ctx, lockId, information.Version, information))
+	}
+	create(a, "lock-1")
+	create(a, "lock-2")
+	create(b, "lock-3")
+	create(memoryStorage, "lock-4")
+
+	assert.ElementsMatch(t, []string{"lock-1", "lock-2"}, listLockIds(t, a))
+	assert.ElementsMatch(t, []string{"lock-3"}, listLockIds(t, b))
+	assert.ElementsMatch(t, []string{"team-a:lock-1", "team-a:lock-2", "team-b:lock-3", "lock-4"}, listLockIds(t, memoryStorage))
+}
+
+// 存活的锁达到配额之后无法再获取新的锁，释放之后配额被归还
+func TestNamespaceStorage_Quota(t *testing.T) {
+	ctx := context.Background()
+	for _, disableAtomicDelete := range []bool{false, true} {
+		memoryStorage := memory_storage.NewMemoryStorageWithOptions(memory_storage.NewMemoryStorageOptions().SetDisableAtomicDelete(disableAtomicDelete))
+		s := newTestNamespaceStorage(t, memoryStorage, NewNamespaceStorageOptions("team-a").SetMaxLiveLocks(2))
+
+		lock1, err := s.NewStorageLock("test-namespace-quota-1")
+		assert.Nil(t, err)
+		lock2, err := s.NewStorageLock("test-namespace-quota-2")
+		assert.Nil(t, err)
+		lock3, err := s.NewStorageLock("test-namespace-quota-3")
+		assert.Nil(t, err)
+
+		assert.Nil(t, lock1.Lock(ctx, "owner"))
+		assert.Nil(t, lock2.Lock(ctx, "owner"))
+		assert.ErrorIs(t, lock3.Lock(ctx, "owner"), ErrNamespaceQuotaExceeded)
+
+		// 已经持有的锁可以重入
+		assert.Nil(t, lock1.Lock(ctx, "owner"))
+		assert.Nil(t, lock1.UnLock(ctx, "owner"))
+
+		// 其他命名空间不受影响
+		other := newTestNamespaceStorage(t, memoryStorage, NewNamespaceStorageOptions("team-b").SetMaxLiveLocks(1))
+		otherLock, err := other.NewStorageLock("test-namespace-quota-1")
+		assert.Nil(t, err)
+		assert.Nil(t, otherLock.Lock(ctx, "owner"))
+		assert.Nil(t, otherLock.UnLock(ctx, "owner"))
+
+		assert.Nil(t, lock1.UnLock(ctx, "owner"))
+		assert.Nil(t, lock3.Lock(ctx, "owner"))
+		// 墓碑重新变为持有状态同样要检查配额
+		assert.ErrorIs(t, lock1.Lock(ctx, "owner"), ErrNamespaceQuotaExceeded)
+
+		assert.Nil(t, lock2.UnLock(ctx, "owner"))
+		assert.Nil(t, lock3.UnLock(ctx, "owner"))
+	}
+}
+
+// 租约过期的锁不占用配额
+func TestNamespaceStorage_QuotaExpired(t *testing.T) {
+	ctx := context.Background()
+	s := newTestNamespaceStorage(t, memory_storage.NewMemoryStorage(), NewNamespaceStorageOptions("team-a").SetMaxLiveLocks(1))
+
+	expired := storagetest.NewTestLockInformation()
+	expired.LeaseExpireTime = time.Now().Add(-time.Second)
+	assert.Nil(t, s.CreateWithVersion(ctx, "test-namespace-quota-expired", expired.Version, expired))
+
+	lock, err := s.NewStorageLock("test-namespace-quota-live")
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+}
+
+// 统计读取次数的存储
+type testCountingStorage struct {
+	*memory_storage.MemoryStorage
+	getCount     int32
+	getTimeCount int32
+}
+
+func (x *testCountingStorage) Get(ctx context.Context, lockId string) (string, error) {
+	atomic.AddInt32(&x.getCount, 1)
+	return x.MemoryStorage.Get(ctx, lockId)
+}
+
+func (x *testCountingStorage) GetTime(ctx context.Context) (time.Time, error) {
+	atomic.AddInt32(&x.getTimeCount, 1)
+	return x.MemoryStorage.GetTime(ctx)
+}
+
+// 对已经持有的记录的更新（比如续租）不需要检查配额
+func TestNamespaceStorage_QuotaSkipHeldUpdate(t *testing.T) {
+	ctx := context.Background()
+	counting := &testCountingStorage{MemoryStorage: memory_storage.NewMemoryStorage()}
+	s := newTestNamespaceStorage(t, counting, NewNamespaceStorageOptions("team-a").SetMaxLiveLocks(1))
+
+	information := storagetest.NewTestLockInformation()
+	assert.Nil(t, s.CreateWithVersion(ctx, "test-namespace-quota-held", information.Version, information))
+
+	getCount, getTimeCount := atomic.LoadInt32(&counting.getCount), atomic.LoadInt32(&counting.getTimeCount)
+	for i := 0; i < 3; i++ {
+		newInformation := storagetest.NewTestLockInformation(information.Version + 1)
+		assert.Nil(t, s.UpdateWithVersion(ctx, "test-namespace-quota-held", information.Version, newInformation.Version, newInformation))
+		information = newInformation
+	}
+	assert.Equal(t, getCount, atomic.LoadInt32(&counting.getCount))
+	assert.Equal(t, getTimeCount, atomic.LoadInt32(&counting.getTimeCount))
+
+	// 写成墓碑之后再变为持有状态要重新检查配额
+	tombstone := storagetest.NewTestLockInformation(information.Version + 1)
+	tombstone.LockCount = 0
+	assert.Nil(t, s.UpdateWithVersion(ctx, "test-namespace-quota-held", information.Version, tombstone.Version, tombstone))
+	other := storagetest.NewTestLockInformation()
+	assert.Nil(t, s.CreateWithVersion(ctx, "test-namespace-quota-other", other.Version, other))
+	revived := storagetest.NewTestLockInformation(tombstone.Version + 1)
+	assert.ErrorIs(t, s.UpdateWithVersion(ctx, "test-namespace-quota-held", tombstone.Version, revived.Version, revived), ErrNamespaceQuotaExceeded)
+}
+
+// 会话记录不占用配额
+func TestNamespaceStorage_QuotaSession(t *testing.T) {
+	ctx := context.Background()
+	s := newTestNamespaceStorage(t, memory_storage.NewMemoryStorage(), NewNamespaceStorageOptions("team-a").SetMaxLiveLocks(1))
+
+	session, err := storage_lock.NewSession(ctx, s, storage_lock.NewSessionOptions().SetLeaseExpireAfter(time.Second*3).SetLeaseRefreshInterval(time.Second))
+	assert.Nil(t, err)
+	defer session.Close(ctx)
+
+	lockOptions := s.NewStorageLockOptions("test-namespace-quota-session").SetSession(session)
+	lock, err := storage_lock.NewStorageLockWithOptions(s, lockOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+
+	other, err := s.NewStorageLock("test-namespace-quota-session-other")
+	assert.Nil(t, err)
+	assert.ErrorIs(t, other.Lock(ctx, "owner"), ErrNamespaceQuotaExceeded)
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+}
+
+// 通过命名空间创建的锁使用命名空间上的默认参数
+func TestNamespaceStorage_Defaults(t *testing.T) {
+	options := NewNamespaceStorageOptions("team-a").
+		SetLeaseExpireAfter(time.Minute).
+		SetLeaseRefreshInterval(time.Second * 10).
+		SetVersionMissRetryInterval(time.Millisecond * 5)
+	s := newTestNamespaceStorage(t, memory_storage.NewMemoryStorage(), options)
+
+	lockOptions := s.NewStorageLockOptions("test-namespace-defaults")
+	assert.Equal(t, "test-namespace-defaults", lockOptions.LockId)
+	assert.Equal(t, time.Minute, lockOptions.LeaseExpireAfter)
+	assert.Equal(t, time.Second*10, lockOptions.LeaseRefreshInterval)
+	assert.Equal(t, time.Millisecond*5, lockOptions.VersionMissRetryInterval)
+
+	// 没有配置的沿用全局默认值
+	s = newTestNamespaceStorage(t, memory_storage.NewMemoryStorage(), NewNamespaceStorageOptions("team-b"))
+	assert.Equal(t, storage_lock.NewStorageLockOptions().LeaseExpireAfter, s.NewStorageLockOptions("test-namespace-defaults").LeaseExpireAfter)
+}
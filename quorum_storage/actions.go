@@ -0,0 +1,28 @@
+package quorum_storage
+
+// 成员操作的事件，每个成员的每次操作都会发布一个，操作失败时 Action 上带有错误
+const (
+	ActionMemberInit              = "QuorumStorage.Member.Init"
+	ActionMemberGet               = "QuorumStorage.Member.Get"
+	ActionMemberCreateWithVersion = "QuorumStorage.Member.CreateWithVersion"
+	ActionMemberUpdateWithVersion = "QuorumStorage.Member.UpdateWithVersion"
+	ActionMemberDeleteWithVersion = "QuorumStorage.Member.DeleteWithVersion"
+	ActionMemberGetTime           = "QuorumStorage.Member.GetTime"
+	ActionMemberList              = "QuorumStorage.Member.List"
+	ActionMemberClose             = "QuorumStorage.Member.Close"
+
+	// 创建没有达到多数派时，把已经创建成功的成员上的记录删掉
+	ActionMemberRollbackCreate = "QuorumStorage.Member.RollbackCreate"
+
+	// 读取时发现少数成员上的记录缺失或者落后，把多数派的记录补到这些成员上
+	ActionMemberReadRepair = "QuorumStorage.Member.ReadRepair"
+
+	// 成员之间没有多数派、且所有的记录都已经失效时，在所有成员上写入一个更高版本的墓碑让成员重新达成一致
+	ActionMemberReconcile = "QuorumStorage.Member.Reconcile"
+)
+
+// Payload的名字
+const (
+	PayloadMemberIndex = "memberIndex"
+	PayloadMemberName  = "memberName"
+)
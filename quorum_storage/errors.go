@@ -0,0 +1,16 @@
+package quorum_storage
+
+import (
+	"errors"
+	"fmt"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+)
+
+var (
+	ErrNoMembers        = errors.New("quorum storage must have at least one member")
+	ErrQuorumNotReached = errors.New("quorum not reached")
+
+	// ErrMembersDisagree 成员之间的记录不一致，而且没有任何一个版本达到多数派，
+	// 它同时也是一个 ErrVersionMiss，StorageLock 会像处理普通的版本冲突一样稍后重试
+	ErrMembersDisagree = fmt.Errorf("%w: quorum storage members disagree and no version reached quorum", storage_lock.ErrVersionMiss)
+)
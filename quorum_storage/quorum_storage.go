@@ -0,0 +1,551 @@
+package quorum_storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-infrastructure/go-iterator"
+	"github.com/storage-lock/go-events"
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QuorumStorage 把 N 个互相独立的存储组合成一个存储，思路与 Redlock 相同：每个写操作同时发往所有成员，
+// 只有多数派（N/2+1）成员成功才认为成功，少数成员宕机或者网络分区不影响锁的可用性和互斥性。
+//
+// 成员之间的记录可能会出现不一致（部分写入成功、成员宕机期间错过了写入），读取的时候按下面的规则收敛：
+//   - 多数派成员上的记录完全相同：以它为准，并把它补写到版本不高于它或者记录已经失效的成员上（读修复）
+//   - 多数派成员上都没有这条记录：认为锁不存在，少数成员上残留的已经失效的记录会被删除（比如错过了一次删除）
+//   - 没有多数派：如果所有成员上的记录都已经失效（过期或者墓碑），在所有成员上写入一个更高版本的墓碑使成员重新一致，
+//     否则返回 ErrMembersDisagree，等记录过期之后再收敛
+//
+// 修复只会覆盖版本不高于多数派的记录或者已经失效的记录，不会动少数成员上版本更高的有效记录（它可能是正在进行中的写入），
+// 覆盖的时候也是以读到的版本为条件，因此修复与正常的锁操作并发进行的时候不会把别人已经获取到的锁弄丢。
+// 不修复的话，错过了删除的成员上会一直留着旧记录，之后再有一个成员不可用时剩下的成员就凑不出多数派了。
+// 缺失记录的成员只有在不支持原子条件删除（释放锁只写墓碑、记录永远不会被删除）的时候才会补创建：
+// 支持删除的时候，成员上没有记录也可能是因为锁刚刚被释放，这时候把读到的旧记录补回去，
+// 几个读取者各补一个成员就可能把一把已经释放的锁在多数派上"复活"，所有人都要等它的租约过期。
+//
+// 时间取所有成员时间的中位数，个别成员的时钟跑偏不会影响整体。
+type QuorumStorage struct {
+	options *QuorumStorageOptions
+}
+
+var _ storage.Storage = &QuorumStorage{}
+
+// DefaultName 多数派存储默认的名字
+const DefaultName = "quorum-storage"
+
+// NewQuorumStorage 使用给定的成员创建一个多数派存储
+func NewQuorumStorage(members ...storage.Storage) (*QuorumStorage, error) {
+	return NewQuorumStorageWithOptions(NewQuorumStorageOptions().SetMembers(members...))
+}
+
+// NewQuorumStorageWithOptions 使用给定的选项创建一个多数派存储
+func NewQuorumStorageWithOptions(options *QuorumStorageOptions) (*QuorumStorage, error) {
+	if len(options.Members) == 0 {
+		return nil, ErrNoMembers
+	}
+	if options.Name == "" {
+		options.Name = DefaultName
+	}
+	return &QuorumStorage{
+		options: options,
+	}, nil
+}
+
+// Quorum 多数派的成员数
+func (x *QuorumStorage) Quorum() int {
+	return len(x.options.Members)/2 + 1
+}
+
+func (x *QuorumStorage) GetName() string {
+	return x.options.Name
+}
+
+// Capabilities 只有所有的成员都声明了的能力才会被声明，
+// 哪怕只有一个成员不支持原子条件删除，StorageLock 也需要走写墓碑的流程
+func (x *QuorumStorage) Capabilities() []storage.StorageCapability {
+	capabilities := make([]storage.StorageCapability, 0)
+	for _, capability := range []storage.StorageCapability{storage.CapabilityCAS, storage.CapabilityReliableTime, storage.CapabilityAtomicDelete} {
+		supported := true
+		for _, member := range x.options.Members {
+			if !storage.HasCapability(member, capability) {
+				supported = false
+				break
+			}
+		}
+		if supported {
+			capabilities = append(capabilities, capability)
+		}
+	}
+	return capabilities
+}
+
+func (x *QuorumStorage) Init(ctx context.Context) error {
+	results := x.fanOut(ctx, "", ActionMemberInit, nil, func(ctx context.Context, index int, member storage.Storage) error {
+		return member.Init(ctx)
+	})
+	if countSuccess(results) < x.Quorum() {
+		return x.quorumError("Init", results)
+	}
+	return nil
+}
+
+func (x *QuorumStorage) CreateWithVersion(ctx context.Context, lockId string, version storage.Version, lockInformation *storage.LockInformation) error {
+	results := x.fanOut(ctx, lockId, ActionMemberCreateWithVersion, nil, func(ctx context.Context, index int, member storage.Storage) error {
+		return member.CreateWithVersion(ctx, lockId, version, lockInformation)
+	})
+	if countSuccess(results) >= x.Quorum() {
+		return nil
+	}
+
+	// 没有达到多数派，把已经创建成功的成员上的记录删掉，不然这些少数派上的记录会挡住之后的创建
+	// 回滚失败也没关系，少数派上残留的记录会在之后的读取中被多数派的结果覆盖
+	succeeded := make([]int, 0)
+	for index, err := range results {
+		if err == nil {
+			succeeded = append(succeeded, index)
+		}
+	}
+	x.fanOut(ctx, lockId, ActionMemberRollbackCreate, succeeded, func(ctx context.Context, index int, member storage.Storage) error {
+		return member.DeleteWithVersion(ctx, lockId, version, lockInformation)
+	})
+
+	return x.quorumError("CreateWithVersion", results)
+}
+
+func (x *QuorumStorage) UpdateWithVersion(ctx context.Context, lockId string, exceptedVersion, newVersion storage.Version, lockInformation *storage.LockInformation) error {
+	results := x.fanOut(ctx, lockId, ActionMemberUpdateWithVersion, nil, func(ctx context.Context, index int, member storage.Storage) error {
+		return member.UpdateWithVersion(ctx, lockId, exceptedVersion, newVersion, lockInformation)
+	})
+	if countSuccess(results) >= x.Quorum() {
+		return nil
+	}
+	// 少数派上已经更新成功的记录版本号比多数派高，读取的时候不会被当作多数派，
+	// 之后的更新会以相同的新版本号覆盖它，所以这里不需要回滚
+	return x.quorumError("UpdateWithVersion", results)
+}
+
+func (x *QuorumStorage) DeleteWithVersion(ctx context.Context, lockId string, exceptedVersion storage.Version, lockInformation *storage.LockInformation) error {
+	results := x.fanOut(ctx, lockId, ActionMemberDeleteWithVersion, nil, func(ctx context.Context, index int, member storage.Storage) error {
+		return member.DeleteWithVersion(ctx, lockId, exceptedVersion, lockInformation)
+	})
+	if countSuccess(results) >= x.Quorum() {
+		return nil
+	}
+	// 少数派上已经被删除的记录不会被补回来，多数派上仍然是一致的
+	return x.quorumError("DeleteWithVersion", results)
+}
+
+func (x *QuorumStorage) Get(ctx context.Context, lockId string) (string, error) {
+
+	records := make([]*memberRecord, len(x.options.Members))
+	results := x.fanOut(ctx, lockId, ActionMemberGet, nil, func(ctx context.Context, index int, member storage.Storage) error {
+		lockInformationJsonString, err := member.Get(ctx, lockId)
+		if err != nil {
+			return err
+		}
+		// 不同的存储表示锁不存在的方式不同，统一为 ErrLockNotFound
+		if lockInformationJsonString == "" {
+			return storage_lock.ErrLockNotFound
+		}
+		information, err := storage_lock.DecodeLockInformation(lockInformationJsonString)
+		if err != nil {
+			return err
+		}
+		records[index] = &memberRecord{
+			lockInformationJsonString: lockInformationJsonString,
+			information:               information,
+		}
+		return nil
+	})
+
+	notFoundCount := 0
+	seenCount := 0
+	for _, err := range results {
+		if err == nil {
+			seenCount++
+		} else if errors.Is(err, storage_lock.ErrLockNotFound) {
+			notFoundCount++
+			seenCount++
+		}
+	}
+	if notFoundCount >= x.Quorum() {
+		x.repairNotFound(ctx, lockId, records)
+		return "", storage_lock.ErrLockNotFound
+	}
+
+	// 对成员上的记录分组，找出达到多数派的那一组
+	groups := make(map[memberRecordKey][]int)
+	for index, record := range records {
+		if record != nil {
+			key := record.key()
+			groups[key] = append(groups[key], index)
+		}
+	}
+	for _, indexes := range groups {
+		if len(indexes) >= x.Quorum() {
+			consensus := records[indexes[0]]
+			x.readRepair(ctx, lockId, consensus, records, results)
+			return consensus.lockInformationJsonString, nil
+		}
+	}
+
+	// 能读到的成员都凑不够多数派，没法判断
+	if seenCount < x.Quorum() {
+		return "", x.quorumError("Get", results)
+	}
+
+	return x.reconcile(ctx, lockId, records, results)
+}
+
+// 把多数派的记录补写到其它成员上，只覆盖版本不高于多数派的记录和已经失效的记录
+func (x *QuorumStorage) readRepair(ctx context.Context, lockId string, consensus *memberRecord, records []*memberRecord, results []error) {
+	version := consensus.information.Version
+	consensusKey := consensus.key()
+	// 记录会被删除的时候不能补创建，原因见 QuorumStorage 上的说明
+	repairMissing := !storage.SupportsAtomicDelete(x)
+	lagging := make([]int, 0)
+	ahead := make([]int, 0)
+	for index, record := range records {
+		if record == nil {
+			// 读取出错的成员不知道它上面是什么状态，不去动它
+			if repairMissing && errors.Is(results[index], storage_lock.ErrLockNotFound) {
+				lagging = append(lagging, index)
+			}
+		} else if record.key() == consensusKey {
+			continue
+		} else if record.information.Version <= version {
+			// 版本相同但是内容不同的是并发写入中输给了多数派的那一份，它不可能再凑够多数派了
+			lagging = append(lagging, index)
+		} else {
+			ahead = append(ahead, index)
+		}
+	}
+	// 版本更高的记录可能是正在进行中的写入，只有已经失效了才能覆盖，比如错过了删除之后锁又被重新创建
+	if len(ahead) != 0 {
+		if storageTime, err := x.GetTime(ctx); err == nil {
+			for _, index := range ahead {
+				if records[index].isDead(storageTime) {
+					lagging = append(lagging, index)
+				}
+			}
+		}
+	}
+	if len(lagging) == 0 {
+		return
+	}
+	x.fanOut(ctx, lockId, ActionMemberReadRepair, lagging, func(ctx context.Context, index int, member storage.Storage) error {
+		if records[index] == nil {
+			return member.CreateWithVersion(ctx, lockId, version, consensus.information)
+		}
+		return member.UpdateWithVersion(ctx, lockId, records[index].information.Version, version, consensus.information)
+	})
+}
+
+// 多数派上锁已经不存在了，把少数成员上残留的已经失效的记录删掉
+// 有效的记录不能删：它可能是正在进行中的创建，删掉之后这次创建凑够的多数派可能就少了一票
+func (x *QuorumStorage) repairNotFound(ctx context.Context, lockId string, records []*memberRecord) {
+	// 不支持原子删除的存储上记录永远不会被删除，少数成员上有记录只可能是正在进行中的创建
+	if !storage.SupportsAtomicDelete(x) {
+		return
+	}
+	stale := make([]int, 0)
+	for index, record := range records {
+		if record != nil {
+			stale = append(stale, index)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+	storageTime, err := x.GetTime(ctx)
+	if err != nil {
+		return
+	}
+	dead := make([]int, 0, len(stale))
+	for _, index := range stale {
+		if records[index].isDead(storageTime) {
+			dead = append(dead, index)
+		}
+	}
+	if len(dead) == 0 {
+		return
+	}
+	x.fanOut(ctx, lockId, ActionMemberReadRepair, dead, func(ctx context.Context, index int, member storage.Storage) error {
+		return member.DeleteWithVersion(ctx, lockId, records[index].information.Version, records[index].information)
+	})
+}
+
+// 成员之间没有多数派的时候尝试让成员重新达成一致
+// 只有在所有成员上的记录都已经失效的时候才能这么做：此时无论以哪个成员为准，锁都是可以被获取的状态，
+// 在所有成员上写入一个比现有版本都高的墓碑，不会覆盖掉任何有效的持有者
+func (x *QuorumStorage) reconcile(ctx context.Context, lockId string, records []*memberRecord, results []error) (string, error) {
+
+	storageTime, err := x.GetTime(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var maxVersion storage.Version
+	for _, record := range records {
+		if record == nil {
+			continue
+		}
+		if !record.isDead(storageTime) {
+			return "", ErrMembersDisagree
+		}
+		if record.information.Version > maxVersion {
+			maxVersion = record.information.Version
+		}
+	}
+
+	tombstone := &storage.LockInformation{
+		LockId:          lockId,
+		Version:         maxVersion + 1,
+		LockCount:       0,
+		LockBeginTime:   storageTime,
+		LeaseExpireTime: storageTime,
+	}
+	reconcileResults := x.fanOut(ctx, lockId, ActionMemberReconcile, nil, func(ctx context.Context, index int, member storage.Storage) error {
+		if records[index] == nil {
+			if !errors.Is(results[index], storage_lock.ErrLockNotFound) {
+				return results[index]
+			}
+			return member.CreateWithVersion(ctx, lockId, tombstone.Version, tombstone)
+		}
+		return member.UpdateWithVersion(ctx, lockId, records[index].information.Version, tombstone.Version, tombstone)
+	})
+	if countSuccess(reconcileResults) < x.Quorum() {
+		return "", ErrMembersDisagree
+	}
+	return tombstone.ToJsonString(), nil
+}
+
+// GetTime 取所有成员时间的中位数，至少需要多数派成员返回时间
+func (x *QuorumStorage) GetTime(ctx context.Context) (time.Time, error) {
+	times := make([]time.Time, len(x.options.Members))
+	results := x.fanOut(ctx, "", ActionMemberGetTime, nil, func(ctx context.Context, index int, member storage.Storage) error {
+		t, err := member.GetTime(ctx)
+		if err != nil {
+			return err
+		}
+		times[index] = t
+		return nil
+	})
+	if countSuccess(results) < x.Quorum() {
+		return time.Time{}, x.quorumError("GetTime", results)
+	}
+
+	validTimes := make([]time.Time, 0, len(times))
+	for index, t := range times {
+		if results[index] == nil {
+			validTimes = append(validTimes, t)
+		}
+	}
+	sort.Slice(validTimes, func(i, j int) bool {
+		return validTimes[i].Before(validTimes[j])
+	})
+	// 偶数个的时候取中间偏小的那个，宁可让租约显得更晚过期
+	return validTimes[(len(validTimes)-1)/2], nil
+}
+
+func (x *QuorumStorage) Close(ctx context.Context) error {
+	results := x.fanOut(ctx, "", ActionMemberClose, nil, func(ctx context.Context, index int, member storage.Storage) error {
+		return member.Close(ctx)
+	})
+	for _, err := range results {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List 汇总所有成员上的锁ID，然后逐个按多数派的规则读取
+func (x *QuorumStorage) List(ctx context.Context) (iterator.Iterator[*storage.LockInformation], error) {
+	lockIdSets := make([]map[string]struct{}, len(x.options.Members))
+	results := x.fanOut(ctx, "", ActionMemberList, nil, func(ctx context.Context, index int, member storage.Storage) error {
+		it, err := member.List(ctx)
+		if err != nil {
+			return err
+		}
+		lockIds := make(map[string]struct{})
+		for it.Next() {
+			lockIds[it.Value().LockId] = struct{}{}
+		}
+		lockIdSets[index] = lockIds
+		return nil
+	})
+	if countSuccess(results) < x.Quorum() {
+		return nil, x.quorumError("List", results)
+	}
+
+	lockIds := make(map[string]struct{})
+	for _, lockIdSet := range lockIdSets {
+		for lockId := range lockIdSet {
+			lockIds[lockId] = struct{}{}
+		}
+	}
+
+	slice := make([]*storage.LockInformation, 0, len(lockIds))
+	for lockId := range lockIds {
+		lockInformationJsonString, err := x.Get(ctx, lockId)
+		if err != nil {
+			if errors.Is(err, storage_lock.ErrLockNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		information, err := storage_lock.DecodeLockInformation(lockInformationJsonString)
+		if err != nil {
+			return nil, err
+		}
+		slice = append(slice, information)
+	}
+	return iterator.FromSlice(slice), nil
+}
+
+// fanOut 在给定的成员上并发执行 f，indexes 为 nil 时在所有的成员上执行
+// 返回值与成员一一对应，没有执行的成员上是 errNotExecuted，每个成员的执行结果都会发布一个事件
+func (x *QuorumStorage) fanOut(ctx context.Context, lockId string, actionName string, indexes []int, f func(ctx context.Context, index int, member storage.Storage) error) []error {
+	results := make([]error, len(x.options.Members))
+	if indexes == nil {
+		indexes = make([]int, len(x.options.Members))
+		for index := range x.options.Members {
+			indexes[index] = index
+		}
+	} else {
+		for index := range results {
+			results[index] = errNotExecuted
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	for _, index := range indexes {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			member := x.options.Members[index]
+
+			memberCtx := ctx
+			if x.options.MemberTimeout > 0 {
+				var cancelFunc context.CancelFunc
+				memberCtx, cancelFunc = context.WithTimeout(ctx, x.options.MemberTimeout)
+				defer cancelFunc()
+			}
+
+			err := f(memberCtx, index, member)
+			results[index] = err
+
+			action := events.NewAction(actionName).
+				AddPayload(PayloadMemberIndex, index).
+				AddPayload(PayloadMemberName, member.GetName())
+			if err != nil {
+				action.SetErr(err)
+			}
+			events.NewEvent(lockId).SetStorageName(x.GetName()).SetListeners(x.options.EventListeners).AddAction(action).Publish(ctx)
+		}(index)
+	}
+	wg.Wait()
+	return results
+}
+
+// 没有达到多数派时返回的错误，尽量还原成 StorageLock 能够理解的错误：
+// 可用的成员凑不够多数派时返回 ErrQuorumNotReached；多数派上锁不存在则返回 ErrLockNotFound；有成员版本冲突则返回 ErrLockAlreadyExists/ErrVersionMiss 让 StorageLock 重试
+func (x *QuorumStorage) quorumError(operation string, results []error) error {
+	notFoundCount := 0
+	unavailableCount := 0
+	alreadyExists := false
+	versionMiss := false
+	messages := make([]string, 0)
+	for index, err := range results {
+		if err == nil || err == errNotExecuted {
+			continue
+		}
+		switch {
+		case errors.Is(err, storage_lock.ErrLockNotFound):
+			notFoundCount++
+		case errors.Is(err, storage_lock.ErrLockAlreadyExists):
+			alreadyExists = true
+		case errors.Is(err, storage_lock.ErrVersionMiss):
+			versionMiss = true
+		default:
+			unavailableCount++
+		}
+		messages = append(messages, fmt.Sprintf("%s: %s", x.options.Members[index].GetName(), err.Error()))
+	}
+
+	var sentinel error
+	switch {
+	case len(results)-unavailableCount < x.Quorum():
+		// 可用的成员已经凑不够多数派了，重试也没有意义
+		sentinel = ErrQuorumNotReached
+	case notFoundCount >= x.Quorum():
+		sentinel = storage_lock.ErrLockNotFound
+	case alreadyExists:
+		sentinel = storage_lock.ErrLockAlreadyExists
+	case versionMiss || notFoundCount > 0:
+		// 少数成员上没有这条记录说明成员之间暂时不一致，与版本冲突一样稍后重试，读取的时候会修复
+		sentinel = storage_lock.ErrVersionMiss
+	default:
+		sentinel = ErrQuorumNotReached
+	}
+	return fmt.Errorf("%w: %s succeeded on %d/%d members, quorum is %d: [%s]", sentinel, operation, countSuccess(results), len(results), x.Quorum(), strings.Join(messages, "; "))
+}
+
+// 没有在这个成员上执行
+var errNotExecuted = errors.New("not executed")
+
+func countSuccess(results []error) int {
+	count := 0
+	for _, err := range results {
+		if err == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// ------------------------------------------------ ---------------------------------------------------------------------
+
+// 某个成员上读取到的锁记录
+type memberRecord struct {
+	lockInformationJsonString string
+	information               *storage.LockInformation
+}
+
+// 用来判断两个成员上的记录是否相同，不直接比较JSON字符串，因为不同的存储序列化出来的格式可能不一样
+type memberRecordKey struct {
+	version         storage.Version
+	ownerId         string
+	lockCount       int
+	lockBeginTime   int64
+	leaseExpireTime int64
+}
+
+func (x *memberRecord) key() memberRecordKey {
+	return memberRecordKey{
+		version:         x.information.Version,
+		ownerId:         x.information.OwnerId,
+		lockCount:       x.information.LockCount,
+		lockBeginTime:   x.information.LockBeginTime.UnixNano(),
+		leaseExpireTime: x.information.LeaseExpireTime.UnixNano(),
+	}
+}
+
+// 记录是否已经失效，会话模式下的锁记录有效性取决于会话而不是自己的租约，这一层判断不了，保守的认为它仍然有效
+func (x *memberRecord) isDead(storageTime time.Time) bool {
+	if x.information.LockCount == 0 {
+		return true
+	}
+	if strings.Contains(x.information.OwnerId, storage_lock.SessionOwnerIdSeparator+storage_lock.SessionIDPrefix) {
+		return false
+	}
+	return storageTime.After(x.information.LeaseExpireTime)
+}
@@ -0,0 +1,61 @@
+package quorum_storage
+
+import (
+	"github.com/storage-lock/go-events"
+	"github.com/storage-lock/go-storage"
+	"time"
+)
+
+// QuorumStorageOptions 创建多数派存储的相关选项
+type QuorumStorageOptions struct {
+
+	// 成员存储，成员之间应当是互相独立的（不同的机器、不同的数据库），建议使用奇数个
+	Members []storage.Storage
+
+	// 存储的名字，用于在事件中区分不同的存储实例，未设置的话使用 DefaultName
+	Name string
+
+	// 对单个成员的每次操作的超时时间，为 0 表示不单独设置超时，只受调用方 ctx 的控制
+	// 设置之后一个卡住的成员不会拖慢整体的操作，只要其他成员能凑够多数派就行
+	MemberTimeout time.Duration
+
+	// 每个成员每次操作的结果都会作为一个事件发布到这些监听器上
+	EventListeners []events.Listener
+}
+
+// NewQuorumStorageOptions 使用默认值创建多数派存储的选项
+func NewQuorumStorageOptions() *QuorumStorageOptions {
+	return &QuorumStorageOptions{
+		Name: DefaultName,
+	}
+}
+
+func (x *QuorumStorageOptions) SetMembers(members ...storage.Storage) *QuorumStorageOptions {
+	x.Members = members
+	return x
+}
+
+func (x *QuorumStorageOptions) AddMember(member storage.Storage) *QuorumStorageOptions {
+	x.Members = append(x.Members, member)
+	return x
+}
+
+func (x *QuorumStorageOptions) SetName(name string) *QuorumStorageOptions {
+	x.Name = name
+	return x
+}
+
+func (x *QuorumStorageOptions) SetMemberTimeout(memberTimeout time.Duration) *QuorumStorageOptions {
+	x.MemberTimeout = memberTimeout
+	return x
+}
+
+func (x *QuorumStorageOptions) SetEventListeners(eventListeners []events.Listener) *QuorumStorageOptions {
+	x.EventListeners = eventListeners
+	return x
+}
+
+func (x *QuorumStorageOptions) AddEventListeners(listener events.Listener) *QuorumStorageOptions {
+	x.EventListeners = append(x.EventListeners, listener)
+	return x
+}
@@ -0,0 +1,320 @@
+package quorum_storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-events"
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/storage-lock/go-storage-lock/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+var errTestMemberDown = errors.New("test member down")
+
+// 可以模拟宕机的成员
+type testMember struct {
+	*memory_storage.MemoryStorage
+	mutex sync.Mutex
+	down  bool
+}
+
+func newTestMember(name string, nowFunc ...func() time.Time) *testMember {
+	options := memory_storage.NewMemoryStorageOptions().SetName(name)
+	if len(nowFunc) != 0 {
+		options.SetNowFunc(nowFunc[0])
+	}
+	return &testMember{MemoryStorage: memory_storage.NewMemoryStorageWithOptions(options)}
+}
+
+func (x *testMember) setDown(down bool) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.down = down
+}
+
+func (x *testMember) err() error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.down {
+		return errTestMemberDown
+	}
+	return nil
+}
+
+func (x *testMember) Get(ctx context.Context, lockId string) (string, error) {
+	if err := x.err(); err != nil {
+		return "", err
+	}
+	return x.MemoryStorage.Get(ctx, lockId)
+}
+
+func (x *testMember) CreateWithVersion(ctx context.Context, lockId string, version storage.Version, lockInformation *storage.LockInformation) error {
+	if err := x.err(); err != nil {
+		return err
+	}
+	return x.MemoryStorage.CreateWithVersion(ctx, lockId, version, lockInformation)
+}
+
+func (x *testMember) UpdateWithVersion(ctx context.Context, lockId string, exceptedVersion, newVersion storage.Version, lockInformation *storage.LockInformation) error {
+	if err := x.err(); err != nil {
+		return err
+	}
+	return x.MemoryStorage.UpdateWithVersion(ctx, lockId, exceptedVersion, newVersion, lockInformation)
+}
+
+func (x *testMember) DeleteWithVersion(ctx context.Context, lockId string, exceptedVersion storage.Version, lockInformation *storage.LockInformation) error {
+	if err := x.err(); err != nil {
+		return err
+	}
+	return x.MemoryStorage.DeleteWithVersion(ctx, lockId, exceptedVersion, lockInformation)
+}
+
+func (x *testMember) GetTime(ctx context.Context) (time.Time, error) {
+	if err := x.err(); err != nil {
+		return time.Time{}, err
+	}
+	return x.MemoryStorage.GetTime(ctx)
+}
+
+func newTestQuorumStorage(t *testing.T, members ...*testMember) *QuorumStorage {
+	storages := make([]storage.Storage, 0, len(members))
+	for _, member := range members {
+		storages = append(storages, member)
+	}
+	s, err := NewQuorumStorage(storages...)
+	assert.Nil(t, err)
+	return s
+}
+
+func newTestQuorumLock(t *testing.T, s storage.Storage, lockId string) *storage_lock.StorageLock {
+	options := storage_lock.NewStorageLockOptionsWithLockId(lockId).
+		SetLeaseExpireAfter(time.Second * 3).
+		SetLeaseRefreshInterval(time.Second).
+		SetVersionMissRetryInterval(time.Millisecond * 5)
+	lock, err := storage_lock.NewStorageLockWithOptions(s, options)
+	assert.Nil(t, err)
+	return lock
+}
+
+func TestQuorumStorage_Conformance(t *testing.T) {
+	s := newTestQuorumStorage(t, newTestMember("a"), newTestMember("b"), newTestMember("c"))
+	// 并发的条件写可能被不同的写入者分别抢到部分成员，谁都凑不够多数
+	storagetest.RunConformanceWithOptions(t, func() storage.Storage {
+		return s
+	}, storagetest.NewConformanceOptions().SetAllowNoWinner(true))
+}
+
+func TestNewQuorumStorage_NoMembers(t *testing.T) {
+	_, err := NewQuorumStorage()
+	assert.ErrorIs(t, err, ErrNoMembers)
+}
+
+// 少数成员宕机不影响锁的获取和释放
+func TestQuorumStorage_MinorityDown(t *testing.T) {
+	ctx := context.Background()
+	a, b, c := newTestMember("a"), newTestMember("b"), newTestMember("c")
+	s := newTestQuorumStorage(t, a, b, c)
+	lock := newTestQuorumLock(t, s, "test-quorum-minority-down")
+
+	c.setDown(true)
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+
+	// 多数成员宕机则无法获取锁
+	b.setDown(true)
+	err := lock.Lock(ctx, "owner")
+	assert.ErrorIs(t, err, ErrQuorumNotReached)
+}
+
+// 创建没有达到多数派时回滚已经创建成功的成员
+func TestQuorumStorage_RollbackPartialCreate(t *testing.T) {
+	ctx := context.Background()
+	a, b, c := newTestMember("a"), newTestMember("b"), newTestMember("c")
+	s := newTestQuorumStorage(t, a, b, c)
+	b.setDown(true)
+	c.setDown(true)
+
+	information := storagetest.NewTestLockInformation()
+	err := s.CreateWithVersion(ctx, "test-quorum-rollback", information.Version, information)
+	assert.ErrorIs(t, err, ErrQuorumNotReached)
+
+	_, err = a.Get(ctx, "test-quorum-rollback")
+	assert.ErrorIs(t, err, storage_lock.ErrLockNotFound)
+}
+
+// 读取时把多数派的记录补到版本落后的成员上
+func TestQuorumStorage_ReadRepair(t *testing.T) {
+	ctx := context.Background()
+	a, b, c := newTestMember("a"), newTestMember("b"), newTestMember("c")
+	s := newTestQuorumStorage(t, a, b, c)
+	lockId := "test-quorum-read-repair"
+
+	old := storagetest.NewTestLockInformation(1)
+	current := storagetest.NewTestLockInformation(2)
+	assert.Nil(t, a.CreateWithVersion(ctx, lockId, current.Version, current))
+	assert.Nil(t, b.CreateWithVersion(ctx, lockId, current.Version, current))
+	assert.Nil(t, c.CreateWithVersion(ctx, lockId, old.Version, old))
+
+	lockInformationJsonString, err := s.Get(ctx, lockId)
+	assert.Nil(t, err)
+	assert.Equal(t, current.ToJsonString(), lockInformationJsonString)
+
+	lockInformationJsonString, err = c.Get(ctx, lockId)
+	assert.Nil(t, err)
+	assert.Equal(t, current.ToJsonString(), lockInformationJsonString)
+
+	// 记录会被删除的时候不会给缺失的成员补创建，避免把刚释放的锁复活
+	d := newTestMember("d")
+	s = newTestQuorumStorage(t, a, b, c, d)
+	_, err = s.Get(ctx, lockId)
+	assert.Nil(t, err)
+	_, err = d.Get(ctx, lockId)
+	assert.ErrorIs(t, err, storage_lock.ErrLockNotFound)
+}
+
+// 只写墓碑的存储上记录永远不会被删除，缺失的成员可以安全的补创建
+func TestQuorumStorage_ReadRepairMissingWithTombstone(t *testing.T) {
+	ctx := context.Background()
+	members := make([]*testMember, 0)
+	for _, name := range []string{"a", "b", "c"} {
+		options := memory_storage.NewMemoryStorageOptions().SetName(name).SetDisableAtomicDelete(true)
+		members = append(members, &testMember{MemoryStorage: memory_storage.NewMemoryStorageWithOptions(options)})
+	}
+	s := newTestQuorumStorage(t, members...)
+	lockId := "test-quorum-read-repair-missing"
+
+	information := storagetest.NewTestLockInformation()
+	assert.Nil(t, members[0].CreateWithVersion(ctx, lockId, information.Version, information))
+	assert.Nil(t, members[1].CreateWithVersion(ctx, lockId, information.Version, information))
+
+	_, err := s.Get(ctx, lockId)
+	assert.Nil(t, err)
+	lockInformationJsonString, err := members[2].Get(ctx, lockId)
+	assert.Nil(t, err)
+	assert.Equal(t, information.ToJsonString(), lockInformationJsonString)
+}
+
+// 错过了删除的成员上残留的旧记录失效之后会被修复，之后再有成员不可用也不影响读取
+func TestQuorumStorage_RepairMissedDelete(t *testing.T) {
+	ctx := context.Background()
+	a, b, c := newTestMember("a"), newTestMember("b"), newTestMember("c")
+	s := newTestQuorumStorage(t, a, b, c)
+	lockId := "test-quorum-repair-missed-delete"
+
+	// 多数派上已经删除了，c 错过了删除
+	stale := storagetest.NewTestLockInformation(5)
+	stale.LeaseExpireTime = time.Now().Add(-time.Second)
+	assert.Nil(t, c.CreateWithVersion(ctx, lockId, stale.Version, stale))
+	_, err := s.Get(ctx, lockId)
+	assert.ErrorIs(t, err, storage_lock.ErrLockNotFound)
+	_, err = c.Get(ctx, lockId)
+	assert.ErrorIs(t, err, storage_lock.ErrLockNotFound)
+
+	// 锁在多数派上被重新创建之后 c 上的旧记录版本更高，失效了也会被覆盖
+	current := storagetest.NewTestLockInformation(1)
+	assert.Nil(t, a.CreateWithVersion(ctx, lockId, current.Version, current))
+	assert.Nil(t, b.CreateWithVersion(ctx, lockId, current.Version, current))
+	assert.Nil(t, c.CreateWithVersion(ctx, lockId, stale.Version, stale))
+	lockInformationJsonString, err := s.Get(ctx, lockId)
+	assert.Nil(t, err)
+	assert.Equal(t, current.ToJsonString(), lockInformationJsonString)
+	lockInformationJsonString, err = c.Get(ctx, lockId)
+	assert.Nil(t, err)
+	assert.Equal(t, current.ToJsonString(), lockInformationJsonString)
+
+	b.setDown(true)
+	lockInformationJsonString, err = s.Get(ctx, lockId)
+	assert.Nil(t, err)
+	assert.Equal(t, current.ToJsonString(), lockInformationJsonString)
+
+	// 版本更高的有效记录可能是正在进行中的写入，不会被覆盖
+	b.setDown(false)
+	assert.Nil(t, c.DeleteWithVersion(ctx, lockId, current.Version, current))
+	ahead := storagetest.NewTestLockInformation(2)
+	assert.Nil(t, c.CreateWithVersion(ctx, lockId, ahead.Version, ahead))
+	_, err = s.Get(ctx, lockId)
+	assert.Nil(t, err)
+	lockInformationJsonString, err = c.Get(ctx, lockId)
+	assert.Nil(t, err)
+	assert.Equal(t, ahead.ToJsonString(), lockInformationJsonString)
+}
+
+// 成员之间没有多数派时，记录都失效了就写一个更高版本的墓碑重新收敛，否则返回版本冲突
+func TestQuorumStorage_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	a, b, c := newTestMember("a"), newTestMember("b"), newTestMember("c")
+	s := newTestQuorumStorage(t, a, b, c)
+	lockId := "test-quorum-reconcile"
+
+	alive := storagetest.NewTestLockInformation(3)
+	expired := storagetest.NewTestLockInformation(5)
+	expired.LeaseExpireTime = time.Now().Add(-time.Second)
+	assert.Nil(t, a.CreateWithVersion(ctx, lockId, alive.Version, alive))
+	assert.Nil(t, b.CreateWithVersion(ctx, lockId, expired.Version, expired))
+
+	_, err := s.Get(ctx, lockId)
+	assert.ErrorIs(t, err, ErrMembersDisagree)
+	assert.ErrorIs(t, err, storage_lock.ErrVersionMiss)
+
+	alive.LeaseExpireTime = time.Now().Add(-time.Second)
+	assert.Nil(t, a.UpdateWithVersion(ctx, lockId, alive.Version, alive.Version, alive))
+
+	lockInformationJsonString, err := s.Get(ctx, lockId)
+	assert.Nil(t, err)
+	tombstone, err := storage.LockInformationFromJsonString(lockInformationJsonString)
+	assert.Nil(t, err)
+	assert.Equal(t, storage.Version(6), tombstone.Version)
+	assert.Equal(t, 0, tombstone.LockCount)
+
+	// 收敛之后可以正常的获取锁
+	lock := newTestQuorumLock(t, s, lockId)
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+}
+
+// 时间取成员的中位数
+func TestQuorumStorage_GetTimeMedian(t *testing.T) {
+	base := time.Now()
+	s := newTestQuorumStorage(t,
+		newTestMember("a", func() time.Time { return base.Add(-time.Hour) }),
+		newTestMember("b", func() time.Time { return base }),
+		newTestMember("c", func() time.Time { return base.Add(time.Hour) }),
+	)
+	storageTime, err := s.GetTime(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, base.Equal(storageTime))
+}
+
+// 每个成员的操作结果都会发布事件
+func TestQuorumStorage_MemberEvents(t *testing.T) {
+	a, b, c := newTestMember("a"), newTestMember("b"), newTestMember("c")
+	c.setDown(true)
+
+	mutex := sync.Mutex{}
+	outcomes := make(map[string]error)
+	listener := events.NewListenerWrapper("test-quorum-listener", func(ctx context.Context, e *events.Event) {
+		for _, action := range e.Actions {
+			if action.Name == ActionMemberCreateWithVersion {
+				mutex.Lock()
+				outcomes[action.GetPayloadAsString(PayloadMemberName)] = action.Err
+				mutex.Unlock()
+			}
+		}
+	})
+	s, err := NewQuorumStorageWithOptions(NewQuorumStorageOptions().SetMembers(a, b, c).AddEventListeners(listener))
+	assert.Nil(t, err)
+
+	information := storagetest.NewTestLockInformation()
+	assert.Nil(t, s.CreateWithVersion(context.Background(), "test-quorum-events", information.Version, information))
+
+	assert.Len(t, outcomes, 3)
+	assert.Nil(t, outcomes["a"])
+	assert.Nil(t, outcomes["b"])
+	assert.ErrorIs(t, outcomes["c"], errTestMemberDown)
+}
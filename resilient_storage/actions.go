@@ -0,0 +1,33 @@
+package resilient_storage
+
+const (
+
+	// 一次操作因为临时性的错误失败了，即将重试
+	ActionRetry = "ResilientStorage.Retry"
+
+	// 重试次数用完，操作最终失败
+	ActionRetryExhausted = "ResilientStorage.Retry.Exhausted"
+
+	// 写操作结果未知（比如CAS超时），重新读取记录判断写入是否已经生效
+	ActionAmbiguousWriteCheck      = "ResilientStorage.AmbiguousWrite.Check"
+	ActionAmbiguousWriteApplied    = "ResilientStorage.AmbiguousWrite.Applied"
+	ActionAmbiguousWriteNotApplied = "ResilientStorage.AmbiguousWrite.NotApplied"
+	ActionAmbiguousWriteConflict   = "ResilientStorage.AmbiguousWrite.Conflict"
+	ActionAmbiguousWriteCheckError = "ResilientStorage.AmbiguousWrite.Check.Error"
+
+	// 放弃之前最后一次确认也失败了，写入是否生效无法确定
+	ActionAmbiguousWriteUnresolved = "ResilientStorage.AmbiguousWrite.Unresolved"
+
+	// 熔断器的状态变化
+	ActionCircuitOpen     = "ResilientStorage.Circuit.Open"
+	ActionCircuitHalfOpen = "ResilientStorage.Circuit.HalfOpen"
+	ActionCircuitClose    = "ResilientStorage.Circuit.Close"
+	ActionCircuitReject   = "ResilientStorage.Circuit.Reject"
+)
+
+// Payload的名字
+const (
+	PayloadOperation = "operation"
+	PayloadAttempt   = "attempt"
+	PayloadSleep     = "sleep"
+)
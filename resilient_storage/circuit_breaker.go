@@ -0,0 +1,142 @@
+package resilient_storage
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitState 熔断器的状态
+type CircuitState int
+
+const (
+
+	// CircuitClosed 正常状态，请求正常发往后端
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen 连续失败的次数达到了阈值，在冷却时间内所有的请求直接失败
+	CircuitOpen
+
+	// CircuitHalfOpen 冷却时间过了，放一个探测请求过去，成功则关闭熔断器，失败则重新打开
+	CircuitHalfOpen
+)
+
+func (x CircuitState) String() string {
+	switch x {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// 熔断器，只统计临时性的错误，锁语义上的错误说明后端是正常工作的
+type circuitBreaker struct {
+	lock sync.Mutex
+
+	// 连续失败多少次之后打开熔断器，为 0 表示不启用熔断
+	failureThreshold int
+
+	// 打开之后多久进入半开状态
+	openDuration time.Duration
+
+	state            CircuitState
+	consecutiveFails int
+	openedAt         time.Time
+
+	// 半开状态下是否已经有探测请求在进行中了
+	probing bool
+}
+
+func newCircuitBreaker(failureThreshold int, openDuration time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+	}
+}
+
+// allow 判断当前是否允许请求通过，返回值中的 CircuitState 不为 from 时表示状态发生了变化
+func (x *circuitBreaker) allow(now time.Time) (allowed bool, from, to CircuitState) {
+	if x.failureThreshold <= 0 {
+		return true, CircuitClosed, CircuitClosed
+	}
+
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	from = x.state
+	switch x.state {
+	case CircuitOpen:
+		if now.Sub(x.openedAt) < x.openDuration {
+			return false, from, x.state
+		}
+		x.state = CircuitHalfOpen
+		x.probing = true
+		return true, from, x.state
+	case CircuitHalfOpen:
+		// 同一时刻只放一个探测请求
+		if x.probing {
+			return false, from, x.state
+		}
+		x.probing = true
+		return true, from, x.state
+	default:
+		return true, from, x.state
+	}
+}
+
+// onSuccess 请求成功（或者得到了确定的答复），关闭熔断器
+func (x *circuitBreaker) onSuccess() (from, to CircuitState) {
+	if x.failureThreshold <= 0 {
+		return CircuitClosed, CircuitClosed
+	}
+
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	from = x.state
+	x.state = CircuitClosed
+	x.consecutiveFails = 0
+	x.probing = false
+	return from, x.state
+}
+
+// onFailure 请求遇到了临时性的错误
+func (x *circuitBreaker) onFailure(now time.Time) (from, to CircuitState) {
+	if x.failureThreshold <= 0 {
+		return CircuitClosed, CircuitClosed
+	}
+
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	from = x.state
+	x.consecutiveFails++
+	x.probing = false
+	if x.state == CircuitHalfOpen || x.consecutiveFails >= x.failureThreshold {
+		x.state = CircuitOpen
+		x.openedAt = now
+	}
+	return from, x.state
+}
+
+// onAbort 请求被调用方取消了，不改变熔断器的状态，只是让出探测的名额
+func (x *circuitBreaker) onAbort() {
+	if x.failureThreshold <= 0 {
+		return
+	}
+
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	x.probing = false
+}
+
+func (x *circuitBreaker) getState() CircuitState {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	return x.state
+}
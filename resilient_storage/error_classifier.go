@@ -0,0 +1,33 @@
+package resilient_storage
+
+import (
+	"context"
+	"errors"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+)
+
+// ErrorClassifier 判断存储返回的错误是否是临时性的，临时性的错误会被重试并计入熔断器的失败次数
+type ErrorClassifier func(err error) bool
+
+// DefaultErrorClassifier 默认的错误分类：
+// 锁语义上的错误（版本miss、锁不存在、锁已存在、锁被占用）是存储正常工作时给出的确定的答复，不是临时性的；
+// 调用方取消了 ctx 也不需要再重试；ErrCircuitOpen 表示熔断器打开了，应该快速失败。
+// 除此之外的错误（网络错误、单次操作超时、后端报错等）都认为是临时性的
+func DefaultErrorClassifier(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, definite := range []error{
+		storage_lock.ErrVersionMiss,
+		storage_lock.ErrLockNotFound,
+		storage_lock.ErrLockAlreadyExists,
+		storage_lock.ErrLockBusy,
+		context.Canceled,
+		ErrCircuitOpen,
+	} {
+		if errors.Is(err, definite) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,14 @@
+package resilient_storage
+
+import "errors"
+
+var (
+	ErrStorageNil = errors.New("resilient storage must wrap a storage")
+
+	// ErrCircuitOpen 熔断器处于打开状态，后端被认为不可用，请求直接失败而不会发往后端
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+
+	// ErrAmbiguousWrite 写操作遇到了临时性的错误，重试用完之前一直没能确认写入是否已经生效，
+	// 调用方需要重新读取记录才能知道结果，不能简单的当成写入失败
+	ErrAmbiguousWrite = errors.New("write result is ambiguous")
+)
@@ -0,0 +1,396 @@
+package resilient_storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-infrastructure/go-iterator"
+	"github.com/storage-lock/go-events"
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"time"
+)
+
+// ResilientStorage 包装一个存储，为它加上单次操作超时、临时性错误重试和熔断。
+//
+// StorageLock 遇到版本miss和锁被占用之外的存储错误会立即返回，一次网络抖动就会让获取锁失败，
+// 用 ResilientStorage 包装之后这类临时性的错误在存储这一层就被重试掉了。
+//
+// 写操作的重试需要特别小心：一个超时的CAS可能已经在后端生效了，如果直接重试，
+// 第二次会因为版本号已经变了而失败，调用方会误以为写入失败。所以写操作遇到临时性错误之后，
+// 下一次重试前会先重新读取记录：
+//   - 记录已经是本次要写入的内容：写入已经生效，直接返回成功
+//   - 记录仍然是写入前的状态：写入没有生效，可以安全的重试
+//   - 记录被别人改掉了：返回对应的版本冲突错误，交给 StorageLock 按正常的冲突流程处理
+type ResilientStorage struct {
+	storage        storage.Storage
+	options        *ResilientStorageOptions
+	circuitBreaker *circuitBreaker
+}
+
+var _ storage.Storage = &ResilientStorage{}
+
+// NewResilientStorage 使用默认选项包装给定的存储
+func NewResilientStorage(s storage.Storage) (*ResilientStorage, error) {
+	return NewResilientStorageWithOptions(s, NewResilientStorageOptions())
+}
+
+// NewResilientStorageWithOptions 使用给定的选项包装给定的存储
+func NewResilientStorageWithOptions(s storage.Storage, options *ResilientStorageOptions) (*ResilientStorage, error) {
+	if s == nil {
+		return nil, ErrStorageNil
+	}
+	if options.ErrorClassifier == nil {
+		options.ErrorClassifier = DefaultErrorClassifier
+	}
+	return &ResilientStorage{
+		storage:        s,
+		options:        options,
+		circuitBreaker: newCircuitBreaker(options.CircuitBreakerFailureThreshold, options.CircuitBreakerOpenDuration),
+	}, nil
+}
+
+// Unwrap 返回被包装的存储
+func (x *ResilientStorage) Unwrap() storage.Storage {
+	return x.storage
+}
+
+// CircuitState 熔断器当前的状态
+func (x *ResilientStorage) CircuitState() CircuitState {
+	return x.circuitBreaker.getState()
+}
+
+func (x *ResilientStorage) GetName() string {
+	if x.options.Name != "" {
+		return x.options.Name
+	}
+	return x.storage.GetName()
+}
+
+// Capabilities 与被包装的存储相同
+func (x *ResilientStorage) Capabilities() []storage.StorageCapability {
+	if declarer, ok := x.storage.(storage.CapabilityDeclarer); ok {
+		return declarer.Capabilities()
+	}
+	return nil
+}
+
+func (x *ResilientStorage) Init(ctx context.Context) error {
+	return x.do(ctx, "", "Init", func(ctx context.Context) error {
+		return x.storage.Init(ctx)
+	}, nil)
+}
+
+func (x *ResilientStorage) UpdateWithVersion(ctx context.Context, lockId string, exceptedVersion, newVersion storage.Version, lockInformation *storage.LockInformation) error {
+	return x.do(ctx, lockId, "UpdateWithVersion", func(ctx context.Context) error {
+		return x.storage.UpdateWithVersion(ctx, lockId, exceptedVersion, newVersion, lockInformation)
+	}, func(ctx context.Context) (bool, error) {
+		current, err := x.getLockInformation(ctx, lockId)
+		if err != nil {
+			// 记录已经不在了，不可能是我们的更新造成的
+			if errors.Is(err, storage_lock.ErrLockNotFound) {
+				return false, storage_lock.ErrVersionMiss
+			}
+			return false, err
+		}
+		if current.Version == newVersion && isSameLockInformation(current, lockInformation) {
+			return true, nil
+		}
+		if current.Version == exceptedVersion {
+			return false, nil
+		}
+		return false, storage_lock.ErrVersionMiss
+	})
+}
+
+func (x *ResilientStorage) CreateWithVersion(ctx context.Context, lockId string, version storage.Version, lockInformation *storage.LockInformation) error {
+	return x.do(ctx, lockId, "CreateWithVersion", func(ctx context.Context) error {
+		return x.storage.CreateWithVersion(ctx, lockId, version, lockInformation)
+	}, func(ctx context.Context) (bool, error) {
+		current, err := x.getLockInformation(ctx, lockId)
+		if err != nil {
+			if errors.Is(err, storage_lock.ErrLockNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+		if current.Version == version && isSameLockInformation(current, lockInformation) {
+			return true, nil
+		}
+		return false, storage_lock.ErrLockAlreadyExists
+	})
+}
+
+func (x *ResilientStorage) DeleteWithVersion(ctx context.Context, lockId string, exceptedVersion storage.Version, lockInformation *storage.LockInformation) error {
+	return x.do(ctx, lockId, "DeleteWithVersion", func(ctx context.Context) error {
+		return x.storage.DeleteWithVersion(ctx, lockId, exceptedVersion, lockInformation)
+	}, func(ctx context.Context) (bool, error) {
+		current, err := x.getLockInformation(ctx, lockId)
+		if err != nil {
+			if errors.Is(err, storage_lock.ErrLockNotFound) {
+				return true, nil
+			}
+			return false, err
+		}
+		if current.Version == exceptedVersion {
+			return false, nil
+		}
+		return false, storage_lock.ErrVersionMiss
+	})
+}
+
+func (x *ResilientStorage) Get(ctx context.Context, lockId string) (string, error) {
+	var lockInformationJsonString string
+	err := x.do(ctx, lockId, "Get", func(ctx context.Context) error {
+		var err error
+		lockInformationJsonString, err = x.storage.Get(ctx, lockId)
+		return err
+	}, nil)
+	return lockInformationJsonString, err
+}
+
+func (x *ResilientStorage) GetTime(ctx context.Context) (time.Time, error) {
+	var storageTime time.Time
+	err := x.do(ctx, "", "GetTime", func(ctx context.Context) error {
+		var err error
+		storageTime, err = x.storage.GetTime(ctx)
+		return err
+	}, nil)
+	return storageTime, err
+}
+
+func (x *ResilientStorage) Close(ctx context.Context) error {
+	return x.storage.Close(ctx)
+}
+
+func (x *ResilientStorage) List(ctx context.Context) (iterator.Iterator[*storage.LockInformation], error) {
+	var it iterator.Iterator[*storage.LockInformation]
+	err := x.do(ctx, "", "List", func(ctx context.Context) error {
+		var err error
+		it, err = x.storage.List(ctx)
+		return err
+	}, nil)
+	return it, err
+}
+
+// do 执行一个带重试和熔断的操作
+// attempt: 调用一次后端
+// resolve: 写操作结果未知时重新读取记录判断写入是否生效，返回 true 表示已经生效，返回 false 且没有错误表示没有生效可以重试，
+// 返回确定性的错误（比如版本冲突）则直接作为操作的结果；只读的操作传 nil
+func (x *ResilientStorage) do(ctx context.Context, lockId, operation string, attempt func(ctx context.Context) error, resolve func(ctx context.Context) (bool, error)) error {
+
+	e := events.NewEvent(lockId).SetStorageName(x.GetName()).SetListeners(x.options.EventListeners)
+
+	var lastErr error
+	// 上一次写入遇到了临时性错误，不知道是否已经生效
+	uncertain := false
+	// 之前有没有过结果未知的写入，确认过"没有生效"的也算：超时的写入可能在确认之后才落地
+	everUncertain := false
+	for retry := 0; ; retry++ {
+
+		if retry > 0 {
+			if retry > x.options.MaxRetries || ctx.Err() != nil {
+				return x.giveUp(ctx, e, operation, retry, lastErr, uncertain, resolve)
+			}
+			sleep := x.retryInterval(retry)
+			e.Fork().AddAction(events.NewAction(ActionRetry).SetErr(lastErr).AddPayload(PayloadOperation, operation).AddPayload(PayloadAttempt, retry).AddPayload(PayloadSleep, sleep)).Publish(ctx)
+			select {
+			case <-ctx.Done():
+				return x.giveUp(ctx, e, operation, retry, lastErr, uncertain, resolve)
+			case <-time.After(sleep):
+			}
+		}
+
+		if uncertain {
+			applied := false
+			e.Fork().AddAction(events.NewAction(ActionAmbiguousWriteCheck).AddPayload(PayloadOperation, operation)).Publish(ctx)
+			err := x.invoke(ctx, e, func(ctx context.Context) error {
+				var err error
+				applied, err = resolve(ctx)
+				return err
+			})
+			if err != nil {
+				if x.isTransient(err) {
+					// 读也失败了，下次重试接着确认
+					e.Fork().AddAction(events.NewAction(ActionAmbiguousWriteCheckError).SetErr(err).AddPayload(PayloadOperation, operation)).Publish(ctx)
+					lastErr = err
+					continue
+				}
+				e.Fork().AddAction(events.NewAction(ActionAmbiguousWriteConflict).SetErr(err).AddPayload(PayloadOperation, operation)).Publish(ctx)
+				return err
+			}
+			if applied {
+				e.Fork().AddAction(events.NewAction(ActionAmbiguousWriteApplied).AddPayload(PayloadOperation, operation)).Publish(ctx)
+				return nil
+			}
+			e.Fork().AddAction(events.NewAction(ActionAmbiguousWriteNotApplied).AddPayload(PayloadOperation, operation)).Publish(ctx)
+			uncertain = false
+		}
+
+		err := x.invoke(ctx, e, attempt)
+		if err == nil {
+			return nil
+		}
+		if !x.isTransient(err) {
+			// 之前超时的写入在确认之后才落地的话，重试会因为记录已经是我们自己写入的内容而冲突，
+			// 这种冲突不能原样返回，否则调用方会把自己的记录当成别人的
+			if everUncertain && isCASConflict(err) {
+				return x.resolveConflict(ctx, e, operation, err, resolve)
+			}
+			return err
+		}
+		lastErr = err
+		if resolve != nil {
+			uncertain = true
+			everUncertain = true
+		}
+	}
+}
+
+// resolveConflict 之前有过结果未知的写入、重试又遇到了CAS冲突的时候再确认一次，记录就是本次要写入的内容的话返回成功
+func (x *ResilientStorage) resolveConflict(ctx context.Context, e *events.Event, operation string, conflictErr error, resolve func(ctx context.Context) (bool, error)) error {
+	applied := false
+	e.Fork().AddAction(events.NewAction(ActionAmbiguousWriteCheck).SetErr(conflictErr).AddPayload(PayloadOperation, operation)).Publish(ctx)
+	err := x.invoke(ctx, e, func(ctx context.Context) error {
+		var err error
+		applied, err = resolve(ctx)
+		return err
+	})
+	if err == nil && applied {
+		e.Fork().AddAction(events.NewAction(ActionAmbiguousWriteApplied).AddPayload(PayloadOperation, operation)).Publish(ctx)
+		return nil
+	}
+	e.Fork().AddAction(events.NewAction(ActionAmbiguousWriteConflict).SetErr(conflictErr).AddPayload(PayloadOperation, operation)).Publish(ctx)
+	return conflictErr
+}
+
+// 是否是CAS冲突的错误
+func isCASConflict(err error) bool {
+	return errors.Is(err, storage_lock.ErrVersionMiss) || errors.Is(err, storage_lock.ErrLockAlreadyExists) || errors.Is(err, storage_lock.ErrLockNotFound)
+}
+
+// giveUp 重试次数用完或者调用方放弃时结束操作
+// 如果最后一次写入的结果仍然未知，放弃之前再读一次记录确认，确认不了则返回 ErrAmbiguousWrite，
+// 不能把临时性的错误原样返回，否则调用方会把一次可能已经生效的写入当成失败
+func (x *ResilientStorage) giveUp(ctx context.Context, e *events.Event, operation string, retry int, lastErr error, uncertain bool, resolve func(ctx context.Context) (bool, error)) error {
+
+	e.Fork().AddAction(events.NewAction(ActionRetryExhausted).SetErr(lastErr).AddPayload(PayloadOperation, operation).AddPayload(PayloadAttempt, retry)).Publish(ctx)
+	if !uncertain {
+		return lastErr
+	}
+
+	// 调用方的 ctx 可能已经结束了，最后这次确认使用独立的 ctx，单次调用的超时仍然由 invoke 控制
+	resolveCtx := ctx
+	if ctx.Err() != nil {
+		resolveCtx = context.Background()
+	}
+	applied := false
+	e.Fork().AddAction(events.NewAction(ActionAmbiguousWriteCheck).AddPayload(PayloadOperation, operation)).Publish(ctx)
+	err := x.invoke(resolveCtx, e, func(ctx context.Context) error {
+		var err error
+		applied, err = resolve(ctx)
+		return err
+	})
+	if err != nil {
+		if x.isTransient(err) {
+			err = fmt.Errorf("%w: %v", ErrAmbiguousWrite, lastErr)
+			e.Fork().AddAction(events.NewAction(ActionAmbiguousWriteUnresolved).SetErr(err).AddPayload(PayloadOperation, operation)).Publish(ctx)
+			return err
+		}
+		e.Fork().AddAction(events.NewAction(ActionAmbiguousWriteConflict).SetErr(err).AddPayload(PayloadOperation, operation)).Publish(ctx)
+		return err
+	}
+	if applied {
+		e.Fork().AddAction(events.NewAction(ActionAmbiguousWriteApplied).AddPayload(PayloadOperation, operation)).Publish(ctx)
+		return nil
+	}
+	// 确认没有生效，写入是确定的失败了
+	e.Fork().AddAction(events.NewAction(ActionAmbiguousWriteNotApplied).AddPayload(PayloadOperation, operation)).Publish(ctx)
+	return lastErr
+}
+
+// invoke 经过熔断器调用一次后端，单次调用带上超时
+func (x *ResilientStorage) invoke(ctx context.Context, e *events.Event, f func(ctx context.Context) error) error {
+
+	allowed, from, to := x.circuitBreaker.allow(time.Now())
+	x.publishCircuitStateChange(ctx, e, from, to)
+	if !allowed {
+		e.Fork().AddAction(events.NewAction(ActionCircuitReject).SetErr(ErrCircuitOpen)).Publish(ctx)
+		return ErrCircuitOpen
+	}
+
+	callCtx := ctx
+	if x.options.OperationTimeout > 0 {
+		var cancelFunc context.CancelFunc
+		callCtx, cancelFunc = context.WithTimeout(ctx, x.options.OperationTimeout)
+		defer cancelFunc()
+	}
+
+	err := f(callCtx)
+	if err != nil && ctx.Err() != nil {
+		// 调用方自己放弃了，这次调用不能说明后端的好坏
+		x.circuitBreaker.onAbort()
+	} else if err != nil && x.isTransient(err) {
+		from, to = x.circuitBreaker.onFailure(time.Now())
+	} else {
+		// 确定性的答复说明后端是正常工作的
+		from, to = x.circuitBreaker.onSuccess()
+	}
+	x.publishCircuitStateChange(ctx, e, from, to)
+	return err
+}
+
+func (x *ResilientStorage) publishCircuitStateChange(ctx context.Context, e *events.Event, from, to CircuitState) {
+	if from == to {
+		return
+	}
+	var actionName string
+	switch to {
+	case CircuitOpen:
+		actionName = ActionCircuitOpen
+	case CircuitHalfOpen:
+		actionName = ActionCircuitHalfOpen
+	default:
+		actionName = ActionCircuitClose
+	}
+	e.Fork().AddActionByName(actionName).Publish(ctx)
+}
+
+func (x *ResilientStorage) isTransient(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	return x.options.ErrorClassifier(err)
+}
+
+// 第 retry 次重试前的等待时间，指数退避
+func (x *ResilientStorage) retryInterval(retry int) time.Duration {
+	interval := x.options.RetryInterval
+	for i := 1; i < retry; i++ {
+		interval *= 2
+		if x.options.MaxRetryInterval > 0 && interval >= x.options.MaxRetryInterval {
+			return x.options.MaxRetryInterval
+		}
+	}
+	return interval
+}
+
+// 直接读取被包装的存储，锁不存在时返回 ErrLockNotFound
+func (x *ResilientStorage) getLockInformation(ctx context.Context, lockId string) (*storage.LockInformation, error) {
+	lockInformationJsonString, err := x.storage.Get(ctx, lockId)
+	if err != nil {
+		return nil, err
+	}
+	if lockInformationJsonString == "" {
+		return nil, storage_lock.ErrLockNotFound
+	}
+	return storage_lock.DecodeLockInformation(lockInformationJsonString)
+}
+
+// 判断存储中的记录是否就是本次要写入的内容，时间经过序列化之后时区可能不同，所以逐个字段比较
+func isSameLockInformation(a, b *storage.LockInformation) bool {
+	return a.OwnerId == b.OwnerId &&
+		a.LockCount == b.LockCount &&
+		a.LockBeginTime.Equal(b.LockBeginTime) &&
+		a.LeaseExpireTime.Equal(b.LeaseExpireTime)
+}
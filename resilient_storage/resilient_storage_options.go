@@ -0,0 +1,107 @@
+package resilient_storage
+
+import (
+	"github.com/storage-lock/go-events"
+	"time"
+)
+
+// ResilientStorageOptions 创建弹性存储的相关选项
+type ResilientStorageOptions struct {
+
+	// 存储的名字，未设置的话沿用被包装的存储的名字
+	Name string
+
+	// 单次调用后端的超时时间，为 0 表示不单独设置超时，只受调用方 ctx 的控制
+	OperationTimeout time.Duration
+
+	// 临时性错误最多重试多少次，为 0 表示不重试
+	MaxRetries int
+
+	// 第一次重试前的等待时间，之后每次翻倍，直到 MaxRetryInterval
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+
+	// 判断错误是否是临时性的，未设置的话使用 DefaultErrorClassifier
+	ErrorClassifier ErrorClassifier
+
+	// 连续多少次临时性错误之后打开熔断器，为 0 表示不启用熔断
+	CircuitBreakerFailureThreshold int
+
+	// 熔断器打开之后多久放探测请求过去
+	CircuitBreakerOpenDuration time.Duration
+
+	// 重试、熔断等事件会发布到这些监听器上
+	EventListeners []events.Listener
+}
+
+const (
+	DefaultOperationTimeout               = time.Second * 3
+	DefaultMaxRetries                     = 3
+	DefaultRetryInterval                  = time.Millisecond * 50
+	DefaultMaxRetryInterval               = time.Second
+	DefaultCircuitBreakerFailureThreshold = 5
+	DefaultCircuitBreakerOpenDuration     = time.Second * 5
+)
+
+// NewResilientStorageOptions 使用默认值创建弹性存储的选项
+func NewResilientStorageOptions() *ResilientStorageOptions {
+	return &ResilientStorageOptions{
+		OperationTimeout:               DefaultOperationTimeout,
+		MaxRetries:                     DefaultMaxRetries,
+		RetryInterval:                  DefaultRetryInterval,
+		MaxRetryInterval:               DefaultMaxRetryInterval,
+		ErrorClassifier:                DefaultErrorClassifier,
+		CircuitBreakerFailureThreshold: DefaultCircuitBreakerFailureThreshold,
+		CircuitBreakerOpenDuration:     DefaultCircuitBreakerOpenDuration,
+	}
+}
+
+func (x *ResilientStorageOptions) SetName(name string) *ResilientStorageOptions {
+	x.Name = name
+	return x
+}
+
+func (x *ResilientStorageOptions) SetOperationTimeout(operationTimeout time.Duration) *ResilientStorageOptions {
+	x.OperationTimeout = operationTimeout
+	return x
+}
+
+func (x *ResilientStorageOptions) SetMaxRetries(maxRetries int) *ResilientStorageOptions {
+	x.MaxRetries = maxRetries
+	return x
+}
+
+func (x *ResilientStorageOptions) SetRetryInterval(retryInterval time.Duration) *ResilientStorageOptions {
+	x.RetryInterval = retryInterval
+	return x
+}
+
+func (x *ResilientStorageOptions) SetMaxRetryInterval(maxRetryInterval time.Duration) *ResilientStorageOptions {
+	x.MaxRetryInterval = maxRetryInterval
+	return x
+}
+
+func (x *ResilientStorageOptions) SetErrorClassifier(errorClassifier ErrorClassifier) *ResilientStorageOptions {
+	x.ErrorClassifier = errorClassifier
+	return x
+}
+
+func (x *ResilientStorageOptions) SetCircuitBreakerFailureThreshold(failureThreshold int) *ResilientStorageOptions {
+	x.CircuitBreakerFailureThreshold = failureThreshold
+	return x
+}
+
+func (x *ResilientStorageOptions) SetCircuitBreakerOpenDuration(openDuration time.Duration) *ResilientStorageOptions {
+	x.CircuitBreakerOpenDuration = openDuration
+	return x
+}
+
+func (x *ResilientStorageOptions) SetEventListeners(eventListeners []events.Listener) *ResilientStorageOptions {
+	x.EventListeners = eventListeners
+	return x
+}
+
+func (x *ResilientStorageOptions) AddEventListeners(listener events.Listener) *ResilientStorageOptions {
+	x.EventListeners = append(x.EventListeners, listener)
+	return x
+}
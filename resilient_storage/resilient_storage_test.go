@@ -0,0 +1,322 @@
+package resilient_storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/storage-lock/go-storage-lock/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+var errTestNetwork = errors.New("test network error")
+
+// 可以按脚本失败的存储
+type testFlakyStorage struct {
+	*memory_storage.MemoryStorage
+
+	mutex sync.Mutex
+
+	// 接下来多少次调用直接失败
+	failCount int
+
+	// 接下来多少次写入在生效之后返回错误（结果未知的写入）
+	ambiguousCount int
+
+	// 结果未知的写入之后接着有多少次调用直接失败
+	failAfterAmbiguousCount int
+
+	// 接下来多少次写入先返回错误，等到下一次读取完成之后才生效（确认之后才落地的写入）
+	delayedCount int
+	delayed      func() error
+
+	calls int
+}
+
+func newTestFlakyStorage() *testFlakyStorage {
+	return &testFlakyStorage{MemoryStorage: memory_storage.NewMemoryStorage()}
+}
+
+func (x *testFlakyStorage) script(failCount, ambiguousCount int) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.failCount = failCount
+	x.ambiguousCount = ambiguousCount
+}
+
+func (x *testFlakyStorage) scriptFailAfterAmbiguous(failAfterAmbiguousCount int) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.ambiguousCount = 1
+	x.failAfterAmbiguousCount = failAfterAmbiguousCount
+}
+
+func (x *testFlakyStorage) scriptDelayed(delayedCount int) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.delayedCount = delayedCount
+}
+
+// 取出等待落地的写入
+func (x *testFlakyStorage) takeDelayed() func() error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	delayed := x.delayed
+	x.delayed = nil
+	return delayed
+}
+
+func (x *testFlakyStorage) getCalls() int {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.calls
+}
+
+// 返回 (调用前失败的错误, 写入后要返回的错误)
+func (x *testFlakyStorage) next() (error, error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.calls++
+	if x.failCount > 0 {
+		x.failCount--
+		return errTestNetwork, nil
+	}
+	if x.ambiguousCount > 0 {
+		x.ambiguousCount--
+		x.failCount = x.failAfterAmbiguousCount
+		x.failAfterAmbiguousCount = 0
+		return nil, context.DeadlineExceeded
+	}
+	return nil, nil
+}
+
+func (x *testFlakyStorage) write(f func() error) error {
+	before, after := x.next()
+	if before != nil {
+		return before
+	}
+	x.mutex.Lock()
+	if x.delayedCount > 0 {
+		x.delayedCount--
+		x.delayed = f
+		x.mutex.Unlock()
+		return context.DeadlineExceeded
+	}
+	x.mutex.Unlock()
+	if err := f(); err != nil {
+		return err
+	}
+	return after
+}
+
+func (x *testFlakyStorage) Get(ctx context.Context, lockId string) (string, error) {
+	if err, _ := x.next(); err != nil {
+		return "", err
+	}
+	lockInformationJsonString, err := x.MemoryStorage.Get(ctx, lockId)
+	if delayed := x.takeDelayed(); delayed != nil {
+		_ = delayed()
+	}
+	return lockInformationJsonString, err
+}
+
+func (x *testFlakyStorage) CreateWithVersion(ctx context.Context, lockId string, version storage.Version, lockInformation *storage.LockInformation) error {
+	return x.write(func() error {
+		return x.MemoryStorage.CreateWithVersion(ctx, lockId, version, lockInformation)
+	})
+}
+
+func (x *testFlakyStorage) UpdateWithVersion(ctx context.Context, lockId string, exceptedVersion, newVersion storage.Version, lockInformation *storage.LockInformation) error {
+	return x.write(func() error {
+		return x.MemoryStorage.UpdateWithVersion(ctx, lockId, exceptedVersion, newVersion, lockInformation)
+	})
+}
+
+func (x *testFlakyStorage) DeleteWithVersion(ctx context.Context, lockId string, exceptedVersion storage.Version, lockInformation *storage.LockInformation) error {
+	return x.write(func() error {
+		return x.MemoryStorage.DeleteWithVersion(ctx, lockId, exceptedVersion, lockInformation)
+	})
+}
+
+func newTestResilientStorage(t *testing.T, s storage.Storage, options ...*ResilientStorageOptions) *ResilientStorage {
+	if len(options) == 0 {
+		options = append(options, NewResilientStorageOptions().SetRetryInterval(time.Millisecond).SetCircuitBreakerFailureThreshold(0))
+	}
+	resilientStorage, err := NewResilientStorageWithOptions(s, options[0])
+	assert.Nil(t, err)
+	return resilientStorage
+}
+
+func TestResilientStorage_Conformance(t *testing.T) {
+	s := newTestResilientStorage(t, memory_storage.NewMemoryStorage())
+	storagetest.RunConformance(t, func() storage.Storage {
+		return s
+	})
+}
+
+// 临时性的错误会被重试掉
+func TestResilientStorage_RetryTransient(t *testing.T) {
+	ctx := context.Background()
+	flaky := newTestFlakyStorage()
+	s := newTestResilientStorage(t, flaky)
+
+	flaky.script(2, 0)
+	_, err := s.Get(ctx, "test-resilient-retry")
+	assert.ErrorIs(t, err, storage_lock.ErrLockNotFound)
+	assert.Equal(t, 3, flaky.getCalls())
+
+	// 超过重试次数则返回最后一次的错误
+	flaky.script(10, 0)
+	_, err = s.Get(ctx, "test-resilient-retry")
+	assert.ErrorIs(t, err, errTestNetwork)
+}
+
+// 确定性的错误不会重试
+func TestResilientStorage_DefiniteNotRetried(t *testing.T) {
+	ctx := context.Background()
+	flaky := newTestFlakyStorage()
+	s := newTestResilientStorage(t, flaky)
+
+	information := storagetest.NewTestLockInformation()
+	assert.Nil(t, s.CreateWithVersion(ctx, "test-resilient-definite", information.Version, information))
+	calls := flaky.getCalls()
+	assert.ErrorIs(t, s.UpdateWithVersion(ctx, "test-resilient-definite", 100, 101, information), storage_lock.ErrVersionMiss)
+	assert.Equal(t, calls+1, flaky.getCalls())
+}
+
+// 结果未知的写入通过重新读取记录来确认
+func TestResilientStorage_AmbiguousWrite(t *testing.T) {
+	ctx := context.Background()
+	flaky := newTestFlakyStorage()
+	s := newTestResilientStorage(t, flaky)
+	lockId := "test-resilient-ambiguous"
+
+	// 创建实际上已经生效了
+	information := storagetest.NewTestLockInformation()
+	flaky.script(0, 1)
+	assert.Nil(t, s.CreateWithVersion(ctx, lockId, information.Version, information))
+
+	// 更新实际上已经生效了
+	newInformation := storagetest.NewTestLockInformation(information.Version + 1)
+	flaky.script(0, 1)
+	assert.Nil(t, s.UpdateWithVersion(ctx, lockId, information.Version, newInformation.Version, newInformation))
+
+	// 更新没有生效，确认之后重试
+	newerInformation := storagetest.NewTestLockInformation(newInformation.Version + 1)
+	flaky.script(1, 0)
+	assert.Nil(t, s.UpdateWithVersion(ctx, lockId, newInformation.Version, newerInformation.Version, newerInformation))
+
+	lockInformationJsonString, err := flaky.MemoryStorage.Get(ctx, lockId)
+	assert.Nil(t, err)
+	assert.Equal(t, newerInformation.ToJsonString(), lockInformationJsonString)
+
+	// 结果未知期间记录被别人改掉了，返回版本冲突
+	other := storagetest.NewTestLockInformation(newerInformation.Version + 1)
+	other.OwnerId = "other"
+	flaky.script(1, 0)
+	assert.Nil(t, flaky.MemoryStorage.UpdateWithVersion(ctx, lockId, newerInformation.Version, other.Version, other))
+	mine := storagetest.NewTestLockInformation(newerInformation.Version + 1)
+	assert.ErrorIs(t, s.UpdateWithVersion(ctx, lockId, newerInformation.Version, mine.Version, mine), storage_lock.ErrVersionMiss)
+
+	// 删除实际上已经生效了
+	flaky.script(0, 1)
+	assert.Nil(t, s.DeleteWithVersion(ctx, lockId, other.Version, other))
+}
+
+// 重试用完时写入结果仍然未知，放弃之前再确认一次
+func TestResilientStorage_AmbiguousWriteExhausted(t *testing.T) {
+	ctx := context.Background()
+	flaky := newTestFlakyStorage()
+	s := newTestResilientStorage(t, flaky)
+	information := storagetest.NewTestLockInformation()
+
+	// 重试期间的确认都失败了，最后一次确认发现写入已经生效
+	flaky.scriptFailAfterAmbiguous(DefaultMaxRetries)
+	assert.Nil(t, s.CreateWithVersion(ctx, "test-resilient-exhausted-applied", information.Version, information))
+
+	// 最后一次确认也失败了，返回结果未知而不是原始的临时性错误
+	flaky.scriptFailAfterAmbiguous(DefaultMaxRetries + 1)
+	err := s.CreateWithVersion(ctx, "test-resilient-exhausted-unresolved", information.Version, information)
+	assert.ErrorIs(t, err, ErrAmbiguousWrite)
+	assert.False(t, errors.Is(err, errTestNetwork))
+
+	// 调用方的 ctx 结束了也要确认一次
+	cancelCtx, cancelFunc := context.WithCancel(ctx)
+	cancelFunc()
+	flaky.scriptFailAfterAmbiguous(0)
+	assert.Nil(t, s.DeleteWithVersion(cancelCtx, "test-resilient-exhausted-applied", information.Version, information))
+}
+
+// 超时的写入在确认"没有生效"之后才落地，重试遇到的冲突其实是自己的写入造成的
+func TestResilientStorage_AmbiguousWriteLandsLate(t *testing.T) {
+	ctx := context.Background()
+	flaky := newTestFlakyStorage()
+	s := newTestResilientStorage(t, flaky)
+	lockId := "test-resilient-lands-late"
+
+	information := storagetest.NewTestLockInformation()
+	flaky.scriptDelayed(1)
+	assert.Nil(t, s.CreateWithVersion(ctx, lockId, information.Version, information))
+	lockInformationJsonString, err := flaky.MemoryStorage.Get(ctx, lockId)
+	assert.Nil(t, err)
+	assert.Equal(t, information.ToJsonString(), lockInformationJsonString)
+
+	newInformation := storagetest.NewTestLockInformation(information.Version + 1)
+	flaky.scriptDelayed(1)
+	assert.Nil(t, s.UpdateWithVersion(ctx, lockId, information.Version, newInformation.Version, newInformation))
+
+	// 别人的记录造成的冲突照常返回
+	other := storagetest.NewTestLockInformation(newInformation.Version)
+	other.OwnerId = "other"
+	flaky.scriptDelayed(1)
+	assert.ErrorIs(t, s.CreateWithVersion(ctx, lockId, other.Version, other), storage_lock.ErrLockAlreadyExists)
+}
+
+// 熔断器在连续失败之后打开，冷却之后放探测请求过去，成功则关闭
+func TestResilientStorage_CircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	flaky := newTestFlakyStorage()
+	options := NewResilientStorageOptions().
+		SetMaxRetries(0).
+		SetCircuitBreakerFailureThreshold(3).
+		SetCircuitBreakerOpenDuration(time.Millisecond * 50)
+	s := newTestResilientStorage(t, flaky, options)
+
+	flaky.script(3, 0)
+	for i := 0; i < 3; i++ {
+		_, err := s.Get(ctx, "test-resilient-circuit")
+		assert.ErrorIs(t, err, errTestNetwork)
+	}
+	assert.Equal(t, CircuitOpen, s.CircuitState())
+
+	// 打开期间直接失败，不会发往后端
+	calls := flaky.getCalls()
+	_, err := s.Get(ctx, "test-resilient-circuit")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, calls, flaky.getCalls())
+
+	time.Sleep(time.Millisecond * 60)
+	_, err = s.Get(ctx, "test-resilient-circuit")
+	assert.ErrorIs(t, err, storage_lock.ErrLockNotFound)
+	assert.Equal(t, CircuitClosed, s.CircuitState())
+}
+
+// StorageLock 可以透过抖动的存储正常的获取和释放锁
+func TestResilientStorage_StorageLock(t *testing.T) {
+	ctx := context.Background()
+	flaky := newTestFlakyStorage()
+	s := newTestResilientStorage(t, flaky)
+
+	lock, err := storage_lock.NewStorageLock(s, "test-resilient-storage-lock")
+	assert.Nil(t, err)
+
+	flaky.script(1, 1)
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	flaky.script(1, 1)
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+}
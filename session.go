@@ -0,0 +1,350 @@
+package storage_lock
+
+import (
+	"context"
+	"errors"
+	"github.com/storage-lock/go-events"
+	go_storage "github.com/storage-lock/go-storage"
+	storage_events "github.com/storage-lock/go-storage-events"
+	"github.com/storage-lock/go-utils"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Session 会话，参考 etcd 的 session/lease 模型：一个进程只维护一条会话租约记录，由一个心跳协程统一续租。
+//
+// 默认情况下每把锁在持有期间都有自己的看门狗续租，锁多了之后续租请求会很多；而且进程崩溃时它持有的锁
+// 会因为各自的租约时间不同在不同的时刻陆续过期。在会话模式下（StorageLockOptions.Session），
+// 锁记录不再依赖自己的租约，而是引用会话的ID：会话存活锁就有效，会话失效（心跳停止超时或者主动 Close）
+// 则会话下的所有锁同时失效，可以立即被其他人获取，锁本身也不再启动看门狗。
+//
+// 会话记录同样存放在 Storage 中，key 就是会话ID，值是一条 LockInformation，
+// LeaseExpireTime 是会话租约的过期时间，LockCount 为 0 表示会话已经被关闭。
+// ⚠️ 引用会话的锁必须与会话使用同一个 Storage，锁是通过这个 Storage 读取会话记录来判断会话是否存活的。
+type Session struct {
+
+	// 会话的ID，同时也是会话记录在Storage中的key
+	id string
+
+	storage         go_storage.Storage
+	storageExecutor *storage_events.WithEventSafeExecutor
+
+	options *SessionOptions
+
+	// 会话生命周期中产生的事件都是这个事件的子事件
+	e *events.Event
+
+	// stop: Close 时 close，通知心跳协程退出；done: 心跳协程退出后 close
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	// lost: 会话失效（过期或者被关闭）时 close，持有者可以通过 Done() 感知
+	lost     chan struct{}
+	lostOnce sync.Once
+	lostErr  atomic.Value
+
+	// 心跳协程生命周期的 context，Close 时取消，用于打断卡在存储调用里的心跳
+	runCtx    context.Context
+	runCancel context.CancelFunc
+}
+
+// SessionIDPrefix 会话ID的前缀，锁记录上通过这个前缀识别引用的是不是会话
+const SessionIDPrefix = "storage-lock-session-"
+
+// SessionOwnerIdSeparator 会话模式下锁记录中 OwnerId 的格式为 "<ownerId>@<sessionId>"
+const SessionOwnerIdSeparator = "@"
+
+// NewSession 在给定的Storage上创建一个会话，并启动心跳协程为其续租
+func NewSession(ctx context.Context, storage go_storage.Storage, options *SessionOptions) (*Session, error) {
+
+	if err := checkSessionOptions(options); err != nil {
+		return nil, err
+	}
+
+	if !options.SkipCapabilityCheck {
+		if err := checkStorageCapabilities(storage, options.TimeProvider); err != nil {
+			return nil, err
+		}
+	}
+
+	id := options.SessionId
+	if id == "" {
+		id = utils.RandomID(SessionIDPrefix)
+	}
+
+	e := events.NewEvent(id).SetOwnerId(id).SetType(events.EventTypeWatchDog).SetStorageName(storage.GetName()).SetListeners(options.EventListeners)
+	session := &Session{
+		id:              id,
+		storage:         storage,
+		storageExecutor: storage_events.NewWithEventSafeExecutor(storage),
+		options:         options,
+		e:               e,
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
+		lost:            make(chan struct{}),
+	}
+
+	// 配置了签名密钥的话会话记录的所有写入都要先签名
+	if len(options.SigningKey) != 0 {
+		session.storageExecutor = storage_events.NewWithEventSafeExecutor(newSigningStorage(storage, options.SigningKey))
+	}
+
+	createEvent := e.Fork().AddActionByName(ActionSessionCreate)
+	createEvent.Publish(ctx)
+
+	storageTime, err := session.getTime(ctx, createEvent.Fork())
+	if err != nil {
+		createEvent.Fork().AddAction(events.NewAction(ActionSessionCreateError).SetErr(err)).Publish(ctx)
+		return nil, err
+	}
+	information := &go_storage.LockInformation{
+		LockId:          id,
+		OwnerId:         id,
+		Version:         1,
+		LockCount:       1,
+		LockBeginTime:   storageTime,
+		LeaseExpireTime: storageTime.Add(options.LeaseExpireAfter),
+	}
+	err = session.storageExecutor.CreateWithVersion(ctx, createEvent.Fork(), id, information.Version, information)
+	if err != nil {
+		createEvent.Fork().AddAction(events.NewAction(ActionSessionCreateError).SetErr(err)).Publish(ctx)
+		return nil, err
+	}
+	createEvent.Fork().SetLockInformation(information).AddActionByName(ActionSessionCreateSuccess).Publish(ctx)
+
+	session.runCtx, session.runCancel = context.WithCancel(context.Background())
+	go session.heartbeat()
+
+	return session, nil
+}
+
+// GetID 会话的ID
+func (x *Session) GetID() string {
+	return x.id
+}
+
+// OwnerId 返回 ownerId 在这个会话下写入锁记录时使用的 OwnerId，
+// 跨进程转移锁的时候，接收方把它交给发送方作为 Transfer 的 toOwnerId，锁就会挂到接收方自己的会话上
+func (x *Session) OwnerId(ownerId string) string {
+	return ownerId + SessionOwnerIdSeparator + x.id
+}
+
+// Done 会话失效（心跳发现会话已经过期、会话记录丢失或者被 Close）时返回的 channel 会被关闭，
+// 此时会话下持有的所有锁都已经失效，持有者应当中止临界区
+func (x *Session) Done() <-chan struct{} {
+	return x.lost
+}
+
+// IsAlive 会话在本地看来是否仍然存活
+func (x *Session) IsAlive() bool {
+	select {
+	case <-x.lost:
+		return false
+	default:
+		return true
+	}
+}
+
+// Err 会话失效的原因，会话仍然存活时返回 nil
+func (x *Session) Err() error {
+	if err, ok := x.lostErr.Load().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// Close 停止心跳并删除会话记录，会话下所有的锁会立即失效
+func (x *Session) Close(ctx context.Context) error {
+
+	closeEvent := x.e.Fork().AddActionByName(ActionSessionClose)
+	closeEvent.Publish(ctx)
+
+	// 先停心跳，避免心跳与删除会话记录互相抢版本号
+	x.stopOnce.Do(func() { close(x.stop) })
+	x.runCancel()
+	select {
+	case <-x.done:
+	case <-ctx.Done():
+		closeEvent.Fork().AddAction(events.NewAction(ActionSessionCloseError).SetErr(ctx.Err())).Publish(ctx)
+		return ctx.Err()
+	}
+	x.markLost(ctx, ErrSessionClosed)
+
+	information, err := x.getSessionInformation(ctx, closeEvent.Fork())
+	// 会话记录被篡改过也照样删掉，会话已经不可信了
+	if err != nil && !errors.Is(err, ErrLockRecordTampered) {
+		if errors.Is(err, ErrLockNotFound) {
+			closeEvent.Fork().AddActionByName(ActionSessionCloseSuccess).Publish(ctx)
+			return nil
+		}
+		closeEvent.Fork().AddAction(events.NewAction(ActionSessionCloseError).SetErr(err)).Publish(ctx)
+		return err
+	}
+
+	// 与释放锁一样，按存储是否支持原子条件删除分流：真删或者写墓碑
+	if go_storage.SupportsAtomicDelete(x.storage) {
+		err = x.storageExecutor.DeleteWithVersion(ctx, closeEvent.Fork(), x.id, information.Version, information)
+	} else {
+		lastVersion := information.Version
+		information.Version++
+		information.LockCount = 0
+		err = x.storageExecutor.UpdateWithVersion(ctx, closeEvent.Fork(), x.id, lastVersion, information.Version, information)
+	}
+	if err != nil {
+		closeEvent.Fork().AddAction(events.NewAction(ActionSessionCloseError).SetErr(err)).Publish(ctx)
+		return err
+	}
+	closeEvent.Fork().AddActionByName(ActionSessionCloseSuccess).Publish(ctx)
+	return nil
+}
+
+// 心跳协程，按 LeaseRefreshInterval 为会话续租，发现会话已经失效时退出
+func (x *Session) heartbeat() {
+
+	defer close(x.done)
+
+	refreshSuccessCount := 0
+	continueErrorCount := 0
+
+	defer func() {
+		exitAction := events.NewAction(ActionSessionHeartbeatExit).
+			AddPayload(PayloadRefreshSuccessCount, refreshSuccessCount).
+			AddPayload(PayloadContinueErrorCount, continueErrorCount)
+		x.e.Fork().AddAction(exitAction).Publish(context.Background())
+	}()
+
+	// 休眠用同一个定时器，退出的时候停掉，不在时钟上留下没人等的定时器
+	timer := x.clock().NewTimer(x.options.LeaseRefreshInterval)
+	defer timer.Stop()
+	for {
+
+		select {
+		case <-x.stop:
+			return
+		case <-timer.C():
+		}
+
+		refreshBeginTime := x.clock().Now()
+		err := x.refresh()
+		if err == nil {
+			refreshSuccessCount++
+			continueErrorCount = 0
+		} else {
+			continueErrorCount++
+			action := events.NewAction(ActionSessionHeartbeatError).
+				AddPayload(PayloadContinueErrorCount, continueErrorCount).
+				AddPayload(PayloadRefreshSuccessCount, refreshSuccessCount).
+				SetErr(err)
+			x.e.Fork().AddAction(action).Publish(context.Background())
+
+			// 会话已经失效，不能再续租把它"复活"，否则失效期间被别人获取走的锁会出现多个持有者
+			if errors.Is(err, ErrSessionExpired) {
+				x.markLost(context.Background(), err)
+				return
+			}
+		}
+
+		// 与看门狗一样对休眠时间做下界保护，刷新过慢时不要无间隔地疯狂重试
+		needSleep := x.options.LeaseRefreshInterval - x.clock().Since(refreshBeginTime)
+		if halfInterval := x.options.LeaseRefreshInterval / 2; needSleep < halfInterval {
+			needSleep = halfInterval
+		}
+		timer.Reset(needSleep)
+	}
+}
+
+// 会话使用的时钟，选项中没有设置的话使用真实的时钟
+func (x *Session) clock() Clock {
+	if x.options.Clock != nil {
+		return x.options.Clock
+	}
+	return defaultClock
+}
+
+// 为会话续租一次
+func (x *Session) refresh() error {
+
+	refreshEvent := x.e.Fork().AddActionByName(ActionSessionHeartbeat)
+
+	ctx, cancelFunc := context.WithTimeout(x.runCtx, x.options.LeaseRefreshInterval)
+	defer cancelFunc()
+
+	information, err := x.getSessionInformation(ctx, refreshEvent.Fork())
+	if err != nil {
+		// 会话记录丢失或者被篡改过，会话都已经不可信了
+		if errors.Is(err, ErrLockNotFound) || errors.Is(err, ErrLockRecordTampered) {
+			return ErrSessionExpired
+		}
+		return err
+	}
+	if information.LockCount == 0 {
+		return ErrSessionExpired
+	}
+
+	storageTime, err := x.getTime(ctx, refreshEvent.Fork())
+	if err != nil {
+		return err
+	}
+	if storageTime.After(information.LeaseExpireTime) {
+		return ErrSessionExpired
+	}
+
+	lastVersion := information.Version
+	information.Version++
+	information.LeaseExpireTime = storageTime.Add(x.options.LeaseExpireAfter)
+	err = x.storageExecutor.UpdateWithVersion(ctx, refreshEvent.Fork(), x.id, lastVersion, information.Version, information)
+	if err != nil {
+		// 只有心跳自己会修改会话记录，版本对不上说明记录被别人动过了，会话已经不可信
+		if errors.Is(err, ErrVersionMiss) {
+			return ErrSessionExpired
+		}
+		return err
+	}
+
+	refreshEvent.Fork().SetLockInformation(information).AddActionByName(ActionSessionHeartbeatSuccess).Publish(ctx)
+	return nil
+}
+
+// 标记会话已经失效，只会生效一次
+func (x *Session) markLost(ctx context.Context, err error) {
+	x.lostOnce.Do(func() {
+		x.lostErr.Store(err)
+		close(x.lost)
+		x.e.Fork().AddAction(events.NewAction(ActionSessionLost).SetErr(err)).Publish(ctx)
+	})
+}
+
+func (x *Session) getTime(ctx context.Context, e *events.Event) (time.Time, error) {
+	if x.options.TimeProvider != nil {
+		return x.options.TimeProvider.GetTime(ctx)
+	}
+	return x.storageExecutor.GetTime(ctx, e)
+}
+
+// 读取会话记录，记录不存在时返回 ErrLockNotFound
+// 配置了签名密钥的话会校验签名，校验不通过时同时返回会话记录和 ErrLockRecordTampered
+func (x *Session) getSessionInformation(ctx context.Context, e *events.Event) (*go_storage.LockInformation, error) {
+	lockInformationJsonString, err := x.storageExecutor.Get(ctx, e, x.id)
+	if err != nil {
+		return nil, err
+	}
+	if lockInformationJsonString == "" {
+		return nil, ErrLockNotFound
+	}
+	information, err := DecodeLockInformation(lockInformationJsonString)
+	if err != nil || len(x.options.SigningKey) == 0 {
+		return information, err
+	}
+	if err := verifySignature(x.options.SigningKey, information); err != nil {
+		return information, err
+	}
+	return information, nil
+}
+
+// isSessionId 给定的ID是否是会话的ID
+func isSessionId(id string) bool {
+	return strings.HasPrefix(id, SessionIDPrefix) && len(id) > len(SessionIDPrefix) && !strings.Contains(id, SessionOwnerIdSeparator)
+}
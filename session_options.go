@@ -0,0 +1,112 @@
+package storage_lock
+
+import (
+	"github.com/storage-lock/go-events"
+	go_storage "github.com/storage-lock/go-storage"
+	"time"
+)
+
+// SessionOptions 创建会话（Session）的相关选项
+type SessionOptions struct {
+
+	// 会话的ID，同时也是会话记录在Storage中的key，未指定的话会自动生成一个以 SessionIDPrefix 开头的ID
+	// 手动指定的话也必须以 SessionIDPrefix 开头，这样锁记录上引用的会话才能被识别出来
+	SessionId string
+
+	// 会话的租约有效期，心跳停止之后超过这个时间会话就失效了，会话下所有的锁随之一起失效
+	// 规则与 StorageLockOptions.LeaseExpireAfter 相同
+	LeaseExpireAfter time.Duration
+
+	// 心跳间隔，规则与 StorageLockOptions.LeaseRefreshInterval 相同
+	LeaseRefreshInterval time.Duration
+
+	// 用于监听观测会话生命周期中的各种事件
+	EventListeners []events.Listener
+
+	// 外部注入的可靠时间源，与锁的 TimeProvider 含义相同
+	// ⚠️ 会话与引用它的锁必须使用同一个时间源，否则判断会话是否过期时会出现偏差
+	TimeProvider go_storage.TimeProvider
+
+	// 会话记录签名用的共享密钥，与 StorageLockOptions.SigningKey 含义相同。
+	// 锁是用自己的 SigningKey 校验会话记录的，所以引用这个会话的锁必须配置相同的密钥
+	SigningKey []byte
+
+	// 心跳间隔使用的本地时钟，未设置的话使用真实的时钟，主要用于在测试中注入可以手动拨动的时钟
+	// @see:
+	//     fake_clock.FakeClock
+	Clock Clock
+
+	// 跳过存储能力检查
+	SkipCapabilityCheck bool
+
+	// 跳过心跳间隔与租约有效期的安全余量检查
+	SkipLeaseMarginCheck bool
+}
+
+// NewSessionOptions 使用默认值创建会话的配置项
+func NewSessionOptions() *SessionOptions {
+	return &SessionOptions{
+		LeaseExpireAfter:     DefaultLeaseExpireAfter,
+		LeaseRefreshInterval: DefaultLeaseRefreshInterval,
+	}
+}
+
+// 检查会话的参数配置是否正确
+func checkSessionOptions(options *SessionOptions) error {
+
+	if options.SessionId != "" && !isSessionId(options.SessionId) {
+		return ErrSessionIdInvalid
+	}
+
+	return checkLeaseOptions(options.LeaseExpireAfter, options.LeaseRefreshInterval, timeProviderUncertainty(options.TimeProvider), options.SkipLeaseMarginCheck)
+}
+
+func (x *SessionOptions) SetSessionId(sessionId string) *SessionOptions {
+	x.SessionId = sessionId
+	return x
+}
+
+func (x *SessionOptions) SetLeaseExpireAfter(leaseExpireAfter time.Duration) *SessionOptions {
+	x.LeaseExpireAfter = leaseExpireAfter
+	return x
+}
+
+func (x *SessionOptions) SetLeaseRefreshInterval(leaseRefreshInterval time.Duration) *SessionOptions {
+	x.LeaseRefreshInterval = leaseRefreshInterval
+	return x
+}
+
+func (x *SessionOptions) SetEventListeners(eventListeners []events.Listener) *SessionOptions {
+	x.EventListeners = eventListeners
+	return x
+}
+
+func (x *SessionOptions) AddEventListeners(eventListener events.Listener) *SessionOptions {
+	x.EventListeners = append(x.EventListeners, eventListener)
+	return x
+}
+
+func (x *SessionOptions) SetTimeProvider(timeProvider go_storage.TimeProvider) *SessionOptions {
+	x.TimeProvider = timeProvider
+	return x
+}
+
+func (x *SessionOptions) SetSigningKey(signingKey []byte) *SessionOptions {
+	x.SigningKey = signingKey
+	return x
+}
+
+func (x *SessionOptions) SetClock(clock Clock) *SessionOptions {
+	x.Clock = clock
+	return x
+}
+
+func (x *SessionOptions) SetSkipCapabilityCheck(skip bool) *SessionOptions {
+	x.SkipCapabilityCheck = skip
+	return x
+}
+
+func (x *SessionOptions) SetSkipLeaseMarginCheck(skip bool) *SessionOptions {
+	x.SkipLeaseMarginCheck = skip
+	return x
+}
@@ -0,0 +1,110 @@
+package storage_lock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSessionLock(t *testing.T, s storage.Storage, lockId string, session *storage_lock.Session) *storage_lock.StorageLock {
+	options := storage_lock.NewStorageLockOptionsWithLockId(lockId).
+		SetLeaseExpireAfter(time.Second * 3).
+		SetLeaseRefreshInterval(time.Second).
+		SetVersionMissRetryInterval(time.Millisecond * 10).
+		SetSession(session)
+	lock, err := storage_lock.NewStorageLockWithOptions(s, options)
+	assert.Nil(t, err)
+	return lock
+}
+
+// TestSession_CloseReleasesAllLocks 会话下的多把锁在会话关闭时同时失效
+func TestSession_CloseReleasesAllLocks(t *testing.T) {
+	ctx := context.Background()
+	s := memory_storage.NewMemoryStorage()
+
+	sessionOptions := storage_lock.NewSessionOptions().SetLeaseExpireAfter(time.Second * 3).SetLeaseRefreshInterval(time.Second)
+	session, err := storage_lock.NewSession(ctx, s, sessionOptions)
+	assert.Nil(t, err)
+
+	lockA := newTestSessionLock(t, s, "test-session-lock-a", session)
+	lockB := newTestSessionLock(t, s, "test-session-lock-b", session)
+	assert.Nil(t, lockA.Lock(ctx, "session-owner"))
+	assert.Nil(t, lockB.Lock(ctx, "session-owner"))
+
+	// 会话模式下不为单把锁启动看门狗
+	assert.Nil(t, lockA.CurrentWatchDog())
+
+	// 会话存活期间其他人拿不到锁
+	otherA := newTestSessionLock(t, s, "test-session-lock-a", nil)
+	timeoutCtx, cancelFunc := context.WithTimeout(ctx, time.Millisecond*100)
+	assert.ErrorIs(t, otherA.Lock(timeoutCtx, "other-owner"), storage_lock.ErrLockBusy)
+	cancelFunc()
+
+	// 关闭会话，会话下的锁一起失效
+	assert.Nil(t, session.Close(ctx))
+	assert.False(t, session.IsAlive())
+	assert.ErrorIs(t, session.Err(), storage_lock.ErrSessionClosed)
+
+	otherB := newTestSessionLock(t, s, "test-session-lock-b", nil)
+	assert.Nil(t, otherA.Lock(ctx, "other-owner"))
+	assert.Nil(t, otherB.Lock(ctx, "other-owner"))
+
+	// 已经关闭的会话下不能再获取锁
+	assert.ErrorIs(t, lockA.Lock(ctx, "session-owner"), storage_lock.ErrSessionClosed)
+
+	assert.Nil(t, otherA.UnLock(ctx, "other-owner"))
+	assert.Nil(t, otherB.UnLock(ctx, "other-owner"))
+}
+
+func TestSession_ReentryAndUnlock(t *testing.T) {
+	ctx := context.Background()
+	s := memory_storage.NewMemoryStorage()
+
+	session, err := storage_lock.NewSession(ctx, s, storage_lock.NewSessionOptions().SetLeaseExpireAfter(time.Second*3).SetLeaseRefreshInterval(time.Second))
+	assert.Nil(t, err)
+	defer session.Close(ctx)
+
+	lock := newTestSessionLock(t, s, "test-session-reentry", session)
+	assert.Nil(t, lock.Lock(ctx, "session-owner"))
+	assert.Nil(t, lock.Lock(ctx, "session-owner"))
+	assert.Nil(t, lock.UnLock(ctx, "session-owner"))
+	assert.Nil(t, lock.UnLock(ctx, "session-owner"))
+	assert.ErrorIs(t, lock.UnLock(ctx, "session-owner"), storage_lock.ErrLockNotFound)
+}
+
+// 会话模式下跨进程转移锁：锁挂到接收方的会话上，发送方的会话关闭之后仍然有效
+func TestSession_TransferAcrossSessions(t *testing.T) {
+	ctx := context.Background()
+	s := memory_storage.NewMemoryStorage()
+	sessionOptions := storage_lock.NewSessionOptions().SetLeaseExpireAfter(time.Second * 3).SetLeaseRefreshInterval(time.Second)
+	senderSession, err := storage_lock.NewSession(ctx, s, sessionOptions)
+	assert.Nil(t, err)
+	receiverSession, err := storage_lock.NewSession(ctx, s, sessionOptions)
+	assert.Nil(t, err)
+	defer receiverSession.Close(ctx)
+
+	sender := newTestSessionLock(t, s, "test-session-transfer-lock", senderSession)
+	receiver := newTestSessionLock(t, s, "test-session-transfer-lock", receiverSession)
+	assert.Nil(t, sender.Lock(ctx, "sender"))
+
+	// 接收方把挂在自己会话上的 OwnerId 交给发送方
+	assert.Nil(t, sender.Transfer(ctx, "sender", receiverSession.OwnerId("receiver")))
+	assert.Nil(t, receiver.AcceptTransfer(ctx, "receiver"))
+	assert.Equal(t, receiverSession.OwnerId("receiver"), getTestLockInformation(t, s, "test-session-transfer-lock").OwnerId)
+
+	// 发送方的会话关闭了，锁仍然被接收方持有着
+	assert.Nil(t, senderSession.Close(ctx))
+	other := newTestSessionLock(t, s, "test-session-transfer-lock", nil)
+	timeoutCtx, cancelFunc := context.WithTimeout(ctx, time.Millisecond*100)
+	defer cancelFunc()
+	assert.ErrorIs(t, other.Lock(timeoutCtx, "other-owner"), storage_lock.ErrLockBusy)
+
+	assert.Nil(t, receiver.UnLock(ctx, "receiver"))
+	assert.Nil(t, other.Lock(ctx, "other-owner"))
+	assert.Nil(t, other.UnLock(ctx, "other-owner"))
+}
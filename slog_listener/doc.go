@@ -0,0 +1,5 @@
+// Package slog_listener 把锁发布的事件以结构化日志的形式输出到 log/slog 的监听器。
+//
+// log/slog 是 Go 1.21 才加入标准库的，这个包中的代码只在 Go 1.21 及以上的版本中编译，
+// 这个文件没有构建约束，保证在低版本中这个包也不是一个空包。
+package slog_listener
@@ -0,0 +1,167 @@
+//go:build go1.21
+
+package slog_listener
+
+import (
+	"context"
+	"github.com/storage-lock/go-events"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// SlogListener 把事件中的每个 action 输出为一条 log/slog 的结构化日志
+//
+// 日志的消息是 action 的名字，事件上的锁ID、持有者等信息和 action 的 payload 都作为结构化的属性，
+// 日志的时间是 action 发生的时间。日志级别默认按照 DefaultLevel 的规则决定，可以通过选项按 action 覆盖或者过滤掉：
+//
+//	listener := slog_listener.NewSlogListenerWithOptions(slog_listener.NewSlogListenerOptions().
+//		SetLogger(logger).
+//		SetLevel(storage_lock.ActionLockSuccess, slog.LevelDebug).
+//		Ignore(storage_lock.ActionTryLockBegin))
+//	options := storage_lock.NewStorageLockOptionsWithLockId(lockId).AddEventListeners(listener)
+type SlogListener struct {
+	options *SlogListenerOptions
+}
+
+var _ events.Listener = &SlogListener{}
+
+// SlogListenerName 结构化日志监听器的名字
+const SlogListenerName = "storage-lock-slog-listener"
+
+// 日志中的属性的名字
+const (
+	AttributeEventId     = "eventId"
+	AttributeRootId      = "rootId"
+	AttributeLockId      = "lockId"
+	AttributeOwnerId     = "ownerId"
+	AttributeStorageName = "storageName"
+	AttributeWatchDogId  = "watchDogId"
+	AttributeError       = "error"
+	AttributePayload     = "payload"
+)
+
+// NewSlogListener 使用默认选项创建结构化日志监听器，日志输出到给定的 logger，为 nil 的话输出到 slog.Default()
+func NewSlogListener(logger *slog.Logger) *SlogListener {
+	return NewSlogListenerWithOptions(NewSlogListenerOptions().SetLogger(logger))
+}
+
+// NewSlogListenerWithOptions 使用给定的选项创建结构化日志监听器
+func NewSlogListenerWithOptions(options *SlogListenerOptions) *SlogListener {
+	return &SlogListener{
+		options: options,
+	}
+}
+
+func (x *SlogListener) Name() string {
+	return SlogListenerName
+}
+
+func (x *SlogListener) On(ctx context.Context, e *events.Event) {
+	logger := x.options.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	handler := logger.Handler()
+
+	for _, action := range e.Actions {
+		if x.options.IgnoredActions[action.Name] {
+			continue
+		}
+		if x.options.Filter != nil && !x.options.Filter(e, action) {
+			continue
+		}
+		level, exists := x.options.Levels[action.Name]
+		if !exists {
+			level = DefaultLevel(action)
+		}
+		if !handler.Enabled(ctx, level) {
+			continue
+		}
+
+		record := slog.NewRecord(actionTime(action), level, action.Name, 0)
+		record.AddAttrs(eventAttrs(e)...)
+		if action.Err != nil {
+			record.AddAttrs(slog.String(AttributeError, action.Err.Error()))
+		}
+		if payload := payloadAttrs(action); len(payload) != 0 {
+			record.AddAttrs(slog.Attr{Key: AttributePayload, Value: slog.GroupValue(payload...)})
+		}
+		_ = handler.Handle(ctx, record)
+	}
+}
+
+// DefaultLevel 默认的日志级别：
+//   - 丢失租约（看门狗发现锁被别人持有了或者锁记录没了、租约断档、会话丢失）是 Warn
+//   - 锁被占用、版本miss 以及随之而来的休眠重试是正常的竞争，是 Debug
+//   - 其它带着错误的 action 是 Error
+//   - 剩下的是 Info
+func DefaultLevel(action *events.Action) slog.Level {
+	switch action.Name {
+	case storage_lock.ActionWatchDogLeaseContinuityViolation, storage_lock.ActionSessionLost, storage_lock.ActionLockSessionExpired:
+		return slog.LevelWarn
+	case storage_lock.ActionNotLockOwner:
+		// 释放锁、转移锁的时候发现不是自己的锁是调用方的问题，只有看门狗续租时发现的才带着错误
+		if action.ErrorIs(storage_lock.ErrLockNotBelongYou) {
+			return slog.LevelWarn
+		}
+		return slog.LevelInfo
+	case storage_lock.ActionLockNotFoundError:
+		// 读取锁的时候锁不存在是正常的，只有看门狗续租时发现的才带着错误，这时候租约已经丢了
+		if action.ErrorIs(storage_lock.ErrLockNotFound) {
+			return slog.LevelWarn
+		}
+		return slog.LevelInfo
+	case storage_lock.ActionLockBusy, storage_lock.ActionLockVersionMiss, storage_lock.ActionUnlockVersionMiss, storage_lock.ActionTransferVersionMiss,
+		storage_lock.ActionSweepDeleteConflict, storage_lock.ActionSleep, storage_lock.ActionSleepRetry:
+		return slog.LevelDebug
+	}
+	if action.Err == nil {
+		return slog.LevelInfo
+	}
+	// 存储操作因为版本miss、锁已经存在而失败同样是正常的竞争
+	if action.ErrorIs(storage_lock.ErrVersionMiss) || action.ErrorIs(storage_lock.ErrLockAlreadyExists) || action.ErrorIs(storage_lock.ErrLockBusy) {
+		return slog.LevelDebug
+	}
+	return slog.LevelError
+}
+
+func eventAttrs(e *events.Event) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String(AttributeEventId, e.ID),
+		slog.String(AttributeRootId, e.RootID),
+	}
+	for _, attr := range []slog.Attr{
+		slog.String(AttributeLockId, e.LockId),
+		slog.String(AttributeOwnerId, e.OwnerId),
+		slog.String(AttributeStorageName, e.StorageName),
+		slog.String(AttributeWatchDogId, e.WatchDogId),
+	} {
+		if attr.Value.String() != "" {
+			attrs = append(attrs, attr)
+		}
+	}
+	return attrs
+}
+
+// payload 按名字排序之后作为属性，保证输出稳定
+func payloadAttrs(action *events.Action) []slog.Attr {
+	keys := make([]string, 0, len(action.PayloadMap))
+	for key := range action.PayloadMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, slog.Any(key, action.PayloadMap[key]))
+	}
+	return attrs
+}
+
+func actionTime(action *events.Action) time.Time {
+	if action.StartTime != nil {
+		return *action.StartTime
+	}
+	return time.Now()
+}
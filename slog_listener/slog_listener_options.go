@@ -0,0 +1,62 @@
+//go:build go1.21
+
+package slog_listener
+
+import (
+	"github.com/storage-lock/go-events"
+	"log/slog"
+)
+
+// SlogListenerOptions 创建结构化日志监听器（SlogListener）的相关选项
+type SlogListenerOptions struct {
+
+	// 日志输出到哪里，未设置的话使用 slog.Default()
+	Logger *slog.Logger
+
+	// 按 action 的名字覆盖默认的日志级别
+	Levels map[string]slog.Level
+
+	// 不输出的 action
+	IgnoredActions map[string]bool
+
+	// 更灵活的过滤，返回 false 的 action 不输出，为 nil 时全部输出
+	Filter func(e *events.Event, action *events.Action) bool
+}
+
+// NewSlogListenerOptions 使用默认值创建结构化日志监听器的选项
+func NewSlogListenerOptions() *SlogListenerOptions {
+	return &SlogListenerOptions{
+		Levels:         make(map[string]slog.Level),
+		IgnoredActions: make(map[string]bool),
+	}
+}
+
+func (x *SlogListenerOptions) SetLogger(logger *slog.Logger) *SlogListenerOptions {
+	x.Logger = logger
+	return x
+}
+
+// SetLevel 给定名字的 action 使用给定的日志级别
+func (x *SlogListenerOptions) SetLevel(actionName string, level slog.Level) *SlogListenerOptions {
+	if x.Levels == nil {
+		x.Levels = make(map[string]slog.Level)
+	}
+	x.Levels[actionName] = level
+	return x
+}
+
+// Ignore 不输出给定名字的 action
+func (x *SlogListenerOptions) Ignore(actionNames ...string) *SlogListenerOptions {
+	if x.IgnoredActions == nil {
+		x.IgnoredActions = make(map[string]bool)
+	}
+	for _, actionName := range actionNames {
+		x.IgnoredActions[actionName] = true
+	}
+	return x
+}
+
+func (x *SlogListenerOptions) SetFilter(filter func(e *events.Event, action *events.Action) bool) *SlogListenerOptions {
+	x.Filter = filter
+	return x
+}
@@ -0,0 +1,135 @@
+//go:build go1.21
+
+package slog_listener
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-events"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// 并发写入安全的缓冲区，看门狗会在别的协程中写日志
+type testLogBuffer struct {
+	mutex sync.Mutex
+	buff  bytes.Buffer
+}
+
+func (x *testLogBuffer) Write(p []byte) (int, error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.buff.Write(p)
+}
+
+// 按 action 的名字收集输出的日志
+func (x *testLogBuffer) records(t *testing.T) map[string][]map[string]any {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	records := make(map[string][]map[string]any)
+	for _, line := range strings.Split(strings.TrimSpace(x.buff.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		record := make(map[string]any)
+		assert.Nil(t, json.Unmarshal([]byte(line), &record))
+		name := record[slog.MessageKey].(string)
+		records[name] = append(records[name], record)
+	}
+	return records
+}
+
+func newTestSlogLogger(buff *testLogBuffer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(buff, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestSlogListener_Lock(t *testing.T) {
+	ctx := context.Background()
+	buff := &testLogBuffer{}
+	listener := NewSlogListenerWithOptions(NewSlogListenerOptions().
+		SetLogger(newTestSlogLogger(buff)).
+		SetLevel(storage_lock.ActionUnlockSuccess, slog.LevelWarn).
+		Ignore(storage_lock.ActionTryLockBegin).
+		SetFilter(func(e *events.Event, action *events.Action) bool {
+			return action.Name != storage_lock.ActionSleepRetry
+		}))
+
+	s := memory_storage.NewMemoryStorage()
+	newLock := func() *storage_lock.StorageLock {
+		options := storage_lock.NewStorageLockOptionsWithLockId("test-slog-lock").
+			SetVersionMissRetryInterval(time.Millisecond * 10).
+			AddEventListeners(listener)
+		lock, err := storage_lock.NewStorageLockWithOptions(s, options)
+		assert.Nil(t, err)
+		return lock
+	}
+	holder := newLock()
+	waiter := newLock()
+
+	assert.Nil(t, holder.Lock(ctx, "holder"))
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+	defer cancel()
+	assert.NotNil(t, waiter.Lock(timeoutCtx, "waiter"))
+	assert.Nil(t, holder.UnLock(ctx, "holder"))
+
+	records := buff.records(t)
+
+	success := records[storage_lock.ActionLockSuccess][0]
+	assert.Equal(t, "INFO", success[slog.LevelKey])
+	assert.Equal(t, "test-slog-lock", success[AttributeLockId])
+	assert.Equal(t, "holder", success[AttributeOwnerId])
+	assert.Equal(t, s.GetName(), success[AttributeStorageName])
+
+	// 锁被占用是 Debug，payload 是结构化的属性
+	busy := records[storage_lock.ActionLockBusy]
+	assert.NotEmpty(t, busy)
+	for _, record := range busy {
+		assert.Equal(t, "DEBUG", record[slog.LevelKey])
+	}
+	payload := busy[len(busy)-1][AttributePayload].(map[string]any)
+	assert.Greater(t, payload[storage_lock.PayloadLockBusyCount], float64(0))
+
+	// 覆盖级别、忽略、过滤
+	assert.Equal(t, "WARN", records[storage_lock.ActionUnlockSuccess][0][slog.LevelKey])
+	assert.Empty(t, records[storage_lock.ActionTryLockBegin])
+	assert.Empty(t, records[storage_lock.ActionSleepRetry])
+	assert.NotEmpty(t, records[storage_lock.ActionSleep])
+}
+
+func TestSlogListener_Levels(t *testing.T) {
+	ctx := context.Background()
+	buff := &testLogBuffer{}
+	listener := NewSlogListener(newTestSlogLogger(buff))
+
+	events.NewEvent("test-slog-lock").
+		AddAction(events.NewAction(storage_lock.ActionLockError).SetErr(errors.New("test storage down"))).
+		AddAction(events.NewAction(storage_lock.ActionWatchDogLeaseContinuityViolation).SetErr(storage_lock.ErrLeaseContinuityViolated)).
+		AddAction(events.NewAction(storage_lock.ActionNotLockOwner).SetErr(storage_lock.ErrLockNotBelongYou)).
+		AddAction(events.NewAction(storage_lock.ActionLockNotFoundError).SetErr(storage_lock.ErrLockNotFound)).
+		AddAction(events.NewAction("test-storage-update-error").SetErr(storage_lock.ErrVersionMiss)).
+		Publish(ctx, listener)
+
+	records := buff.records(t)
+	lockError := records[storage_lock.ActionLockError][0]
+	assert.Equal(t, "ERROR", lockError[slog.LevelKey])
+	assert.Equal(t, "test storage down", lockError[AttributeError])
+	assert.Equal(t, "WARN", records[storage_lock.ActionWatchDogLeaseContinuityViolation][0][slog.LevelKey])
+	assert.Equal(t, "WARN", records[storage_lock.ActionNotLockOwner][0][slog.LevelKey])
+	assert.Equal(t, "WARN", records[storage_lock.ActionLockNotFoundError][0][slog.LevelKey])
+	assert.Equal(t, "DEBUG", records["test-storage-update-error"][0][slog.LevelKey])
+
+	// 低于 logger 的级别的不输出
+	buff = &testLogBuffer{}
+	listener = NewSlogListener(slog.New(slog.NewJSONHandler(buff, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	events.NewEvent("test-slog-lock").AddActionByName(storage_lock.ActionLockSuccess).AddActionByName(storage_lock.ActionLockBusy).Publish(ctx, listener)
+	assert.Empty(t, buff.records(t))
+}
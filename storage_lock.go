@@ -17,7 +17,8 @@ type StorageLock struct {
 	// 锁持久化存储到哪个存储介质上，go_storage.Storage是个接口，用来把锁进行持久化存储，这个接口有很多种不同的实现
 	storage go_storage.Storage
 	// 调用storage方法的时候不会直接调用，而是通过一层带事件监听和recover包着的执行器来调用，这样我们可以实现对锁的可观测性以及一些更高级的特性
-	storageExecutor *storage_events.WithEventSafeExecutor
+	// 每次调用存储的时候还会按照选项中的配置加上超时
+	storageExecutor *timeoutStorageExecutor
 
 	// 锁的一些选项，可以高度定制化锁的行为
 	options *StorageLockOptions
@@ -29,8 +30,14 @@ type StorageLock struct {
 	// 保护 storageLockWatchDog 的读写，防止 Lock 和 UnLock 并发操作时产生数据竞争
 	watchDogMu sync.Mutex
 
+	// 最近一次启动看门狗时租约开始的本地时间，同样由 watchDogMu 保护
+	leaseStartTime time.Time
+
 	// 做一些ID自动生成的工作
 	ownerIdGenerator *OwnerIdGenerator
+
+	// 检测时间源与本地时钟之间的漂移
+	clockSkewMonitor *clockSkewMonitor
 }
 
 // LockIdPrefix 自动生成的锁的ID的前缀，但是不建议使用自动生成的锁ID
@@ -53,22 +60,14 @@ func NewStorageLockWithOptions(storage go_storage.Storage, options *StorageLockO
 	}
 
 	// 检查存储实现是否满足分布式锁的必要条件
-	// 必要条件 1：CAS 原子性（CapabilityCAS）——硬性，不可降级，直接保护互斥性
-	// 必要条件 2：可靠时间源——可由"Storage 声明 CapabilityReliableTime"或"外部注入 options.TimeProvider"满足其一
-	//   这让对象存储、HTTP 存储等无服务端时钟的介质可通过注入 NTP 时间源接入
 	if !options.SkipCapabilityCheck {
-		missingCapabilities := go_storage.CheckCapabilities(storage)
-		// 若仅缺 ReliableTime 且用户注入了外部 TimeProvider，则视为已满足
-		if len(missingCapabilities) > 0 {
-			filtered := make([]go_storage.StorageCapability, 0, len(missingCapabilities))
-			for _, c := range missingCapabilities {
-				if c == go_storage.CapabilityReliableTime && options.TimeProvider != nil {
-					continue // 由外部 TimeProvider 替代满足
-				}
-				filtered = append(filtered, c)
-			}
-			if len(filtered) > 0 {
-				return nil, fmt.Errorf("%w: storage %s missing capabilities: %v", ErrStorageCapabilityMissing, storage.GetName(), filtered)
+		if err := checkStorageCapabilities(storage, options.TimeProvider); err != nil {
+			return nil, err
+		}
+		// 声明的能力没问题之后再实际验证一下
+		if options.CapabilitySelfTest {
+			if err := checkStorageSelfTest(storage, options.TimeProvider); err != nil {
+				return nil, err
 			}
 		}
 	}
@@ -77,9 +76,14 @@ func NewStorageLockWithOptions(storage go_storage.Storage, options *StorageLockO
 	e := events.NewEvent(options.LockId).SetType(events.EventTypeCreateLock).SetStorageName(storage.GetName()).SetListeners(options.EventListeners)
 	lock := &StorageLock{
 		storage:          storage,
-		storageExecutor:  storage_events.NewWithEventSafeExecutor(storage),
+		storageExecutor:  newTimeoutStorageExecutor(storage, options),
 		options:          options,
 		ownerIdGenerator: NewOwnerIdGenerator(),
+		clockSkewMonitor: newClockSkewMonitor(options),
+	}
+	// 配置了签名密钥的话锁记录的所有写入都要先签名
+	if len(options.SigningKey) != 0 {
+		lock.storageExecutor = newTimeoutStorageExecutor(newSigningStorage(storage, options.SigningKey), options)
 	}
 
 	ctx, cancelFunc := context.WithTimeout(context.Background(), time.Minute*5)
@@ -89,12 +93,48 @@ func NewStorageLockWithOptions(storage go_storage.Storage, options *StorageLockO
 	return lock, nil
 }
 
+// checkStorageCapabilities 检查存储实现是否满足分布式锁的必要条件，锁和会话（Session）共用
+// 必要条件 1：CAS 原子性（CapabilityCAS）——硬性，不可降级，直接保护互斥性
+// 必要条件 2：可靠时间源——可由"Storage 声明 CapabilityReliableTime"或"外部注入 TimeProvider"满足其一，
+// 这让对象存储、HTTP 存储等无服务端时钟的介质可通过注入 NTP 时间源接入
+func checkStorageCapabilities(storage go_storage.Storage, timeProvider go_storage.TimeProvider) error {
+	missingCapabilities := go_storage.CheckCapabilities(storage)
+	// 若仅缺 ReliableTime 且用户注入了外部 TimeProvider，则视为已满足
+	if len(missingCapabilities) > 0 {
+		filtered := make([]go_storage.StorageCapability, 0, len(missingCapabilities))
+		for _, c := range missingCapabilities {
+			if c == go_storage.CapabilityReliableTime && timeProvider != nil {
+				continue // 由外部 TimeProvider 替代满足
+			}
+			filtered = append(filtered, c)
+		}
+		if len(filtered) > 0 {
+			return fmt.Errorf("%w: storage %s missing capabilities: %v", ErrStorageCapabilityMissing, storage.GetName(), filtered)
+		}
+	}
+	return nil
+}
+
 // getTime 获取用于租约计算的时间
 // 优先使用外部注入的 options.TimeProvider（用于对象存储、HTTP 存储等无服务端时钟的介质），
 // 否则回退到 Storage 自身的时间。两者取其一，由能力校验保证至少有一个可用。
+// 每次读取到的时间都会交给 clockSkewMonitor 检测与本地时钟之间的漂移
 func (x *StorageLock) getTime(ctx context.Context, e *events.Event) (time.Time, error) {
+	localBefore := x.clock().Now()
+	storageTime, err := x.readTime(ctx, e)
+	if err != nil {
+		return storageTime, err
+	}
+	x.clockSkewMonitor.observe(ctx, e, localBefore, x.clock().Now(), storageTime)
+	return storageTime, nil
+}
+
+func (x *StorageLock) readTime(ctx context.Context, e *events.Event) (time.Time, error) {
 	if x.options.TimeProvider != nil {
-		return x.options.TimeProvider.GetTime(ctx)
+		timeoutCtx, cancelFunc := withStorageTimeout(ctx, x.options.GetTimeTimeout)
+		defer cancelFunc()
+		storageTime, err := x.options.TimeProvider.GetTime(timeoutCtx)
+		return storageTime, checkStorageTimeout(ctx, timeoutCtx, e, ActionStorageGetTimeTimeout, x.options.GetTimeTimeout, err)
 	}
 	return x.storageExecutor.GetTime(ctx, e)
 }
@@ -115,10 +155,28 @@ func (x *StorageLock) retryIntervalRandomBase() time.Duration {
 }
 
 // 获取之前的锁保存的信息
+// 配置了签名密钥的话会校验锁记录的签名，校验不通过时同时返回锁的信息和 ErrLockRecordTampered，由调用方决定如何处理
 // ctx:
 // e: 事件流推送
 // lockId: 要获取的锁的信息
 func (x *StorageLock) getLockInformation(ctx context.Context, e *events.Event, lockId string) (*go_storage.LockInformation, error) {
+	lockInformation, err := x.readLockInformation(ctx, e, lockId)
+	if err != nil || len(x.options.SigningKey) == 0 {
+		return lockInformation, err
+	}
+	if err := verifySignature(x.options.SigningKey, lockInformation); err != nil {
+		action := events.NewAction(ActionLockRecordTampered).
+			SetErr(err).
+			AddPayload(storage_events.PayloadLockId, lockId).
+			AddPayload(storage_events.PayloadLockInformation, lockInformation)
+		e.Fork().AddAction(action).Publish(ctx)
+		return lockInformation, err
+	}
+	return lockInformation, nil
+}
+
+// 读取存储中保存的锁的信息，不校验签名
+func (x *StorageLock) readLockInformation(ctx context.Context, e *events.Event, lockId string) (*go_storage.LockInformation, error) {
 
 	e.AddActionByName("StorageLock.getLockInformation.Begin").Publish(ctx)
 
@@ -139,7 +197,7 @@ func (x *StorageLock) getLockInformation(ctx context.Context, e *events.Event, l
 		AddPayload(storage_events.PayloadLockId, lockId).
 		AddPayload(storage_events.PayloadLockInformationJsonString, lockInformationJsonString)
 	e.Fork().AddAction(action).Publish(ctx)
-	return go_storage.LockInformationFromJsonString(lockInformationJsonString)
+	return DecodeLockInformation(lockInformationJsonString)
 }
 
 // stopWatchDog 停止看门狗协程并清空引用，带互斥锁保护
@@ -167,4 +225,19 @@ func (x *StorageLock) setWatchDog(watchDog WatchDog) {
 	x.storageLockWatchDog = watchDog
 }
 
+func (x *StorageLock) setLeaseStartTime(leaseStart time.Time) {
+	x.watchDogMu.Lock()
+	defer x.watchDogMu.Unlock()
+	x.leaseStartTime = leaseStart
+}
+
+// LeaseStartTime 正在创建的看门狗所守护的租约开始时对应的本地时间（按 StorageLockOptions.Clock），
+// 取的是获取锁写入之前、读取存储时间之前的时刻，所以不会晚于真实的租约起点；
+// 接手转移过来的锁时不知道租约的起点，返回零值。WatchDogFactory 创建看门狗的时候用它计算第一个租约的截止时间
+func (x *StorageLock) LeaseStartTime() time.Time {
+	x.watchDogMu.Lock()
+	defer x.watchDogMu.Unlock()
+	return x.leaseStartTime
+}
+
 // ------------------------------------------------- --------------------------------------------------------------------
@@ -0,0 +1,203 @@
+package storage_lock
+
+import (
+	"context"
+	"fmt"
+	"github.com/storage-lock/go-events"
+	"sync"
+	"time"
+)
+
+// StorageLock中与时钟漂移检测相关的逻辑拆分到这个文件中
+//
+// 租约是按存储时间（或者 TimeProvider 的时间）计算的，看门狗却是按本地时钟休眠的，
+// checkStorageLockOptions 检查的续租安全余量默认两边的时间走得一样快。
+// 如果本地时钟比存储时钟走得慢（或者存储的时间发生了跳变），看门狗按本地时间休眠一个刷新间隔，
+// 在存储看来已经过去了更久，余量被悄悄的吃掉，租约可能在续租之前就过期了。
+//
+// 锁每次读取时间的时候都会顺便记录一个样本：本地单调时钟的读数和时间源返回的时间，
+// 对比两个样本之间两边各自走过的时间就能得到这段时间内的漂移，漂移超过 ClockSkewThreshold 时发布 ActionClockSkewExceeded，
+// 两个样本之间隔了不止一段观察区间的时候按速率折算成一段观察区间内的漂移，
+// 之后要观察到一段不短于 LeaseExpireAfter 的、漂移在阈值之内的区间才会恢复并发布 ActionClockSkewRecovered。
+// 每过 LeaseExpireAfter 重新开始一段观察区间并发布一次 ActionClockSkew，事件中带有这段时间内的漂移。
+//
+// 漂移超过阈值的时候除了发布事件，还可以通过 ClockSkewPolicy 选择：
+//   - ClockSkewPolicyRefuseLock：拒绝新的 Lock 调用，直到恢复为止
+//   - ClockSkewPolicyShortenLease：看门狗按本地时间计算的刷新间隔和租约截止时间都扣掉观察到的漂移，提前续租
+
+// ClockSkewPolicy 时间源与本地时钟的漂移超过阈值的时候如何处理
+type ClockSkewPolicy int
+
+const (
+
+	// ClockSkewPolicyReport 只发布事件，这是默认的策略
+	ClockSkewPolicyReport ClockSkewPolicy = iota
+
+	// ClockSkewPolicyRefuseLock 拒绝新的获取锁，Lock 返回 ErrClockSkewExceeded，已经持有的锁不受影响
+	ClockSkewPolicyRefuseLock
+
+	// ClockSkewPolicyShortenLease 缩短看门狗眼中的有效租约，刷新间隔和本地的租约截止时间都扣掉观察到的漂移
+	ClockSkewPolicyShortenLease
+)
+
+func (x ClockSkewPolicy) String() string {
+	switch x {
+	case ClockSkewPolicyReport:
+		return "report"
+	case ClockSkewPolicyRefuseLock:
+		return "refuse-lock"
+	case ClockSkewPolicyShortenLease:
+		return "shorten-lease"
+	default:
+		return "unknown"
+	}
+}
+
+// clockSkewMonitor 根据锁读取时间时顺便记录的样本，持续的检测时间源与本地单调时钟之间的漂移
+type clockSkewMonitor struct {
+
+	// 漂移超过多少算异常，小于 0 表示不检测
+	threshold time.Duration
+
+	// 每段观察区间的长度
+	window time.Duration
+
+	mutex sync.Mutex
+
+	// 当前观察区间的起点：本地单调时钟的读数、时间源的时间、这个样本本身的误差
+	baseLocalTime  time.Time
+	baseSourceTime time.Time
+	baseNoise      time.Duration
+	hasBase        bool
+
+	// 漂移是否超过了阈值，以及最近一次观察到的漂移
+	exceeded bool
+	drift    time.Duration
+}
+
+func newClockSkewMonitor(options *StorageLockOptions) *clockSkewMonitor {
+	threshold := options.ClockSkewThreshold
+	if threshold == 0 {
+		// 默认允许漂移吃掉一半的续租安全余量
+		threshold = (options.LeaseExpireAfter - options.LeaseRefreshInterval) / 2
+	}
+	return &clockSkewMonitor{
+		threshold: threshold,
+		window:    options.LeaseExpireAfter,
+	}
+}
+
+// 记录一个样本，localBefore 和 localAfter 是读取时间前后本地单调时钟的读数
+func (x *clockSkewMonitor) observe(ctx context.Context, e *events.Event, localBefore, localAfter, sourceTime time.Time) {
+	if x.threshold < 0 {
+		return
+	}
+
+	// 认为时间源是在往返的正中间读的时间，误差最多是往返耗时的一半
+	rtt := localAfter.Sub(localBefore)
+	localTime := localBefore.Add(rtt / 2)
+	noise := rtt / 2
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if !x.hasBase {
+		x.rebase(localTime, sourceTime, noise)
+		return
+	}
+
+	localElapsed := localTime.Sub(x.baseLocalTime)
+	drift := sourceTime.Sub(x.baseSourceTime) - localElapsed
+	if drift < 0 {
+		drift = -drift
+	}
+	// 闲置了很久才来的样本跨过了好几段观察区间，正常的晶振误差累积下来也会超过阈值，
+	// 所以按漂移的速率折算成一段观察区间内的漂移再比较
+	span := localElapsed
+	if span > x.window {
+		drift = time.Duration(float64(drift) * float64(x.window) / float64(span))
+		span = x.window
+	}
+	// 扣掉两个样本本身的误差，剩下的才是确定的漂移
+	excess := drift - noise - x.baseNoise
+
+	if excess > x.threshold {
+		x.drift = drift
+		if !x.exceeded {
+			x.exceeded = true
+			e.Fork().AddAction(events.NewAction(ActionClockSkewExceeded).
+				SetErr(fmt.Errorf("%w: drift %s in %s exceeds %s", ErrClockSkewExceeded, drift, span, x.threshold)).
+				AddPayload(PayloadClockSkew, drift)).Publish(ctx)
+		}
+		x.rebase(localTime, sourceTime, noise)
+		return
+	}
+
+	if localElapsed >= x.window {
+		x.drift = drift
+		e.Fork().AddAction(events.NewAction(ActionClockSkew).AddPayload(PayloadClockSkew, drift)).Publish(ctx)
+		if x.exceeded {
+			x.exceeded = false
+			e.Fork().AddAction(events.NewAction(ActionClockSkewRecovered).AddPayload(PayloadClockSkew, drift)).Publish(ctx)
+		}
+		x.rebase(localTime, sourceTime, noise)
+	}
+}
+
+// 开始一段新的观察区间，调用前要持有 mutex
+func (x *clockSkewMonitor) rebase(localTime, sourceTime time.Time, noise time.Duration) {
+	x.baseLocalTime = localTime
+	x.baseSourceTime = sourceTime
+	x.baseNoise = noise
+	x.hasBase = true
+}
+
+// 漂移超过阈值的话返回观察到的漂移
+func (x *clockSkewMonitor) exceededDrift() (time.Duration, bool) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.drift, x.exceeded
+}
+
+// 获取锁之前检查漂移，策略是 ClockSkewPolicyRefuseLock 并且漂移超过了阈值的时候拒绝获取，
+// 拒绝之前先重新读一次时间，让被拒绝的调用方也能推动检测恢复
+func (x *StorageLock) checkClockSkew(ctx context.Context, e *events.Event) error {
+	if x.options.ClockSkewPolicy != ClockSkewPolicyRefuseLock {
+		return nil
+	}
+	if _, exceeded := x.clockSkewMonitor.exceededDrift(); !exceeded {
+		return nil
+	}
+	if _, err := x.getTime(ctx, e.Fork()); err != nil {
+		return err
+	}
+	if drift, exceeded := x.clockSkewMonitor.exceededDrift(); exceeded {
+		return fmt.Errorf("%w: drift %s", ErrClockSkewExceeded, drift)
+	}
+	return nil
+}
+
+// 看门狗使用的有效租约时长，策略是 ClockSkewPolicyShortenLease 并且漂移超过了阈值的时候扣掉漂移
+func (x *StorageLock) effectiveLeaseExpireAfter() time.Duration {
+	return x.shortenByClockSkew(x.options.LeaseExpireAfter)
+}
+
+// 看门狗使用的有效刷新间隔，策略是 ClockSkewPolicyShortenLease 并且漂移超过了阈值的时候扣掉漂移
+func (x *StorageLock) effectiveLeaseRefreshInterval() time.Duration {
+	return x.shortenByClockSkew(x.options.LeaseRefreshInterval)
+}
+
+// 扣掉漂移，但是最多缩短到原来的四分之一，避免看门狗疯狂的续租
+func (x *StorageLock) shortenByClockSkew(duration time.Duration) time.Duration {
+	if x.options.ClockSkewPolicy != ClockSkewPolicyShortenLease {
+		return duration
+	}
+	drift, exceeded := x.clockSkewMonitor.exceededDrift()
+	if !exceeded {
+		return duration
+	}
+	if shortened := duration - drift; shortened > duration/4 {
+		return shortened
+	}
+	return duration / 4
+}
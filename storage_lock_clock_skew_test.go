@@ -0,0 +1,129 @@
+package storage_lock_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/fake_clock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// 在本地时间的基础上加一个可以随时调整的偏移，用来模拟时间源的跳变
+type testSkewTimeProvider struct {
+	offset atomic.Int64
+}
+
+func (x *testSkewTimeProvider) GetTime(ctx context.Context) (time.Time, error) {
+	return time.Now().Add(time.Duration(x.offset.Load())), nil
+}
+
+func newTestClockSkewLock(t *testing.T, timeProvider *testSkewTimeProvider, policy storage_lock.ClockSkewPolicy, recorder *testActionRecorder) *storage_lock.StorageLock {
+	options := storage_lock.NewStorageLockOptionsWithLockId("test-clock-skew-lock").
+		SetLeaseExpireAfter(time.Second * 30).
+		SetLeaseRefreshInterval(time.Second * 10).
+		SetTimeProvider(timeProvider).
+		SetClockSkewThreshold(time.Millisecond * 500).
+		SetClockSkewPolicy(policy).
+		AddEventListeners(recorder.listener())
+	lock, err := storage_lock.NewStorageLockWithOptions(memory_storage.NewMemoryStorage(), options)
+	assert.Nil(t, err)
+	return lock
+}
+
+func TestStorageLock_ClockSkewReport(t *testing.T) {
+	ctx := context.Background()
+	recorder := newTestActionRecorder()
+	timeProvider := &testSkewTimeProvider{}
+	lock := newTestClockSkewLock(t, timeProvider, storage_lock.ClockSkewPolicyReport, recorder)
+
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+	assert.Equal(t, 0, recorder.count(storage_lock.ActionClockSkewExceeded))
+
+	// 时间源向前跳了一秒，只发布一次事件，不影响获取锁
+	timeProvider.offset.Store(int64(time.Second))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, lock.Lock(ctx, "owner"))
+		assert.Nil(t, lock.UnLock(ctx, "owner"))
+	}
+	assert.Equal(t, 1, recorder.count(storage_lock.ActionClockSkewExceeded))
+	assert.Equal(t, time.Second*30, lock.EffectiveLeaseExpireAfter())
+}
+
+func TestStorageLock_ClockSkewRefuseLock(t *testing.T) {
+	ctx := context.Background()
+	recorder := newTestActionRecorder()
+	timeProvider := &testSkewTimeProvider{}
+	lock := newTestClockSkewLock(t, timeProvider, storage_lock.ClockSkewPolicyRefuseLock, recorder)
+
+	// 重入的时候读取时间发现了漂移，已经持有的锁不受影响
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	timeProvider.offset.Store(int64(time.Second))
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	assert.Equal(t, 1, recorder.count(storage_lock.ActionClockSkewExceeded))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+
+	err := lock.Lock(ctx, "owner")
+	assert.ErrorIs(t, err, storage_lock.ErrClockSkewExceeded)
+}
+
+func TestStorageLock_ClockSkewShortenLease(t *testing.T) {
+	ctx := context.Background()
+	recorder := newTestActionRecorder()
+	timeProvider := &testSkewTimeProvider{}
+	lock := newTestClockSkewLock(t, timeProvider, storage_lock.ClockSkewPolicyShortenLease, recorder)
+
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	timeProvider.offset.Store(int64(time.Second * 2))
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	assert.Equal(t, 1, recorder.count(storage_lock.ActionClockSkewExceeded))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+
+	// 扣掉了观察到的大约两秒的漂移
+	assert.InDelta(t, float64(time.Second*28), float64(lock.EffectiveLeaseExpireAfter()), float64(time.Millisecond*100))
+	assert.InDelta(t, float64(time.Second*8), float64(lock.EffectiveLeaseRefreshInterval()), float64(time.Millisecond*100))
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+}
+
+// 按比本地时钟快百分之一的速度走的时间源
+type testFastTimeProvider struct {
+	clock *fake_clock.FakeClock
+}
+
+func (x *testFastTimeProvider) GetTime(ctx context.Context) (time.Time, error) {
+	elapsed := x.clock.Now().Sub(fake_clock.DefaultStartTime)
+	return fake_clock.DefaultStartTime.Add(elapsed + elapsed/100), nil
+}
+
+// 闲置很久之后累积下来的漂移按速率折算，百分之一的晶振误差不会被当成异常
+func TestStorageLock_ClockSkewIdleGap(t *testing.T) {
+	ctx := context.Background()
+	recorder := newTestActionRecorder()
+	clock := fake_clock.NewFakeClock()
+	options := storage_lock.NewStorageLockOptionsWithLockId("test-clock-skew-idle-gap").
+		SetLeaseExpireAfter(time.Second * 30).
+		SetLeaseRefreshInterval(time.Second * 10).
+		SetTimeProvider(&testFastTimeProvider{clock: clock}).
+		SetClockSkewThreshold(time.Millisecond * 500).
+		SetClockSkewPolicy(storage_lock.ClockSkewPolicyRefuseLock).
+		SetClock(clock).
+		AddEventListeners(recorder.listener())
+	lock, err := storage_lock.NewStorageLockWithOptions(memory_storage.NewMemoryStorage(), options)
+	assert.Nil(t, err)
+
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+
+	// 闲置了一个小时，累积的漂移有 36 秒，折算到 30 秒的观察区间内只有 300 毫秒
+	clock.Advance(time.Hour)
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+	assert.Equal(t, 0, recorder.count(storage_lock.ActionClockSkewExceeded))
+}
@@ -0,0 +1,182 @@
+package storage_lock_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/fake_clock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/storage-lock/go-storage-lock/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+const testClockLockId = "test-clock-lock"
+
+func newTestClockLock(t *testing.T, s *memory_storage.MemoryStorage, clock storage_lock.Clock) *storage_lock.StorageLock {
+	options := storage_lock.NewStorageLockOptionsWithLockId(testClockLockId).
+		SetLeaseExpireAfter(time.Second * 30).
+		SetLeaseRefreshInterval(time.Second * 10).
+		SetClock(clock)
+	lock, err := storage_lock.NewStorageLockWithOptions(s, options)
+	assert.Nil(t, err)
+	return lock
+}
+
+// 持有者崩溃之后租约过期被别人抢占，整个过程不需要真的等待
+func TestStorageLock_FakeClockExpireSteal(t *testing.T) {
+	ctx := context.Background()
+	begin := time.Now()
+	clock := fake_clock.NewFakeClock()
+	s := memory_storage.NewMemoryStorageWithOptions(memory_storage.NewMemoryStorageOptions().SetNowFunc(clock.Now))
+	crashed := newTestClockLock(t, s, clock)
+	stealer := newTestClockLock(t, s, clock)
+
+	// 持有者的看门狗停掉了，模拟进程崩溃
+	assert.Nil(t, crashed.Lock(ctx, "crashed-owner"))
+	assert.Nil(t, crashed.CurrentWatchDog().Stop(ctx))
+
+	result := make(chan error, 1)
+	go func() {
+		result <- stealer.Lock(ctx, "stealer")
+	}()
+
+	// 租约还没过期的时候一直在等
+	// 停掉的看门狗不会在时钟上留下定时器，等待的只有抢占者
+	assert.True(t, clock.BlockUntil(ctx, 1))
+	assert.Equal(t, 1, clock.Waiters())
+	clock.Advance(time.Second * 29)
+	assert.True(t, clock.BlockUntil(ctx, 1))
+	select {
+	case err := <-result:
+		t.Fatalf("lock stolen before lease expired: %v", err)
+	default:
+	}
+
+	// 租约过期之后抢占成功
+	clock.Advance(time.Second * 2)
+	assert.Nil(t, <-result)
+	information := getTestLockInformation(t, s, testClockLockId)
+	assert.Equal(t, "stealer", information.OwnerId)
+	assert.Nil(t, stealer.UnLock(ctx, "stealer"))
+	assert.Less(t, time.Since(begin), time.Second)
+}
+
+// 看门狗按照假的时钟续租，时间过去了很多个租约周期锁也一直有效
+func TestStorageLock_FakeClockWatchDogRefresh(t *testing.T) {
+	ctx := context.Background()
+	begin := time.Now()
+	clock := fake_clock.NewFakeClock()
+	s := memory_storage.NewMemoryStorageWithOptions(memory_storage.NewMemoryStorageOptions().SetNowFunc(clock.Now))
+	lock := newTestClockLock(t, s, clock)
+
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	for i := 0; i < 10; i++ {
+		assert.True(t, clock.BlockUntil(ctx, 1))
+		clock.Advance(time.Second * 10)
+	}
+	// 等最后一次续租完成
+	assert.True(t, clock.BlockUntil(ctx, 1))
+
+	information := getTestLockInformation(t, s, testClockLockId)
+	assert.Equal(t, "owner", information.OwnerId)
+	assert.True(t, information.LeaseExpireTime.After(clock.Now()), "lease %s expired at %s", information.LeaseExpireTime, clock.Now())
+	assert.Equal(t, fake_clock.DefaultStartTime.Add(time.Second*100), clock.Now())
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+	assert.Less(t, time.Since(begin), time.Second)
+}
+
+// 会话的心跳按照假的时钟续租，停掉之后不在时钟上留下定时器
+func TestSession_FakeClockHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	clock := fake_clock.NewFakeClock()
+	s := memory_storage.NewMemoryStorageWithOptions(memory_storage.NewMemoryStorageOptions().SetNowFunc(clock.Now))
+	sessionOptions := storage_lock.NewSessionOptions().
+		SetLeaseExpireAfter(time.Second * 3).
+		SetLeaseRefreshInterval(time.Second).
+		SetClock(clock)
+	session, err := storage_lock.NewSession(ctx, s, sessionOptions)
+	assert.Nil(t, err)
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, clock.BlockUntil(ctx, 1))
+		clock.Advance(time.Second)
+	}
+	assert.True(t, clock.BlockUntil(ctx, 1))
+	assert.True(t, session.IsAlive())
+	assert.True(t, getTestLockInformation(t, s, session.GetID()).LeaseExpireTime.After(clock.Now()))
+
+	assert.Nil(t, session.Close(ctx))
+	assert.Equal(t, 0, clock.Waiters())
+}
+
+// 清理器按照假的时钟定期清理，停掉之后不在时钟上留下定时器
+func TestSweeper_FakeClockInterval(t *testing.T) {
+	ctx := context.Background()
+	clock := fake_clock.NewFakeClock()
+	s := memory_storage.NewMemoryStorageWithOptions(memory_storage.NewMemoryStorageOptions().SetNowFunc(clock.Now))
+	sweeper, err := storage_lock.NewSweeperWithOptions(s, storage_lock.NewSweeperOptions().SetInterval(time.Minute).SetClock(clock))
+	assert.Nil(t, err)
+	sweeper.Start()
+	assert.True(t, clock.BlockUntil(ctx, 1))
+
+	information := storagetest.NewTestLockInformation()
+	information.LockId = "test-sweeper-fake-clock"
+	information.LeaseExpireTime = clock.Now().Add(-time.Hour * 2)
+	assert.Nil(t, s.CreateWithVersion(ctx, information.LockId, information.Version, information))
+
+	clock.Advance(time.Minute)
+	assert.True(t, clock.BlockUntil(ctx, 1))
+	assertTestRecordExists(t, s, information.LockId, false)
+
+	assert.Nil(t, sweeper.Stop(ctx))
+	assert.Equal(t, 0, clock.Waiters())
+}
+
+// 第一次读取时间的时候让假的时钟走过 20 秒，模拟获取锁的时候很慢
+type testSlowOnceTimeProvider struct {
+	clock *fake_clock.FakeClock
+	once  sync.Once
+}
+
+func (x *testSlowOnceTimeProvider) GetTime(ctx context.Context) (time.Time, error) {
+	now := x.clock.Now()
+	x.once.Do(func() {
+		x.clock.Advance(time.Second * 20)
+	})
+	return now, nil
+}
+
+// 看门狗的第一个租约截止时间从获取锁之前的本地时间算起，而不是从看门狗创建的时候算起
+func TestStorageLock_FakeClockLeaseStart(t *testing.T) {
+	ctx := context.Background()
+	clock := fake_clock.NewFakeClock()
+	violations := make(chan *storage_lock.LeaseContinuityViolation, 10)
+	options := storage_lock.NewStorageLockOptionsWithLockId("test-clock-lease-start").
+		SetLeaseExpireAfter(time.Second * 30).
+		SetLeaseRefreshInterval(time.Second * 10).
+		SetTimeProvider(&testSlowOnceTimeProvider{clock: clock}).
+		SetClock(clock).
+		SetOnLeaseContinuityViolation(func(ctx context.Context, violation *storage_lock.LeaseContinuityViolation) {
+			violations <- violation
+		})
+	s := memory_storage.NewMemoryStorageWithOptions(memory_storage.NewMemoryStorageOptions().SetNowFunc(clock.Now))
+	lock, err := storage_lock.NewStorageLockWithOptions(s, options)
+	assert.Nil(t, err)
+
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	assert.Equal(t, fake_clock.DefaultStartTime, lock.LeaseStartTime())
+
+	// 租约在存储看来从 DefaultStartTime 开始，31 秒之后已经过期了，看门狗醒来之后要能发现
+	assert.True(t, clock.BlockUntil(ctx, 1))
+	clock.Advance(time.Second * 11)
+	select {
+	case violation := <-violations:
+		assert.Equal(t, fake_clock.DefaultStartTime.Add(time.Second*30), violation.LeaseDeadline)
+	case <-time.After(time.Second * 5):
+		t.Fatal("lease continuity violation not reported")
+	}
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+}
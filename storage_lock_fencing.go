@@ -61,6 +61,7 @@ import (
 func (x *StorageLock) GetFencingToken(ctx context.Context, ownerId string) (go_storage.Version, error) {
 
 	lockId := x.options.LockId
+	ownerId = x.storageOwnerId(ownerId)
 	e := events.NewEvent(lockId).SetOwnerId(ownerId).SetStorageName(x.storage.GetName()).SetListeners(x.options.EventListeners)
 
 	lockInformation, err := x.getLockInformation(ctx, e.Fork(), lockId)
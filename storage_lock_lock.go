@@ -24,6 +24,8 @@ import (
 func (x *StorageLock) Lock(ctx context.Context, ownerId string) error {
 
 	lockId := x.options.LockId
+	// 会话模式下锁记录中的 OwnerId 需要带上会话ID
+	ownerId = x.storageOwnerId(ownerId)
 
 	// 触发一个获取锁的事件
 	e := events.NewEvent(lockId).SetOwnerId(ownerId).SetType(events.EventTypeLock).SetListeners(x.options.EventListeners).SetStorageName(x.storage.GetName())
@@ -40,6 +42,17 @@ func (x *StorageLock) Lock(ctx context.Context, ownerId string) error {
 		e.Fork().AddAction(events.NewAction(ActionLockFinish).AddPayload(PayloadVersionMissCount, versionMissCount)).Publish(ctx)
 	}()
 
+	// 时间源与本地时钟的漂移超过了阈值的话按照配置拒绝获取锁
+	if err := x.checkClockSkew(ctx, e); err != nil {
+		e.Fork().AddAction(events.NewAction(ActionLockError).SetErr(err)).Publish(ctx)
+		return err
+	}
+
+	// 存储支持推送的话先订阅锁记录的变化，锁被释放的时候可以立刻醒来重试，而不用等到下一次轮询
+	watchCtx, cancelWatch := context.WithCancel(ctx)
+	defer cancelWatch()
+	notify := x.watch(watchCtx, e, lockId)
+
 	// 然后开始循环获取锁
 	for {
 
@@ -67,10 +80,10 @@ func (x *StorageLock) Lock(ctx context.Context, ownerId string) error {
 			return err
 		}
 
-		// 然后休眠一下再开始重新抢占锁
+		// 然后休眠一下再开始重新抢占锁，订阅了锁记录的变化的话锁被释放时会提前醒来
 		sleepDuration := x.options.VersionMissRetryInterval + x.retryIntervalRandomBase()
 		e.Fork().AddAction(events.NewAction(ActionSleep).AddPayload(PayloadSleep, sleepDuration)).Publish(ctx)
-		time.Sleep(sleepDuration)
+		notify = x.waitRetry(ctx, e, notify, sleepDuration)
 
 		// 然后开始重试
 		select {
@@ -92,8 +105,18 @@ func (x *StorageLock) tryLock(ctx context.Context, e *events.Event, lockId, owne
 	// 触发开始获取锁的事件
 	e.SetLockId(lockId).SetOwnerId(ownerId).AddAction(events.NewAction(ActionTryLockBegin)).Publish(ctx)
 
+	// 会话模式下自己的会话已经失效的话就没必要再尝试了
+	if err := x.checkSessionAlive(); err != nil {
+		e.Fork().AddAction(events.NewAction(ActionLockSessionExpired).SetErr(err)).Publish(ctx)
+		return err
+	}
+
 	// 先尝试从Storage中读取上次存储的锁的信息
 	lockInformation, err := x.getLockInformation(ctx, e, lockId)
+	// 锁记录被篡改过，按照配置的策略认为锁被占用着或者可以被抢占
+	if errors.Is(err, ErrLockRecordTampered) {
+		return x.lockTampered(ctx, e.Fork(), lockId, ownerId, lockInformation, err)
+	}
 	// 如果读取锁的时候发生错误，除非是锁不存在的错误，否则都认为是中断执行
 	if err != nil && !errors.Is(err, ErrLockNotFound) {
 		e.Fork().AddAction(events.NewAction(ActionGetLockInformationError).SetErr(err)).Publish(ctx)
@@ -114,6 +137,8 @@ func (x *StorageLock) lockExists(ctx context.Context, e *events.Event, lockId, o
 
 	e.SetLockId(lockId).SetOwnerId(ownerId).AddActionByName(ActionLockExists).Publish(ctx)
 
+	// 抢占成功的话新租约从 storageTime 开始，它对应的本地时间不会早于读取时间之前的这个时刻
+	leaseStart := x.clock().Now()
 	storageTime, err := x.getTime(ctx, e.Fork())
 	if err != nil {
 		e.Fork().AddAction(events.NewAction(storage_events.ActionStorageGetTimeError).SetErr(err)).Publish(ctx)
@@ -121,15 +146,26 @@ func (x *StorageLock) lockExists(ctx context.Context, e *events.Event, lockId, o
 	}
 
 	// 看下锁是否已经过期了，如果已经过期了的话，则直接开始尝试抢占锁
-	if storageTime.After(lockInformation.LeaseExpireTime) {
-		return x.lockExpired(ctx, e.Fork(), lockId, ownerId, storageTime, lockInformation)
+	// 会话模式下写入的锁记录不看自己的租约，而是看引用的会话是否存活，会话失效则锁随之失效
+	if _, sessionId, ok := parseSessionOwnerId(lockInformation.OwnerId); ok && lockInformation.LockCount > 0 {
+		alive, err := x.isSessionAlive(ctx, e.Fork(), sessionId, storageTime)
+		if err != nil {
+			e.Fork().AddAction(events.NewAction(ActionGetLockInformationError).SetErr(err).AddPayload(PayloadSessionId, sessionId)).Publish(ctx)
+			return err
+		}
+		if !alive {
+			e.Fork().AddAction(events.NewAction(ActionLockSessionExpired).AddPayload(PayloadSessionId, sessionId)).Publish(ctx)
+			return x.lockExpired(ctx, e.Fork(), lockId, ownerId, leaseStart, storageTime, lockInformation)
+		}
+	} else if storageTime.After(lockInformation.LeaseExpireTime) {
+		return x.lockExpired(ctx, e.Fork(), lockId, ownerId, leaseStart, storageTime, lockInformation)
 	}
 
 	// 墓碑标记：LockCount==0 表示上一个持有者已释放，但底层存储不支持原子条件删除
 	// （如对象存储只有条件 PUT 没有条件 DELETE），释放时仅写入了墓碑而非真删记录。
 	// 此时锁逻辑上已不存在，等价于"可被抢占的失效记录"，走与过期相同的抢占路径。
 	if lockInformation.LockCount == 0 {
-		return x.lockExpired(ctx, e.Fork(), lockId, ownerId, storageTime, lockInformation)
+		return x.lockExpired(ctx, e.Fork(), lockId, ownerId, leaseStart, storageTime, lockInformation)
 	}
 
 	// 锁没过期的话，又分为两种情况，一种是锁就是自己持有的，一种是锁被别人持有
@@ -142,8 +178,8 @@ func (x *StorageLock) lockExists(ctx context.Context, e *events.Event, lockId, o
 	}
 }
 
-// 尝试抢占已经过期的锁
-func (x *StorageLock) lockExpired(ctx context.Context, e *events.Event, lockId, ownerId string, storageTime time.Time, information *storage.LockInformation) error {
+// 尝试抢占已经过期的锁，leaseStart 是读取 storageTime 之前的本地时间
+func (x *StorageLock) lockExpired(ctx context.Context, e *events.Event, lockId, ownerId string, leaseStart, storageTime time.Time, information *storage.LockInformation) error {
 
 	// 过期的锁认为是失效了，除了lockId其它都跟之前不一样了
 	newLockInformation := &storage.LockInformation{
@@ -175,7 +211,7 @@ func (x *StorageLock) lockExpired(ctx context.Context, e *events.Event, lockId,
 	// 抢占过期锁相当于新持有，需要启动新的看门狗来续租
 	// 之前可能有残留的看门狗协程（理论上不应该有，但防御性清理一下）
 	x.stopWatchDog(ctx, e.Fork(), newLockInformation)
-	return x.startWatchDog(ctx, e.Fork(), lockId, ownerId, newLockInformation)
+	return x.startWatchDog(ctx, e.Fork(), lockId, ownerId, newLockInformation, leaseStart)
 }
 
 // 进入重入锁的逻辑，尝试对可重入锁的层级加一
@@ -222,7 +258,8 @@ func (x *StorageLock) lockNotExists(ctx context.Context, e *events.Event, lockId
 	// 触发事件先
 	e.SetLockId(lockId).SetOwnerId(ownerId).SetLockInformation(lockInformation).AddActionByName(ActionLockNotExists).Publish(ctx)
 
-	// 获取Storage的时间（或外部注入的时间源）
+	// 获取Storage的时间（或外部注入的时间源），租约从这个时间开始，读取之前先记下本地时间给看门狗用
+	leaseStart := x.clock().Now()
 	storageTime, err := x.getTime(ctx, e.Fork())
 	if err != nil {
 		// 完蛋，出师未捷身先死，获取时间就没获取到
@@ -266,14 +303,22 @@ func (x *StorageLock) lockNotExists(ctx context.Context, e *events.Event, lockId
 	x.stopWatchDog(ctx, e.Fork(), lockInformation)
 
 	// 为自己创建并启动一只新的看门狗
-	return x.startWatchDog(ctx, e.Fork(), lockId, ownerId, lockInformation)
+	return x.startWatchDog(ctx, e.Fork(), lockId, ownerId, lockInformation, leaseStart)
 }
 
 // startWatchDog 创建并启动一只新的看门狗协程，用于在锁持有期间自动续租
+// leaseStart 是当前租约开始时对应的本地时间（取写入之前读取存储时间前的时刻），不知道的话传零值
 // 如果看门狗创建或启动失败，会尝试回滚（释放）刚获取的锁
-func (x *StorageLock) startWatchDog(ctx context.Context, e *events.Event, lockId, ownerId string, lockInformation *storage.LockInformation) error {
+func (x *StorageLock) startWatchDog(ctx context.Context, e *events.Event, lockId, ownerId string, lockInformation *storage.LockInformation, leaseStart time.Time) error {
+
+	// 会话模式下锁的有效性由会话的心跳统一维护，不需要为每把锁单独续租
+	if x.options.Session != nil {
+		e.Fork().AddAction(events.NewAction(ActionWatchDogSkipBySession).AddPayload(PayloadSessionId, x.options.Session.GetID())).Publish(ctx)
+		return nil
+	}
 
 	// 为自己创建一只新的看门狗
+	x.setLeaseStartTime(leaseStart)
 	watchDog, err := x.options.WatchDogFactory.NewWatchDog(ctx, e.Fork(), x, ownerId)
 	if err != nil {
 		// 看门狗创建失败，尝试释放掉锁
@@ -1,6 +1,8 @@
 package storage_lock
 
 import (
+	"bytes"
+	"fmt"
 	go_storage "github.com/storage-lock/go-storage"
 	"github.com/storage-lock/go-events"
 	"time"
@@ -31,13 +33,48 @@ func checkStorageLockOptions(options *StorageLockOptions) error {
 		return ErrLockIdEmpty
 	}
 
+	// 租约相关的参数
+	if err := checkLeaseOptions(options.LeaseExpireAfter, options.LeaseRefreshInterval, timeProviderUncertainty(options.TimeProvider), options.SkipLeaseMarginCheck); err != nil {
+		return err
+	}
+
+	// 按名字选择看门狗factory，名字通常来自配置文件
+	if options.WatchDogFactoryName != "" {
+		if options.WatchDogFactory == nil {
+			factory, err := GetWatchDogFactory(options.WatchDogFactoryName)
+			if err != nil {
+				return err
+			}
+			options.WatchDogFactory = factory
+		} else if options.WatchDogFactory.Name() != options.WatchDogFactoryName {
+			return fmt.Errorf("%w: WatchDogFactoryName is %s, but WatchDogFactory is %s", ErrWatchDogFactoryNameMismatch, options.WatchDogFactoryName, options.WatchDogFactory.Name())
+		}
+	}
+
+	// 锁用自己的密钥校验会话记录，两边的密钥不一致的话会话记录会被当成被篡改的
+	if options.Session != nil && !bytes.Equal(options.SigningKey, options.Session.options.SigningKey) {
+		return ErrSessionSigningKeyMismatch
+	}
+
+	// 如果没有设置看门狗factory的话，则为其设置上默认的
+	if options.WatchDogFactory == nil {
+		options.WatchDogFactory = NewWatchDogFactoryCommonsImpl()
+	}
+
+	return nil
+}
+
+// 检查租约有效期与续租间隔是否配置正确，锁和会话（Session）共用这套规则
+// timeUncertainty 是时间源已知的最大误差，两个实例的误差方向可能相反，所以它的两倍要额外计入安全余量
+func checkLeaseOptions(leaseExpireAfter, leaseRefreshInterval, timeUncertainty time.Duration, skipLeaseMarginCheck bool) error {
+
 	// 每次刷新租约的时候把有效期往后推动的时间不能小于3秒
-	if options.LeaseExpireAfter < time.Second*3 {
+	if leaseExpireAfter < time.Second*3 {
 		return ErrLeaseExpireAfter
 	}
 
 	// 刷新间隔必须小于租约有效时间，不然租约都过期了再刷新还有个毛用啊
-	if options.LeaseRefreshInterval >= options.LeaseExpireAfter {
+	if leaseRefreshInterval >= leaseExpireAfter {
 		return ErrLeaseRefreshInterval
 	}
 
@@ -47,20 +84,16 @@ func checkStorageLockOptions(options *StorageLockOptions) error {
 	// 就会让租约在下次刷新完成前过期，被他人合法抢占（lockExpired 路径），破坏互斥性。
 	// 强制余量至少为 max(1s, LeaseExpireAfter/3)，保证续租有足够重试窗口。
 	// 可通过 SkipLeaseMarginCheck 跳过（自担风险）。
-	margin := options.LeaseExpireAfter - options.LeaseRefreshInterval
+	margin := leaseExpireAfter - leaseRefreshInterval
 	minMargin := time.Second
-	if third := options.LeaseExpireAfter / 3; third > minMargin {
+	if third := leaseExpireAfter / 3; third > minMargin {
 		minMargin = third
 	}
-	if !options.SkipLeaseMarginCheck && margin < minMargin {
+	minMargin += 2 * timeUncertainty
+	if !skipLeaseMarginCheck && margin < minMargin {
 		return ErrLeaseRefreshIntervalTooClose
 	}
 
-	// 如果没有设置看门狗factory的话，则为其设置上默认的
-	if options.WatchDogFactory == nil {
-		options.WatchDogFactory = NewWatchDogFactoryCommonsImpl()
-	}
-
 	return nil
 }
 
@@ -89,9 +122,29 @@ type StorageLockOptions struct {
 	// 用于创建看门狗
 	WatchDogFactory WatchDogFactory
 
+	// 按名字从全局注册表中选择看门狗工厂，适合从配置文件加载选项的场景
+	// 当 WatchDogFactory 未设置时根据这个名字查找，名字未注册的话创建锁会失败；
+	// 两者都设置时名字必须与 WatchDogFactory.Name() 一致
+	// @see:
+	//     RegisterWatchDogFactory
+	//     ErrWatchDogFactoryNotFound
+	WatchDogFactoryName string
+
 	// 版本未命中时的重试间隔
 	VersionMissRetryInterval time.Duration
 
+	// 每一种存储操作单独的超时时间，在调用方传入的 ctx 的基础上生效，为 0 表示不设置超时，只受调用方的 ctx 控制。
+	// 锁的获取、释放、回滚、围栏令牌以及看门狗续租对存储的调用都会应用这些超时，超时之后返回 ErrStorageOperationTimeout。
+	// GetTimeTimeout 同样作用于外部注入的 TimeProvider
+	// @see:
+	//     SetStorageOperationTimeout
+	//     ActionStorageGetTimeout
+	GetTimeout               time.Duration
+	GetTimeTimeout           time.Duration
+	CreateWithVersionTimeout time.Duration
+	UpdateWithVersionTimeout time.Duration
+	DeleteWithVersionTimeout time.Duration
+
 	// 跳过存储能力检查，默认为 false
 	// 当设置为 true 时，即使存储实现不支持 CAS 或可靠时间源，也允许创建锁
 	// ⚠️ 警告：跳过能力检查可能导致锁的互斥性被破坏，仅建议在以下场景使用：
@@ -101,6 +154,14 @@ type StorageLockOptions struct {
 	// 生产环境请确保存储实现满足所有必要条件
 	SkipCapabilityCheck bool
 
+	// CapabilitySelfTest 创建锁的时候在一个临时的锁ID上实际验证存储的行为是否与声明的能力相符，默认为 false。
+	// 自检会对存储做若干次读写，并且可能要等待最多一秒来确认时间在往前走，建议只在接入新的存储实现或者服务启动的时候开启。
+	// 与 SkipCapabilityCheck 同时设置时不做自检
+	// @see:
+	//     SelfTestStorage
+	//     ErrStorageSelfTestFailed
+	CapabilitySelfTest bool
+
 	// SkipLeaseMarginCheck 跳过"续租刷新间隔与租约过期时间的安全余量"检查，默认为 false。
 	// 漏洞 I：余量过小时一次续租抖动会让租约在下次刷新前过期、被他人抢占，破坏互斥性。
 	// 默认强制余量 >= max(1s, LeaseExpireAfter/3)。仅在确信你的环境续租延迟极小且稳定、
@@ -111,8 +172,49 @@ type StorageLockOptions struct {
 	// 例如对象存储（S3/OSS）、纯 HTTP 存储没有服务端时钟，无法自身满足 CapabilityReliableTime，
 	// 此时通过注入外部时间源（如 go-ntp-time-provider 提供的 NTP 时间源）来满足必要条件。
 	// 如果 Storage 自身已声明 CapabilityReliableTime，此字段可留空（优先使用 Storage 的时间）。
-	// ⚠️ 注入的时间源必须单调递增、不能出现时钟回拨，否则会破坏锁的互斥性
+	// ⚠️ 注入的时间源必须单调递增、不能出现时钟回拨，否则会破坏锁的互斥性，可以用 MonotonicTimeProvider 包装一层来保证
 	TimeProvider go_storage.TimeProvider
+
+	// OnLeaseContinuityViolation 租约出现断档时的回调，可选
+	// 进程停顿（GC、SIGSTOP等）超过租约时看门狗醒来会发现租约已经过期过，即使之后续租成功，
+	// 断档期间锁也可能被别人合法持有过，临界区可以借助这个回调中止或者重新校验
+	// @see:
+	//     LeaseContinuityViolation
+	//     ActionWatchDogLeaseContinuityViolation
+	OnLeaseContinuityViolation LeaseContinuityViolationHandler
+
+	// Session 会话，可选，设置之后锁工作在会话模式下：
+	// 锁记录引用会话的ID而不是依赖自己的租约，会话存活锁就有效，会话失效则会话下所有的锁同时失效，
+	// 锁不再单独启动看门狗，由会话的心跳统一续租。会话必须与锁使用同一个 Storage
+	// @see:
+	//     NewSession
+	Session *Session
+
+	// SigningKey 锁记录签名用的共享密钥，可选，设置之后每次写入锁记录都会用它对锁信息做 HMAC-SHA256 签名，
+	// 读取时校验签名，防止锁记录被其它系统或者人工改动之后悄无声息的破坏互斥性。
+	// 共享同一把锁的所有实例必须使用相同的密钥；会话模式下会话记录也要签名，会话必须配置相同的 SessionOptions.SigningKey
+	// @see:
+	//     ErrLockRecordTampered
+	//     ActionLockRecordTampered
+	SigningKey []byte
+
+	// TamperedRecordPolicy 获取锁时遇到签名校验不通过的锁记录如何处理，默认认为锁被占用着
+	TamperedRecordPolicy TamperedRecordPolicy
+
+	// ClockSkewThreshold 时间源与本地时钟在一个租约周期内的漂移超过多少算异常，
+	// 为 0 时使用续租安全余量（LeaseExpireAfter - LeaseRefreshInterval）的一半，小于 0 表示不检测
+	// @see:
+	//     ActionClockSkewExceeded
+	ClockSkewThreshold time.Duration
+
+	// ClockSkewPolicy 漂移超过阈值的时候除了发布事件之外还要做什么，默认只发布事件
+	ClockSkewPolicy ClockSkewPolicy
+
+	// Clock 获取锁时的重试等待、看门狗的续租间隔和租约连续性检查使用的本地时钟，未设置的话使用真实的时钟，
+	// 主要用于在测试中注入可以手动拨动的时钟
+	// @see:
+	//     fake_clock.FakeClock
+	Clock Clock
 }
 
 // NewStorageLockOptions 使用默认值创建锁的配置项
@@ -159,16 +261,63 @@ func (x *StorageLockOptions) SetWatchDogFactory(watchDogFactory WatchDogFactory)
 	return x
 }
 
+// SetWatchDogFactoryName 按名字从全局注册表中选择看门狗工厂
+func (x *StorageLockOptions) SetWatchDogFactoryName(watchDogFactoryName string) *StorageLockOptions {
+	x.WatchDogFactoryName = watchDogFactoryName
+	return x
+}
+
 func (x *StorageLockOptions) SetVersionMissRetryInterval(versionMissRetryInterval time.Duration) *StorageLockOptions {
 	x.VersionMissRetryInterval = versionMissRetryInterval
 	return x
 }
 
+func (x *StorageLockOptions) SetGetTimeout(getTimeout time.Duration) *StorageLockOptions {
+	x.GetTimeout = getTimeout
+	return x
+}
+
+func (x *StorageLockOptions) SetGetTimeTimeout(getTimeTimeout time.Duration) *StorageLockOptions {
+	x.GetTimeTimeout = getTimeTimeout
+	return x
+}
+
+func (x *StorageLockOptions) SetCreateWithVersionTimeout(createWithVersionTimeout time.Duration) *StorageLockOptions {
+	x.CreateWithVersionTimeout = createWithVersionTimeout
+	return x
+}
+
+func (x *StorageLockOptions) SetUpdateWithVersionTimeout(updateWithVersionTimeout time.Duration) *StorageLockOptions {
+	x.UpdateWithVersionTimeout = updateWithVersionTimeout
+	return x
+}
+
+func (x *StorageLockOptions) SetDeleteWithVersionTimeout(deleteWithVersionTimeout time.Duration) *StorageLockOptions {
+	x.DeleteWithVersionTimeout = deleteWithVersionTimeout
+	return x
+}
+
+// SetStorageOperationTimeout 为所有的存储操作设置相同的超时时间
+func (x *StorageLockOptions) SetStorageOperationTimeout(timeout time.Duration) *StorageLockOptions {
+	x.GetTimeout = timeout
+	x.GetTimeTimeout = timeout
+	x.CreateWithVersionTimeout = timeout
+	x.UpdateWithVersionTimeout = timeout
+	x.DeleteWithVersionTimeout = timeout
+	return x
+}
+
 func (x *StorageLockOptions) SetSkipCapabilityCheck(skip bool) *StorageLockOptions {
 	x.SkipCapabilityCheck = skip
 	return x
 }
 
+// SetCapabilitySelfTest 设置创建锁的时候是否对存储做能力自检
+func (x *StorageLockOptions) SetCapabilitySelfTest(capabilitySelfTest bool) *StorageLockOptions {
+	x.CapabilitySelfTest = capabilitySelfTest
+	return x
+}
+
 // SetSkipLeaseMarginCheck 设置是否跳过续租间隔与租约过期的安全余量检查（漏洞 I）
 func (x *StorageLockOptions) SetSkipLeaseMarginCheck(skip bool) *StorageLockOptions {
 	x.SkipLeaseMarginCheck = skip
@@ -181,3 +330,45 @@ func (x *StorageLockOptions) SetTimeProvider(timeProvider go_storage.TimeProvide
 	x.TimeProvider = timeProvider
 	return x
 }
+
+// SetOnLeaseContinuityViolation 设置租约出现断档时的回调
+func (x *StorageLockOptions) SetOnLeaseContinuityViolation(handler LeaseContinuityViolationHandler) *StorageLockOptions {
+	x.OnLeaseContinuityViolation = handler
+	return x
+}
+
+// SetSession 设置锁所属的会话，锁将工作在会话模式下
+func (x *StorageLockOptions) SetSession(session *Session) *StorageLockOptions {
+	x.Session = session
+	return x
+}
+
+// SetSigningKey 设置锁记录签名用的共享密钥
+func (x *StorageLockOptions) SetSigningKey(signingKey []byte) *StorageLockOptions {
+	x.SigningKey = signingKey
+	return x
+}
+
+// SetTamperedRecordPolicy 设置遇到被篡改的锁记录时的处理策略
+func (x *StorageLockOptions) SetTamperedRecordPolicy(policy TamperedRecordPolicy) *StorageLockOptions {
+	x.TamperedRecordPolicy = policy
+	return x
+}
+
+// SetClockSkewThreshold 设置时间源与本地时钟的漂移阈值
+func (x *StorageLockOptions) SetClockSkewThreshold(threshold time.Duration) *StorageLockOptions {
+	x.ClockSkewThreshold = threshold
+	return x
+}
+
+// SetClockSkewPolicy 设置漂移超过阈值时的处理策略
+func (x *StorageLockOptions) SetClockSkewPolicy(policy ClockSkewPolicy) *StorageLockOptions {
+	x.ClockSkewPolicy = policy
+	return x
+}
+
+// SetClock 设置锁使用的本地时钟
+func (x *StorageLockOptions) SetClock(clock Clock) *StorageLockOptions {
+	x.Clock = clock
+	return x
+}
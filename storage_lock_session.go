@@ -0,0 +1,72 @@
+package storage_lock
+
+import (
+	"context"
+	"errors"
+	"github.com/storage-lock/go-events"
+	"strings"
+	"time"
+)
+
+// StorageLock中与会话（Session）模式相关的逻辑拆分到这个文件中
+//
+// 会话模式下锁记录中的 OwnerId 会带上会话ID："<ownerId>@<sessionId>"，
+// 这样任何读到这条锁记录的人都能找到它引用的会话，通过会话记录来判断锁是否还有效，
+// 锁记录自己的 LeaseExpireTime 只作为参考，不再参与有效性判断。
+
+// storageOwnerId 返回写入到锁记录中的 OwnerId，非会话模式下就是 ownerId 本身
+func (x *StorageLock) storageOwnerId(ownerId string) string {
+	if x.options.Session == nil {
+		return ownerId
+	}
+	// 已经是挂在自己的会话上的 OwnerId 了（比如通过 Session.OwnerId 得到的），不再重复拼接
+	if _, sessionId, ok := parseSessionOwnerId(ownerId); ok && sessionId == x.options.Session.GetID() {
+		return ownerId
+	}
+	return x.options.Session.OwnerId(ownerId)
+}
+
+// parseSessionOwnerId 从锁记录的 OwnerId 中解析出引用的会话ID，如果不是会话模式下写入的锁记录则返回 false
+func parseSessionOwnerId(storageOwnerId string) (ownerId string, sessionId string, ok bool) {
+	index := strings.LastIndex(storageOwnerId, SessionOwnerIdSeparator)
+	if index < 0 {
+		return storageOwnerId, "", false
+	}
+	sessionId = storageOwnerId[index+len(SessionOwnerIdSeparator):]
+	if !isSessionId(sessionId) {
+		return storageOwnerId, "", false
+	}
+	return storageOwnerId[:index], sessionId, true
+}
+
+// checkSessionAlive 会话模式下获取锁之前检查自己的会话是否还存活，
+// 在已经失效的会话下写入的锁记录任何人都会认为是无效的，获取到了也没有意义
+func (x *StorageLock) checkSessionAlive() error {
+	if x.options.Session == nil || x.options.Session.IsAlive() {
+		return nil
+	}
+	if err := x.options.Session.Err(); err != nil {
+		return err
+	}
+	return ErrSessionExpired
+}
+
+// isSessionAlive 通过会话记录判断给定的会话在 storageTime 时刻是否存活
+// 会话记录不存在、已经被关闭（墓碑）或者租约已经过期都认为会话失效，
+// 签名校验不通过的会话记录与被篡改的锁记录一样按 TamperedRecordPolicy 处理
+func (x *StorageLock) isSessionAlive(ctx context.Context, e *events.Event, sessionId string, storageTime time.Time) (bool, error) {
+	sessionInformation, err := x.getLockInformation(ctx, e, sessionId)
+	if err != nil {
+		if errors.Is(err, ErrLockNotFound) {
+			return false, nil
+		}
+		if errors.Is(err, ErrLockRecordTampered) {
+			return x.options.TamperedRecordPolicy != TamperedRecordPolicyStealable, nil
+		}
+		return false, err
+	}
+	if sessionInformation.LockCount == 0 {
+		return false, nil
+	}
+	return !storageTime.After(sessionInformation.LeaseExpireTime), nil
+}
@@ -0,0 +1,19 @@
+package storage_lock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSessionOwnerId(t *testing.T) {
+	ownerId, sessionId, ok := parseSessionOwnerId("owner@" + SessionIDPrefix + "abc")
+	assert.True(t, ok)
+	assert.Equal(t, "owner", ownerId)
+	assert.Equal(t, SessionIDPrefix+"abc", sessionId)
+
+	_, _, ok = parseSessionOwnerId("owner@example.com")
+	assert.False(t, ok)
+	_, _, ok = parseSessionOwnerId("owner")
+	assert.False(t, ok)
+}
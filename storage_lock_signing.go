@@ -0,0 +1,182 @@
+package storage_lock
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/golang-infrastructure/go-iterator"
+	"github.com/storage-lock/go-events"
+	go_storage "github.com/storage-lock/go-storage"
+	storage_events "github.com/storage-lock/go-storage-events"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StorageLock中与锁记录签名相关的逻辑拆分到这个文件中
+//
+// 锁记录放在共享的数据库里，其它系统或者人工都有可能改动它，手动改一下 OwnerId 或者 LeaseExpireTime
+// 就能悄无声息的破坏锁的互斥性。配置了 SigningKey 之后，每次写入锁记录时用共享密钥对锁信息做 HMAC-SHA256 签名，
+// 读取锁记录时校验签名，校验不通过的记录被认为是被篡改过的。
+//
+// LockInformation 的结构是固定的，签名附在 OwnerId 的后面："<ownerId>#sig:<hex>"，
+// 读取并校验通过之后会去掉，对锁的其它逻辑是透明的。签名覆盖了锁记录的所有字段，
+// 共享同一把锁的所有实例必须配置相同的密钥，否则会互相认为对方的记录被篡改了。
+// 会话（Session）记录用 SessionOptions.SigningKey 签名，锁读取会话记录时用自己的密钥校验，所以两边的密钥必须相同。
+
+// SignatureOwnerIdSeparator 签名附在锁记录的 OwnerId 后面，格式为 "<ownerId>#sig:<签名>"
+const SignatureOwnerIdSeparator = "#sig:"
+
+// TamperedRecordPolicy 获取锁的时候遇到被篡改的锁记录如何处理
+type TamperedRecordPolicy int
+
+const (
+
+	// TamperedRecordPolicyBusy 认为锁被别人持有着，一直等待到记录被修正或者 ctx 超时，这是默认的策略，
+	// 宁可获取不到锁也不冒破坏互斥性的风险
+	TamperedRecordPolicyBusy TamperedRecordPolicy = iota
+
+	// TamperedRecordPolicyStealable 认为锁记录已经失效，与过期的锁一样直接抢占，
+	// 抢占仍然是基于版本号的 CAS，多个竞争者之间的互斥性不受影响
+	TamperedRecordPolicyStealable
+)
+
+func (x TamperedRecordPolicy) String() string {
+	switch x {
+	case TamperedRecordPolicyBusy:
+		return "busy"
+	case TamperedRecordPolicyStealable:
+		return "stealable"
+	default:
+		return "unknown"
+	}
+}
+
+// 计算锁信息的签名，lockInformation.OwnerId 中不能带有签名
+func signLockInformation(key []byte, lockInformation *go_storage.LockInformation) string {
+	mac := hmac.New(sha256.New, key)
+	fields := []string{
+		lockInformation.LockId,
+		lockInformation.OwnerId,
+		strconv.FormatUint(uint64(lockInformation.Version), 10),
+		strconv.Itoa(lockInformation.LockCount),
+		strconv.FormatInt(lockInformation.LockBeginTime.UnixNano(), 10),
+		strconv.FormatInt(lockInformation.LeaseExpireTime.UnixNano(), 10),
+	}
+	// 字段之间用长度前缀分隔，防止通过挪动字段之间的边界构造出相同的签名
+	for _, field := range fields {
+		mac.Write([]byte(strconv.Itoa(len(field)) + ":" + field))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 复制一份锁信息并把签名附在 OwnerId 后面
+func attachSignature(key []byte, lockInformation *go_storage.LockInformation) *go_storage.LockInformation {
+	if lockInformation == nil {
+		return nil
+	}
+	signed := *lockInformation
+	signed.OwnerId = lockInformation.OwnerId + SignatureOwnerIdSeparator + signLockInformation(key, lockInformation)
+	return &signed
+}
+
+// 校验锁信息的签名，通过的话把签名从 OwnerId 中去掉
+func verifySignature(key []byte, lockInformation *go_storage.LockInformation) error {
+	index := strings.LastIndex(lockInformation.OwnerId, SignatureOwnerIdSeparator)
+	if index < 0 {
+		return fmt.Errorf("%w: signature missing", ErrLockRecordTampered)
+	}
+	signature := lockInformation.OwnerId[index+len(SignatureOwnerIdSeparator):]
+	lockInformation.OwnerId = lockInformation.OwnerId[:index]
+	if !hmac.Equal([]byte(signature), []byte(signLockInformation(key, lockInformation))) {
+		return fmt.Errorf("%w: signature mismatch", ErrLockRecordTampered)
+	}
+	return nil
+}
+
+// 去掉 OwnerId 上附带的签名，不做校验
+func trimSignature(storageOwnerId string) string {
+	if index := strings.LastIndex(storageOwnerId, SignatureOwnerIdSeparator); index >= 0 {
+		return storageOwnerId[:index]
+	}
+	return storageOwnerId
+}
+
+// 获取锁的时候遇到了被篡改的锁记录，按照配置的策略处理
+func (x *StorageLock) lockTampered(ctx context.Context, e *events.Event, lockId, ownerId string, lockInformation *go_storage.LockInformation, err error) error {
+
+	if x.options.TamperedRecordPolicy != TamperedRecordPolicyStealable {
+		e.Fork().AddAction(events.NewAction(ActionLockBusy).SetErr(err)).Publish(ctx)
+		return ErrLockBusy
+	}
+
+	leaseStart := x.clock().Now()
+	storageTime, err := x.getTime(ctx, e.Fork())
+	if err != nil {
+		e.Fork().AddAction(events.NewAction(storage_events.ActionStorageGetTimeError).SetErr(err)).Publish(ctx)
+		return err
+	}
+	return x.lockExpired(ctx, e.Fork(), lockId, ownerId, leaseStart, storageTime, lockInformation)
+}
+
+// ------------------------------------------------- --------------------------------------------------------------------
+
+// signingStorage 在写入锁记录之前签名，锁的所有写入都通过它进行，读取出来的记录由 getLockInformation 负责校验
+type signingStorage struct {
+	storage go_storage.Storage
+	key     []byte
+}
+
+var _ go_storage.Storage = &signingStorage{}
+
+func newSigningStorage(storage go_storage.Storage, key []byte) *signingStorage {
+	return &signingStorage{
+		storage: storage,
+		key:     key,
+	}
+}
+
+func (x *signingStorage) GetName() string {
+	return x.storage.GetName()
+}
+
+func (x *signingStorage) Capabilities() []go_storage.StorageCapability {
+	if declarer, ok := x.storage.(go_storage.CapabilityDeclarer); ok {
+		return declarer.Capabilities()
+	}
+	return nil
+}
+
+func (x *signingStorage) Init(ctx context.Context) error {
+	return x.storage.Init(ctx)
+}
+
+func (x *signingStorage) UpdateWithVersion(ctx context.Context, lockId string, exceptedVersion, newVersion go_storage.Version, lockInformation *go_storage.LockInformation) error {
+	return x.storage.UpdateWithVersion(ctx, lockId, exceptedVersion, newVersion, attachSignature(x.key, lockInformation))
+}
+
+func (x *signingStorage) CreateWithVersion(ctx context.Context, lockId string, version go_storage.Version, lockInformation *go_storage.LockInformation) error {
+	return x.storage.CreateWithVersion(ctx, lockId, version, attachSignature(x.key, lockInformation))
+}
+
+func (x *signingStorage) DeleteWithVersion(ctx context.Context, lockId string, exceptedVersion go_storage.Version, lockInformation *go_storage.LockInformation) error {
+	return x.storage.DeleteWithVersion(ctx, lockId, exceptedVersion, attachSignature(x.key, lockInformation))
+}
+
+func (x *signingStorage) Get(ctx context.Context, lockId string) (string, error) {
+	return x.storage.Get(ctx, lockId)
+}
+
+func (x *signingStorage) GetTime(ctx context.Context) (time.Time, error) {
+	return x.storage.GetTime(ctx)
+}
+
+func (x *signingStorage) Close(ctx context.Context) error {
+	return x.storage.Close(ctx)
+}
+
+func (x *signingStorage) List(ctx context.Context) (iterator.Iterator[*go_storage.LockInformation], error) {
+	return x.storage.List(ctx)
+}
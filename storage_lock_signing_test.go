@@ -0,0 +1,179 @@
+package storage_lock_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-events"
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSigningLockId = "test-signing-lock"
+
+func newTestSigningLock(t *testing.T, s storage.Storage, key string, policy storage_lock.TamperedRecordPolicy, listeners ...events.Listener) *storage_lock.StorageLock {
+	options := storage_lock.NewStorageLockOptionsWithLockId(testSigningLockId).
+		SetVersionMissRetryInterval(time.Millisecond * 10).
+		SetSigningKey([]byte(key)).
+		SetTamperedRecordPolicy(policy)
+	for _, listener := range listeners {
+		options.AddEventListeners(listener)
+	}
+	lock, err := storage_lock.NewStorageLockWithOptions(s, options)
+	assert.Nil(t, err)
+	return lock
+}
+
+// 绕过锁直接改存储中的锁记录，模拟人工把租约改成已经过期
+func tamperTestLockRecord(t *testing.T, s storage.Storage) {
+	information := getTestLockInformation(t, s, testSigningLockId)
+	information.LeaseExpireTime = time.Now().Add(-time.Minute)
+	assert.Nil(t, s.UpdateWithVersion(context.Background(), testSigningLockId, information.Version, information.Version, information))
+}
+
+func TestStorageLock_Signing(t *testing.T) {
+	ctx := context.Background()
+	s := memory_storage.NewMemoryStorage()
+	lock := newTestSigningLock(t, s, "test-key", storage_lock.TamperedRecordPolicyBusy)
+
+	// 存储中的锁记录带有签名，锁自己读取的时候是透明的
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	information := getTestLockInformation(t, s, testSigningLockId)
+	assert.True(t, strings.HasPrefix(information.OwnerId, "owner"+storage_lock.SignatureOwnerIdSeparator))
+	token, err := lock.GetFencingToken(ctx, "owner")
+	assert.Nil(t, err)
+	assert.Equal(t, information.Version, token)
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+
+	// 不支持原子删除的时候墓碑同样带有签名
+	s = memory_storage.NewMemoryStorageWithOptions(memory_storage.NewMemoryStorageOptions().SetDisableAtomicDelete(true))
+	lock = newTestSigningLock(t, s, "test-key", storage_lock.TamperedRecordPolicyBusy)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, lock.Lock(ctx, "owner"))
+		assert.Nil(t, lock.UnLock(ctx, "owner"))
+	}
+}
+
+// 默认策略下被篡改的锁记录被认为是被占用着，不会被抢占
+func TestStorageLock_SigningTamperedBusy(t *testing.T) {
+	ctx := context.Background()
+	s := memory_storage.NewMemoryStorage()
+	recorder := newTestActionRecorder()
+	holder := newTestSigningLock(t, s, "test-key", storage_lock.TamperedRecordPolicyBusy)
+	waiter := newTestSigningLock(t, s, "test-key", storage_lock.TamperedRecordPolicyBusy, recorder.listener())
+
+	assert.Nil(t, holder.Lock(ctx, "holder"))
+	tamperTestLockRecord(t, s)
+
+	timeoutCtx, cancelFunc := context.WithTimeout(ctx, time.Millisecond*100)
+	defer cancelFunc()
+	assert.ErrorIs(t, waiter.Lock(timeoutCtx, "waiter"), storage_lock.ErrLockBusy)
+	assert.Greater(t, recorder.count(storage_lock.ActionLockRecordTampered), 0)
+
+	// 持有者自己也无法再操作被篡改的记录
+	assert.ErrorIs(t, holder.UnLock(ctx, "holder"), storage_lock.ErrLockRecordTampered)
+	_, err := holder.GetFencingToken(ctx, "holder")
+	assert.ErrorIs(t, err, storage_lock.ErrLockRecordTampered)
+}
+
+// 配置为可抢占的时候被篡改的锁记录与过期的锁一样被直接抢占
+func TestStorageLock_SigningTamperedStealable(t *testing.T) {
+	ctx := context.Background()
+	s := memory_storage.NewMemoryStorage()
+	holder := newTestSigningLock(t, s, "test-key", storage_lock.TamperedRecordPolicyStealable)
+	waiter := newTestSigningLock(t, s, "test-key", storage_lock.TamperedRecordPolicyStealable)
+
+	assert.Nil(t, holder.Lock(ctx, "holder"))
+	tamperTestLockRecord(t, s)
+
+	timeoutCtx, cancelFunc := context.WithTimeout(ctx, time.Second*3)
+	defer cancelFunc()
+	assert.Nil(t, waiter.Lock(timeoutCtx, "waiter"))
+	assert.ErrorIs(t, holder.UnLock(ctx, "holder"), storage_lock.ErrLockNotBelongYou)
+	assert.Nil(t, waiter.UnLock(ctx, "waiter"))
+}
+
+// 密钥不同的实例之间互相认为对方的记录被篡改了
+func TestStorageLock_SigningKeyMismatch(t *testing.T) {
+	ctx := context.Background()
+	s := memory_storage.NewMemoryStorage()
+	holder := newTestSigningLock(t, s, "test-key", storage_lock.TamperedRecordPolicyBusy)
+	other := newTestSigningLock(t, s, "other-key", storage_lock.TamperedRecordPolicyBusy)
+
+	assert.Nil(t, holder.Lock(ctx, "holder"))
+	_, err := other.GetFencingToken(ctx, "holder")
+	assert.ErrorIs(t, err, storage_lock.ErrLockRecordTampered)
+	assert.Nil(t, holder.UnLock(ctx, "holder"))
+}
+
+func newTestSigningSessionLock(t *testing.T, s storage.Storage, key string, policy storage_lock.TamperedRecordPolicy, session *storage_lock.Session) *storage_lock.StorageLock {
+	options := storage_lock.NewStorageLockOptionsWithLockId(testSigningLockId).
+		SetLeaseExpireAfter(time.Second * 3).
+		SetLeaseRefreshInterval(time.Second).
+		SetVersionMissRetryInterval(time.Millisecond * 10).
+		SetSigningKey([]byte(key)).
+		SetTamperedRecordPolicy(policy).
+		SetSession(session)
+	lock, err := storage_lock.NewStorageLockWithOptions(s, options)
+	assert.Nil(t, err)
+	return lock
+}
+
+// 会话记录同样带有签名，被篡改的会话记录按锁的 TamperedRecordPolicy 处理
+func TestStorageLock_SigningSession(t *testing.T) {
+	ctx := context.Background()
+	for _, policy := range []storage_lock.TamperedRecordPolicy{storage_lock.TamperedRecordPolicyBusy, storage_lock.TamperedRecordPolicyStealable} {
+		s := memory_storage.NewMemoryStorage()
+		sessionOptions := storage_lock.NewSessionOptions().
+			SetLeaseExpireAfter(time.Second * 3).
+			SetLeaseRefreshInterval(time.Second).
+			SetSigningKey([]byte("test-key"))
+		session, err := storage_lock.NewSession(ctx, s, sessionOptions)
+		assert.Nil(t, err)
+		sessionInformation := getTestLockInformation(t, s, session.GetID())
+		assert.True(t, strings.HasPrefix(sessionInformation.OwnerId, session.GetID()+storage_lock.SignatureOwnerIdSeparator))
+
+		holder := newTestSigningSessionLock(t, s, "test-key", policy, session)
+		waiter := newTestSigningSessionLock(t, s, "test-key", policy, nil)
+		assert.Nil(t, holder.Lock(ctx, "holder"))
+
+		// 人工把会话的租约延长，企图让会话下的锁一直有效
+		sessionInformation = getTestLockInformation(t, s, session.GetID())
+		sessionInformation.LeaseExpireTime = time.Now().Add(time.Hour)
+		assert.Nil(t, s.UpdateWithVersion(ctx, session.GetID(), sessionInformation.Version, sessionInformation.Version, sessionInformation))
+
+		timeoutCtx, cancelFunc := context.WithTimeout(ctx, time.Millisecond*300)
+		err = waiter.Lock(timeoutCtx, "waiter")
+		cancelFunc()
+		if policy == storage_lock.TamperedRecordPolicyBusy {
+			assert.ErrorIs(t, err, storage_lock.ErrLockBusy)
+		} else {
+			assert.Nil(t, err)
+			assert.Nil(t, waiter.UnLock(ctx, "waiter"))
+		}
+		session.Close(ctx)
+	}
+}
+
+// 锁与会话的签名密钥必须一致
+func TestStorageLock_SigningSessionKeyMismatch(t *testing.T) {
+	ctx := context.Background()
+	s := memory_storage.NewMemoryStorage()
+	session, err := storage_lock.NewSession(ctx, s, storage_lock.NewSessionOptions().SetLeaseExpireAfter(time.Second*3).SetLeaseRefreshInterval(time.Second))
+	assert.Nil(t, err)
+	defer session.Close(ctx)
+
+	options := storage_lock.NewStorageLockOptionsWithLockId(testSigningLockId).
+		SetLeaseExpireAfter(time.Second * 3).
+		SetLeaseRefreshInterval(time.Second).
+		SetSigningKey([]byte("test-key")).
+		SetSession(session)
+	_, err = storage_lock.NewStorageLockWithOptions(s, options)
+	assert.ErrorIs(t, err, storage_lock.ErrSessionSigningKeyMismatch)
+}
@@ -0,0 +1,87 @@
+package storage_lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/storage-lock/go-events"
+	go_storage "github.com/storage-lock/go-storage"
+	storage_events "github.com/storage-lock/go-storage-events"
+	"time"
+)
+
+// StorageLock中与存储操作超时相关的逻辑拆分到这个文件中
+//
+// 锁的各个流程（获取、释放、回滚、围栏令牌、看门狗续租）都是把调用方的 ctx 直接传给存储的，
+// 调用方使用 context.Background() 的话，存储卡住的时候锁也会跟着一直卡住。
+// 在 StorageLockOptions 中可以为每一种存储操作单独设置超时时间，锁对存储的所有调用都经过 timeoutStorageExecutor，
+// 每次调用都在调用方的 ctx 上再派生一个带超时的 ctx，超时之后发布对应的超时事件并返回 ErrStorageOperationTimeout。
+//
+// 超时依赖于存储实现遵守 ctx 的取消，完全不理会 ctx 的存储仍然会卡住。
+// 写操作超时的时候并不知道存储到底有没有写入成功：比如获取锁时 CreateWithVersion 超时了但其实写入成功了，
+// Lock 返回错误之后这条锁记录没有看门狗续租，会在租约过期之后被别人抢占，不会永远占着锁。
+
+// timeoutStorageExecutor 在 WithEventSafeExecutor 的基础上为每次存储操作加上超时，方法与 WithEventSafeExecutor 一一对应
+type timeoutStorageExecutor struct {
+	executor *storage_events.WithEventSafeExecutor
+	options  *StorageLockOptions
+}
+
+func newTimeoutStorageExecutor(storage go_storage.Storage, options *StorageLockOptions) *timeoutStorageExecutor {
+	return &timeoutStorageExecutor{
+		executor: storage_events.NewWithEventSafeExecutor(storage),
+		options:  options,
+	}
+}
+
+func (x *timeoutStorageExecutor) Get(ctx context.Context, e *events.Event, lockId string) (string, error) {
+	timeoutCtx, cancelFunc := withStorageTimeout(ctx, x.options.GetTimeout)
+	defer cancelFunc()
+	lockInformationJsonString, err := x.executor.Get(timeoutCtx, e, lockId)
+	return lockInformationJsonString, checkStorageTimeout(ctx, timeoutCtx, e, ActionStorageGetTimeout, x.options.GetTimeout, err)
+}
+
+func (x *timeoutStorageExecutor) GetTime(ctx context.Context, e *events.Event) (time.Time, error) {
+	timeoutCtx, cancelFunc := withStorageTimeout(ctx, x.options.GetTimeTimeout)
+	defer cancelFunc()
+	storageTime, err := x.executor.GetTime(timeoutCtx, e)
+	return storageTime, checkStorageTimeout(ctx, timeoutCtx, e, ActionStorageGetTimeTimeout, x.options.GetTimeTimeout, err)
+}
+
+func (x *timeoutStorageExecutor) CreateWithVersion(ctx context.Context, e *events.Event, lockId string, version go_storage.Version, lockInformation *go_storage.LockInformation) error {
+	timeoutCtx, cancelFunc := withStorageTimeout(ctx, x.options.CreateWithVersionTimeout)
+	defer cancelFunc()
+	err := x.executor.CreateWithVersion(timeoutCtx, e, lockId, version, lockInformation)
+	return checkStorageTimeout(ctx, timeoutCtx, e, ActionStorageCreateWithVersionTimeout, x.options.CreateWithVersionTimeout, err)
+}
+
+func (x *timeoutStorageExecutor) UpdateWithVersion(ctx context.Context, e *events.Event, lockId string, exceptedVersion, newVersion go_storage.Version, lockInformation *go_storage.LockInformation) error {
+	timeoutCtx, cancelFunc := withStorageTimeout(ctx, x.options.UpdateWithVersionTimeout)
+	defer cancelFunc()
+	err := x.executor.UpdateWithVersion(timeoutCtx, e, lockId, exceptedVersion, newVersion, lockInformation)
+	return checkStorageTimeout(ctx, timeoutCtx, e, ActionStorageUpdateWithVersionTimeout, x.options.UpdateWithVersionTimeout, err)
+}
+
+func (x *timeoutStorageExecutor) DeleteWithVersion(ctx context.Context, e *events.Event, lockId string, exceptedVersion go_storage.Version, lockInformation *go_storage.LockInformation) error {
+	timeoutCtx, cancelFunc := withStorageTimeout(ctx, x.options.DeleteWithVersionTimeout)
+	defer cancelFunc()
+	err := x.executor.DeleteWithVersion(timeoutCtx, e, lockId, exceptedVersion, lockInformation)
+	return checkStorageTimeout(ctx, timeoutCtx, e, ActionStorageDeleteWithVersionTimeout, x.options.DeleteWithVersionTimeout, err)
+}
+
+// 超时时间为 0 的时候不设置超时，直接使用调用方的 ctx
+func withStorageTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// 判断存储操作失败是不是因为超时，只有是这次操作自己的超时到了才算，调用方的 ctx 结束了的话原样返回错误
+func checkStorageTimeout(ctx, timeoutCtx context.Context, e *events.Event, actionName string, timeout time.Duration, err error) error {
+	if err == nil || timeout <= 0 || ctx.Err() != nil || !errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	e.Fork().AddAction(events.NewAction(actionName).SetErr(err).AddPayload(PayloadStorageTimeout, timeout)).Publish(ctx)
+	return fmt.Errorf("%w: %s after %s: %v", ErrStorageOperationTimeout, actionName, timeout, err)
+}
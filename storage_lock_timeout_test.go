@@ -0,0 +1,96 @@
+package storage_lock_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// 打开开关之后所有的写操作都卡住，直到 ctx 结束
+type testHangingStorage struct {
+	*memory_storage.MemoryStorage
+	hang atomic.Bool
+}
+
+func (x *testHangingStorage) wait(ctx context.Context) error {
+	if !x.hang.Load() {
+		return nil
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (x *testHangingStorage) CreateWithVersion(ctx context.Context, lockId string, version storage.Version, lockInformation *storage.LockInformation) error {
+	if err := x.wait(ctx); err != nil {
+		return err
+	}
+	return x.MemoryStorage.CreateWithVersion(ctx, lockId, version, lockInformation)
+}
+
+func (x *testHangingStorage) UpdateWithVersion(ctx context.Context, lockId string, exceptedVersion, newVersion storage.Version, lockInformation *storage.LockInformation) error {
+	if err := x.wait(ctx); err != nil {
+		return err
+	}
+	return x.MemoryStorage.UpdateWithVersion(ctx, lockId, exceptedVersion, newVersion, lockInformation)
+}
+
+func (x *testHangingStorage) DeleteWithVersion(ctx context.Context, lockId string, exceptedVersion storage.Version, lockInformation *storage.LockInformation) error {
+	if err := x.wait(ctx); err != nil {
+		return err
+	}
+	return x.MemoryStorage.DeleteWithVersion(ctx, lockId, exceptedVersion, lockInformation)
+}
+
+func TestStorageLock_StorageOperationTimeout(t *testing.T) {
+	ctx := context.Background()
+	recorder := newTestActionRecorder()
+	s := &testHangingStorage{MemoryStorage: memory_storage.NewMemoryStorage()}
+	options := storage_lock.NewStorageLockOptionsWithLockId("test-timeout-lock").
+		SetStorageOperationTimeout(time.Millisecond * 100).
+		AddEventListeners(recorder.listener())
+	lock, err := storage_lock.NewStorageLockWithOptions(s, options)
+	assert.Nil(t, err)
+
+	// 获取锁的时候存储卡住了，使用 context.Background() 也能按时返回
+	s.hang.Store(true)
+	start := time.Now()
+	err = lock.Lock(ctx, "owner")
+	assert.ErrorIs(t, err, storage_lock.ErrStorageOperationTimeout)
+	assert.Less(t, time.Since(start), time.Second*5)
+	assert.Equal(t, 1, recorder.count(storage_lock.ActionStorageCreateWithVersionTimeout))
+
+	// 释放锁的时候存储卡住了
+	s.hang.Store(false)
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	s.hang.Store(true)
+	err = lock.UnLock(ctx, "owner")
+	assert.ErrorIs(t, err, storage_lock.ErrStorageOperationTimeout)
+	assert.Equal(t, 1, recorder.count(storage_lock.ActionStorageDeleteWithVersionTimeout))
+	s.hang.Store(false)
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+}
+
+// 调用方自己的 ctx 结束了不算存储超时
+func TestStorageLock_StorageOperationTimeoutCallerDeadline(t *testing.T) {
+	recorder := newTestActionRecorder()
+	s := &testHangingStorage{MemoryStorage: memory_storage.NewMemoryStorage()}
+	options := storage_lock.NewStorageLockOptionsWithLockId("test-timeout-lock").
+		SetStorageOperationTimeout(time.Minute).
+		AddEventListeners(recorder.listener())
+	lock, err := storage_lock.NewStorageLockWithOptions(s, options)
+	assert.Nil(t, err)
+
+	s.hang.Store(true)
+	ctx, cancelFunc := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancelFunc()
+	err = lock.Lock(ctx, "owner")
+	assert.NotNil(t, err)
+	assert.NotErrorIs(t, err, storage_lock.ErrStorageOperationTimeout)
+	assert.Equal(t, 0, recorder.count(storage_lock.ActionStorageCreateWithVersionTimeout))
+}
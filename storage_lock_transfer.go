@@ -0,0 +1,245 @@
+package storage_lock
+
+import (
+	"context"
+	"errors"
+	"github.com/storage-lock/go-events"
+	"github.com/storage-lock/go-storage"
+	storage_events "github.com/storage-lock/go-storage-events"
+	"time"
+)
+
+// StorageLock中与锁的所有权转移相关的逻辑拆分到这个文件中
+//
+// 典型场景是发布时的交接：旧 Pod 持有着锁，新 Pod 要接手，如果走"旧的 UnLock、新的 Lock"，
+// 两步之间会有一个窗口期，第三方可能恰好在这个窗口里把锁抢走。
+// Transfer 用一次 CAS 直接把锁记录上的 OwnerId 从旧主人改成新主人，锁在整个过程中始终处于被持有的状态，不存在窗口期。
+
+// Transfer 把当前被 fromOwnerId 持有的锁原地转交给 toOwnerId，转移期间锁不会被释放
+// fromOwnerId: 锁当前的持有者，如果锁不属于它则返回 ErrLockNotBelongYou
+// toOwnerId: 锁的新持有者，不能为空，也不能与 fromOwnerId 相同。
+//
+//	会话模式下跨进程转移时，接收方要把 Session.OwnerId(ownerId) 交给发送方作为 toOwnerId，
+//	锁才会挂在接收方自己的会话上，不会随着发送方的会话过期而失效，接收方的 AcceptTransfer 也才能认出这把锁
+//
+// 转移会保留 LockCount（重入层级原样交给新主人），版本号加一，同时把租约从转移时刻开始重新计算，给新主人留出启动看门狗的时间。
+// 本实例上为旧主人续租的看门狗会被停掉；新主人需要在它自己的 StorageLock 实例上调用 AcceptTransfer 启动自己的看门狗，
+// 之后按正常方式使用 toOwnerId 调用 UnLock 释放锁即可。
+func (x *StorageLock) Transfer(ctx context.Context, fromOwnerId, toOwnerId string) error {
+
+	lockId := x.options.LockId
+	e := events.NewEvent(lockId).SetStorageName(x.storage.GetName()).SetListeners(x.options.EventListeners).SetOwnerId(fromOwnerId)
+
+	e.AddAction(events.NewAction(ActionTransferBegin).AddPayload(PayloadFromOwnerId, fromOwnerId).AddPayload(PayloadToOwnerId, toOwnerId)).Publish(ctx)
+
+	if toOwnerId == "" || toOwnerId == fromOwnerId {
+		e.Fork().AddAction(events.NewAction(ActionTransferError).SetErr(ErrTransferOwnerInvalid)).Publish(ctx)
+		return ErrTransferOwnerInvalid
+	}
+
+	// 会话模式下旧主人挂在当前实例的会话上；
+	// 新主人如果已经是挂在某个会话上的 OwnerId（跨进程转移时接收方通过 Session.OwnerId 得到的）则原样使用，
+	// 否则认为是进程内的交接，同样挂在当前实例的会话上
+	fromOwnerId = x.storageOwnerId(fromOwnerId)
+	if _, _, ok := parseSessionOwnerId(toOwnerId); !ok {
+		toOwnerId = x.storageOwnerId(toOwnerId)
+	}
+	if toOwnerId == fromOwnerId {
+		e.Fork().AddAction(events.NewAction(ActionTransferError).SetErr(ErrTransferOwnerInvalid)).Publish(ctx)
+		return ErrTransferOwnerInvalid
+	}
+
+	versionMissCount := 0
+
+	// 在方法退出的时候发送事件通知
+	defer func() {
+		e.Fork().AddAction(events.NewAction(ActionTransferFinish).AddPayload(PayloadVersionMissCount, versionMissCount)).Publish(ctx)
+	}()
+
+	// 先确认锁确实被 fromOwnerId 有效的持有着，再去动看门狗：
+	// 传错了 fromOwnerId 的话如果先停掉了看门狗，真正的持有者的租约就会悄悄的过期
+	if err := x.transferCheckOwner(ctx, e.Fork(), lockId, fromOwnerId); err != nil {
+		e.Fork().AddAction(events.NewAction(ActionTransferError).SetErr(err)).Publish(ctx)
+		return err
+	}
+
+	// 再停掉为旧主人续租的看门狗，原因与 unlockRelease 中相同：
+	// 看门狗在转移期间仍在续租推进版本号的话，转移的 CAS 会一直 miss
+	x.stopWatchDog(ctx, e.Fork(), nil)
+
+	for {
+
+		err := x.tryTransfer(ctx, e.Fork(), lockId, fromOwnerId, toOwnerId)
+		if err == nil {
+			e.Fork().AddAction(events.NewAction(ActionTransferSuccess).AddPayload(PayloadVersionMissCount, versionMissCount)).Publish(ctx)
+			return nil
+		}
+
+		// 只有在版本miss的情况下才会重试
+		if !errors.Is(err, ErrVersionMiss) {
+			e.Fork().AddAction(events.NewAction(ActionTransferError).SetErr(err).AddPayload(PayloadVersionMissCount, versionMissCount)).Publish(ctx)
+			x.transferRestoreWatchDog(ctx, e.Fork(), lockId, fromOwnerId)
+			return err
+		}
+		versionMissCount++
+		e.Fork().AddAction(events.NewAction(ActionTransferVersionMiss).AddPayload(PayloadVersionMissCount, versionMissCount)).Publish(ctx)
+
+		// 休眠一会儿再开始重试
+		sleepDuration := x.options.VersionMissRetryInterval + x.retryIntervalRandomBase()
+		e.Fork().AddAction(events.NewAction(ActionSleep).AddPayload(PayloadSleep, sleepDuration)).Publish(ctx)
+		x.clock().Sleep(sleepDuration)
+
+		select {
+		case <-ctx.Done():
+			e.Fork().AddAction(events.NewAction(ActionTimeout).AddPayload(PayloadVersionMissCount, versionMissCount)).Publish(ctx)
+			x.transferRestoreWatchDog(ctx, e.Fork(), lockId, fromOwnerId)
+			return err
+		default:
+			e.Fork().AddAction(events.NewAction(ActionSleepRetry).AddPayload(PayloadVersionMissCount, versionMissCount)).Publish(ctx)
+			continue
+		}
+	}
+}
+
+// transferCheckOwner 转移之前检查锁是否被 fromOwnerId 持有着并且租约还没有过期
+func (x *StorageLock) transferCheckOwner(ctx context.Context, e *events.Event, lockId, fromOwnerId string) error {
+
+	lockInformation, err := x.getLockInformation(ctx, e.Fork(), lockId)
+	if err != nil {
+		e.Fork().AddAction(events.NewAction(ActionGetLockInformationError).SetErr(err)).Publish(ctx)
+		return err
+	}
+	if lockInformation.LockCount == 0 {
+		e.Fork().AddActionByName(ActionLockNotExists).Publish(ctx)
+		return ErrLockNotFound
+	}
+	if lockInformation.OwnerId != fromOwnerId {
+		e.Fork().AddAction(events.NewAction(ActionNotLockOwner).AddPayload(storage_events.PayloadLockInformation, lockInformation)).Publish(ctx)
+		return ErrLockNotBelongYou
+	}
+
+	storageTime, err := x.getTime(ctx, e.Fork())
+	if err != nil {
+		e.Fork().AddAction(events.NewAction(storage_events.ActionStorageGetTimeError).SetErr(err)).Publish(ctx)
+		return err
+	}
+	// 会话模式下写入的锁记录看引用的会话是否存活，与 lockExists 中的判断一致
+	alive := !storageTime.After(lockInformation.LeaseExpireTime)
+	if _, sessionId, ok := parseSessionOwnerId(lockInformation.OwnerId); ok {
+		alive, err = x.isSessionAlive(ctx, e.Fork(), sessionId, storageTime)
+		if err != nil {
+			e.Fork().AddAction(events.NewAction(ActionGetLockInformationError).SetErr(err).AddPayload(PayloadSessionId, sessionId)).Publish(ctx)
+			return err
+		}
+	}
+	if !alive {
+		e.Fork().AddAction(events.NewAction(ActionLockExpired).AddPayload(storage_events.PayloadLockInformation, lockInformation)).Publish(ctx)
+		return ErrLockLeaseExpired
+	}
+	return nil
+}
+
+// tryTransfer 尝试一次所有权转移
+func (x *StorageLock) tryTransfer(ctx context.Context, e *events.Event, lockId, fromOwnerId, toOwnerId string) error {
+
+	e.SetLockId(lockId).AddActionByName(ActionTransfer).Publish(ctx)
+
+	lockInformation, err := x.getLockInformation(ctx, e.Fork(), lockId)
+	if err != nil {
+		e.Fork().AddAction(events.NewAction(ActionGetLockInformationError).SetErr(err)).Publish(ctx)
+		return err
+	}
+	e.SetLockInformation(lockInformation)
+
+	// 墓碑（LockCount==0）表示锁已经被释放了，没有东西可以转移
+	if lockInformation.LockCount == 0 {
+		e.Fork().AddActionByName(ActionLockNotExists).Publish(ctx)
+		return ErrLockNotFound
+	}
+
+	// 只有锁当前的持有者才能把锁转让出去
+	if lockInformation.OwnerId != fromOwnerId {
+		e.Fork().AddAction(events.NewAction(ActionNotLockOwner).AddPayload(storage_events.PayloadLockInformation, lockInformation)).Publish(ctx)
+		return ErrLockNotBelongYou
+	}
+
+	// 租约从转移时刻重新开始计算，新主人接手之后有完整的一个租约周期来启动自己的看门狗
+	expireTime, err := x.getLeaseExpireTime(ctx, e.Fork())
+	if err != nil {
+		e.Fork().AddAction(events.NewAction(ActionGetLeaseExpireTimeError).SetErr(err)).Publish(ctx)
+		return err
+	}
+
+	lastVersion := lockInformation.Version
+	newLockInformation := &storage.LockInformation{
+		LockId:          lockInformation.LockId,
+		OwnerId:         toOwnerId,
+		Version:         lastVersion + 1,
+		LockCount:       lockInformation.LockCount,
+		LockBeginTime:   lockInformation.LockBeginTime,
+		LeaseExpireTime: expireTime,
+	}
+
+	err = x.storageExecutor.UpdateWithVersion(ctx, e.Fork(), lockId, lastVersion, newLockInformation.Version, newLockInformation)
+	if err != nil {
+		if errors.Is(err, ErrVersionMiss) {
+			e.Fork().AddAction(events.NewAction(storage_events.ActionStorageUpdateWithVersionMiss).SetErr(err)).Publish(ctx)
+			return ErrVersionMiss
+		} else {
+			e.Fork().AddAction(events.NewAction(storage_events.ActionStorageUpdateWithVersionError).SetErr(err)).Publish(ctx)
+			return err
+		}
+	}
+	e.Fork().SetLockInformation(newLockInformation).AddActionByName(storage_events.ActionStorageUpdateWithVersionSuccess).Publish(ctx)
+	return nil
+}
+
+// transferRestoreWatchDog 转移失败的时候锁仍然属于旧主人，为旧主人重新把看门狗启动起来，不然锁会在转移失败之后慢慢过期
+// 不管转移是因为什么失败的，都以存储中的锁记录为准：记录仍然属于旧主人就恢复，已经不属于旧主人了（比如已经被别人抢占）则什么都不做
+func (x *StorageLock) transferRestoreWatchDog(ctx context.Context, e *events.Event, lockId, fromOwnerId string) {
+	lockInformation, err := x.getLockInformation(ctx, e.Fork(), lockId)
+	if err != nil || lockInformation.LockCount == 0 || lockInformation.OwnerId != fromOwnerId {
+		return
+	}
+	// 不知道这份租约是什么时候续上的，看门狗第一次续租成功之后才开始检查租约断档
+	_ = x.startWatchDog(ctx, e.Fork(), lockId, fromOwnerId, lockInformation, time.Time{})
+}
+
+// AcceptTransfer 新主人在接手锁之后调用，为自己启动看门狗续租
+// 调用前锁必须已经通过 Transfer 转移给了 ownerId，否则返回 ErrLockNotBelongYou
+// 如果看门狗启动失败，会像 Lock 一样尝试回滚（释放）这把锁并返回错误
+func (x *StorageLock) AcceptTransfer(ctx context.Context, ownerId string) error {
+
+	lockId := x.options.LockId
+	ownerId = x.storageOwnerId(ownerId)
+	e := events.NewEvent(lockId).SetStorageName(x.storage.GetName()).SetListeners(x.options.EventListeners).SetOwnerId(ownerId)
+
+	e.AddActionByName(ActionTransferAccept).Publish(ctx)
+
+	lockInformation, err := x.getLockInformation(ctx, e.Fork(), lockId)
+	if err != nil {
+		e.Fork().AddAction(events.NewAction(ActionTransferAcceptError).SetErr(err)).Publish(ctx)
+		return err
+	}
+
+	if lockInformation.LockCount == 0 {
+		e.Fork().AddAction(events.NewAction(ActionTransferAcceptError).SetErr(ErrLockNotFound)).Publish(ctx)
+		return ErrLockNotFound
+	}
+
+	if lockInformation.OwnerId != ownerId {
+		e.Fork().AddAction(events.NewAction(ActionTransferAcceptError).SetErr(ErrLockNotBelongYou).AddPayload(storage_events.PayloadLockInformation, lockInformation)).Publish(ctx)
+		return ErrLockNotBelongYou
+	}
+
+	// 同一个实例上可能还残留着旧主人的看门狗（进程内交接的情况），先清理掉
+	x.stopWatchDog(ctx, e.Fork(), lockInformation)
+	// 租约是旧主人转移的时候写入的，本地不知道它的起点
+	if err := x.startWatchDog(ctx, e.Fork(), lockId, ownerId, lockInformation, time.Time{}); err != nil {
+		e.Fork().AddAction(events.NewAction(ActionTransferAcceptError).SetErr(err)).Publish(ctx)
+		return err
+	}
+
+	e.Fork().AddActionByName(ActionTransferAcceptSuccess).Publish(ctx)
+	return nil
+}
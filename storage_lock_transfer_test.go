@@ -0,0 +1,105 @@
+package storage_lock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/fake_clock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTransferLock(t *testing.T, s storage.Storage) *storage_lock.StorageLock {
+	options := storage_lock.NewStorageLockOptionsWithLockId("test-transfer-lock").
+		SetLeaseExpireAfter(time.Second * 3).
+		SetLeaseRefreshInterval(time.Second).
+		SetVersionMissRetryInterval(time.Millisecond * 10)
+	lock, err := storage_lock.NewStorageLockWithOptions(s, options)
+	assert.Nil(t, err)
+	return lock
+}
+
+func getTestLockInformation(t *testing.T, s storage.Storage, lockId string) *storage.LockInformation {
+	lockInformationJsonString, err := s.Get(context.Background(), lockId)
+	assert.Nil(t, err)
+	information, err := storage_lock.DecodeLockInformation(lockInformationJsonString)
+	assert.Nil(t, err)
+	return information
+}
+
+func TestStorageLock_Transfer(t *testing.T) {
+	ctx := context.Background()
+	s := memory_storage.NewMemoryStorage()
+	oldLock := newTestTransferLock(t, s)
+	newLock := newTestTransferLock(t, s)
+
+	// 旧主人重入两次，转移之后新主人需要释放两次
+	assert.Nil(t, oldLock.Lock(ctx, "old-owner"))
+	assert.Nil(t, oldLock.Lock(ctx, "old-owner"))
+	before := getTestLockInformation(t, s, "test-transfer-lock")
+
+	assert.Nil(t, oldLock.Transfer(ctx, "old-owner", "new-owner"))
+
+	// 旧实例上的看门狗已经停掉
+	assert.Nil(t, oldLock.CurrentWatchDog())
+
+	after := getTestLockInformation(t, s, "test-transfer-lock")
+	assert.Equal(t, "new-owner", after.OwnerId)
+	assert.Equal(t, before.LockCount, after.LockCount)
+	assert.Greater(t, after.Version, before.Version)
+
+	// 旧主人已经无权再操作这把锁
+	assert.ErrorIs(t, oldLock.UnLock(ctx, "old-owner"), storage_lock.ErrLockNotBelongYou)
+	assert.ErrorIs(t, oldLock.Transfer(ctx, "old-owner", "other-owner"), storage_lock.ErrLockNotBelongYou)
+
+	// 新主人接手之后启动自己的看门狗
+	assert.Nil(t, newLock.AcceptTransfer(ctx, "new-owner"))
+	assert.NotNil(t, newLock.CurrentWatchDog())
+
+	assert.Nil(t, newLock.UnLock(ctx, "new-owner"))
+	assert.Nil(t, newLock.UnLock(ctx, "new-owner"))
+	assert.ErrorIs(t, newLock.UnLock(ctx, "new-owner"), storage_lock.ErrLockNotFound)
+}
+
+func TestStorageLock_TransferInvalidOwner(t *testing.T) {
+	ctx := context.Background()
+	lock := newTestTransferLock(t, memory_storage.NewMemoryStorage())
+	assert.ErrorIs(t, lock.Transfer(ctx, "owner", "owner"), storage_lock.ErrTransferOwnerInvalid)
+	assert.ErrorIs(t, lock.Transfer(ctx, "owner", ""), storage_lock.ErrTransferOwnerInvalid)
+	assert.ErrorIs(t, lock.Transfer(ctx, "owner", "other-owner"), storage_lock.ErrLockNotFound)
+}
+
+// 传错了 fromOwnerId 的时候不能停掉真正的持有者的看门狗
+func TestStorageLock_TransferWrongFromOwner(t *testing.T) {
+	ctx := context.Background()
+	clock := fake_clock.NewFakeClock()
+	s := memory_storage.NewMemoryStorageWithOptions(memory_storage.NewMemoryStorageOptions().SetNowFunc(clock.Now))
+	options := storage_lock.NewStorageLockOptionsWithLockId("test-transfer-lock").
+		SetLeaseExpireAfter(time.Second * 3).
+		SetLeaseRefreshInterval(time.Second).
+		SetClock(clock)
+	lock, err := storage_lock.NewStorageLockWithOptions(s, options)
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Lock(ctx, "holder"))
+	watchDog := lock.CurrentWatchDog()
+	assert.NotNil(t, watchDog)
+
+	assert.ErrorIs(t, lock.Transfer(ctx, "not-the-holder", "other"), storage_lock.ErrLockNotBelongYou)
+	assert.Equal(t, watchDog, lock.CurrentWatchDog())
+	assert.Equal(t, "holder", getTestLockInformation(t, s, "test-transfer-lock").OwnerId)
+
+	// 看门狗仍然在续租，过了租约时长之后锁还是自己的
+	// 看门狗每次续租完都会重新等在时钟上，等到它在等了再往前拨时间，看门狗被停掉的话会等不到
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	for i := 0; i < 4; i++ {
+		assert.True(t, clock.BlockUntil(waitCtx, 1))
+		clock.Advance(time.Second)
+	}
+	assert.True(t, clock.BlockUntil(waitCtx, 1))
+	assert.True(t, getTestLockInformation(t, s, "test-transfer-lock").LeaseExpireTime.After(clock.Now()))
+	assert.Nil(t, lock.UnLock(ctx, "holder"))
+}
@@ -6,7 +6,6 @@ import (
 	"github.com/storage-lock/go-events"
 	"github.com/storage-lock/go-storage"
 	storage_events "github.com/storage-lock/go-storage-events"
-	"time"
 )
 
 // StorageLock中与释放锁相关的逻辑拆分到这个文件中，以防止逻辑都放在一个文件中内容太长不好管理
@@ -16,6 +15,7 @@ import (
 func (x *StorageLock) UnLock(ctx context.Context, ownerId string) error {
 
 	lockId := x.options.LockId
+	ownerId = x.storageOwnerId(ownerId)
 	e := events.NewEvent(lockId).SetType(events.EventTypeUnlock).SetStorageName(x.storage.GetName()).SetListeners(x.options.EventListeners).SetOwnerId(ownerId)
 
 	versionMissCount := 0
@@ -45,7 +45,7 @@ func (x *StorageLock) UnLock(ctx context.Context, ownerId string) error {
 		// 休眠一会儿再开始重试
 		sleepDuration := x.options.VersionMissRetryInterval + x.retryIntervalRandomBase()
 		e.Fork().AddAction(events.NewAction(ActionSleep).AddPayload(PayloadSleep, sleepDuration)).Publish(ctx)
-		time.Sleep(sleepDuration)
+		x.clock().Sleep(sleepDuration)
 
 		select {
 		case <-ctx.Done():
@@ -0,0 +1,68 @@
+package storage_lock
+
+import (
+	"context"
+	"github.com/storage-lock/go-events"
+	go_storage "github.com/storage-lock/go-storage"
+	"time"
+)
+
+// WatchableStorage 能够主动推送锁记录变化的存储，是一个可选的能力，没有实现的存储只能靠轮询发现锁被释放了
+//
+// 获取锁的时候如果锁被别人持有着，Lock 默认每隔 VersionMissRetryInterval 轮询一次，
+// 锁被释放之后等待者最多要晚一个轮询间隔才能发现。存储实现了 WatchableStorage 的话，
+// Lock 会在开始竞争之前先订阅锁记录的变化，持有者释放锁（删除记录或者写入墓碑）时等待者立刻被唤醒，
+// 轮询仍然保留作为兜底：持有者崩溃之后租约过期并不会产生任何写入，只能靠轮询发现；通知丢失的时候也不会一直等下去。
+// 所以在支持推送的存储上可以把 VersionMissRetryInterval 设置得大一些来减少轮询的开销，而不影响锁被释放之后的获取延迟。
+type WatchableStorage interface {
+	go_storage.Storage
+
+	// Watch 订阅锁记录的变化，之后锁记录每被创建、更新或者删除一次，返回的 channel 都会收到通知，
+	// ctx 结束的时候取消订阅并关闭 channel。
+	// 通知只表示"锁记录可能变了，该重新读一下了"，不携带锁的信息，来不及消费的多个通知可以合并为一个，
+	// 但是订阅之后发生的变化至少要有一个通知能被收到
+	Watch(ctx context.Context, lockId string) (<-chan struct{}, error)
+}
+
+// 如果存储支持推送的话订阅锁记录的变化，不支持或者订阅失败的时候返回 nil，调用方退化为轮询，
+// 订阅要在读取锁记录之前完成，否则读取之后、开始等待之前发生的释放会被错过
+func (x *StorageLock) watch(ctx context.Context, e *events.Event, lockId string) <-chan struct{} {
+	watchableStorage, ok := x.storage.(WatchableStorage)
+	if !ok {
+		return nil
+	}
+	notify, err := watchableStorage.Watch(ctx, lockId)
+	if err != nil {
+		e.Fork().AddAction(events.NewAction(ActionLockWatchError).SetErr(err)).Publish(ctx)
+		return nil
+	}
+	e.Fork().AddAction(events.NewAction(ActionLockWatch)).Publish(ctx)
+	return notify
+}
+
+// 等待下一次重试，收到锁记录变化的通知、等够了轮询间隔或者 ctx 结束，任何一个先发生都会返回，
+// 返回之后继续使用的通知 channel，订阅被存储关闭了的话返回 nil，之后退化为轮询
+func (x *StorageLock) waitRetry(ctx context.Context, e *events.Event, notify <-chan struct{}, sleepDuration time.Duration) <-chan struct{} {
+	if notify == nil {
+		x.clock().Sleep(sleepDuration)
+		return nil
+	}
+
+	timer := x.clock().NewTimer(sleepDuration)
+	defer timer.Stop()
+	select {
+	case _, ok := <-notify:
+		if !ok {
+			e.Fork().AddAction(events.NewAction(ActionLockWatchClosed)).Publish(ctx)
+			select {
+			case <-timer.C():
+			case <-ctx.Done():
+			}
+			return nil
+		}
+		e.Fork().AddAction(events.NewAction(ActionLockWatchNotify)).Publish(ctx)
+	case <-timer.C():
+	case <-ctx.Done():
+	}
+	return notify
+}
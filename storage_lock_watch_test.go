@@ -0,0 +1,109 @@
+package storage_lock_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-events"
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// 只暴露 Storage 的方法，隐藏掉内存存储的推送能力
+type testPollingStorage struct {
+	storage.Storage
+}
+
+type testActionRecorder struct {
+	mutex   sync.Mutex
+	actions map[string]int
+}
+
+func newTestActionRecorder() *testActionRecorder {
+	return &testActionRecorder{actions: make(map[string]int)}
+}
+
+func (x *testActionRecorder) listener() events.Listener {
+	return events.NewListenerWrapper("test-action-recorder", func(ctx context.Context, e *events.Event) {
+		x.mutex.Lock()
+		defer x.mutex.Unlock()
+		for _, action := range e.Actions {
+			x.actions[action.Name]++
+		}
+	})
+}
+
+func (x *testActionRecorder) count(name string) int {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.actions[name]
+}
+
+func newTestWatchLock(t *testing.T, s storage.Storage, versionMissRetryInterval time.Duration, listeners ...events.Listener) *storage_lock.StorageLock {
+	options := storage_lock.NewStorageLockOptionsWithLockId("test-watch-lock").
+		SetLeaseExpireAfter(time.Second * 30).
+		SetLeaseRefreshInterval(time.Second * 10).
+		SetVersionMissRetryInterval(versionMissRetryInterval).
+		SetSkipCapabilityCheck(true)
+	for _, listener := range listeners {
+		options.AddEventListeners(listener)
+	}
+	lock, err := storage_lock.NewStorageLockWithOptions(s, options)
+	assert.Nil(t, err)
+	return lock
+}
+
+// 在获取锁的过程中释放锁，返回等待者获取到锁花了多长时间
+func waitForRelease(t *testing.T, holder, waiter *storage_lock.StorageLock) time.Duration {
+	ctx := context.Background()
+	assert.Nil(t, holder.Lock(ctx, "holder"))
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- waiter.Lock(ctx, "waiter")
+	}()
+	time.Sleep(time.Millisecond * 100)
+	assert.Nil(t, holder.UnLock(ctx, "holder"))
+
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second * 10):
+		t.Fatal("waiter not woken up")
+	}
+	elapsed := time.Since(start)
+	assert.Nil(t, waiter.UnLock(ctx, "waiter"))
+	return elapsed
+}
+
+// 存储支持推送的时候，锁被释放（删除记录或者写入墓碑）之后等待者立刻被唤醒，不用等到下一次轮询
+func TestStorageLock_WatchWakesWaiter(t *testing.T) {
+	for _, disableAtomicDelete := range []bool{false, true} {
+		s := memory_storage.NewMemoryStorageWithOptions(memory_storage.NewMemoryStorageOptions().SetDisableAtomicDelete(disableAtomicDelete))
+		recorder := newTestActionRecorder()
+		holder := newTestWatchLock(t, s, time.Hour)
+		waiter := newTestWatchLock(t, s, time.Hour, recorder.listener())
+
+		elapsed := waitForRelease(t, holder, waiter)
+		assert.Less(t, elapsed, time.Second*5)
+		assert.Equal(t, 1, recorder.count(storage_lock.ActionLockWatch))
+		assert.GreaterOrEqual(t, recorder.count(storage_lock.ActionLockWatchNotify), 1)
+	}
+}
+
+// 存储不支持推送的时候退化为轮询
+func TestStorageLock_WatchFallbackToPolling(t *testing.T) {
+	s := &testPollingStorage{Storage: memory_storage.NewMemoryStorage()}
+	recorder := newTestActionRecorder()
+	holder := newTestWatchLock(t, s, time.Millisecond*10)
+	waiter := newTestWatchLock(t, s, time.Millisecond*10, recorder.listener())
+
+	waitForRelease(t, holder, waiter)
+	assert.Equal(t, 0, recorder.count(storage_lock.ActionLockWatch))
+	assert.Greater(t, recorder.count(storage_lock.ActionSleep), 0)
+}
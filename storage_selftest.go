@@ -0,0 +1,345 @@
+package storage_lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	go_storage "github.com/storage-lock/go-storage"
+	"github.com/storage-lock/go-utils"
+	"strings"
+	"time"
+)
+
+// 存储能力自检
+//
+// checkStorageCapabilities 只看存储实现自己声明的 Capabilities()，声明了但是实际做不到的存储（比如 Update 的时候没有带上版本条件）
+// 在正常运行的时候几乎不会暴露出来，只有在并发竞争的时候才会悄悄的破坏互斥性。
+// 自检会在一个临时的锁ID上实际跑一遍锁依赖的各项语义，发现存储的行为与声明不符时拒绝创建锁，并给出详细的报告。
+// 自检会对存储做若干次读写，默认不开启，通过 StorageLockOptions.CapabilitySelfTest 开启，也可以直接调用 SelfTestStorage。
+
+// SelfTestLockIdPrefix 自检使用的临时锁ID的前缀，每次自检都会生成一个新的ID，结束的时候删除
+const SelfTestLockIdPrefix = "storage-lock-self-test-"
+
+// DefaultCapabilitySelfTestTimeout 创建锁时运行自检的超时时间
+const DefaultCapabilitySelfTestTimeout = time.Second * 30
+
+// 自检的各项检查的名字
+const (
+	SelfTestCheckGetNotFound       = "get-not-found"
+	SelfTestCheckCreate            = "create"
+	SelfTestCheckCreateDuplicate   = "create-rejects-duplicate"
+	SelfTestCheckUpdateStale       = "update-rejects-stale-version"
+	SelfTestCheckUpdate            = "update"
+	SelfTestCheckDeleteStale       = "delete-rejects-stale-version"
+	SelfTestCheckAtomicDelete      = "atomic-delete"
+	SelfTestCheckTimeMovesForward  = "time-moves-forward"
+	selfTestTimeMovesForwardPeriod = time.Millisecond * 10
+)
+
+// SelfTestCheck 自检中的一项检查的结果
+type SelfTestCheck struct {
+
+	// 检查的名字，取值为 SelfTestCheck* 常量
+	Name string
+
+	// 是否通过了检查
+	Passed bool
+
+	// 是否因为存储没有声明对应的能力或者前面的检查失败了而跳过
+	Skipped bool
+
+	// 检查的细节，没通过的时候说明存储实际的行为是什么
+	Detail string
+}
+
+func (x *SelfTestCheck) String() string {
+	status := "PASS"
+	if x.Skipped {
+		status = "SKIP"
+	} else if !x.Passed {
+		status = "FAIL"
+	}
+	if x.Detail == "" {
+		return fmt.Sprintf("[%s] %s", status, x.Name)
+	}
+	return fmt.Sprintf("[%s] %s: %s", status, x.Name, x.Detail)
+}
+
+// SelfTestReport 一次存储能力自检的报告
+type SelfTestReport struct {
+
+	// 被检查的存储的名字
+	StorageName string
+
+	// 自检使用的临时锁ID
+	LockId string
+
+	// 按执行顺序排列的各项检查
+	Checks []*SelfTestCheck
+}
+
+// Passed 是否所有的检查都通过了，跳过的检查不算失败
+func (x *SelfTestReport) Passed() bool {
+	for _, check := range x.Checks {
+		if !check.Passed && !check.Skipped {
+			return false
+		}
+	}
+	return true
+}
+
+// FailedChecks 没有通过的检查
+func (x *SelfTestReport) FailedChecks() []*SelfTestCheck {
+	failed := make([]*SelfTestCheck, 0)
+	for _, check := range x.Checks {
+		if !check.Passed && !check.Skipped {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+func (x *SelfTestReport) String() string {
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("storage %s self test on lock %s:", x.StorageName, x.LockId))
+	for _, check := range x.Checks {
+		builder.WriteString("\n  ")
+		builder.WriteString(check.String())
+	}
+	return builder.String()
+}
+
+func (x *SelfTestReport) pass(name, detail string) {
+	x.Checks = append(x.Checks, &SelfTestCheck{Name: name, Passed: true, Detail: detail})
+}
+
+func (x *SelfTestReport) fail(name, detail string) {
+	x.Checks = append(x.Checks, &SelfTestCheck{Name: name, Detail: detail})
+}
+
+func (x *SelfTestReport) skip(name, detail string) {
+	x.Checks = append(x.Checks, &SelfTestCheck{Name: name, Skipped: true, Detail: detail})
+}
+
+// SelfTestStorage 在一个临时的锁ID上实际验证存储的行为是否与它声明的能力相符：
+//   - 查询不存在的锁返回空字符串或者 ErrLockNotFound
+//   - CreateWithVersion 拒绝重复创建
+//   - UpdateWithVersion 拒绝过期的版本，使用正确的版本能够更新成功
+//   - 声明了 CapabilityAtomicDelete 的话，DeleteWithVersion 拒绝过期的版本，使用正确的版本能够真正删除记录
+//   - 锁使用的时间源（timeProvider 不为空时使用它，否则使用存储的 GetTime）不会倒退
+//
+// 返回的 error 只表示自检本身没能跑完（比如 ctx 超时），存储的行为与声明不符时 error 为 nil，需要检查 report.Passed()。
+// 不支持原子删除的存储上临时的锁记录最终会以墓碑的形式留下来，可以交给 Sweeper 清理
+func SelfTestStorage(ctx context.Context, storage go_storage.Storage, timeProvider go_storage.TimeProvider) (*SelfTestReport, error) {
+	report := &SelfTestReport{
+		StorageName: storage.GetName(),
+		LockId:      utils.RandomID(SelfTestLockIdPrefix),
+	}
+	lockId := report.LockId
+	atomicDelete := go_storage.SupportsAtomicDelete(storage)
+
+	// 查询不存在的锁
+	if information, ok, err := selfTestGet(ctx, storage, lockId); err != nil {
+		report.fail(SelfTestCheckGetNotFound, fmt.Sprintf("get returned error: %v", err))
+	} else if ok {
+		report.fail(SelfTestCheckGetNotFound, fmt.Sprintf("get returned a record for a lock never created: %s", information.ToJsonString()))
+	} else {
+		report.pass(SelfTestCheckGetNotFound, "")
+	}
+	if ctx.Err() != nil {
+		return report, ctx.Err()
+	}
+
+	// 创建临时的锁，之后的检查都依赖于它
+	now := time.Now()
+	version := go_storage.Version(now.UnixNano())
+	information := &go_storage.LockInformation{
+		LockId:          lockId,
+		OwnerId:         lockId,
+		Version:         version,
+		LockCount:       1,
+		LockBeginTime:   now,
+		LeaseExpireTime: now.Add(time.Minute),
+	}
+	if err := storage.CreateWithVersion(ctx, lockId, version, information); err != nil {
+		report.fail(SelfTestCheckCreate, fmt.Sprintf("create returned error: %v", err))
+		for _, name := range []string{SelfTestCheckCreateDuplicate, SelfTestCheckUpdateStale, SelfTestCheckUpdate, SelfTestCheckDeleteStale, SelfTestCheckAtomicDelete} {
+			report.skip(name, "create failed")
+		}
+		return report, selfTestTime(ctx, report, storage, timeProvider)
+	}
+	report.pass(SelfTestCheckCreate, "")
+
+	// 无论检查到哪一步，结束的时候都把临时的锁清理掉
+	defer func() {
+		cleanupCtx, cancelFunc := context.WithTimeout(context.Background(), DefaultCapabilitySelfTestTimeout)
+		defer cancelFunc()
+		if atomicDelete {
+			_ = storage.DeleteWithVersion(cleanupCtx, lockId, version, information)
+			return
+		}
+		tombstone := *information
+		tombstone.Version = version + 1
+		tombstone.LockCount = 0
+		tombstone.LeaseExpireTime = time.Now()
+		_ = storage.UpdateWithVersion(cleanupCtx, lockId, version, tombstone.Version, &tombstone)
+	}()
+
+	// 重复创建必须失败，并且不能覆盖已有的记录
+	duplicate := *information
+	duplicate.OwnerId = lockId + "-duplicate"
+	if err := storage.CreateWithVersion(ctx, lockId, version+1, &duplicate); err == nil {
+		report.fail(SelfTestCheckCreateDuplicate, "create succeeded on an existing lock")
+		// 被覆盖之后以存储中实际的版本为准，尽量把后面的检查跑完
+		version = version + 1
+		information = &duplicate
+	} else if !errors.Is(err, ErrLockAlreadyExists) && !errors.Is(err, ErrVersionMiss) {
+		report.pass(SelfTestCheckCreateDuplicate, fmt.Sprintf("rejected with unexpected error %v, ErrLockAlreadyExists is recommended", err))
+	} else {
+		report.pass(SelfTestCheckCreateDuplicate, "")
+	}
+
+	// 使用过期的版本更新必须失败
+	stale := *information
+	stale.OwnerId = lockId + "-stale"
+	stale.Version = version + 2
+	if err := storage.UpdateWithVersion(ctx, lockId, version-1, stale.Version, &stale); err == nil {
+		report.fail(SelfTestCheckUpdateStale, "update succeeded with a stale version, storage does not do compare-and-swap")
+		version = stale.Version
+		information = &stale
+	} else if current, ok, getErr := selfTestGet(ctx, storage, lockId); getErr == nil && ok && current.OwnerId != information.OwnerId {
+		report.fail(SelfTestCheckUpdateStale, fmt.Sprintf("update returned error %v but the record was changed to %s", err, current.ToJsonString()))
+	} else {
+		report.pass(SelfTestCheckUpdateStale, "")
+	}
+	if ctx.Err() != nil {
+		return report, ctx.Err()
+	}
+
+	// 使用正确的版本更新必须成功，并且读取出来的是新的记录
+	updated := *information
+	updated.OwnerId = lockId + "-updated"
+	updated.Version = version + 3
+	updated.LockCount = 2
+	if err := storage.UpdateWithVersion(ctx, lockId, version, updated.Version, &updated); err != nil {
+		report.fail(SelfTestCheckUpdate, fmt.Sprintf("update with the current version returned error: %v", err))
+	} else if current, ok, getErr := selfTestGet(ctx, storage, lockId); getErr != nil || !ok {
+		report.fail(SelfTestCheckUpdate, fmt.Sprintf("get after update returned found=%v error=%v", ok, getErr))
+		version = updated.Version
+		information = &updated
+	} else if current.OwnerId != updated.OwnerId || current.LockCount != updated.LockCount {
+		report.fail(SelfTestCheckUpdate, fmt.Sprintf("get after update returned %s", current.ToJsonString()))
+		version = updated.Version
+		information = &updated
+	} else {
+		report.pass(SelfTestCheckUpdate, "")
+		version = updated.Version
+		information = &updated
+	}
+
+	// 删除只在声明了原子条件删除的时候检查，没有声明的存储锁不会调用 DeleteWithVersion
+	if !atomicDelete {
+		report.skip(SelfTestCheckDeleteStale, "storage does not declare CapabilityAtomicDelete")
+		report.skip(SelfTestCheckAtomicDelete, "storage does not declare CapabilityAtomicDelete")
+		return report, selfTestTime(ctx, report, storage, timeProvider)
+	}
+
+	if err := storage.DeleteWithVersion(ctx, lockId, version-1, information); err == nil {
+		report.fail(SelfTestCheckDeleteStale, "delete succeeded with a stale version")
+	} else if _, ok, getErr := selfTestGet(ctx, storage, lockId); getErr == nil && !ok {
+		report.fail(SelfTestCheckDeleteStale, fmt.Sprintf("delete returned error %v but the record was deleted", err))
+	} else {
+		report.pass(SelfTestCheckDeleteStale, "")
+	}
+
+	if err := storage.DeleteWithVersion(ctx, lockId, version, information); err != nil {
+		report.fail(SelfTestCheckAtomicDelete, fmt.Sprintf("delete with the current version returned error: %v", err))
+	} else if current, ok, getErr := selfTestGet(ctx, storage, lockId); getErr != nil {
+		report.fail(SelfTestCheckAtomicDelete, fmt.Sprintf("get after delete returned error: %v", getErr))
+	} else if ok {
+		report.fail(SelfTestCheckAtomicDelete, fmt.Sprintf("record still exists after delete: %s", current.ToJsonString()))
+	} else {
+		report.pass(SelfTestCheckAtomicDelete, "")
+	}
+
+	return report, selfTestTime(ctx, report, storage, timeProvider)
+}
+
+// 检查锁使用的时间源不会倒退，并且确实在往前走
+func selfTestTime(ctx context.Context, report *SelfTestReport, storage go_storage.Storage, timeProvider go_storage.TimeProvider) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	getTime := storage.GetTime
+	if timeProvider != nil {
+		getTime = timeProvider.GetTime
+	}
+
+	first, err := getTime(ctx)
+	if err != nil {
+		report.fail(SelfTestCheckTimeMovesForward, fmt.Sprintf("get time returned error: %v", err))
+		return nil
+	}
+	if first.IsZero() {
+		report.fail(SelfTestCheckTimeMovesForward, "get time returned zero time")
+		return nil
+	}
+
+	// 有的存储时间的精度只有秒，等待一段时间之后只要求不倒退，超过一秒之后才要求必须往前走
+	var last time.Time
+	for waited := time.Duration(0); waited <= time.Second+selfTestTimeMovesForwardPeriod; waited += selfTestTimeMovesForwardPeriod {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(selfTestTimeMovesForwardPeriod):
+		}
+		last, err = getTime(ctx)
+		if err != nil {
+			report.fail(SelfTestCheckTimeMovesForward, fmt.Sprintf("get time returned error: %v", err))
+			return nil
+		}
+		if last.Before(first) {
+			report.fail(SelfTestCheckTimeMovesForward, fmt.Sprintf("time went backwards from %s to %s", first, last))
+			return nil
+		}
+		if last.After(first) {
+			report.pass(SelfTestCheckTimeMovesForward, "")
+			return nil
+		}
+	}
+	report.fail(SelfTestCheckTimeMovesForward, fmt.Sprintf("time stuck at %s", first))
+	return nil
+}
+
+// 读取锁记录，不存在的时候返回 false
+func selfTestGet(ctx context.Context, storage go_storage.Storage, lockId string) (*go_storage.LockInformation, bool, error) {
+	lockInformationString, err := storage.Get(ctx, lockId)
+	if errors.Is(err, ErrLockNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if lockInformationString == "" {
+		return nil, false, nil
+	}
+	information, err := DecodeLockInformation(lockInformationString)
+	if err != nil {
+		return nil, false, err
+	}
+	return information, true, nil
+}
+
+// 创建锁的时候运行自检，存储的行为与声明不符时返回带有详细报告的错误
+func checkStorageSelfTest(storage go_storage.Storage, timeProvider go_storage.TimeProvider) error {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), DefaultCapabilitySelfTestTimeout)
+	defer cancelFunc()
+	report, err := SelfTestStorage(ctx, storage, timeProvider)
+	if err != nil {
+		return fmt.Errorf("%w: %v\n%s", ErrStorageSelfTestFailed, err, report)
+	}
+	if !report.Passed() {
+		return fmt.Errorf("%w\n%s", ErrStorageSelfTestFailed, report)
+	}
+	return nil
+}
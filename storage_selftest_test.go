@@ -0,0 +1,105 @@
+package storage_lock_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// 声明了全部能力，但是更新的时候不检查版本
+type testNoCASStorage struct {
+	*memory_storage.MemoryStorage
+}
+
+func (x *testNoCASStorage) UpdateWithVersion(ctx context.Context, lockId string, exceptedVersion, newVersion storage.Version, lockInformation *storage.LockInformation) error {
+	information, err := x.MemoryStorage.Get(ctx, lockId)
+	if err != nil {
+		return err
+	}
+	current, err := storage_lock.DecodeLockInformation(information)
+	if err != nil {
+		return err
+	}
+	return x.MemoryStorage.UpdateWithVersion(ctx, lockId, current.Version, newVersion, lockInformation)
+}
+
+// 声明了原子条件删除，但是删除什么也不做
+type testFakeDeleteStorage struct {
+	*memory_storage.MemoryStorage
+}
+
+func (x *testFakeDeleteStorage) DeleteWithVersion(ctx context.Context, lockId string, exceptedVersion storage.Version, lockInformation *storage.LockInformation) error {
+	return nil
+}
+
+// 时间停在了某一刻
+type testFrozenTimeStorage struct {
+	*memory_storage.MemoryStorage
+}
+
+func (x *testFrozenTimeStorage) GetTime(ctx context.Context) (time.Time, error) {
+	return time.Unix(1700000000, 0), nil
+}
+
+func failedCheckNames(report *storage_lock.SelfTestReport) []string {
+	names := make([]string, 0)
+	for _, check := range report.FailedChecks() {
+		names = append(names, check.Name)
+	}
+	return names
+}
+
+func TestSelfTestStorage(t *testing.T) {
+	ctx := context.Background()
+
+	// 诚实的存储全部通过，临时的锁被清理掉了
+	s := memory_storage.NewMemoryStorage()
+	report, err := storage_lock.SelfTestStorage(ctx, s, nil)
+	assert.Nil(t, err)
+	assert.True(t, report.Passed(), report.String())
+	assert.Len(t, report.Checks, 8)
+	_, err = s.Get(ctx, report.LockId)
+	assert.ErrorIs(t, err, storage_lock.ErrLockNotFound)
+
+	// 不支持原子删除的存储跳过删除相关的检查，留下一个墓碑
+	s = memory_storage.NewMemoryStorageWithOptions(memory_storage.NewMemoryStorageOptions().SetDisableAtomicDelete(true))
+	report, err = storage_lock.SelfTestStorage(ctx, s, nil)
+	assert.Nil(t, err)
+	assert.True(t, report.Passed(), report.String())
+	tombstone := getTestLockInformation(t, s, report.LockId)
+	assert.Equal(t, 0, tombstone.LockCount)
+
+	report, err = storage_lock.SelfTestStorage(ctx, &testNoCASStorage{memory_storage.NewMemoryStorage()}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{storage_lock.SelfTestCheckUpdateStale}, failedCheckNames(report))
+
+	report, err = storage_lock.SelfTestStorage(ctx, &testFakeDeleteStorage{memory_storage.NewMemoryStorage()}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{storage_lock.SelfTestCheckDeleteStale, storage_lock.SelfTestCheckAtomicDelete}, failedCheckNames(report))
+
+	report, err = storage_lock.SelfTestStorage(ctx, &testFrozenTimeStorage{memory_storage.NewMemoryStorage()}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{storage_lock.SelfTestCheckTimeMovesForward}, failedCheckNames(report))
+}
+
+func TestStorageLock_CapabilitySelfTest(t *testing.T) {
+	options := storage_lock.NewStorageLockOptionsWithLockId("test-self-test-lock").SetCapabilitySelfTest(true)
+	_, err := storage_lock.NewStorageLockWithOptions(memory_storage.NewMemoryStorage(), options)
+	assert.Nil(t, err)
+
+	// 存储撒谎的话创建锁失败，错误中带有报告
+	_, err = storage_lock.NewStorageLockWithOptions(&testNoCASStorage{memory_storage.NewMemoryStorage()}, options)
+	assert.ErrorIs(t, err, storage_lock.ErrStorageSelfTestFailed)
+	assert.True(t, strings.Contains(err.Error(), "[FAIL] "+storage_lock.SelfTestCheckUpdateStale), err.Error())
+
+	// 默认不做自检
+	options.SetCapabilitySelfTest(false)
+	_, err = storage_lock.NewStorageLockWithOptions(&testNoCASStorage{memory_storage.NewMemoryStorage()}, options)
+	assert.Nil(t, err)
+}
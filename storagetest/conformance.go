@@ -0,0 +1,343 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/stretchr/testify/assert"
+)
+
+// RunConformance 对Storage的实现跑一遍一致性测试，检查它是否满足 StorageLock 对存储的要求
+// newStorage: 创建被测试的存储，每次调用都应该返回连接到同一个后端的实例（可以是同一个实例），
+// 互斥测试会用多个实例模拟多个进程同时争抢同一把锁，如果每次返回的是互相隔离的后端，互斥测试就失去了意义
+func RunConformance(t *testing.T, newStorage func() storage.Storage) {
+	RunConformanceWithOptions(t, newStorage, NewConformanceOptions())
+}
+
+// RunConformanceWithOptions 使用给定的选项跑一致性测试
+func RunConformanceWithOptions(t *testing.T, newStorage func() storage.Storage, options *ConformanceOptions) {
+	t.Run("CreateWithVersion", func(t *testing.T) {
+		testCreateWithVersion(t, newStorage())
+	})
+	t.Run("UpdateWithVersion", func(t *testing.T) {
+		testUpdateWithVersion(t, newStorage())
+	})
+	t.Run("DeleteWithVersion", func(t *testing.T) {
+		testDeleteWithVersion(t, newStorage())
+	})
+	t.Run("GetNotFound", func(t *testing.T) {
+		testGetNotFound(t, newStorage())
+	})
+	t.Run("GetTime", func(t *testing.T) {
+		testGetTime(t, newStorage)
+	})
+	t.Run("List", func(t *testing.T) {
+		testList(t, newStorage())
+	})
+	t.Run("Capabilities", func(t *testing.T) {
+		testCapabilities(t, newStorage, options)
+	})
+	t.Run("MutualExclusion", func(t *testing.T) {
+		testMutualExclusion(t, newStorage)
+	})
+}
+
+// 同一个锁只能被创建一次
+func testCreateWithVersion(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	lockId := newTestLockId("create")
+	defer EnsureLockNotExists(t, s, lockId)
+
+	information := NewTestLockInformation()
+	information.LockId = lockId
+	assert.Nil(t, s.CreateWithVersion(ctx, lockId, information.Version, information))
+
+	stored, exists := getLockInformation(t, s, lockId)
+	assert.True(t, exists)
+	if exists {
+		assert.Equal(t, information.Version, stored.Version)
+		assert.Equal(t, information.OwnerId, stored.OwnerId)
+	}
+
+	err := s.CreateWithVersion(ctx, lockId, information.Version, information)
+	assert.ErrorIs(t, err, storage_lock.ErrLockAlreadyExists)
+}
+
+// 只有期望的版本号与存储中的版本号相同时才能更新
+func testUpdateWithVersion(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	lockId := newTestLockId("update")
+	defer EnsureLockNotExists(t, s, lockId)
+
+	information := NewTestLockInformation()
+	information.LockId = lockId
+
+	// 更新不存在的锁
+	err := s.UpdateWithVersion(ctx, lockId, information.Version, information.Version+1, information)
+	assertNotFoundOrVersionMiss(t, err)
+
+	assert.Nil(t, s.CreateWithVersion(ctx, lockId, information.Version, information))
+
+	// 版本号对不上
+	err = s.UpdateWithVersion(ctx, lockId, information.Version+10, information.Version+11, information)
+	assert.ErrorIs(t, err, storage_lock.ErrVersionMiss)
+
+	newInformation := NewTestLockInformation(information.Version + 1)
+	newInformation.LockId = lockId
+	newInformation.OwnerId = "test-case-updated"
+	assert.Nil(t, s.UpdateWithVersion(ctx, lockId, information.Version, newInformation.Version, newInformation))
+
+	stored, exists := getLockInformation(t, s, lockId)
+	assert.True(t, exists)
+	if exists {
+		assert.Equal(t, newInformation.Version, stored.Version)
+		assert.Equal(t, newInformation.OwnerId, stored.OwnerId)
+	}
+
+	// 旧的版本号已经失效了
+	err = s.UpdateWithVersion(ctx, lockId, information.Version, newInformation.Version+1, newInformation)
+	assert.ErrorIs(t, err, storage_lock.ErrVersionMiss)
+}
+
+// 只有期望的版本号与存储中的版本号相同时才能删除
+func testDeleteWithVersion(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	lockId := newTestLockId("delete")
+	defer EnsureLockNotExists(t, s, lockId)
+
+	information := NewTestLockInformation()
+	information.LockId = lockId
+
+	// 删除不存在的锁
+	err := s.DeleteWithVersion(ctx, lockId, information.Version, information)
+	assertNotFoundOrVersionMiss(t, err)
+
+	assert.Nil(t, s.CreateWithVersion(ctx, lockId, information.Version, information))
+
+	err = s.DeleteWithVersion(ctx, lockId, information.Version+10, information)
+	assert.ErrorIs(t, err, storage_lock.ErrVersionMiss)
+	_, exists := getLockInformation(t, s, lockId)
+	assert.True(t, exists)
+
+	assert.Nil(t, s.DeleteWithVersion(ctx, lockId, information.Version, information))
+	_, exists = getLockInformation(t, s, lockId)
+	assert.False(t, exists)
+}
+
+// 查询不存在的锁要么返回 ErrLockNotFound，要么返回空字符串，不能返回其他的错误
+func testGetNotFound(t *testing.T, s storage.Storage) {
+	lockInformationJsonString, err := s.Get(context.Background(), newTestLockId("not-found"))
+	if err != nil {
+		assert.ErrorIs(t, err, storage_lock.ErrLockNotFound)
+	} else {
+		assert.Equal(t, "", lockInformationJsonString)
+	}
+}
+
+// 存储的时间不能回退
+func testGetTime(t *testing.T, newStorage func() storage.Storage) {
+	ctx := context.Background()
+	s := newStorage()
+	last, err := s.GetTime(ctx)
+	assert.Nil(t, err)
+	assert.False(t, last.IsZero())
+	for i := 0; i < 20; i++ {
+		now, err := s.GetTime(ctx)
+		assert.Nil(t, err)
+		assert.False(t, now.Before(last), "storage time went backwards: %s -> %s", last, now)
+		last = now
+	}
+}
+
+// List 要能列出所有存在的锁
+func testList(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	lockIds := make(map[string]bool)
+	for i := 0; i < 5; i++ {
+		lockId := newTestLockId("list")
+		information := NewTestLockInformation()
+		information.LockId = lockId
+		assert.Nil(t, s.CreateWithVersion(ctx, lockId, information.Version, information))
+		lockIds[lockId] = false
+		defer EnsureLockNotExists(t, s, lockId)
+	}
+
+	iterator, err := s.List(ctx)
+	if !assert.Nil(t, err) {
+		return
+	}
+	for iterator.Next() {
+		if _, ok := lockIds[iterator.Value().LockId]; ok {
+			lockIds[iterator.Value().LockId] = true
+		}
+	}
+	for lockId, found := range lockIds {
+		assert.True(t, found, "lock %s not listed", lockId)
+	}
+}
+
+// 声明的能力必须与实际的行为相符
+func testCapabilities(t *testing.T, newStorage func() storage.Storage, options *ConformanceOptions) {
+	s := newStorage()
+
+	if storage.HasCapability(s, storage.CapabilityCAS) {
+		t.Run(string(storage.CapabilityCAS), func(t *testing.T) {
+			testCapabilityCAS(t, newStorage, options)
+		})
+	}
+	if storage.HasCapability(s, storage.CapabilityReliableTime) {
+		t.Run(string(storage.CapabilityReliableTime), func(t *testing.T) {
+			testCapabilityReliableTime(t, newStorage)
+		})
+	}
+	if storage.HasCapability(s, storage.CapabilityAtomicDelete) {
+		t.Run(string(storage.CapabilityAtomicDelete), func(t *testing.T) {
+			testCapabilityAtomicDelete(t, newStorage, options)
+		})
+	}
+}
+
+// 并发的创建和并发的条件更新只能有一个成功
+func testCapabilityCAS(t *testing.T, newStorage func() storage.Storage, options *ConformanceOptions) {
+	ctx := context.Background()
+	lockId := newTestLockId("cas")
+	s := newStorage()
+	defer EnsureLockNotExists(t, s, lockId)
+
+	information := NewTestLockInformation()
+	information.LockId = lockId
+	success := runConcurrently(newStorage, func(s storage.Storage) error {
+		return s.CreateWithVersion(ctx, lockId, information.Version, information)
+	})
+	assertOneWinner(t, success, options, "concurrent CreateWithVersion")
+	if success == 0 && options.AllowNoWinner {
+		assert.Nil(t, s.CreateWithVersion(ctx, lockId, information.Version, information))
+	}
+
+	newInformation := NewTestLockInformation(information.Version + 1)
+	newInformation.LockId = lockId
+	success = runConcurrently(newStorage, func(s storage.Storage) error {
+		return s.UpdateWithVersion(ctx, lockId, information.Version, newInformation.Version, newInformation)
+	})
+	assertOneWinner(t, success, options, "concurrent UpdateWithVersion")
+}
+
+// 同一个后端的多个实例看到的时间应该是一致的
+func testCapabilityReliableTime(t *testing.T, newStorage func() storage.Storage) {
+	ctx := context.Background()
+	a, err := newStorage().GetTime(ctx)
+	assert.Nil(t, err)
+	b, err := newStorage().GetTime(ctx)
+	assert.Nil(t, err)
+	diff := b.Sub(a)
+	if diff < 0 {
+		diff = -diff
+	}
+	assert.Less(t, diff, time.Second, "storage instances disagree on time: %s vs %s", a, b)
+}
+
+// 条件删除与条件更新竞争同一个版本号时只能有一个成功
+func testCapabilityAtomicDelete(t *testing.T, newStorage func() storage.Storage, options *ConformanceOptions) {
+	ctx := context.Background()
+	lockId := newTestLockId("atomic-delete")
+	s := newStorage()
+	defer EnsureLockNotExists(t, s, lockId)
+
+	information := NewTestLockInformation()
+	information.LockId = lockId
+	assert.Nil(t, s.CreateWithVersion(ctx, lockId, information.Version, information))
+
+	newInformation := NewTestLockInformation(information.Version + 1)
+	newInformation.LockId = lockId
+	var counter int32
+	success := runConcurrently(newStorage, func(s storage.Storage) error {
+		if atomic.AddInt32(&counter, 1)%2 == 0 {
+			return s.DeleteWithVersion(ctx, lockId, information.Version, information)
+		}
+		return s.UpdateWithVersion(ctx, lockId, information.Version, newInformation.Version, newInformation)
+	})
+	assertOneWinner(t, success, options, "concurrent DeleteWithVersion and UpdateWithVersion")
+}
+
+// 通过 StorageLock 在多个存储实例上并发争抢同一把锁，临界区内同时只能有一个持有者
+func testMutualExclusion(t *testing.T, newStorage func() storage.Storage) {
+	lockId := newTestLockId("mutual-exclusion")
+	defer EnsureLockNotExists(t, newStorage(), lockId)
+
+	// 临界区的计数用原子变量，因为 race 检测感知不到存储建立的先后关系
+	var inside, counter int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := context.Background()
+			options := storage_lock.NewStorageLockOptionsWithLockId(lockId).
+				SetLeaseExpireAfter(time.Second * 30).
+				SetLeaseRefreshInterval(time.Second * 5).
+				SetVersionMissRetryInterval(time.Millisecond * 5).
+				// 能力是否与行为相符由 Capabilities 单独检查，这里直接检验行为
+				SetSkipCapabilityCheck(true)
+			lock, err := storage_lock.NewStorageLockWithOptions(newStorage(), options)
+			if !assert.Nil(t, err) {
+				return
+			}
+			for j := 0; j < 10; j++ {
+				ownerId := storage_lock.NewOwnerIdGenerator().GenOwnerId()
+				if !assert.Nil(t, lock.Lock(ctx, ownerId)) {
+					return
+				}
+				assert.Equal(t, int32(1), atomic.AddInt32(&inside, 1), "more than one owner inside the critical section")
+				atomic.AddInt32(&counter, 1)
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&inside, -1)
+				assert.Nil(t, lock.UnLock(ctx, ownerId))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(50), atomic.LoadInt32(&counter))
+}
+
+// 在多个存储实例上并发执行同一个操作，返回成功的次数
+func runConcurrently(newStorage func() storage.Storage, f func(s storage.Storage) error) int32 {
+	var success int32
+	start := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		s := newStorage()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if f(s) == nil {
+				atomic.AddInt32(&success, 1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return success
+}
+
+// 并发的条件写恰好有一个成功，打开了 AllowNoWinner 时也允许全部失败
+func assertOneWinner(t *testing.T, success int32, options *ConformanceOptions, msg string) {
+	if options.AllowNoWinner {
+		assert.LessOrEqual(t, success, int32(1), msg)
+		return
+	}
+	assert.Equal(t, int32(1), success, msg)
+}
+
+func assertNotFoundOrVersionMiss(t *testing.T, err error) {
+	if !errors.Is(err, storage_lock.ErrLockNotFound) && !errors.Is(err, storage_lock.ErrVersionMiss) {
+		t.Errorf("expected ErrLockNotFound or ErrVersionMiss, got %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+package storagetest
+
+// ConformanceOptions 一致性测试的选项
+type ConformanceOptions struct {
+
+	// 允许并发的条件写全部失败，默认要求并发的条件写恰好有一个成功。
+	// 多数派这类组合存储在并发时各个成员可能被不同的写入者抢到，谁都凑不够多数，这不违反CAS，
+	// 只有这类存储需要打开这个选项，普通的存储打开它会掩盖"并发时所有人都失败"的问题
+	AllowNoWinner bool
+}
+
+// NewConformanceOptions 使用默认值创建一致性测试的选项
+func NewConformanceOptions() *ConformanceOptions {
+	return &ConformanceOptions{}
+}
+
+func (x *ConformanceOptions) SetAllowNoWinner(allowNoWinner bool) *ConformanceOptions {
+	x.AllowNoWinner = allowNoWinner
+	return x
+}
@@ -0,0 +1,70 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// 这个包中的方法是用来方便的测试Storage的实现的，Storage的实现者可以在自己的单元测试中直接调用 RunConformance
+
+const (
+
+	// 测试时锁定的资源ID
+	TestStorageLockId = "storage_lock_lock_id_test"
+
+	// 测试时锁的初始版本号
+	TestStorageVersion = 1
+)
+
+// NewTestLockInformation 创建一个单元测试中使用的锁的信息
+// 参数是一个可选的版本号，不传的话使用 TestStorageVersion
+func NewTestLockInformation(version ...storage.Version) *storage.LockInformation {
+	if len(version) == 0 {
+		version = append(version, TestStorageVersion)
+	}
+	information := &storage.LockInformation{
+		OwnerId:         "test-case",
+		Version:         version[0],
+		LockCount:       1,
+		LockBeginTime:   time.Now(),
+		LeaseExpireTime: time.Now().Add(time.Second * 30),
+	}
+	return information
+}
+
+// EnsureLockNotExists 确保给定的锁在存储中不存在，如果存在的话则将其删除
+func EnsureLockNotExists(t *testing.T, s storage.Storage, lockId string) {
+	information, exists := getLockInformation(t, s, lockId)
+	if !exists {
+		return
+	}
+	err := s.DeleteWithVersion(context.Background(), lockId, information.Version, information)
+	assert.Nil(t, err)
+}
+
+// 读取锁的信息，不存在的时候返回 false
+// 存储可以用 storage_lock.ErrLockNotFound 或者返回空字符串两种方式表示锁不存在，StorageLock 对两种方式都能正确处理
+func getLockInformation(t *testing.T, s storage.Storage, lockId string) (*storage.LockInformation, bool) {
+	lockInformationJsonString, err := s.Get(context.Background(), lockId)
+	if errors.Is(err, storage_lock.ErrLockNotFound) {
+		return nil, false
+	}
+	if !assert.Nil(t, err) || lockInformationJsonString == "" {
+		return nil, false
+	}
+	information, err := storage_lock.DecodeLockInformation(lockInformationJsonString)
+	assert.Nil(t, err)
+	return information, true
+}
+
+// 为本次运行生成一个不会与存储中已有数据冲突的锁ID，这样在持久化的存储上重复运行也不会互相干扰
+func newTestLockId(name string) string {
+	return utils.RandomID(TestStorageLockId + "-" + name + "-")
+}
@@ -0,0 +1,417 @@
+package storage_lock
+
+import (
+	"context"
+	"errors"
+	"github.com/storage-lock/go-events"
+	go_storage "github.com/storage-lock/go-storage"
+	storage_events "github.com/storage-lock/go-storage-events"
+	"github.com/storage-lock/go-utils"
+	"sync"
+	"time"
+)
+
+// Sweeper 清理器，清理存储中已经没有用的锁记录：
+//   - 墓碑：存储不支持原子条件删除时，释放锁只会写入一个 LockCount==0 的墓碑，用过的每个锁ID都会留下一条记录
+//   - 被遗弃的锁：持有者崩溃之后没有人再来获取这把锁，租约过期的记录会一直留在存储中
+//
+// 清理器通过 Storage.List 找到墓碑和过期超过宽限期的记录，删除之前会重新读取一次，记录在这期间被改动过的话放弃删除，
+// 删除本身也是基于版本号的 CAS，不会误删正在被使用的锁：
+//   - 存储支持原子条件删除时直接 DeleteWithVersion
+//   - 存储不支持原子条件删除时 DeleteWithVersion 不能保证"比较"和"删除"之间没有别人写入，
+//     所以先通过 UpdateWithVersion 以一个短租约持有这条记录（与抢占过期的锁一样），持有期间别人获取不到这把锁，
+//     再删除自己持有的这条记录。删除失败的话记录会在短租约过期之后变成一把普通的过期的锁，下一次清理的时候再处理
+//
+// 会话模式下的锁记录有效性取决于会话，只有引用的会话已经失效超过宽限期的时候才会被清理。
+// 注意记录被删除之后这个锁ID的版本号会从头开始，与支持原子条件删除的存储上释放锁的效果相同，
+// 所以墓碑默认是不清理的，见 SweeperOptions.DeleteTombstones。
+//
+// 锁配置了 SigningKey 的话清理器也要配置相同的密钥：清理器持有记录时写入的短租约记录需要签名，
+// 否则删除失败时留下的记录会被所有的锁当成被篡改的记录；签名校验不通过的记录不会被清理。
+//
+// 清理可以通过 Sweep 一次性执行（比如运维手动触发），也可以通过 Start 在后台定期执行。
+type Sweeper struct {
+
+	// 清理器的ID，存储不支持原子条件删除时作为持有记录的 OwnerId
+	id string
+
+	storage         go_storage.Storage
+	storageExecutor *storage_events.WithEventSafeExecutor
+
+	options *SweeperOptions
+
+	// 清理器生命周期中产生的事件都是这个事件的子事件
+	e *events.Event
+
+	// stop: Stop 时 close，通知后台协程退出；done: 后台协程退出后 close
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+
+	// 后台协程生命周期的 context，Stop 时取消，用于打断卡在存储调用里的清理
+	runCtx    context.Context
+	runCancel context.CancelFunc
+}
+
+// SweeperIDPrefix 清理器ID的前缀
+const SweeperIDPrefix = "storage-lock-sweeper-"
+
+// 删除记录的原因
+const (
+	SweepReasonTombstone      = "tombstone"
+	SweepReasonExpired        = "expired"
+	SweepReasonSessionExpired = "session-expired"
+)
+
+// SweepResult 一次清理的结果
+type SweepResult struct {
+
+	// 扫描了多少条记录
+	Scanned int `json:"scanned"`
+
+	// 删除了多少条墓碑
+	Tombstones int `json:"tombstones"`
+
+	// 删除了多少条过期的锁，包括会话已经失效的锁
+	Expired int `json:"expired"`
+
+	// 有多少条记录在清理期间被改动过，放弃删除
+	Conflicts int `json:"conflicts"`
+
+	// 有多少条记录删除失败
+	Failed int `json:"failed"`
+}
+
+// Deleted 一共删除了多少条记录
+func (x *SweepResult) Deleted() int {
+	return x.Tombstones + x.Expired
+}
+
+// NewSweeper 使用默认选项在给定的存储上创建一个清理器
+func NewSweeper(storage go_storage.Storage) (*Sweeper, error) {
+	return NewSweeperWithOptions(storage, NewSweeperOptions())
+}
+
+// NewSweeperWithOptions 使用给定的选项在给定的存储上创建一个清理器，创建之后不会自动开始清理
+func NewSweeperWithOptions(storage go_storage.Storage, options *SweeperOptions) (*Sweeper, error) {
+
+	if err := checkSweeperOptions(options); err != nil {
+		return nil, err
+	}
+
+	id := utils.RandomID(SweeperIDPrefix)
+	sweeper := &Sweeper{
+		id:              id,
+		storage:         storage,
+		storageExecutor: storage_events.NewWithEventSafeExecutor(storage),
+		options:         options,
+		e:               events.NewEvent(id).SetOwnerId(id).SetStorageName(storage.GetName()).SetListeners(options.EventListeners),
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+	// 配置了签名密钥的话清理器的写入也要先签名
+	if len(options.SigningKey) != 0 {
+		sweeper.storageExecutor = storage_events.NewWithEventSafeExecutor(newSigningStorage(storage, options.SigningKey))
+	}
+	sweeper.runCtx, sweeper.runCancel = context.WithCancel(context.Background())
+	return sweeper, nil
+}
+
+// GetID 清理器的ID
+func (x *Sweeper) GetID() string {
+	return x.id
+}
+
+// Start 启动后台协程，立即清理一次，之后每隔 Interval 清理一次，重复调用只会启动一次
+func (x *Sweeper) Start() {
+	x.startOnce.Do(func() {
+		go x.run()
+	})
+}
+
+// Stop 停止后台协程并等待它退出，正在进行中的清理会被打断
+func (x *Sweeper) Stop(ctx context.Context) error {
+	x.stopOnce.Do(func() { close(x.stop) })
+	x.runCancel()
+
+	// 没有启动过的话不需要等待
+	x.startOnce.Do(func() {
+		close(x.done)
+	})
+
+	select {
+	case <-x.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 后台协程，每隔 Interval 清理一次
+func (x *Sweeper) run() {
+
+	defer close(x.done)
+	defer func() {
+		x.e.Fork().AddActionByName(ActionSweeperExit).Publish(context.Background())
+	}()
+
+	// 休眠用同一个定时器，退出的时候停掉，不在时钟上留下没人等的定时器
+	var timer Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		// 清理失败的话事件中已经有了错误信息，下一次再试就可以了
+		_, _ = x.Sweep(x.runCtx)
+
+		if timer == nil {
+			timer = x.clock().NewTimer(x.options.Interval)
+		} else {
+			timer.Reset(x.options.Interval)
+		}
+		select {
+		case <-x.stop:
+			return
+		case <-timer.C():
+		}
+	}
+}
+
+// 清理器使用的时钟，选项中没有设置的话使用真实的时钟
+func (x *Sweeper) clock() Clock {
+	if x.options.Clock != nil {
+		return x.options.Clock
+	}
+	return defaultClock
+}
+
+// Sweep 执行一次清理，返回这次清理的结果，
+// 只有列出记录失败或者 ctx 结束的时候才会返回错误，单条记录删除失败只会计入结果并发送事件
+func (x *Sweeper) Sweep(ctx context.Context) (*SweepResult, error) {
+
+	e := x.e.Fork().AddActionByName(ActionSweep)
+	e.Publish(ctx)
+
+	result := &SweepResult{}
+	err := x.sweep(ctx, e, result)
+	if err != nil {
+		e.Fork().AddAction(events.NewAction(ActionSweepError).SetErr(err).AddPayload(PayloadSweepResult, result)).Publish(ctx)
+		return result, err
+	}
+	e.Fork().AddAction(events.NewAction(ActionSweepSuccess).AddPayload(PayloadSweepResult, result)).Publish(ctx)
+	return result, nil
+}
+
+func (x *Sweeper) sweep(ctx context.Context, e *events.Event, result *SweepResult) error {
+
+	storageTime, err := x.getTime(ctx, e.Fork())
+	if err != nil {
+		return err
+	}
+
+	// 先按列出来的记录挑出候选，删除之前还会再读取一次
+	it, err := x.storageExecutor.List(ctx, e.Fork())
+	if err != nil {
+		return err
+	}
+	candidates := make([]string, 0)
+	for it.Next() {
+		result.Scanned++
+		information := it.Value()
+		reason, err := "", x.verifySignature(information)
+		if err == nil {
+			reason, err = x.sweepReason(ctx, e, information, storageTime)
+		}
+		if err != nil {
+			result.Failed++
+			e.Fork().SetLockId(information.LockId).AddAction(events.NewAction(ActionSweepDeleteError).SetErr(err)).Publish(ctx)
+			continue
+		}
+		if reason != "" {
+			candidates = append(candidates, information.LockId)
+		}
+	}
+
+	var timer Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for index, lockId := range candidates {
+
+		if x.options.MaxDeletesPerSweep > 0 && result.Deleted() >= x.options.MaxDeletesPerSweep {
+			break
+		}
+
+		// 限速
+		if index > 0 && x.options.DeleteInterval > 0 {
+			if timer == nil {
+				timer = x.clock().NewTimer(x.options.DeleteInterval)
+			} else {
+				timer.Reset(x.options.DeleteInterval)
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timer.C():
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		x.sweepOne(ctx, e.Fork().SetLockId(lockId), lockId, storageTime, result)
+	}
+	return nil
+}
+
+// 删除一条记录，结果计入 result
+func (x *Sweeper) sweepOne(ctx context.Context, e *events.Event, lockId string, storageTime time.Time, result *SweepResult) {
+
+	e.AddActionByName(ActionSweepDelete).Publish(ctx)
+
+	// 重新读取一次，列出来之后记录可能已经被重新获取了
+	information, err := x.getLockInformation(ctx, e.Fork(), lockId)
+	if err != nil {
+		if errors.Is(err, ErrLockNotFound) {
+			result.Conflicts++
+			e.Fork().AddAction(events.NewAction(ActionSweepDeleteConflict).SetErr(err)).Publish(ctx)
+			return
+		}
+		result.Failed++
+		e.Fork().AddAction(events.NewAction(ActionSweepDeleteError).SetErr(err)).Publish(ctx)
+		return
+	}
+	e.SetLockInformation(information)
+
+	reason, err := x.sweepReason(ctx, e, information, storageTime)
+	if err != nil {
+		result.Failed++
+		e.Fork().AddAction(events.NewAction(ActionSweepDeleteError).SetErr(err)).Publish(ctx)
+		return
+	}
+	if reason == "" {
+		result.Conflicts++
+		e.Fork().AddActionByName(ActionSweepDeleteConflict).Publish(ctx)
+		return
+	}
+
+	if go_storage.SupportsAtomicDelete(x.storage) {
+		err = x.storageExecutor.DeleteWithVersion(ctx, e.Fork(), lockId, information.Version, information)
+	} else {
+		err = x.claimAndDelete(ctx, e.Fork(), lockId, information)
+	}
+	if err != nil {
+		if errors.Is(err, ErrVersionMiss) || errors.Is(err, ErrLockNotFound) {
+			result.Conflicts++
+			e.Fork().AddAction(events.NewAction(ActionSweepDeleteConflict).SetErr(err).AddPayload(PayloadSweepReason, reason)).Publish(ctx)
+			return
+		}
+		result.Failed++
+		e.Fork().AddAction(events.NewAction(ActionSweepDeleteError).SetErr(err).AddPayload(PayloadSweepReason, reason)).Publish(ctx)
+		return
+	}
+
+	if reason == SweepReasonTombstone {
+		result.Tombstones++
+	} else {
+		result.Expired++
+	}
+	e.Fork().AddAction(events.NewAction(ActionSweepDeleteSuccess).AddPayload(PayloadSweepReason, reason)).Publish(ctx)
+}
+
+// 存储不支持原子条件删除时，先以短租约持有这条记录，再删除自己持有的记录
+func (x *Sweeper) claimAndDelete(ctx context.Context, e *events.Event, lockId string, information *go_storage.LockInformation) error {
+	// 一次清理可能持续比较久，短租约要从现在开始算
+	storageTime, err := x.getTime(ctx, e.Fork())
+	if err != nil {
+		return err
+	}
+	claim := &go_storage.LockInformation{
+		LockId:          lockId,
+		OwnerId:         x.id,
+		Version:         information.Version + 1,
+		LockCount:       1,
+		LockBeginTime:   storageTime,
+		LeaseExpireTime: storageTime.Add(x.options.ClaimLeaseExpireAfter),
+	}
+	if err := x.storageExecutor.UpdateWithVersion(ctx, e.Fork(), lockId, information.Version, claim.Version, claim); err != nil {
+		return err
+	}
+	return x.storageExecutor.DeleteWithVersion(ctx, e.Fork(), lockId, claim.Version, claim)
+}
+
+// 判断一条记录是否可以被清理，可以的话返回原因，不可以的话返回空字符串
+func (x *Sweeper) sweepReason(ctx context.Context, e *events.Event, information *go_storage.LockInformation, storageTime time.Time) (string, error) {
+
+	if information.LockCount == 0 {
+		if x.options.DeleteTombstones && storageTime.Sub(information.LeaseExpireTime) >= x.options.TombstoneGracePeriod {
+			return SweepReasonTombstone, nil
+		}
+		return "", nil
+	}
+
+	// 会话模式下的锁记录要看引用的会话是不是已经失效超过了宽限期
+	if _, sessionId, ok := parseSessionOwnerId(trimSignature(information.OwnerId)); ok {
+		expireTime := information.LeaseExpireTime
+		sessionInformation, err := x.getLockInformation(ctx, e.Fork(), sessionId)
+		if err != nil && !errors.Is(err, ErrLockNotFound) {
+			return "", err
+		}
+		if sessionInformation != nil {
+			if sessionInformation.LockCount > 0 && !storageTime.After(sessionInformation.LeaseExpireTime) {
+				return "", nil
+			}
+			if sessionInformation.LeaseExpireTime.After(expireTime) {
+				expireTime = sessionInformation.LeaseExpireTime
+			}
+		}
+		if storageTime.Sub(expireTime) >= x.options.ExpiredGracePeriod {
+			return SweepReasonSessionExpired, nil
+		}
+		return "", nil
+	}
+
+	if storageTime.Sub(information.LeaseExpireTime) >= x.options.ExpiredGracePeriod {
+		return SweepReasonExpired, nil
+	}
+	return "", nil
+}
+
+func (x *Sweeper) getTime(ctx context.Context, e *events.Event) (time.Time, error) {
+	if x.options.TimeProvider != nil {
+		return x.options.TimeProvider.GetTime(ctx)
+	}
+	return x.storageExecutor.GetTime(ctx, e)
+}
+
+// 读取锁记录，记录不存在时返回 ErrLockNotFound，配置了签名密钥的话签名校验不通过时返回 ErrLockRecordTampered
+func (x *Sweeper) getLockInformation(ctx context.Context, e *events.Event, lockId string) (*go_storage.LockInformation, error) {
+	lockInformationJsonString, err := x.storageExecutor.Get(ctx, e, lockId)
+	if err != nil {
+		return nil, err
+	}
+	if lockInformationJsonString == "" {
+		return nil, ErrLockNotFound
+	}
+	information, err := DecodeLockInformation(lockInformationJsonString)
+	if err != nil {
+		return nil, err
+	}
+	if err := x.verifySignature(information); err != nil {
+		return nil, err
+	}
+	return information, nil
+}
+
+// 配置了签名密钥的话校验锁记录的签名，通过的话把签名从 OwnerId 中去掉
+func (x *Sweeper) verifySignature(information *go_storage.LockInformation) error {
+	if len(x.options.SigningKey) == 0 {
+		return nil
+	}
+	return verifySignature(x.options.SigningKey, information)
+}
@@ -0,0 +1,153 @@
+package storage_lock
+
+import (
+	"github.com/storage-lock/go-events"
+	go_storage "github.com/storage-lock/go-storage"
+	"time"
+)
+
+const (
+
+	// DefaultSweepInterval 后台运行时默认每隔多久清理一次
+	DefaultSweepInterval = time.Minute * 10
+
+	// DefaultTombstoneGracePeriod 墓碑默认保留多久之后才会被清理
+	DefaultTombstoneGracePeriod = time.Minute
+
+	// DefaultExpiredGracePeriod 租约过期的锁默认过期多久之后才会被清理
+	DefaultExpiredGracePeriod = time.Hour
+
+	// DefaultSweepDeleteInterval 默认两次删除之间至少间隔多久
+	DefaultSweepDeleteInterval = time.Millisecond * 10
+
+	// DefaultSweepClaimLeaseExpireAfter 存储不支持原子条件删除时，清理之前先占住记录的租约默认多长
+	DefaultSweepClaimLeaseExpireAfter = time.Second * 30
+)
+
+// SweeperOptions 创建清理器（Sweeper）的相关选项
+type SweeperOptions struct {
+
+	// 后台运行时每隔多久清理一次，只对 Start 启动的后台任务有效
+	Interval time.Duration
+
+	// 是否清理墓碑（LockCount==0），默认不清理。
+	// 不支持原子条件删除的存储上墓碑保存着这个锁ID的版本号，删掉之后下一次获取锁会从版本号 1 重新开始，
+	// 栅栏令牌（GetFencingToken）在持有者变更时严格单调递增的保证就不成立了，只有不使用栅栏令牌的时候才应该打开
+	DeleteTombstones bool
+
+	// 墓碑（LockCount==0）释放之后至少保留多久才会被清理，墓碑的 LeaseExpireTime 就是释放的时间
+	TombstoneGracePeriod time.Duration
+
+	// 锁的租约过期之后至少再过多久才会被当做被遗弃的锁清理掉，
+	// 要明显长于锁的 LeaseExpireAfter，给时钟误差和持有者的续租留出足够的余量。
+	// 与墓碑一样，记录被删掉之后这个锁ID的版本号会从 1 重新开始
+	ExpiredGracePeriod time.Duration
+
+	// 限速，两次删除之间至少间隔多久，避免一次清理大量的记录时压垮存储，为 0 表示不限速
+	DeleteInterval time.Duration
+
+	// 一次清理最多删除多少条记录，剩下的留给下一次，为 0 表示不限制
+	MaxDeletesPerSweep int
+
+	// 存储不支持原子条件删除时，删除之前先以一个短租约持有这条记录，租约要足够长，能够覆盖一次删除的耗时
+	ClaimLeaseExpireAfter time.Duration
+
+	// 外部注入的可靠时间源，与锁的 TimeProvider 含义相同，必须与锁使用同一个时间源
+	TimeProvider go_storage.TimeProvider
+
+	// 锁记录签名用的共享密钥，与 StorageLockOptions.SigningKey 含义相同，锁配置了签名密钥的话这里必须配置相同的密钥
+	SigningKey []byte
+
+	// 用于监听观测清理过程中的各种事件
+	EventListeners []events.Listener
+
+	// 后台清理的间隔和删除限速使用的本地时钟，未设置的话使用真实的时钟，主要用于在测试中注入可以手动拨动的时钟
+	// @see:
+	//     fake_clock.FakeClock
+	Clock Clock
+}
+
+// NewSweeperOptions 使用默认值创建清理器的配置项
+func NewSweeperOptions() *SweeperOptions {
+	return &SweeperOptions{
+		Interval:              DefaultSweepInterval,
+		TombstoneGracePeriod:  DefaultTombstoneGracePeriod,
+		ExpiredGracePeriod:    DefaultExpiredGracePeriod,
+		DeleteInterval:        DefaultSweepDeleteInterval,
+		ClaimLeaseExpireAfter: DefaultSweepClaimLeaseExpireAfter,
+	}
+}
+
+// 检查清理器的参数配置是否正确
+func checkSweeperOptions(options *SweeperOptions) error {
+	if options.TombstoneGracePeriod < 0 || options.ExpiredGracePeriod < 0 {
+		return ErrSweepGracePeriodInvalid
+	}
+	if options.Interval <= 0 {
+		options.Interval = DefaultSweepInterval
+	}
+	if options.ClaimLeaseExpireAfter <= 0 {
+		options.ClaimLeaseExpireAfter = DefaultSweepClaimLeaseExpireAfter
+	}
+	return nil
+}
+
+func (x *SweeperOptions) SetInterval(interval time.Duration) *SweeperOptions {
+	x.Interval = interval
+	return x
+}
+
+func (x *SweeperOptions) SetDeleteTombstones(deleteTombstones bool) *SweeperOptions {
+	x.DeleteTombstones = deleteTombstones
+	return x
+}
+
+func (x *SweeperOptions) SetTombstoneGracePeriod(tombstoneGracePeriod time.Duration) *SweeperOptions {
+	x.TombstoneGracePeriod = tombstoneGracePeriod
+	return x
+}
+
+func (x *SweeperOptions) SetExpiredGracePeriod(expiredGracePeriod time.Duration) *SweeperOptions {
+	x.ExpiredGracePeriod = expiredGracePeriod
+	return x
+}
+
+func (x *SweeperOptions) SetDeleteInterval(deleteInterval time.Duration) *SweeperOptions {
+	x.DeleteInterval = deleteInterval
+	return x
+}
+
+func (x *SweeperOptions) SetMaxDeletesPerSweep(maxDeletesPerSweep int) *SweeperOptions {
+	x.MaxDeletesPerSweep = maxDeletesPerSweep
+	return x
+}
+
+func (x *SweeperOptions) SetClaimLeaseExpireAfter(claimLeaseExpireAfter time.Duration) *SweeperOptions {
+	x.ClaimLeaseExpireAfter = claimLeaseExpireAfter
+	return x
+}
+
+func (x *SweeperOptions) SetTimeProvider(timeProvider go_storage.TimeProvider) *SweeperOptions {
+	x.TimeProvider = timeProvider
+	return x
+}
+
+func (x *SweeperOptions) SetSigningKey(signingKey []byte) *SweeperOptions {
+	x.SigningKey = signingKey
+	return x
+}
+
+func (x *SweeperOptions) SetEventListeners(eventListeners []events.Listener) *SweeperOptions {
+	x.EventListeners = eventListeners
+	return x
+}
+
+func (x *SweeperOptions) AddEventListeners(eventListener events.Listener) *SweeperOptions {
+	x.EventListeners = append(x.EventListeners, eventListener)
+	return x
+}
+
+func (x *SweeperOptions) SetClock(clock Clock) *SweeperOptions {
+	x.Clock = clock
+	return x
+}
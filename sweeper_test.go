@@ -0,0 +1,206 @@
+package storage_lock_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-storage"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/fake_clock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/storage-lock/go-storage-lock/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSweeper(t *testing.T, s storage.Storage, options *storage_lock.SweeperOptions) *storage_lock.Sweeper {
+	sweeper, err := storage_lock.NewSweeperWithOptions(s, options.SetDeleteInterval(0))
+	assert.Nil(t, err)
+	return sweeper
+}
+
+// 直接往存储中写入一条租约已经过期了 expiredFor 的锁记录
+func createTestExpiredRecord(t *testing.T, s storage.Storage, lockId string, expiredFor time.Duration) {
+	information := storagetest.NewTestLockInformation()
+	information.LockId = lockId
+	information.LeaseExpireTime = time.Now().Add(-expiredFor)
+	assert.Nil(t, s.CreateWithVersion(context.Background(), lockId, information.Version, information))
+}
+
+func assertTestRecordExists(t *testing.T, s storage.Storage, lockId string, exists bool) {
+	_, err := s.Get(context.Background(), lockId)
+	if exists {
+		assert.Nil(t, err)
+	} else {
+		assert.ErrorIs(t, err, storage_lock.ErrLockNotFound)
+	}
+}
+
+// 不支持原子删除的存储上释放锁留下的墓碑会被清理掉，清理之后锁可以正常的获取
+func TestSweeper_Tombstones(t *testing.T) {
+	ctx := context.Background()
+	s := memory_storage.NewMemoryStorageWithOptions(memory_storage.NewMemoryStorageOptions().SetDisableAtomicDelete(true))
+	lockIds := []string{"test-sweeper-tombstone-1", "test-sweeper-tombstone-2", "test-sweeper-tombstone-3"}
+	for _, lockId := range lockIds {
+		lock, err := storage_lock.NewStorageLock(s, lockId)
+		assert.Nil(t, err)
+		assert.Nil(t, lock.Lock(ctx, "owner"))
+		assert.Nil(t, lock.UnLock(ctx, "owner"))
+		assertTestRecordExists(t, s, lockId, true)
+	}
+
+	// 默认不清理墓碑，墓碑上保存着版本号
+	result, err := newTestSweeper(t, s, storage_lock.NewSweeperOptions().SetTombstoneGracePeriod(0)).Sweep(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, result.Scanned)
+	assert.Equal(t, 0, result.Deleted())
+
+	// 还在宽限期内的墓碑不会被清理
+	result, err = newTestSweeper(t, s, storage_lock.NewSweeperOptions().SetDeleteTombstones(true)).Sweep(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, result.Scanned)
+	assert.Equal(t, 0, result.Deleted())
+
+	result, err = newTestSweeper(t, s, storage_lock.NewSweeperOptions().SetDeleteTombstones(true).SetTombstoneGracePeriod(0)).Sweep(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, result.Tombstones)
+	for _, lockId := range lockIds {
+		assertTestRecordExists(t, s, lockId, false)
+	}
+
+	lock, err := storage_lock.NewStorageLock(s, lockIds[0])
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+}
+
+// 过期超过宽限期的锁被清理，持有中的锁和刚过期的锁不受影响
+func TestSweeper_Expired(t *testing.T) {
+	ctx := context.Background()
+	for _, disableAtomicDelete := range []bool{false, true} {
+		s := memory_storage.NewMemoryStorageWithOptions(memory_storage.NewMemoryStorageOptions().SetDisableAtomicDelete(disableAtomicDelete))
+		createTestExpiredRecord(t, s, "test-sweeper-abandoned", time.Hour*2)
+		createTestExpiredRecord(t, s, "test-sweeper-recently-expired", time.Minute)
+		lock, err := storage_lock.NewStorageLock(s, "test-sweeper-held")
+		assert.Nil(t, err)
+		assert.Nil(t, lock.Lock(ctx, "owner"))
+
+		result, err := newTestSweeper(t, s, storage_lock.NewSweeperOptions()).Sweep(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, result.Expired)
+		assertTestRecordExists(t, s, "test-sweeper-abandoned", false)
+		assertTestRecordExists(t, s, "test-sweeper-recently-expired", true)
+
+		// 持有中的锁的记录没有被动过，可以正常的释放
+		assert.Nil(t, lock.UnLock(ctx, "owner"))
+	}
+}
+
+// 一次清理最多删除 MaxDeletesPerSweep 条，剩下的留给下一次
+func TestSweeper_MaxDeletesPerSweep(t *testing.T) {
+	ctx := context.Background()
+	s := memory_storage.NewMemoryStorage()
+	for _, lockId := range []string{"test-sweeper-max-1", "test-sweeper-max-2", "test-sweeper-max-3"} {
+		createTestExpiredRecord(t, s, lockId, time.Hour*2)
+	}
+
+	sweeper := newTestSweeper(t, s, storage_lock.NewSweeperOptions().SetMaxDeletesPerSweep(2))
+	result, err := sweeper.Sweep(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Deleted())
+	result, err = sweeper.Sweep(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, result.Deleted())
+}
+
+// 会话模式下的锁记录只有在会话失效之后才会被清理
+func TestSweeper_Session(t *testing.T) {
+	ctx := context.Background()
+	s := memory_storage.NewMemoryStorage()
+	session, err := storage_lock.NewSession(ctx, s, storage_lock.NewSessionOptions().SetLeaseExpireAfter(time.Second*3).SetLeaseRefreshInterval(time.Second))
+	assert.Nil(t, err)
+	lock := newTestSessionLock(t, s, "test-sweeper-session-lock", session)
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+
+	sweeper := newTestSweeper(t, s, storage_lock.NewSweeperOptions().SetExpiredGracePeriod(0))
+	result, err := sweeper.Sweep(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, result.Deleted())
+
+	// 会话关闭之后会话下的锁变成了被遗弃的锁
+	assert.Nil(t, session.Close(ctx))
+	time.Sleep(time.Second * 3)
+	result, err = sweeper.Sweep(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, result.Expired)
+	assertTestRecordExists(t, s, "test-sweeper-session-lock", false)
+}
+
+// 后台定期清理
+func TestSweeper_StartStop(t *testing.T) {
+	s := memory_storage.NewMemoryStorage()
+	recorder := newTestActionRecorder()
+	options := storage_lock.NewSweeperOptions().SetInterval(time.Millisecond * 10).AddEventListeners(recorder.listener())
+	sweeper := newTestSweeper(t, s, options)
+	sweeper.Start()
+
+	createTestExpiredRecord(t, s, "test-sweeper-background", time.Hour*2)
+	assert.Eventually(t, func() bool {
+		_, err := s.Get(context.Background(), "test-sweeper-background")
+		return err != nil
+	}, time.Second*3, time.Millisecond*10)
+
+	assert.Nil(t, sweeper.Stop(context.Background()))
+	assert.Equal(t, 1, recorder.count(storage_lock.ActionSweepDeleteSuccess))
+	assert.Equal(t, 1, recorder.count(storage_lock.ActionSweeperExit))
+}
+
+// 删除总是失败的存储，清理器持有记录之后删不掉
+type testUndeletableStorage struct {
+	*memory_storage.MemoryStorage
+}
+
+func (x *testUndeletableStorage) DeleteWithVersion(ctx context.Context, lockId string, exceptedVersion storage.Version, lockInformation *storage.LockInformation) error {
+	return errors.New("test delete error")
+}
+
+// 配置了签名密钥的清理器持有记录时写入的记录带有签名，伪造的记录不会被清理
+func TestSweeper_Signing(t *testing.T) {
+	ctx := context.Background()
+	clock := fake_clock.NewFakeClock()
+	memoryStorage := memory_storage.NewMemoryStorageWithOptions(memory_storage.NewMemoryStorageOptions().SetDisableAtomicDelete(true).SetNowFunc(clock.Now))
+	s := &testUndeletableStorage{MemoryStorage: memoryStorage}
+	key := []byte("test-key")
+	lockOptions := storage_lock.NewStorageLockOptionsWithLockId("test-sweeper-signing").
+		SetLeaseExpireAfter(time.Second * 3).
+		SetLeaseRefreshInterval(time.Second).
+		SetSigningKey(key).
+		SetClock(clock)
+	lock, err := storage_lock.NewStorageLockWithOptions(s, lockOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+	assert.Nil(t, lock.CurrentWatchDog().Stop(ctx))
+
+	// 伪造一条没有签名的过期记录
+	forged := storagetest.NewTestLockInformation()
+	forged.LockId = "test-sweeper-forged"
+	forged.LeaseExpireTime = clock.Now()
+	assert.Nil(t, s.CreateWithVersion(ctx, forged.LockId, forged.Version, forged))
+
+	clock.Advance(time.Second * 4)
+	options := storage_lock.NewSweeperOptions().
+		SetExpiredGracePeriod(0).
+		SetClaimLeaseExpireAfter(time.Second).
+		SetSigningKey(key)
+	result, err := newTestSweeper(t, s, options).Sweep(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, result.Deleted())
+	assert.Equal(t, 2, result.Failed)
+	assertTestRecordExists(t, s, forged.LockId, true)
+
+	// 删除失败留下的是签名正确的短租约记录，过期之后锁照常可以获取
+	clock.Advance(time.Second * 2)
+	assert.Nil(t, lock.Lock(ctx, "other-owner"))
+	assert.Nil(t, lock.UnLock(ctx, "other-owner"))
+}
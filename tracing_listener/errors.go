@@ -0,0 +1,12 @@
+package tracing_listener
+
+import "errors"
+
+var (
+
+	// ErrTraceparentInvalid W3C Trace Context 的 traceparent 格式不对
+	ErrTraceparentInvalid = errors.New("traceparent invalid")
+
+	// ErrLockTimeout 获取锁直到 ctx 结束也没有成功，用作 Lock 的 span 的错误
+	ErrLockTimeout = errors.New("lock timeout")
+)
@@ -0,0 +1,174 @@
+package tracing_listener
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID 一条链路的ID，与 W3C Trace Context 一样是 16 个字节
+type TraceID [16]byte
+
+func (x TraceID) IsValid() bool {
+	return x != TraceID{}
+}
+
+func (x TraceID) String() string {
+	return hex.EncodeToString(x[:])
+}
+
+// SpanID 一个 span 的ID，与 W3C Trace Context 一样是 8 个字节
+type SpanID [8]byte
+
+func (x SpanID) IsValid() bool {
+	return x != SpanID{}
+}
+
+func (x SpanID) String() string {
+	return hex.EncodeToString(x[:])
+}
+
+// SpanContext 标识链路中的一个 span，调用方把自己的 SpanContext 放到 ctx 中传给 Lock/UnLock，锁的 span 就会挂在它下面
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+}
+
+func (x SpanContext) IsValid() bool {
+	return x.TraceID.IsValid() && x.SpanID.IsValid()
+}
+
+// Traceparent 格式化为 W3C Trace Context 的 traceparent，方便继续往下游传递
+func (x SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", x.TraceID, x.SpanID)
+}
+
+// ParseTraceparent 解析 W3C Trace Context 的 traceparent，比如从 HTTP 请求头中取出调用方的 SpanContext
+func ParseTraceparent(traceparent string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, fmt.Errorf("%w: %s", ErrTraceparentInvalid, traceparent)
+	}
+	var spanContext SpanContext
+	if _, err := hex.Decode(spanContext.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, fmt.Errorf("%w: %s", ErrTraceparentInvalid, traceparent)
+	}
+	if _, err := hex.Decode(spanContext.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, fmt.Errorf("%w: %s", ErrTraceparentInvalid, traceparent)
+	}
+	if !spanContext.IsValid() {
+		return SpanContext{}, fmt.Errorf("%w: %s", ErrTraceparentInvalid, traceparent)
+	}
+	return spanContext, nil
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext 把调用方的 SpanContext 放到 ctx 中
+func ContextWithSpanContext(ctx context.Context, spanContext SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, spanContext)
+}
+
+// SpanContextFromContext 从 ctx 中取出调用方的 SpanContext
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if ctx == nil {
+		return SpanContext{}, false
+	}
+	spanContext, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return spanContext, ok && spanContext.IsValid()
+}
+
+// ------------------------------------------------- --------------------------------------------------------------------
+
+// Span 由事件树转换出来的一个 span
+type Span struct {
+	Name        string
+	SpanContext SpanContext
+
+	// 父 span，链路的根 span 的父 span 是调用方放在 ctx 中的 SpanContext，没有的话是零值
+	Parent SpanContext
+
+	StartTime time.Time
+	EndTime   time.Time
+
+	// lockId、ownerId、version、storageName 等属性
+	Attributes map[string]any
+
+	// span 期间发生的 action
+	Events []*SpanEvent
+
+	// span 失败的原因，成功的话为 nil
+	Err error
+}
+
+// Duration span 持续了多久
+func (x *Span) Duration() time.Duration {
+	return x.EndTime.Sub(x.StartTime)
+}
+
+// SpanEvent span 期间发生的一个 action
+type SpanEvent struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]any
+	Err        error
+}
+
+// SpanExporter 接收转换好的 span，可以在这里把 span 转交给 OpenTelemetry 之类的链路追踪系统
+type SpanExporter interface {
+
+	// ExportSpan 每个 span 结束的时候调用一次，在发布事件的协程中同步执行，不要在里面做耗时的操作
+	ExportSpan(ctx context.Context, span *Span)
+}
+
+// InMemoryExporter 把 span 保存在内存中的导出器，主要用于测试
+type InMemoryExporter struct {
+	mutex sync.Mutex
+	spans []*Span
+}
+
+var _ SpanExporter = &InMemoryExporter{}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (x *InMemoryExporter) ExportSpan(ctx context.Context, span *Span) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.spans = append(x.spans, span)
+}
+
+// Spans 按照结束的先后返回所有导出过的 span
+func (x *InMemoryExporter) Spans() []*Span {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return append([]*Span(nil), x.spans...)
+}
+
+// Reset 清空导出过的 span
+func (x *InMemoryExporter) Reset() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.spans = nil
+}
+
+// 事件的ID是随机生成的，由它推导出 span 的ID，同一个事件总是对应同一个 span
+func spanIDFromEventID(eventID string) SpanID {
+	var spanID SpanID
+	sum := sha256.Sum256([]byte(eventID))
+	copy(spanID[:], sum[:])
+	return spanID
+}
+
+// 调用方没有传递 SpanContext 的时候由事件树的根事件的ID推导出链路的ID
+func traceIDFromRootID(rootID string) TraceID {
+	var traceID TraceID
+	sum := sha256.Sum256([]byte(rootID))
+	copy(traceID[:], sum[:])
+	return traceID
+}
@@ -0,0 +1,313 @@
+package tracing_listener
+
+import (
+	"context"
+	"github.com/storage-lock/go-events"
+	"github.com/storage-lock/go-storage"
+	storage_events "github.com/storage-lock/go-storage-events"
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"sync"
+	"time"
+)
+
+// TracingListener 把事件树转换为链路追踪的 span 的监听器
+//
+// 事件每次 Fork 都会形成一棵父子关系的树，正好就是一棵 span 树，但是每个 Fork 出来的事件通常只带一个瞬时的 action，
+// 都转换成 span 的话一次 Lock 就会有几十个没有时长的 span。所以只有下面这些有实际时长的事件会成为 span：
+//   - Lock、UnLock、Transfer 的根事件，从开始一直持续到 ActionLockFinish、ActionUnlockFinish、ActionTransferFinish
+//   - 看门狗的事件，从创建一直持续到 ActionWatchDogExit，它是获取到锁的那次 Lock 的 span 的子 span
+//   - 看门狗的每次续租，从开始续租一直持续到续租的事件被发布
+//
+// 其它的事件中的 action 作为 span event 挂到离它最近的 span 上。不属于上面任何一种的事件树（比如 AcceptTransfer、清理器）
+// 每个被发布的事件单独成为一个 span。
+//
+// 调用方通过 ContextWithSpanContext 把自己的 SpanContext 放到 ctx 中传给 Lock/UnLock 的话，锁的 span 会挂在调用方的 span 下面：
+//
+//	listener := tracing_listener.NewTracingListener(exporter)
+//	options := storage_lock.NewStorageLockOptionsWithLockId(lockId).AddEventListeners(listener)
+//	...
+//	err := lock.Lock(tracing_listener.ContextWithSpanContext(ctx, spanContext), ownerId)
+type TracingListener struct {
+	options *TracingListenerOptions
+
+	mutex sync.Mutex
+
+	// 还没有结束的 span，key 是对应的事件的ID
+	openSpans map[string]*Span
+
+	// 最近结束的 span，结束之后才发布的事件（比如看门狗退出之后才发布的停止事件）仍然能挂到它们下面，而不是重新打开
+	closedSpans     map[string]SpanContext
+	closedSpanOrder []string
+}
+
+var _ events.Listener = &TracingListener{}
+
+// TracingListenerName 链路追踪监听器的名字
+const TracingListenerName = "storage-lock-tracing-listener"
+
+// span 的属性的名字
+const (
+	AttributeLockId      = "lockId"
+	AttributeOwnerId     = "ownerId"
+	AttributeVersion     = "version"
+	AttributeStorageName = "storageName"
+	AttributeWatchDogId  = "watchDogId"
+)
+
+// NewTracingListener 使用默认选项创建链路追踪监听器，span 结束的时候交给给定的导出器
+func NewTracingListener(exporter SpanExporter) *TracingListener {
+	return NewTracingListenerWithOptions(NewTracingListenerOptions().SetExporter(exporter))
+}
+
+// NewTracingListenerWithOptions 使用给定的选项创建链路追踪监听器
+func NewTracingListenerWithOptions(options *TracingListenerOptions) *TracingListener {
+	if options.MaxClosedSpans <= 0 {
+		options.MaxClosedSpans = DefaultMaxClosedSpans
+	}
+	return &TracingListener{
+		options:     options,
+		openSpans:   make(map[string]*Span),
+		closedSpans: make(map[string]SpanContext),
+	}
+}
+
+func (x *TracingListener) Name() string {
+	return TracingListenerName
+}
+
+func (x *TracingListener) On(ctx context.Context, e *events.Event) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	span, parent, spanEventId := x.enclosingSpan(ctx, e)
+
+	// 不在任何一个有时长的 span 中，被发布的事件单独成为一个 span
+	if span == nil {
+		standalone := x.newSpan(e, parent)
+		x.addActions(standalone, e, true)
+		standalone.EndTime = eventEndTime(e)
+		x.export(ctx, standalone)
+		return
+	}
+
+	x.updateAttributes(span, e)
+	own := spanEventId == e.ID
+	x.addActions(span, e, own)
+
+	// 续租的事件是在续租结束的时候才发布的
+	if own && isRefreshEvent(e) {
+		span.EndTime = eventEndTime(e)
+		x.closeSpan(ctx, spanEventId, span)
+		return
+	}
+
+	// 子事件中带着 span 的结束的 action
+	for _, action := range e.Actions {
+		if isSpanEndAction(action.Name) {
+			span.EndTime = actionTime(action)
+			x.closeSpan(ctx, spanEventId, span)
+			return
+		}
+	}
+}
+
+// 找到包围给定的事件的最近的 span，需要的话沿途打开还没打开的 span，返回这个 span 和它对应的事件的ID；
+// 没有的话返回的 parent 是新的独立 span 应该挂在下面的 span
+func (x *TracingListener) enclosingSpan(ctx context.Context, e *events.Event) (*Span, SpanContext, string) {
+
+	// 从下往上找到第一个已经打开或者已经结束的 span
+	var span *Span
+	var spanEventId string
+	var parent SpanContext
+	chain := make([]*events.Event, 0)
+	for current := e; current != nil; current = current.Parent {
+		if openSpan, exists := x.openSpans[current.ID]; exists {
+			span, spanEventId, parent = openSpan, current.ID, openSpan.SpanContext
+			break
+		}
+		if closedSpan, exists := x.closedSpans[current.ID]; exists {
+			parent = closedSpan
+			break
+		}
+		chain = append(chain, current)
+	}
+
+	// 一直找到了根事件的话，挂在调用方的 span 下面
+	if !parent.IsValid() {
+		if spanContext, ok := SpanContextFromContext(ctx); ok {
+			parent = spanContext
+		}
+	}
+	if !parent.TraceID.IsValid() {
+		parent.TraceID = traceIDFromRootID(e.RootID)
+	}
+
+	// 从上往下打开中间经过的有时长的 span
+	for index := len(chain) - 1; index >= 0; index-- {
+		current := chain[index]
+		if !isSpanEvent(current) {
+			continue
+		}
+		span = x.newSpan(current, parent)
+		spanEventId = current.ID
+		x.openSpans[current.ID] = span
+		parent = span.SpanContext
+	}
+	return span, parent, spanEventId
+}
+
+func (x *TracingListener) newSpan(e *events.Event, parent SpanContext) *Span {
+	span := &Span{
+		Name: spanName(e),
+		SpanContext: SpanContext{
+			TraceID: parent.TraceID,
+			SpanID:  spanIDFromEventID(e.ID),
+		},
+		Attributes: make(map[string]any),
+	}
+	if parent.SpanID.IsValid() {
+		span.Parent = parent
+	}
+	if e.StartTime != nil {
+		span.StartTime = *e.StartTime
+	}
+	x.updateAttributes(span, e)
+	return span
+}
+
+// 事件上的属性补充到 span 上，同一个 span 中后面的事件可能带着更新的信息，比如获取到锁之后才有的版本号和看门狗ID
+func (x *TracingListener) updateAttributes(span *Span, e *events.Event) {
+	setAttribute(span, AttributeLockId, e.LockId)
+	setAttribute(span, AttributeOwnerId, e.OwnerId)
+	setAttribute(span, AttributeStorageName, e.StorageName)
+	setAttribute(span, AttributeWatchDogId, e.WatchDogId)
+	if e.LockInformation != nil {
+		span.Attributes[AttributeVersion] = e.LockInformation.Version
+	}
+	for _, action := range e.Actions {
+		if payload, exists := action.GetPayload(storage_events.PayloadLockInformation); exists {
+			if lockInformation, ok := payload.(*storage.LockInformation); ok && lockInformation != nil {
+				span.Attributes[AttributeVersion] = lockInformation.Version
+			}
+		}
+	}
+}
+
+// 事件中的 action 作为 span event 挂到 span 上，own 表示事件本身就是这个 span
+func (x *TracingListener) addActions(span *Span, e *events.Event, own bool) {
+	for _, action := range e.Actions {
+		spanEvent := &SpanEvent{
+			Name: action.Name,
+			Time: actionTime(action),
+			Err:  action.Err,
+		}
+		if len(action.PayloadMap) != 0 {
+			spanEvent.Attributes = make(map[string]any, len(action.PayloadMap))
+			for key, value := range action.PayloadMap {
+				spanEvent.Attributes[key] = value
+			}
+		}
+		span.Events = append(span.Events, spanEvent)
+
+		// 自己的 action 出错就是 span 出错，子事件中只有表示最终结果的 action 才决定 span 的成败，中途的重试不算
+		switch {
+		case action.Name == storage_lock.ActionTimeout && e.EventType == events.EventTypeLock:
+			span.Err = ErrLockTimeout
+		case action.Err != nil && (own || isSpanErrorAction(action.Name)):
+			span.Err = action.Err
+		}
+	}
+}
+
+// 结束并导出 span，记住它结束了，防止之后的事件又把它打开
+func (x *TracingListener) closeSpan(ctx context.Context, eventId string, span *Span) {
+	delete(x.openSpans, eventId)
+	x.closedSpans[eventId] = span.SpanContext
+	x.closedSpanOrder = append(x.closedSpanOrder, eventId)
+	if len(x.closedSpanOrder) > x.options.MaxClosedSpans {
+		delete(x.closedSpans, x.closedSpanOrder[0])
+		x.closedSpanOrder = x.closedSpanOrder[1:]
+	}
+	x.export(ctx, span)
+}
+
+func (x *TracingListener) export(ctx context.Context, span *Span) {
+	if x.options.Exporter != nil {
+		x.options.Exporter.ExportSpan(ctx, span)
+	}
+}
+
+// ------------------------------------------------- --------------------------------------------------------------------
+
+// 是否是有时长的事件
+func isSpanEvent(e *events.Event) bool {
+	if e.Parent == nil && (e.EventType == events.EventTypeLock || e.EventType == events.EventTypeUnlock || hasAction(e, storage_lock.ActionTransferBegin)) {
+		return true
+	}
+	return hasAction(e, storage_lock.ActionWatchDogCreate) || isRefreshEvent(e)
+}
+
+func isRefreshEvent(e *events.Event) bool {
+	return hasAction(e, storage_lock.ActionWatchDogRefresh)
+}
+
+func isSpanEndAction(name string) bool {
+	switch name {
+	case storage_lock.ActionLockFinish, storage_lock.ActionUnlockFinish, storage_lock.ActionTransferFinish, storage_lock.ActionWatchDogExit:
+		return true
+	default:
+		return false
+	}
+}
+
+// 子事件中表示 span 最终失败的 action
+func isSpanErrorAction(name string) bool {
+	switch name {
+	case storage_lock.ActionLockError, storage_lock.ActionUnlockError, storage_lock.ActionTransferError, storage_lock.ActionNotLockOwner:
+		return true
+	default:
+		return false
+	}
+}
+
+func spanName(e *events.Event) string {
+	switch {
+	case e.Parent == nil && e.EventType == events.EventTypeLock:
+		return "StorageLock.Lock"
+	case e.Parent == nil && e.EventType == events.EventTypeUnlock:
+		return "StorageLock.UnLock"
+	case len(e.Actions) != 0:
+		return e.Actions[0].Name
+	default:
+		return "StorageLock.Event"
+	}
+}
+
+func setAttribute(span *Span, key, value string) {
+	if value != "" {
+		span.Attributes[key] = value
+	}
+}
+
+func hasAction(e *events.Event, name string) bool {
+	for _, action := range e.Actions {
+		if action.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func actionTime(action *events.Action) time.Time {
+	if action.StartTime != nil {
+		return *action.StartTime
+	}
+	return time.Now()
+}
+
+func eventEndTime(e *events.Event) time.Time {
+	if e.EndTime != nil {
+		return *e.EndTime
+	}
+	return time.Now()
+}
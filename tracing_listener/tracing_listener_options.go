@@ -0,0 +1,31 @@
+package tracing_listener
+
+// DefaultMaxClosedSpans 默认最多记住多少个最近结束的 span
+const DefaultMaxClosedSpans = 4096
+
+// TracingListenerOptions 创建链路追踪监听器（TracingListener）的相关选项
+type TracingListenerOptions struct {
+
+	// span 结束的时候交给它导出
+	Exporter SpanExporter
+
+	// 最多记住多少个最近结束的 span，span 结束之后才发布的子事件仍然能挂到它下面
+	MaxClosedSpans int
+}
+
+// NewTracingListenerOptions 使用默认值创建链路追踪监听器的选项
+func NewTracingListenerOptions() *TracingListenerOptions {
+	return &TracingListenerOptions{
+		MaxClosedSpans: DefaultMaxClosedSpans,
+	}
+}
+
+func (x *TracingListenerOptions) SetExporter(exporter SpanExporter) *TracingListenerOptions {
+	x.Exporter = exporter
+	return x
+}
+
+func (x *TracingListenerOptions) SetMaxClosedSpans(maxClosedSpans int) *TracingListenerOptions {
+	x.MaxClosedSpans = maxClosedSpans
+	return x
+}
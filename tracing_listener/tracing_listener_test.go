@@ -0,0 +1,150 @@
+package tracing_listener
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	storage_lock "github.com/storage-lock/go-storage-lock"
+	"github.com/storage-lock/go-storage-lock/fake_clock"
+	"github.com/storage-lock/go-storage-lock/memory_storage"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTracingLockId = "test-tracing-lock"
+
+func newTestTracingLock(t *testing.T, s *memory_storage.MemoryStorage, clock storage_lock.Clock, listener *TracingListener) *storage_lock.StorageLock {
+	options := storage_lock.NewStorageLockOptionsWithLockId(testTracingLockId).
+		SetLeaseExpireAfter(time.Second * 30).
+		SetLeaseRefreshInterval(time.Second * 10).
+		SetVersionMissRetryInterval(time.Millisecond * 10).
+		AddEventListeners(listener)
+	if clock != nil {
+		options.SetClock(clock)
+	}
+	lock, err := storage_lock.NewStorageLockWithOptions(s, options)
+	assert.Nil(t, err)
+	return lock
+}
+
+func findSpans(exporter *InMemoryExporter, name string) []*Span {
+	spans := make([]*Span, 0)
+	for _, span := range exporter.Spans() {
+		if span.Name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func waitSpans(t *testing.T, exporter *InMemoryExporter, name string, n int) []*Span {
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		if spans := findSpans(exporter, name); len(spans) >= n {
+			return spans
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("span %s not exported", name)
+	return nil
+}
+
+func TestTracingListener_LockTree(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	listener := NewTracingListener(exporter)
+	clock := fake_clock.NewFakeClock()
+	s := memory_storage.NewMemoryStorageWithOptions(memory_storage.NewMemoryStorageOptions().SetNowFunc(clock.Now))
+	lock := newTestTracingLock(t, s, clock, listener)
+
+	caller, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.Nil(t, err)
+	ctx := ContextWithSpanContext(context.Background(), caller)
+
+	assert.Nil(t, lock.Lock(ctx, "owner"))
+
+	// 看门狗续租一次
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	assert.True(t, clock.BlockUntil(timeoutCtx, 1))
+	clock.Advance(time.Second)
+	refreshSpans := waitSpans(t, exporter, storage_lock.ActionWatchDogRefresh, 1)
+
+	assert.Nil(t, lock.UnLock(ctx, "owner"))
+	watchDogSpans := waitSpans(t, exporter, storage_lock.ActionWatchDogCreate, 1)
+
+	// Lock 的 span 挂在调用方的 span 下面
+	lockSpans := findSpans(exporter, "StorageLock.Lock")
+	assert.Len(t, lockSpans, 1)
+	lockSpan := lockSpans[0]
+	assert.Equal(t, caller.TraceID, lockSpan.SpanContext.TraceID)
+	assert.Equal(t, caller, lockSpan.Parent)
+	assert.Nil(t, lockSpan.Err)
+	assert.False(t, lockSpan.EndTime.Before(lockSpan.StartTime))
+	assert.Equal(t, testTracingLockId, lockSpan.Attributes[AttributeLockId])
+	assert.Equal(t, "owner", lockSpan.Attributes[AttributeOwnerId])
+	assert.Equal(t, s.GetName(), lockSpan.Attributes[AttributeStorageName])
+	assert.NotNil(t, lockSpan.Attributes[AttributeVersion])
+	assert.NotEmpty(t, lockSpan.Attributes[AttributeWatchDogId])
+	assert.Equal(t, storage_lock.ActionLockBegin, lockSpan.Events[0].Name)
+	assert.Equal(t, storage_lock.ActionLockFinish, lockSpan.Events[len(lockSpan.Events)-1].Name)
+
+	// 看门狗是 Lock 的子 span，续租是看门狗的子 span，看门狗退出之后才结束
+	watchDogSpan := watchDogSpans[0]
+	assert.Equal(t, lockSpan.SpanContext, watchDogSpan.Parent)
+	assert.Equal(t, watchDogSpan.SpanContext, refreshSpans[0].Parent)
+	assert.Equal(t, caller.TraceID, refreshSpans[0].SpanContext.TraceID)
+	assert.Nil(t, refreshSpans[0].Err)
+	assert.Equal(t, storage_lock.ActionWatchDogExit, watchDogSpan.Events[len(watchDogSpan.Events)-1].Name)
+
+	// UnLock 是单独的一棵树，同样挂在调用方的 span 下面
+	unlockSpans := findSpans(exporter, "StorageLock.UnLock")
+	assert.Len(t, unlockSpans, 1)
+	assert.Equal(t, caller, unlockSpans[0].Parent)
+	assert.Nil(t, unlockSpans[0].Err)
+
+	assert.Empty(t, listener.openSpans)
+}
+
+func TestTracingListener_LockTimeout(t *testing.T) {
+	ctx := context.Background()
+	exporter := NewInMemoryExporter()
+	listener := NewTracingListener(exporter)
+	s := memory_storage.NewMemoryStorage()
+	holder := newTestTracingLock(t, s, nil, listener)
+	waiter := newTestTracingLock(t, s, nil, listener)
+
+	assert.Nil(t, holder.Lock(ctx, "holder"))
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+	defer cancel()
+	assert.NotNil(t, waiter.Lock(timeoutCtx, "waiter"))
+	assert.Nil(t, holder.UnLock(ctx, "holder"))
+
+	lockSpans := findSpans(exporter, "StorageLock.Lock")
+	assert.Len(t, lockSpans, 2)
+	assert.Nil(t, lockSpans[0].Err)
+	assert.ErrorIs(t, lockSpans[1].Err, ErrLockTimeout)
+	assert.Equal(t, "waiter", lockSpans[1].Attributes[AttributeOwnerId])
+
+	// 没有调用方的 span 的时候各自是一条新的链路
+	assert.False(t, lockSpans[0].Parent.IsValid())
+	assert.NotEqual(t, lockSpans[0].SpanContext.TraceID, lockSpans[1].SpanContext.TraceID)
+}
+
+func TestParseTraceparent(t *testing.T) {
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	spanContext, err := ParseTraceparent(traceparent)
+	assert.Nil(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spanContext.TraceID.String())
+	assert.Equal(t, traceparent, spanContext.Traceparent())
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceparent(invalid)
+		assert.ErrorIs(t, err, ErrTraceparentInvalid, invalid)
+	}
+}
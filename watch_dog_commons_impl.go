@@ -49,6 +49,12 @@ type WatchDogCommonsImpl struct {
 	// 存储调用立刻返回，goroutine 迅速从 refreshLeaseExpiredTime 返回并在下次 select 命中 stop 退出。
 	runCtx    context.Context
 	runCancel context.CancelFunc
+
+	// leaseDeadline 最近一次确认过的租约截止时间，用本地单调时钟表示，只在看门狗 goroutine 内读写
+	// 进程被 GC 停顿、SIGSTOP 等冻结超过租约时，醒来时的本地时间会越过它，说明租约在持有者无感知的情况下断档了
+	leaseDeadline time.Time
+	// 已经为哪个截止时间上报过断档，同一段断档只上报一次
+	violationReportedDeadline time.Time
 }
 
 // WatchDogIDPrefix 看门狗协程分配的ID
@@ -57,7 +63,8 @@ const WatchDogIDPrefix = "storage-lock-watch-dog-"
 var _ WatchDog = &WatchDogCommonsImpl{}
 
 // NewWatchDogCommonsImpl 创建一只看门狗
-func NewWatchDogCommonsImpl(ctx context.Context, e *events.Event, lock *StorageLock, ownerId string) *WatchDogCommonsImpl {
+// leaseStart 是当前租约开始时对应的本地时间，通常传 StorageLock.LeaseStartTime()，零值表示不知道，第一次续租成功之前不检查租约断档
+func NewWatchDogCommonsImpl(ctx context.Context, e *events.Event, lock *StorageLock, ownerId string, leaseStart time.Time) *WatchDogCommonsImpl {
 
 	// 为看门狗协程生成一个唯一ID
 	lockId := lock.options.LockId
@@ -79,6 +86,10 @@ func NewWatchDogCommonsImpl(ctx context.Context, e *events.Event, lock *StorageL
 		storageLock: lock,
 		ownerId:     ownerId,
 	}
+	// 租约是按写入之前读到的存储时间计算的，用读取之前的本地时间作为起点，算出来的截止时间只会偏早
+	if !leaseStart.IsZero() {
+		wd.leaseDeadline = leaseStart.Add(lock.effectiveLeaseExpireAfter())
+	}
 	// e 用 atomic.Pointer，构造后单独 Store（结构体字面量无法直接赋 atomic 类型）
 	wd.e.Store(e)
 	return wd
@@ -136,13 +147,17 @@ func (x *WatchDogCommonsImpl) Start(ctx context.Context) error {
 			needSleep = time.Second
 		}
 		// 使用 select 监听 stop channel，使 Stop 能立即唤醒此 sleep，避免 UnLock 阻塞
+		// 休眠用同一个定时器，退出的时候停掉，不在时钟上留下没人等的定时器
+		timer := x.storageLock.clock().NewTimer(needSleep)
+		defer timer.Stop()
 		select {
 		case <-x.stop:
 			// Stop 已经被调用，直接退出
 			return
-		case <-time.After(needSleep):
+		case <-timer.C():
 			// 正常唤醒，继续刷新
 		}
+		x.checkLeaseContinuity(x.storageLock.clock().Now())
 
 		for x.isRunning.Load() {
 
@@ -153,7 +168,7 @@ func (x *WatchDogCommonsImpl) Start(ctx context.Context) error {
 			x.e.Load().Fork().AddAction(refreshBeginAction).Publish(context.Background())
 
 			// 调用刷新的方法进行一次刷新
-			refreshBeginTime := time.Now()
+			refreshBeginTime := x.storageLock.clock().Now()
 			err := x.refreshLeaseExpiredTime()
 			if err != nil {
 				continueErrorCount++
@@ -177,6 +192,12 @@ func (x *WatchDogCommonsImpl) Start(ctx context.Context) error {
 
 			} else {
 
+				// 续租落地的时候旧租约可能已经过期了（刷新本身很慢），这种"悄悄续上"同样是断档，先检查再推进截止时间
+				// 新的截止时间从刷新开始的时刻算起，续租用的存储时间是在这之后才取的，所以这个估计是偏保守的
+				x.checkLeaseContinuity(x.storageLock.clock().Now())
+				// 时间源与本地时钟的漂移超过阈值时按照配置扣掉漂移
+				x.leaseDeadline = refreshBeginTime.Add(x.storageLock.effectiveLeaseExpireAfter())
+
 				// 记录当前的刷新成功
 				refreshSuccessCount++
 
@@ -193,13 +214,15 @@ func (x *WatchDogCommonsImpl) Start(ctx context.Context) error {
 
 			// 休眠，避免刷新得太频繁导致乐观锁的版本miss率过高对底层存储系统产生负载
 			// 使用 select 监听 stop channel，使 Stop 能立即唤醒此 sleep
+			timer.Reset(x.computeRefreshSleepDuration(refreshBeginTime))
 			select {
 			case <-x.stop:
 				// Stop 已经被调用，直接退出循环
 				return
-			case <-time.After(x.computeRefreshSleepDuration(refreshBeginTime)):
+			case <-timer.C():
 				// 正常唤醒，继续下一次刷新
 			}
+			x.checkLeaseContinuity(x.storageLock.clock().Now())
 		}
 
 	}()
@@ -215,11 +238,12 @@ func (x *WatchDogCommonsImpl) Start(ctx context.Context) error {
 // 取"剩余间隔"与"LeaseRefreshInterval 的一半"中较大者，保证两次刷新间至少有
 // 半个刷新间隔的喘息；同时绝不低于一个最小兜底值。
 func (x *WatchDogCommonsImpl) computeRefreshSleepDuration(refreshBeginTime time.Time) time.Duration {
-	cost := time.Now().Sub(refreshBeginTime)
-	needSleepDuration := x.storageLock.options.LeaseRefreshInterval - cost
+	cost := x.storageLock.clock().Since(refreshBeginTime)
+	refreshInterval := x.storageLock.effectiveLeaseRefreshInterval()
+	needSleepDuration := refreshInterval - cost
 
 	// 半个刷新间隔，作为"刷新过慢"时的下界，避免疯狂重试
-	halfInterval := x.storageLock.options.LeaseRefreshInterval / 2
+	halfInterval := refreshInterval / 2
 	if needSleepDuration < halfInterval {
 		needSleepDuration = halfInterval
 	}
@@ -231,6 +255,33 @@ func (x *WatchDogCommonsImpl) computeRefreshSleepDuration(refreshBeginTime time.
 	return needSleepDuration
 }
 
+// checkLeaseContinuity 检查租约是否出现了断档
+//
+// 看门狗按本地时钟休眠，如果进程被冻结的时间超过了租约（STW GC、SIGSTOP、虚拟机迁移等），
+// 醒来之后锁可能已经被别人抢走，也可能没人抢、接下来的续租照样成功——后一种情况最危险，
+// 因为在断档期间别人完全可以合法地获取锁并操作被保护的资源，而持有者对此毫无感知。
+// 所以只要醒来的时刻越过了最近一次确认过的租约截止时间，不管之后续租成不成功，都要告诉持有者，
+// 让临界区有机会中止或者重新校验（比如配合 GetFencingToken 使用）。
+func (x *WatchDogCommonsImpl) checkLeaseContinuity(now time.Time) {
+	if x.leaseDeadline.IsZero() || !now.After(x.leaseDeadline) {
+		return
+	}
+	if x.violationReportedDeadline.Equal(x.leaseDeadline) {
+		return
+	}
+	x.violationReportedDeadline = x.leaseDeadline
+
+	violation := &LeaseContinuityViolation{
+		LockId:        x.lockId,
+		OwnerId:       x.ownerId,
+		WatchDogId:    x.id,
+		LeaseDeadline: x.leaseDeadline,
+		DetectTime:    now,
+		Overdue:       now.Sub(x.leaseDeadline),
+	}
+	x.storageLock.reportLeaseContinuityViolation(context.Background(), x.e.Load().Fork(), violation)
+}
+
 // 刷新锁的过期时间，为其续约
 func (x *WatchDogCommonsImpl) refreshLeaseExpiredTime() error {
 
@@ -22,5 +22,5 @@ func (x *WatchDogFactoryCommonsImpl) Name() string {
 }
 
 func (x *WatchDogFactoryCommonsImpl) NewWatchDog(ctx context.Context, e *events.Event, lock *StorageLock, ownerId string) (WatchDog, error) {
-	return NewWatchDogCommonsImpl(ctx, e, lock, ownerId), nil
+	return NewWatchDogCommonsImpl(ctx, e, lock, ownerId, lock.LeaseStartTime()), nil
 }
@@ -0,0 +1,86 @@
+package storage_lock
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// 进程级别的 WatchDogFactory 注册表，按 WatchDogFactory.Name() 查找工厂
+// 这样在从配置文件加载锁的选项时，只需要在配置里写看门狗工厂的名字（StorageLockOptions.WatchDogFactoryName），
+// 不需要在代码里调用 SetWatchDogFactory
+//
+// 内置的工厂在包初始化的时候就注册好了，第三方的实现可以在自己包的 init 中调用 RegisterWatchDogFactory 注册
+
+var (
+	watchDogFactoryRegistry   = make(map[string]WatchDogFactory)
+	watchDogFactoryRegistryMu sync.RWMutex
+)
+
+func init() {
+	MustRegisterWatchDogFactory(NewWatchDogFactoryCommonsImpl())
+}
+
+// RegisterWatchDogFactory 把工厂按它的名字注册到全局的注册表中
+// 名字不能为空，也不能与已经注册过的工厂重名，否则返回错误
+func RegisterWatchDogFactory(factory WatchDogFactory) error {
+	if factory == nil || factory.Name() == "" {
+		return ErrWatchDogFactoryNameEmpty
+	}
+
+	watchDogFactoryRegistryMu.Lock()
+	defer watchDogFactoryRegistryMu.Unlock()
+
+	name := factory.Name()
+	if _, exists := watchDogFactoryRegistry[name]; exists {
+		return fmt.Errorf("%w: %s", ErrWatchDogFactoryAlreadyRegistered, name)
+	}
+	watchDogFactoryRegistry[name] = factory
+	return nil
+}
+
+// MustRegisterWatchDogFactory 注册工厂，注册失败的话直接panic，适合在 init 中使用
+func MustRegisterWatchDogFactory(factory WatchDogFactory) {
+	if err := RegisterWatchDogFactory(factory); err != nil {
+		panic(err)
+	}
+}
+
+// UnregisterWatchDogFactory 从注册表中移除给定名字的工厂，返回之前是否注册过
+func UnregisterWatchDogFactory(name string) bool {
+	watchDogFactoryRegistryMu.Lock()
+	defer watchDogFactoryRegistryMu.Unlock()
+
+	_, exists := watchDogFactoryRegistry[name]
+	delete(watchDogFactoryRegistry, name)
+	return exists
+}
+
+// GetWatchDogFactory 根据名字查找已经注册的工厂，未找到时返回 ErrWatchDogFactoryNotFound
+func GetWatchDogFactory(name string) (WatchDogFactory, error) {
+	watchDogFactoryRegistryMu.RLock()
+	defer watchDogFactoryRegistryMu.RUnlock()
+
+	factory, exists := watchDogFactoryRegistry[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s, registered: %v", ErrWatchDogFactoryNotFound, name, watchDogFactoryNamesLocked())
+	}
+	return factory, nil
+}
+
+// ListWatchDogFactoryNames 列出所有已经注册的工厂的名字，按字典序排列
+func ListWatchDogFactoryNames() []string {
+	watchDogFactoryRegistryMu.RLock()
+	defer watchDogFactoryRegistryMu.RUnlock()
+	return watchDogFactoryNamesLocked()
+}
+
+// 调用方需要持有 watchDogFactoryRegistryMu
+func watchDogFactoryNamesLocked() []string {
+	names := make([]string, 0, len(watchDogFactoryRegistry))
+	for name := range watchDogFactoryRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
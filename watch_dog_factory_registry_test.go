@@ -0,0 +1,48 @@
+package storage_lock
+
+import (
+	"context"
+	"testing"
+
+	"github.com/storage-lock/go-events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchDogFactoryRegistry(t *testing.T) {
+
+	// 内置的工厂在包初始化时就已经注册
+	factory, err := GetWatchDogFactory(WatchDogFactoryCommonsImplName)
+	assert.Nil(t, err)
+	assert.Equal(t, WatchDogFactoryCommonsImplName, factory.Name())
+
+	// 重复注册同名工厂
+	assert.ErrorIs(t, RegisterWatchDogFactory(NewWatchDogFactoryCommonsImpl()), ErrWatchDogFactoryAlreadyRegistered)
+
+	// 第三方注册自己的工厂
+	custom := NewWatchDogFactoryFuncWrapper("test-custom-watch-dog-factory", func(ctx context.Context, e *events.Event, lock *StorageLock, ownerId string) (WatchDog, error) {
+		return NewWatchDogCommonsImpl(ctx, e, lock, ownerId, lock.LeaseStartTime()), nil
+	})
+	assert.Nil(t, RegisterWatchDogFactory(custom))
+	defer UnregisterWatchDogFactory(custom.Name())
+	assert.Contains(t, ListWatchDogFactoryNames(), custom.Name())
+
+	assert.ErrorIs(t, RegisterWatchDogFactory(NewWatchDogFactoryFuncWrapper("", nil)), ErrWatchDogFactoryNameEmpty)
+}
+
+func TestCheckStorageLockOptionsWatchDogFactoryName(t *testing.T) {
+
+	// 按名字选择
+	options := NewStorageLockOptionsWithLockId("test-watch-dog-factory-name").SetWatchDogFactoryName(WatchDogFactoryCommonsImplName)
+	assert.Nil(t, checkStorageLockOptions(options))
+	assert.Equal(t, WatchDogFactoryCommonsImplName, options.WatchDogFactory.Name())
+
+	// 未注册的名字
+	options = NewStorageLockOptionsWithLockId("test-watch-dog-factory-name").SetWatchDogFactoryName("not-exists-watch-dog-factory")
+	assert.ErrorIs(t, checkStorageLockOptions(options), ErrWatchDogFactoryNotFound)
+
+	// 名字与工厂不一致
+	options = NewStorageLockOptionsWithLockId("test-watch-dog-factory-name").
+		SetWatchDogFactoryName("not-exists-watch-dog-factory").
+		SetWatchDogFactory(NewWatchDogFactoryCommonsImpl())
+	assert.ErrorIs(t, checkStorageLockOptions(options), ErrWatchDogFactoryNameMismatch)
+}
@@ -0,0 +1,50 @@
+package storage_lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/storage-lock/go-events"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCheckLeaseContinuity 模拟进程停顿：看门狗醒来时本地时间已经越过了租约截止时间，
+// 此时即使没有人抢锁、之后的续租照样成功，也必须上报一次断档
+func TestCheckLeaseContinuity(t *testing.T) {
+	violations := make([]*LeaseContinuityViolation, 0)
+	options := NewStorageLockOptionsWithLockId("test-lease-continuity").
+		SetOnLeaseContinuityViolation(func(ctx context.Context, violation *LeaseContinuityViolation) {
+			violations = append(violations, violation)
+		})
+	wd := &WatchDogCommonsImpl{
+		id:          "test-watch-dog",
+		lockId:      options.LockId,
+		ownerId:     "test-owner",
+		storageLock: &StorageLock{options: options},
+	}
+	wd.e.Store(events.NewEvent(options.LockId))
+
+	now := time.Now()
+
+	// 租约还没到期，不上报
+	wd.leaseDeadline = now.Add(time.Second)
+	wd.checkLeaseContinuity(now)
+	assert.Len(t, violations, 0)
+
+	// 停顿了 10 秒才醒来，越过截止时间
+	wd.leaseDeadline = now.Add(-time.Second * 10)
+	wd.checkLeaseContinuity(now)
+	assert.Len(t, violations, 1)
+	assert.Equal(t, "test-owner", violations[0].OwnerId)
+	assert.Equal(t, time.Second*10, violations[0].Overdue)
+
+	// 同一段断档只上报一次，比如醒来时上报过，续租成功后又检查了一次
+	wd.checkLeaseContinuity(now.Add(time.Second))
+	assert.Len(t, violations, 1)
+
+	// 续租推进了截止时间之后再次断档，需要重新上报
+	wd.leaseDeadline = now.Add(time.Second)
+	wd.checkLeaseContinuity(now.Add(time.Second * 5))
+	assert.Len(t, violations, 2)
+}